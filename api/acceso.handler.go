@@ -0,0 +1,72 @@
+// Chequeos de dueño para los handlers de citas y facturas (ver acceso.service.go).
+// Responden 404 si el registro no existe y 403 si existe pero no es del usuario.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func usuarioDeContexto(c *gin.Context) int {
+	usuarioID, _ := c.Get("usuarioID")
+	id, _ := usuarioID.(int)
+	return id
+}
+
+// autorizarCita deja seguir solo al dueño, al empleado asignado o a quien tenga
+// citas:ver_todas.
+func autorizarCita(c *gin.Context, citaID int) bool {
+	err := AccesoCita(citaID, usuarioDeContexto(c), tienePermiso(c, PermisoCitasVerTodas))
+	switch {
+	case errors.Is(err, ErrCitaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+		return false
+	case errors.Is(err, ErrSinAcceso):
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tiene acceso a esta cita"})
+		return false
+	case err != nil:
+		fmt.Println("❌ Error al validar acceso a cita:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+		return false
+	}
+	return true
+}
+
+// autorizarFactura deja seguir solo al cliente, al empleado de la cita, a quien creó
+// la factura o a quien tenga facturas:ver.
+func autorizarFactura(c *gin.Context, facturaID int) bool {
+	err := AccesoFactura(facturaID, usuarioDeContexto(c), tienePermiso(c, PermisoFacturasVer))
+	switch {
+	case errors.Is(err, ErrFacturaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Factura no encontrada"})
+		return false
+	case errors.Is(err, ErrSinAcceso):
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tiene acceso a esta factura"})
+		return false
+	case err != nil:
+		fmt.Printf("Error al validar acceso a factura %d: %v\n", facturaID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener factura"})
+		return false
+	}
+	return true
+}
+
+// facturaVisibleParam es facturaDeParam con el chequeo de dueño. Las rutas de cobro y
+// edición usan facturaDeParam: ahí manda el permiso de la ruta, porque en caja se
+// cobra cualquier factura.
+func facturaVisibleParam(c *gin.Context) (*Factura, bool) {
+	facturaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de factura inválido"})
+		return nil, false
+	}
+	if !autorizarFactura(c, facturaID) {
+		return nil, false
+	}
+	return facturaDeParam(c)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sqlAccesoCita    = "SELECT usuario_id, empleado_id FROM citas WHERE id = @id"
+	sqlAccesoFactura = "WHERE f.idFact = @id"
+)
+
+// Rutas que leen o cancelan una cita: 404 si no existe, 403 si es de otro.
+func TestAccesoCitaHandlers(t *testing.T) {
+	handlers := []struct {
+		nombre  string
+		metodo  string
+		ruta    string
+		cuerpo  string
+		handler gin.HandlerFunc
+	}{
+		{"ObtenerCita", http.MethodGet, "/citas/:id", "", ObtenerCita},
+		{"CancelarCitaConMotivo", http.MethodPut, "/citas/:id/cancelar", `{"motivo":"no puedo"}`, CancelarCitaConMotivo},
+		{"FinalizarCita", http.MethodPost, "/cita/:id/finalizar", "", FinalizarCita},
+	}
+	for _, h := range handlers {
+		url := strings.Replace(h.ruta, ":id", "7", 1)
+
+		t.Run(h.nombre+"/no existe", func(t *testing.T) {
+			mock := baseSimulada(t)
+			mock.ExpectQuery(consulta(sqlAccesoCita)).WithArgs(sql.Named("id", 7)).
+				WillReturnRows(sqlmock.NewRows([]string{"usuario_id", "empleado_id"}))
+
+			w := ejecutar(sesionCliente, h.metodo, h.ruta, url, h.cuerpo, h.handler)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("código %d, se esperaba 404: %s", w.Code, w.Body)
+			}
+		})
+
+		t.Run(h.nombre+"/de otro usuario", func(t *testing.T) {
+			mock := baseSimulada(t)
+			// Cita de otro cliente atendida por otro empleado
+			mock.ExpectQuery(consulta(sqlAccesoCita)).WithArgs(sql.Named("id", 7)).
+				WillReturnRows(sqlmock.NewRows([]string{"usuario_id", "empleado_id"}).AddRow(31, 21))
+
+			sesion := sesionCliente
+			if h.nombre == "FinalizarCita" {
+				sesion = sesionEmpleado
+			}
+			w := ejecutar(sesion, h.metodo, h.ruta, url, h.cuerpo, h.handler)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("código %d, se esperaba 403: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// Rutas que leen una factura: 404 si no existe, 403 si es de otro.
+func TestAccesoFacturaHandlers(t *testing.T) {
+	handlers := []struct {
+		nombre  string
+		ruta    string
+		handler gin.HandlerFunc
+	}{
+		{"ObtenerFactura", "/facturas/:id", ObtenerFactura},
+		{"DescargarFacturaPDF", "/facturas/:id/pdf", DescargarFacturaPDF},
+		{"ListarPagosFactura", "/facturas/:id/pagos", ListarPagosFactura},
+	}
+	for _, h := range handlers {
+		url := strings.Replace(h.ruta, ":id", "9", 1)
+
+		t.Run(h.nombre+"/no existe", func(t *testing.T) {
+			mock := baseSimulada(t)
+			mock.ExpectQuery(consulta(sqlAccesoFactura)).WithArgs(sql.Named("id", 9)).
+				WillReturnRows(sqlmock.NewRows([]string{"cliente", "empleado", "creado_por"}))
+
+			w := ejecutar(sesionCliente, http.MethodGet, h.ruta, url, "", h.handler)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("código %d, se esperaba 404: %s", w.Code, w.Body)
+			}
+		})
+
+		t.Run(h.nombre+"/de otro usuario", func(t *testing.T) {
+			mock := baseSimulada(t)
+			mock.ExpectQuery(consulta(sqlAccesoFactura)).WithArgs(sql.Named("id", 9)).
+				WillReturnRows(sqlmock.NewRows([]string{"cliente", "empleado", "creado_por"}).AddRow(31, 21, 1))
+
+			w := ejecutar(sesionCliente, http.MethodGet, h.ruta, url, "", h.handler)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("código %d, se esperaba 403: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// El cliente dueño solo cancela con la anticipación de la política.
+func TestCancelarCitaSinAnticipacion(t *testing.T) {
+	mock := baseSimulada(t)
+	mock.ExpectQuery(consulta(sqlAccesoCita)).WithArgs(sql.Named("id", 7)).
+		WillReturnRows(sqlmock.NewRows([]string{"usuario_id", "empleado_id"}).AddRow(sesionCliente.usuarioID, 20))
+	mock.ExpectQuery(consulta("SELECT fecha_hora, usuario_id FROM citas WHERE id = @id")).WithArgs(sql.Named("id", 7)).
+		WillReturnRows(sqlmock.NewRows([]string{"fecha_hora", "usuario_id"}).AddRow(time.Now().Add(2*time.Hour), sesionCliente.usuarioID))
+	mock.ExpectQuery(consulta("FROM politica_citas WHERE id = 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"anticipacion_minima_horas", "max_reprogramaciones", "requiere_reconfirmacion"}).AddRow(24, 2, false))
+
+	w := ejecutar(sesionCliente, http.MethodPut, "/citas/:id/cancelar", "/citas/7/cancelar", `{"motivo":"no puedo"}`, CancelarCitaConMotivo)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "24h de antelación") {
+		t.Fatalf("código %d, se esperaba 403 por anticipación: %s", w.Code, w.Body)
+	}
+}
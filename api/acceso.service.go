@@ -0,0 +1,87 @@
+// Política de acceso a citas y facturas por dueño: quien tiene el permiso de ver todo
+// (por defecto el admin) accede a cualquiera; el personal a las que tiene asignadas o
+// registró; el cliente a las suyas. Se consulta antes de responder con el registro.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"slices"
+)
+
+var ErrSinAcceso = errors.New("no tiene acceso a este registro")
+
+// propietarios son los usuarios ligados a un registro: el cliente dueño y el personal
+// a cargo (empleado asignado a la cita, quien creó la factura).
+type propietarios struct {
+	ClienteID sql.NullInt32
+	Personal  []int
+}
+
+// puedeAcceder aplica la política. verTodos sale del permiso de la ruta (citas:ver_todas,
+// facturas:ver); sin usuario autenticado nunca hay acceso.
+func puedeAcceder(usuarioID int, verTodos bool, p propietarios) bool {
+	if verTodos {
+		return true
+	}
+	if usuarioID <= 0 {
+		return false
+	}
+	if p.ClienteID.Valid && int(p.ClienteID.Int32) == usuarioID {
+		return true
+	}
+	return slices.Contains(p.Personal, usuarioID)
+}
+
+// AccesoCita devuelve ErrCitaNoExiste si no hay cita y ErrSinAcceso si el usuario no
+// es su dueño ni el empleado asignado.
+func AccesoCita(citaID, usuarioID int, verTodos bool) error {
+	var cliente, empleado sql.NullInt32
+	err := dto.DB.QueryRow("SELECT usuario_id, empleado_id FROM citas WHERE id = @id", sql.Named("id", citaID)).
+		Scan(&cliente, &empleado)
+	if err == sql.ErrNoRows {
+		return ErrCitaNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar dueño de la cita: %w", err)
+	}
+
+	p := propietarios{ClienteID: cliente}
+	if empleado.Valid {
+		p.Personal = append(p.Personal, int(empleado.Int32))
+	}
+	if !puedeAcceder(usuarioID, verTodos, p) {
+		return ErrSinAcceso
+	}
+	return nil
+}
+
+// AccesoFactura devuelve ErrFacturaNoExiste si no hay factura y ErrSinAcceso si el
+// usuario no es el cliente, el empleado de la cita ni quien la creó.
+func AccesoFactura(facturaID, usuarioID int, verTodos bool) error {
+	var cliente, empleado, creadoPor sql.NullInt32
+	err := dto.DB.QueryRow(`
+		SELECT COALESCE(c.usuario_id, f.cliente_id), c.empleado_id, f.creado_por
+		FROM factura f
+		LEFT JOIN citas c ON c.id = f.idCita
+		WHERE f.idFact = @id`, sql.Named("id", facturaID)).
+		Scan(&cliente, &empleado, &creadoPor)
+	if err == sql.ErrNoRows {
+		return ErrFacturaNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar dueño de la factura: %w", err)
+	}
+
+	p := propietarios{ClienteID: cliente}
+	for _, id := range []sql.NullInt32{empleado, creadoPor} {
+		if id.Valid {
+			p.Personal = append(p.Personal, int(id.Int32))
+		}
+	}
+	if !puedeAcceder(usuarioID, verTodos, p) {
+		return ErrSinAcceso
+	}
+	return nil
+}
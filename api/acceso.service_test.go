@@ -0,0 +1,40 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestPuedeAcceder(t *testing.T) {
+	const (
+		cliente  = 30
+		empleado = 20
+		otro     = 31
+	)
+	cita := propietarios{ClienteID: nulo(cliente), Personal: []int{empleado}}
+
+	casos := []struct {
+		nombre    string
+		usuarioID int
+		verTodos  bool
+		p         propietarios
+		esperado  bool
+	}{
+		{"dueño", cliente, false, cita, true},
+		{"empleado asignado", empleado, false, cita, true},
+		{"otro cliente", otro, false, cita, false},
+		{"otro empleado", 21, false, cita, false},
+		{"personal con ver todas", otro, true, cita, true},
+		{"ver todas sin dueño", otro, true, propietarios{}, true},
+		{"cita de invitado", cliente, false, propietarios{Personal: []int{empleado}}, false},
+		{"quien creó la factura", 40, false, propietarios{ClienteID: nulo(cliente), Personal: []int{empleado, 40}}, true},
+		{"sin usuario", 0, false, propietarios{ClienteID: sql.NullInt32{Valid: true}}, false},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			if got := puedeAcceder(tc.usuarioID, tc.verTodos, tc.p); got != tc.esperado {
+				t.Errorf("puedeAcceder(%d, %v) = %v, se esperaba %v", tc.usuarioID, tc.verTodos, got, tc.esperado)
+			}
+		})
+	}
+}
@@ -10,12 +10,6 @@ import (
 
 // GET /alertas/inventario - Obtener alertas de inventario bajo
 func ObtenerAlertasInventario(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	if !existe || (rol != "admin" && rol != "empleado") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y empleados pueden ver alertas"})
-		return
-	}
-
 	query := `
 		SELECT 
 			id, producto_id, producto_nombre, cantidad_actual, 
@@ -58,12 +52,6 @@ func ObtenerAlertasInventario(c *gin.Context) {
 
 // PUT /alertas/inventario/:id/resolver - Marcar alerta como resuelta
 func ResolverAlertaInventario(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	if !existe || (rol != "admin" && rol != "empleado") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y empleados pueden resolver alertas"})
-		return
-	}
-
 	id := c.Param("id")
 
 	query := `UPDATE alertas_inventario SET estado = 'RESUELTO', fecha_alerta = GETDATE() WHERE id = @p1`
@@ -80,12 +68,6 @@ func ResolverAlertaInventario(c *gin.Context) {
 
 // GET /auditoria/usuarios - Obtener historial de cambios de usuarios
 func ObtenerAuditoriaUsuarios(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	if !existe || rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden ver la auditoría"})
-		return
-	}
-
 	query := `
 		SELECT 
 			id, usuario_id, accion, campo_modificado, 
@@ -128,17 +110,11 @@ func ObtenerAuditoriaUsuarios(c *gin.Context) {
 
 // GET /estadisticas/clientes - Obtener estadísticas de clientes
 func ObtenerEstadisticasClientes(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	if !existe || (rol != "admin" && rol != "empleado") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y empleados pueden ver estadísticas"})
-		return
-	}
-
 	query := `
 		SELECT 
 			ec.cliente_id,
 			u.nombre,
-			u.email,
+			u.correo AS email,
 			ec.total_citas,
 			ec.citas_completadas,
 			ec.citas_canceladas,
@@ -187,12 +163,6 @@ func ObtenerEstadisticasClientes(c *gin.Context) {
 
 // GET /historial/precios-servicios - Obtener historial de cambios de precios
 func ObtenerHistorialPreciosServicios(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	if !existe || (rol != "admin" && rol != "empleado") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y empleados pueden ver el historial"})
-		return
-	}
-
 	query := `
 		SELECT 
 			id, servicio_id, servicio_nombre, precio_anterior, 
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"regexp"
+	"restapi/dto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+}
+
+// baseSimulada reemplaza dto.DB por un sqlmock mientras dure la prueba y deja los
+// permisos en la matriz predeterminada, así tienePermiso no consulta la base.
+func baseSimulada(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("crear base simulada: %v", err)
+	}
+	anterior := dto.DB
+	dto.DB = db
+
+	porRol := map[string]map[string]bool{}
+	for rol, permisos := range permisosPredeterminados {
+		porRol[rol] = map[string]bool{}
+		for _, p := range permisos {
+			porRol[rol][p] = true
+		}
+	}
+	cachePermisos.Lock()
+	cachePermisos.porRol, cachePermisos.cargadoEn = porRol, time.Now()
+	cachePermisos.Unlock()
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("consultas esperadas: %v", err)
+		}
+		db.Close()
+		dto.DB = anterior
+		invalidarCachePermisos()
+	})
+	return mock
+}
+
+// consulta arma el patrón de sqlmock a partir de un fragmento literal del SQL.
+func consulta(fragmento string) string {
+	return regexp.QuoteMeta(fragmento)
+}
+
+// sesionPrueba es el usuario que Autenticar habría dejado en el contexto.
+type sesionPrueba struct {
+	usuarioID int
+	rol       string
+}
+
+var (
+	sesionAdmin    = sesionPrueba{usuarioID: 1, rol: "admin"}
+	sesionEmpleado = sesionPrueba{usuarioID: 20, rol: "empleado"}
+	sesionCliente  = sesionPrueba{usuarioID: 30, rol: "cliente"}
+)
+
+// ejecutar monta handler en ruta con la sesión dada y atiende una solicitud.
+func ejecutar(sesion sesionPrueba, metodo, ruta, url, cuerpo string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(metodo, ruta, func(c *gin.Context) {
+		c.Set("usuarioID", sesion.usuarioID)
+		c.Set("rol", sesion.rol)
+		c.Next()
+	}, handler)
+
+	var body io.Reader
+	if cuerpo != "" {
+		body = strings.NewReader(cuerpo)
+	}
+	req := httptest.NewRequest(metodo, url, body)
+	if cuerpo != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func nulo(v int32) sql.NullInt32 {
+	return sql.NullInt32{Int32: v, Valid: true}
+}
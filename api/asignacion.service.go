@@ -0,0 +1,293 @@
+// Asignación automática de empleados a citas con estrategias intercambiables:
+// menor carga, rotación, especialidad en el servicio o estilista preferido del cliente.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+var (
+	ErrEstrategiaDesconocida = errors.New("estrategia de asignación desconocida")
+	ErrSinCandidatos         = errors.New("no hay empleados disponibles para la cita")
+	ErrSinEspecialistas      = errors.New("ningún empleado disponible domina el servicio")
+)
+
+// CitaAsignable son los datos de la cita que necesitan las estrategias.
+type CitaAsignable struct {
+	ID         int32
+	ServicioID int32
+	UsuarioID  sql.NullInt32
+	FechaHora  time.Time
+}
+
+// CandidatoAsignacion es un empleado en turno y libre durante la cita.
+type CandidatoAsignacion struct {
+	ID     int32
+	Nombre string
+}
+
+// ResultadoAsignacion explica qué empleado se eligió y por qué.
+type ResultadoAsignacion struct {
+	EmpleadoID int32  `json:"empleado_id"`
+	Nombre     string `json:"nombre"`
+	Estrategia string `json:"estrategia"`
+	Motivo     string `json:"motivo"`
+	Candidatos int    `json:"candidatos"`
+}
+
+// EstrategiaAsignacion elige un candidato y devuelve el motivo de la elección.
+// Los candidatos ya vienen filtrados por turno y traslapes.
+type EstrategiaAsignacion interface {
+	Elegir(cita CitaAsignable, candidatos []CandidatoAsignacion) (CandidatoAsignacion, string, error)
+}
+
+var estrategiasAsignacion = map[string]EstrategiaAsignacion{
+	"menor_carga":  asignacionMenorCarga{},
+	"rotacion":     asignacionRotacion{},
+	"especialidad": asignacionEspecialidad{},
+	"preferido":    asignacionPreferido{},
+}
+
+// AsignarEmpleado calcula los candidatos de la cita y aplica la estrategia indicada.
+func AsignarEmpleado(cita CitaAsignable, nombreEstrategia string) (*ResultadoAsignacion, error) {
+	estrategia, ok := estrategiasAsignacion[nombreEstrategia]
+	if !ok {
+		return nil, ErrEstrategiaDesconocida
+	}
+
+	candidatos, err := candidatosParaCita(cita)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidatos) == 0 {
+		return nil, ErrSinCandidatos
+	}
+
+	elegido, motivo, err := estrategia.Elegir(cita, candidatos)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResultadoAsignacion{
+		EmpleadoID: elegido.ID,
+		Nombre:     elegido.Nombre,
+		Estrategia: nombreEstrategia,
+		Motivo:     motivo,
+		Candidatos: len(candidatos),
+	}, nil
+}
+
+// candidatosParaCita devuelve los empleados que trabajan durante todo el servicio
+// y no tienen otra cita activa que se cruce con él.
+func candidatosParaCita(cita CitaAsignable) ([]CandidatoAsignacion, error) {
+	duracion, buffer, err := tiemposServicio(cita.ServicioID)
+	if err != nil {
+		return nil, err
+	}
+
+	inicio := relojLocal(cita.FechaHora)
+	fin := inicio.Add(duracion)
+	finBloqueo := fin.Add(buffer)
+
+	empleados, err := empleadosActivos()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int32, 0, len(empleados))
+	for _, e := range empleados {
+		ids = append(ids, e.ID)
+	}
+
+	jornadas, err := jornadasDelDia(inicio, ids)
+	if err != nil {
+		return nil, err
+	}
+	ocupaciones, err := ocupacionesDelDia(inicioDelDia(inicio), cita.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ocupados := map[int32]bool{}
+	for _, o := range ocupaciones {
+		if o.empleadoID.Valid && o.inicio.Before(finBloqueo) && o.fin.After(inicio) {
+			ocupados[o.empleadoID.Int32] = true
+		}
+	}
+
+	candidatos := []CandidatoAsignacion{}
+	for _, e := range empleados {
+		if !ocupados[e.ID] && jornadas[e.ID].cubre(inicio, fin) {
+			candidatos = append(candidatos, CandidatoAsignacion{ID: e.ID, Nombre: e.Nombre})
+		}
+	}
+	return candidatos, nil
+}
+
+// asignacionMenorCarga elige al candidato con menos citas activas ese día.
+type asignacionMenorCarga struct{}
+
+func (asignacionMenorCarga) Elegir(cita CitaAsignable, candidatos []CandidatoAsignacion) (CandidatoAsignacion, string, error) {
+	dia := inicioDelDia(cita.FechaHora)
+	rows, err := dto.DB.Query(`
+		SELECT empleado_id, COUNT(*)
+		FROM citas
+		WHERE empleado_id IS NOT NULL
+		  AND fecha_hora >= @desde AND fecha_hora < @hasta
+		  AND estado IN ('pendiente', 'confirmada')
+		GROUP BY empleado_id`,
+		sql.Named("desde", dia),
+		sql.Named("hasta", dia.AddDate(0, 0, 1)),
+	)
+	if err != nil {
+		return CandidatoAsignacion{}, "", fmt.Errorf("consultar carga de empleados: %w", err)
+	}
+	defer rows.Close()
+
+	carga := map[int32]int{}
+	for rows.Next() {
+		var id int32
+		var total int
+		if err := rows.Scan(&id, &total); err != nil {
+			return CandidatoAsignacion{}, "", fmt.Errorf("leer carga de empleado: %w", err)
+		}
+		carga[id] = total
+	}
+
+	elegido := candidatos[0]
+	for _, cand := range candidatos[1:] {
+		if carga[cand.ID] < carga[elegido.ID] {
+			elegido = cand
+		}
+	}
+
+	motivo := fmt.Sprintf("%s tiene %d citas activas ese día, la menor carga entre %d empleados disponibles",
+		elegido.Nombre, carga[elegido.ID], len(candidatos))
+	return elegido, motivo, nil
+}
+
+// asignacionRotacion reparte las citas en orden: gana quien hace más tiempo no recibe una.
+type asignacionRotacion struct{}
+
+func (asignacionRotacion) Elegir(cita CitaAsignable, candidatos []CandidatoAsignacion) (CandidatoAsignacion, string, error) {
+	rows, err := dto.DB.Query(`
+		SELECT empleado_id, MAX(COALESCE(actualizado_en, creado_en))
+		FROM citas
+		WHERE empleado_id IS NOT NULL AND id <> @cita_id
+		GROUP BY empleado_id`,
+		sql.Named("cita_id", cita.ID),
+	)
+	if err != nil {
+		return CandidatoAsignacion{}, "", fmt.Errorf("consultar rotación de empleados: %w", err)
+	}
+	defer rows.Close()
+
+	ultima := map[int32]time.Time{}
+	for rows.Next() {
+		var id int32
+		var fecha sql.NullTime
+		if err := rows.Scan(&id, &fecha); err != nil {
+			return CandidatoAsignacion{}, "", fmt.Errorf("leer rotación de empleado: %w", err)
+		}
+		ultima[id] = fecha.Time
+	}
+
+	elegido := candidatos[0]
+	for _, cand := range candidatos[1:] {
+		if ultima[cand.ID].Before(ultima[elegido.ID]) {
+			elegido = cand
+		}
+	}
+
+	if ultima[elegido.ID].IsZero() {
+		return elegido, fmt.Sprintf("Rotación: %s aún no tenía citas asignadas", elegido.Nombre), nil
+	}
+	motivo := fmt.Sprintf("Rotación: %s recibió su última cita el %s, antes que el resto",
+		elegido.Nombre, ultima[elegido.ID].Format("2006-01-02 15:04"))
+	return elegido, motivo, nil
+}
+
+// asignacionEspecialidad limita los candidatos a quienes dominan el servicio y,
+// entre ellos, aplica menor carga.
+type asignacionEspecialidad struct{}
+
+func (asignacionEspecialidad) Elegir(cita CitaAsignable, candidatos []CandidatoAsignacion) (CandidatoAsignacion, string, error) {
+	rows, err := dto.DB.Query("SELECT empleado_id FROM empleado_servicios WHERE servicio_id = @servicio_id",
+		sql.Named("servicio_id", cita.ServicioID))
+	if err != nil {
+		return CandidatoAsignacion{}, "", fmt.Errorf("consultar especialidades: %w", err)
+	}
+	defer rows.Close()
+
+	especialistas := map[int32]bool{}
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return CandidatoAsignacion{}, "", fmt.Errorf("leer especialidad: %w", err)
+		}
+		especialistas[id] = true
+	}
+
+	var aptos []CandidatoAsignacion
+	for _, cand := range candidatos {
+		if especialistas[cand.ID] {
+			aptos = append(aptos, cand)
+		}
+	}
+	if len(aptos) == 0 {
+		return CandidatoAsignacion{}, "", ErrSinEspecialistas
+	}
+
+	elegido, motivo, err := asignacionMenorCarga{}.Elegir(cita, aptos)
+	if err != nil {
+		return CandidatoAsignacion{}, "", err
+	}
+	return elegido, "Especialista en el servicio. " + motivo, nil
+}
+
+// asignacionPreferido respeta al estilista preferido del cliente: el configurado en
+// su perfil o, si no hay, con quien más citas ha finalizado. Si no está disponible
+// se recurre a menor carga y se explica.
+type asignacionPreferido struct{}
+
+func (asignacionPreferido) Elegir(cita CitaAsignable, candidatos []CandidatoAsignacion) (CandidatoAsignacion, string, error) {
+	if !cita.UsuarioID.Valid {
+		elegido, motivo, err := asignacionMenorCarga{}.Elegir(cita, candidatos)
+		return elegido, "La cita es de un invitado sin historial. " + motivo, err
+	}
+
+	var preferido sql.NullInt32
+	err := dto.DB.QueryRow(`
+		SELECT COALESCE(u.empleado_preferido_id, (
+			SELECT TOP 1 c.empleado_id
+			FROM citas c
+			WHERE c.usuario_id = u.id AND c.empleado_id IS NOT NULL AND c.estado = 'finalizada'
+			GROUP BY c.empleado_id
+			ORDER BY COUNT(*) DESC, MAX(c.fecha_hora) DESC
+		))
+		FROM usuarios u
+		WHERE u.id = @usuario_id`,
+		sql.Named("usuario_id", cita.UsuarioID.Int32),
+	).Scan(&preferido)
+	if err != nil && err != sql.ErrNoRows {
+		return CandidatoAsignacion{}, "", fmt.Errorf("consultar estilista preferido: %w", err)
+	}
+
+	if preferido.Valid {
+		for _, cand := range candidatos {
+			if cand.ID == preferido.Int32 {
+				return cand, fmt.Sprintf("%s es el estilista preferido del cliente", cand.Nombre), nil
+			}
+		}
+	}
+
+	elegido, motivo, err := asignacionMenorCarga{}.Elegir(cita, candidatos)
+	if preferido.Valid {
+		return elegido, "El estilista preferido no está disponible en ese horario. " + motivo, err
+	}
+	return elegido, "El cliente no tiene estilista preferido. " + motivo, err
+}
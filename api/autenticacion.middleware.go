@@ -1,11 +1,12 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 func Autenticar() gin.HandlerFunc {
@@ -26,25 +27,102 @@ func Autenticar() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return secretKey, nil
-		})
+		claims, err := leerToken(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			return
+		}
 
-		if err != nil || !token.Valid {
+		// Los tokens de invitado solo sirven en las rutas de AutenticarInvitado
+		jti, _ := claims["jti"].(string)
+		if claims["tipo"] == tipoTokenInvitado || jti == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			id, _ := claims["id"].(float64)
-			rol, _ := claims["rol"].(string)
+		id, _ := claims["id"].(float64)
+		rol, _ := claims["rol"].(string)
+		sesion, _ := claims["sid"].(string)
+		expira, _ := claims["exp"].(float64)
+
+		// Revocado por logout o por "cerrar todas las sesiones"
+		revocado, err := tokenRevocado(int(id), jti, emisionToken(claims))
+		if err != nil {
+			fmt.Println("❌ Error al validar token:", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error al validar el token"})
+			return
+		}
+		if revocado {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token revocado"})
+			return
+		}
+
+		c.Set("usuarioID", int(id))
+		c.Set("rol", rol)
+		c.Set("tokenJTI", jti)
+		c.Set("tokenSesion", sesion)
+		c.Set("tokenExpira", time.Unix(int64(expira), 0))
+		c.Next()
+	}
+}
+
+// AutenticarInvitado valida el token de gestión que recibe un invitado al reservar o
+// al verificar su código, y deja su alcance en el contexto como "accesoInvitado".
+func AutenticarInvitado() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if tokenString == "" {
+			// El enlace mágico trae el token en la URL
+			tokenString = c.Query("token")
+		}
+		if tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token requerido"})
+			return
+		}
 
-			c.Set("usuarioID", int(id))
-			c.Set("rol", rol)
-			c.Next()
-		} else {
+		acceso, err := LeerTokenInvitado(tokenString)
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
 			return
 		}
+
+		c.Set("accesoInvitado", acceso)
+		c.Set("rol", tipoTokenInvitado)
+		c.Next()
+	}
+}
+
+// RequierePermiso deja pasar solo si el rol del token tiene todos los permisos
+// indicados. Va después de Autenticar, al registrar la ruta.
+func RequierePermiso(permisos ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rol, _ := c.Get("rol")
+		rolTexto, _ := rol.(string)
+		for _, permiso := range permisos {
+			ok, err := RolTienePermiso(rolTexto, permiso)
+			if err != nil {
+				fmt.Println("❌ Error al validar permisos:", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error al validar permisos"})
+				return
+			}
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Acceso denegado", "permiso": permiso})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// tienePermiso sirve dentro de un handler para decidir el alcance (p. ej. ver a todos
+// los empleados o solo a sí mismo). Ante un error de la base responde que no.
+func tienePermiso(c *gin.Context, permiso string) bool {
+	rol, _ := c.Get("rol")
+	rolTexto, _ := rol.(string)
+	ok, err := RolTienePermiso(rolTexto, permiso)
+	if err != nil {
+		fmt.Println("❌ Error al validar permisos:", err)
+		return false
 	}
+	return ok
 }
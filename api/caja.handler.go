@@ -0,0 +1,185 @@
+// Manejador de caja: apertura, retiros y cierre de la sesión de la terminal (personal),
+// y consulta de sesiones pasadas con su cuadre (admin).
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /caja/actual
+func SesionCajaActualHandler(c *gin.Context) {
+	sesion, err := SesionCajaActual()
+	switch {
+	case errors.Is(err, ErrCajaCerrada):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No hay una caja abierta en esta terminal", "punto_emision": puntoEmisionActual()})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al consultar caja:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar la caja"})
+		return
+	}
+	c.JSON(http.StatusOK, sesion)
+}
+
+// POST /caja/abrir  {"monto_inicial": 50000, "observaciones": "..."}
+func AbrirCajaHandler(c *gin.Context) {
+	var input struct {
+		MontoInicial  *float64 `json:"monto_inicial"`
+		Observaciones string   `json:"observaciones"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.MontoInicial == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique el monto_inicial de la caja"})
+		return
+	}
+
+	id, err := AbrirCaja(*input.MontoInicial, input.Observaciones, actorDeContexto(c).ID)
+	switch {
+	case errors.Is(err, ErrMontoCajaInvalido):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrCajaYaAbierta):
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya hay una caja abierta en esta terminal"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al abrir caja:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo abrir la caja"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Caja abierta", "id": id})
+}
+
+// POST /caja/retiros  {"monto": 100000, "motivo": "Depósito al banco"}
+func RegistrarRetiroHandler(c *gin.Context) {
+	var input struct {
+		Monto  float64 `json:"monto"`
+		Motivo string  `json:"motivo"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	id, err := RegistrarRetiro(input.Monto, input.Motivo, actorDeContexto(c).ID)
+	switch {
+	case errors.Is(err, ErrRetiroInvalido):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrCajaCerrada):
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay una caja abierta en esta terminal"})
+		return
+	case errors.Is(err, ErrRetiroExcede):
+		c.JSON(http.StatusConflict, gin.H{"error": "El retiro excede el efectivo disponible en caja"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al registrar retiro:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo registrar el retiro"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Retiro registrado", "id": id})
+}
+
+// POST /caja/cerrar  {"monto_contado": 152500, "observaciones": "..."}
+// Responde con el cuadre: efectivo esperado, contado y la diferencia.
+func CerrarCajaHandler(c *gin.Context) {
+	var input struct {
+		MontoContado  *float64 `json:"monto_contado"`
+		Observaciones string   `json:"observaciones"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.MontoContado == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique el monto_contado en caja"})
+		return
+	}
+
+	sesion, err := CerrarCaja(*input.MontoContado, input.Observaciones, actorDeContexto(c).ID)
+	switch {
+	case errors.Is(err, ErrMontoCajaInvalido):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrCajaCerrada):
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay una caja abierta en esta terminal"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al cerrar caja:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo cerrar la caja"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Caja cerrada", "sesion": sesion})
+}
+
+// GET /caja/sesiones?inicio=YYYY-MM-DD&fin=YYYY-MM-DD[&estado=cerrada]
+func ListarSesionesCajaHandler(c *gin.Context) {
+	layout := "2006-01-02"
+	start, err1 := time.Parse(layout, c.Query("inicio"))
+	end, err2 := time.Parse(layout, c.Query("fin"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+		return
+	}
+	estado := c.Query("estado")
+	if estado != "" && estado != SesionCajaAbierta && estado != SesionCajaCerrada {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El estado debe ser abierta o cerrada"})
+		return
+	}
+
+	sesiones, err := ListarSesionesCaja(start, end, estado)
+	if err != nil {
+		fmt.Println("❌ Error al listar sesiones de caja:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar sesiones de caja"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sesiones": sesiones})
+}
+
+// GET /caja/sesiones/:id: cuadre y todos los movimientos de la sesión
+func ObtenerSesionCajaHandler(c *gin.Context) {
+	sesion, ok := sesionCajaDeParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, sesion)
+}
+
+// GET /caja/sesiones/:id/pdf: resumen de cierre para imprimir
+func DescargarCierreCajaPDF(c *gin.Context) {
+	sesion, ok := sesionCajaDeParam(c)
+	if !ok {
+		return
+	}
+
+	pdf, err := PDFCierreCaja(*sesion)
+	if err != nil {
+		fmt.Printf("Error al generar PDF de caja %d: %v\n", sesion.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el PDF del cierre de caja"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=cierre_caja_%d.pdf", sesion.ID))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// sesionCajaDeParam lee el :id y carga la sesión, respondiendo 400/404/500 si falla.
+func sesionCajaDeParam(c *gin.Context) (*SesionCaja, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de sesión inválido"})
+		return nil, false
+	}
+
+	sesion, err := ObtenerSesionCaja(id)
+	if errors.Is(err, ErrSesionCajaNoExiste) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesión de caja no encontrada"})
+		return nil, false
+	} else if err != nil {
+		fmt.Println("❌ Error al consultar sesión de caja:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar la sesión de caja"})
+		return nil, false
+	}
+	return sesion, true
+}
@@ -0,0 +1,446 @@
+// Sesiones de caja por terminal: apertura con fondo inicial, pagos y reembolsos ligados
+// a la sesión abierta, retiros de efectivo y cierre con el monto contado. El efectivo
+// esperado se calcula de los movimientos; la diferencia con lo contado es el descuadre.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"strings"
+	"time"
+)
+
+// Estados de la sesión de caja
+const (
+	SesionCajaAbierta = "abierta"
+	SesionCajaCerrada = "cerrada"
+)
+
+// Resultado del cuadre al cerrar
+const (
+	CuadreExacto   = "cuadrada"
+	CuadreSobrante = "sobrante"
+	CuadreFaltante = "faltante"
+)
+
+var (
+	ErrCajaCerrada        = errors.New("no hay una sesión de caja abierta en esta terminal")
+	ErrCajaYaAbierta      = errors.New("ya hay una sesión de caja abierta en esta terminal")
+	ErrSesionCajaNoExiste = errors.New("la sesión de caja no existe")
+	ErrMontoCajaInvalido  = errors.New("el monto no puede ser negativo")
+	ErrRetiroInvalido     = errors.New("el retiro necesita un monto mayor a cero y un motivo")
+	ErrRetiroExcede       = errors.New("el retiro excede el efectivo disponible en caja")
+)
+
+type SesionCaja struct {
+	ID                    int          `json:"id"`
+	Sucursal              string       `json:"sucursal"`
+	Terminal              string       `json:"terminal"`
+	Estado                string       `json:"estado"`
+	MontoInicial          float64      `json:"monto_inicial"`
+	ObservacionesApertura *string      `json:"observaciones_apertura"`
+	AbiertaPor            *int         `json:"abierta_por"`
+	AbiertaPorNombre      *string      `json:"abierta_por_nombre"`
+	AbiertaEn             string       `json:"abierta_en"`
+	EfectivoEsperado      *float64     `json:"efectivo_esperado"`
+	MontoContado          *float64     `json:"monto_contado"`
+	Diferencia            *float64     `json:"diferencia"`
+	ObservacionesCierre   *string      `json:"observaciones_cierre"`
+	CerradaPor            *int         `json:"cerrada_por"`
+	CerradaPorNombre      *string      `json:"cerrada_por_nombre"`
+	CerradaEn             *string      `json:"cerrada_en"`
+	Resumen               *ResumenCaja `json:"resumen,omitempty"`
+}
+
+// MetodoCaja son los totales de un método de pago en la sesión.
+type MetodoCaja struct {
+	Metodo      string  `json:"metodo"`
+	Pagos       int     `json:"pagos"`
+	Cobrado     float64 `json:"cobrado"`
+	Propinas    float64 `json:"propinas"`
+	Reembolsado float64 `json:"reembolsado"`
+	Neto        float64 `json:"neto"` // cobrado + propinas - reembolsado
+}
+
+// MovimientoCaja es un pago, reembolso o retiro de la sesión, para auditoría.
+type MovimientoCaja struct {
+	Tipo          string  `json:"tipo"` // pago, reembolso o retiro
+	ID            int     `json:"id"`
+	FacturaID     *int    `json:"factura_id"`
+	Metodo        *string `json:"metodo"`
+	Monto         float64 `json:"monto"`
+	Propina       float64 `json:"propina"`
+	Detalle       *string `json:"detalle"` // referencia del pago, consecutivo de la nota o motivo del retiro
+	RegistradoPor *int    `json:"registrado_por"`
+	Fecha         string  `json:"fecha"`
+}
+
+// ResumenCaja es el cuadre de la sesión. Con la sesión abierta, MontoContado y
+// Diferencia quedan vacíos.
+type ResumenCaja struct {
+	MontoInicial     float64          `json:"monto_inicial"`
+	PorMetodo        []MetodoCaja     `json:"por_metodo"`
+	Cobrado          float64          `json:"cobrado"`
+	Propinas         float64          `json:"propinas"`
+	Reembolsado      float64          `json:"reembolsado"`
+	Retiros          float64          `json:"retiros"`
+	EfectivoEsperado float64          `json:"efectivo_esperado"`
+	MontoContado     *float64         `json:"monto_contado"`
+	Diferencia       *float64         `json:"diferencia"`
+	Cuadre           string           `json:"cuadre,omitempty"`
+	Movimientos      []MovimientoCaja `json:"movimientos"`
+}
+
+// sesionCajaAbiertaTx devuelve la sesión abierta de la terminal actual. El candado
+// hace que un cierre espere a los cobros en curso y que después ya no entren más.
+func sesionCajaAbiertaTx(tx *sql.Tx) (int, error) {
+	punto := puntoEmisionActual()
+	var id int
+	err := tx.QueryRow(`
+		SELECT id FROM sesiones_caja WITH (UPDLOCK, ROWLOCK)
+		WHERE sucursal = @sucursal AND terminal = @terminal AND estado = @abierta`,
+		sql.Named("sucursal", punto.Sucursal),
+		sql.Named("terminal", punto.Terminal),
+		sql.Named("abierta", SesionCajaAbierta),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrCajaCerrada
+	} else if err != nil {
+		return 0, fmt.Errorf("consultar sesión de caja: %w", err)
+	}
+	return id, nil
+}
+
+// AbrirCaja abre una sesión en la terminal actual con el fondo inicial contado.
+func AbrirCaja(montoInicial float64, observaciones string, abiertaPor sql.NullInt32) (int, error) {
+	if centavos(montoInicial) < 0 {
+		return 0, ErrMontoCajaInvalido
+	}
+	punto := puntoEmisionActual()
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// HOLDLOCK bloquea el rango aunque no haya fila: dos aperturas simultáneas no pasan
+	var abiertas int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM sesiones_caja WITH (UPDLOCK, HOLDLOCK)
+		WHERE sucursal = @sucursal AND terminal = @terminal AND estado = @abierta`,
+		sql.Named("sucursal", punto.Sucursal),
+		sql.Named("terminal", punto.Terminal),
+		sql.Named("abierta", SesionCajaAbierta),
+	).Scan(&abiertas)
+	if err != nil {
+		return 0, fmt.Errorf("consultar sesión de caja: %w", err)
+	}
+	if abiertas > 0 {
+		return 0, ErrCajaYaAbierta
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO sesiones_caja (sucursal, terminal, estado, monto_inicial, observaciones_apertura, abierta_por)
+		OUTPUT INSERTED.id
+		VALUES (@sucursal, @terminal, @abierta, @monto, @observaciones, @abierta_por)`,
+		sql.Named("sucursal", punto.Sucursal),
+		sql.Named("terminal", punto.Terminal),
+		sql.Named("abierta", SesionCajaAbierta),
+		sql.Named("monto", redondear(montoInicial)),
+		sql.Named("observaciones", textoONulo(observaciones)),
+		sql.Named("abierta_por", abiertaPor),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("abrir caja: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return id, nil
+}
+
+// RegistrarRetiro saca efectivo de la caja abierta. No puede dejar la caja en negativo.
+func RegistrarRetiro(monto float64, motivo string, registradoPor sql.NullInt32) (int, error) {
+	motivo = strings.TrimSpace(motivo)
+	if centavos(monto) <= 0 || motivo == "" {
+		return 0, ErrRetiroInvalido
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	sesionID, err := sesionCajaAbiertaTx(tx)
+	if err != nil {
+		return 0, err
+	}
+	resumen, err := resumenCaja(tx, sesionID)
+	if err != nil {
+		return 0, err
+	}
+	if centavos(monto) > centavos(resumen.EfectivoEsperado) {
+		return 0, ErrRetiroExcede
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO retiros_caja (sesion_id, monto, motivo, registrado_por)
+		OUTPUT INSERTED.id
+		VALUES (@sesion_id, @monto, @motivo, @registrado_por)`,
+		sql.Named("sesion_id", sesionID),
+		sql.Named("monto", redondear(monto)),
+		sql.Named("motivo", motivo),
+		sql.Named("registrado_por", registradoPor),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("registrar retiro: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return id, nil
+}
+
+// CerrarCaja cierra la sesión abierta con el efectivo contado y guarda el esperado y
+// la diferencia tal como estaban al cerrar.
+func CerrarCaja(montoContado float64, observaciones string, cerradaPor sql.NullInt32) (*SesionCaja, error) {
+	if centavos(montoContado) < 0 {
+		return nil, ErrMontoCajaInvalido
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	sesionID, err := sesionCajaAbiertaTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	resumen, err := resumenCaja(tx, sesionID)
+	if err != nil {
+		return nil, err
+	}
+	diferencia := centavos(montoContado) - centavos(resumen.EfectivoEsperado)
+
+	_, err = tx.Exec(`
+		UPDATE sesiones_caja
+		SET estado = @cerrada, efectivo_esperado = @esperado, monto_contado = @contado, diferencia = @diferencia,
+		    observaciones_cierre = @observaciones, cerrada_por = @cerrada_por, cerrada_en = GETDATE()
+		WHERE id = @id`,
+		sql.Named("cerrada", SesionCajaCerrada),
+		sql.Named("esperado", resumen.EfectivoEsperado),
+		sql.Named("contado", redondear(montoContado)),
+		sql.Named("diferencia", aMonto(diferencia)),
+		sql.Named("observaciones", textoONulo(observaciones)),
+		sql.Named("cerrada_por", cerradaPor),
+		sql.Named("id", sesionID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cerrar caja: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return ObtenerSesionCaja(sesionID)
+}
+
+// SesionCajaActual devuelve la sesión abierta de la terminal con el cuadre al momento.
+func SesionCajaActual() (*SesionCaja, error) {
+	punto := puntoEmisionActual()
+	var id int
+	err := dto.DB.QueryRow("SELECT id FROM sesiones_caja WHERE sucursal = @sucursal AND terminal = @terminal AND estado = @abierta",
+		sql.Named("sucursal", punto.Sucursal), sql.Named("terminal", punto.Terminal), sql.Named("abierta", SesionCajaAbierta)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrCajaCerrada
+	} else if err != nil {
+		return nil, fmt.Errorf("consultar sesión de caja: %w", err)
+	}
+	return ObtenerSesionCaja(id)
+}
+
+const columnasSesionCaja = `
+	SELECT s.id, s.sucursal, s.terminal, s.estado, s.monto_inicial, s.observaciones_apertura,
+	       s.abierta_por, ua.nombre, CONVERT(VARCHAR(19), s.abierta_en, 126),
+	       s.efectivo_esperado, s.monto_contado, s.diferencia, s.observaciones_cierre,
+	       s.cerrada_por, uc.nombre, CONVERT(VARCHAR(19), s.cerrada_en, 126)
+	FROM sesiones_caja s
+	LEFT JOIN usuarios ua ON ua.id = s.abierta_por
+	LEFT JOIN usuarios uc ON uc.id = s.cerrada_por`
+
+func escanearSesionCaja(scan func(dest ...interface{}) error) (*SesionCaja, error) {
+	var s SesionCaja
+	var abiertaPor, cerradaPor sql.NullInt32
+	var esperado, contado, diferencia sql.NullFloat64
+	err := scan(&s.ID, &s.Sucursal, &s.Terminal, &s.Estado, &s.MontoInicial, &s.ObservacionesApertura,
+		&abiertaPor, &s.AbiertaPorNombre, &s.AbiertaEn,
+		&esperado, &contado, &diferencia, &s.ObservacionesCierre,
+		&cerradaPor, &s.CerradaPorNombre, &s.CerradaEn)
+	if err != nil {
+		return nil, err
+	}
+	s.AbiertaPor = nullInt32Ptr(abiertaPor)
+	s.CerradaPor = nullInt32Ptr(cerradaPor)
+	s.EfectivoEsperado = nullFloat64Ptr(esperado)
+	s.MontoContado = nullFloat64Ptr(contado)
+	s.Diferencia = nullFloat64Ptr(diferencia)
+	return &s, nil
+}
+
+// ObtenerSesionCaja carga la sesión con su cuadre y todos sus movimientos.
+func ObtenerSesionCaja(id int) (*SesionCaja, error) {
+	s, err := escanearSesionCaja(dto.DB.QueryRow(columnasSesionCaja+" WHERE s.id = @id", sql.Named("id", id)).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrSesionCajaNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("consultar sesión de caja: %w", err)
+	}
+
+	s.Resumen, err = resumenCaja(dto.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	// Una sesión cerrada se reporta con lo que se guardó al cerrar
+	if s.Estado == SesionCajaCerrada && s.EfectivoEsperado != nil && s.MontoContado != nil && s.Diferencia != nil {
+		s.Resumen.EfectivoEsperado = *s.EfectivoEsperado
+		s.Resumen.MontoContado = s.MontoContado
+		s.Resumen.Diferencia = s.Diferencia
+		s.Resumen.Cuadre = cuadreDeDiferencia(*s.Diferencia)
+	}
+	return s, nil
+}
+
+// ListarSesionesCaja devuelve las sesiones abiertas en el rango [inicio, fin], sin
+// movimientos. estado vacío trae todas.
+func ListarSesionesCaja(inicio, fin time.Time, estado string) ([]SesionCaja, error) {
+	rows, err := dto.DB.Query(columnasSesionCaja+`
+		WHERE CAST(s.abierta_en AS DATE) BETWEEN @inicio AND @fin
+		  AND (@estado = '' OR s.estado = @estado)
+		ORDER BY s.abierta_en DESC, s.id DESC`,
+		sql.Named("inicio", inicio.Format("2006-01-02")),
+		sql.Named("fin", fin.Format("2006-01-02")),
+		sql.Named("estado", estado),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("consultar sesiones de caja: %w", err)
+	}
+	defer rows.Close()
+
+	sesiones := []SesionCaja{}
+	for rows.Next() {
+		s, err := escanearSesionCaja(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("leer sesión de caja: %w", err)
+		}
+		sesiones = append(sesiones, *s)
+	}
+	return sesiones, rows.Err()
+}
+
+// resumenCaja suma los movimientos de la sesión. El efectivo esperado es el fondo
+// inicial más lo cobrado en efectivo (propinas incluidas) menos reembolsos en
+// efectivo y retiros.
+func resumenCaja(q consultorSQL, sesionID int) (*ResumenCaja, error) {
+	r := &ResumenCaja{PorMetodo: []MetodoCaja{}, Movimientos: []MovimientoCaja{}}
+	if err := q.QueryRow("SELECT monto_inicial FROM sesiones_caja WHERE id = @id", sql.Named("id", sesionID)).Scan(&r.MontoInicial); err != nil {
+		return nil, fmt.Errorf("consultar sesión de caja: %w", err)
+	}
+
+	rows, err := q.Query(`
+		SELECT m.tipo, m.id, m.idFact, m.metodo, m.monto, m.propina, m.detalle, m.registrado_por, CONVERT(VARCHAR(19), m.creado_en, 126)
+		FROM (
+			SELECT 'pago' AS tipo, p.id, p.idFact, p.metodo, p.monto, p.propina, p.referencia AS detalle, p.registrado_por, p.creado_en
+			FROM pagos_factura p WHERE p.sesion_caja_id = @id
+			UNION ALL
+			SELECT 'reembolso', n.id, n.idFact, n.metodo_reembolso, n.monto_reembolsado, 0, n.consecutivo, n.creado_por, n.creado_en
+			FROM notas_credito n WHERE n.sesion_caja_id = @id AND n.monto_reembolsado > 0
+			UNION ALL
+			SELECT 'retiro', r.id, NULL, NULL, r.monto, 0, r.motivo, r.registrado_por, r.creado_en
+			FROM retiros_caja r WHERE r.sesion_id = @id
+		) m
+		ORDER BY m.creado_en, m.tipo, m.id`, sql.Named("id", sesionID))
+	if err != nil {
+		return nil, fmt.Errorf("consultar movimientos de caja: %w", err)
+	}
+	defer rows.Close()
+
+	metodos := map[string]*MetodoCaja{}
+	var cobrado, propinas, reembolsado, retiros, efectivo int64
+	for rows.Next() {
+		var m MovimientoCaja
+		var facturaID, registradoPor sql.NullInt32
+		if err := rows.Scan(&m.Tipo, &m.ID, &facturaID, &m.Metodo, &m.Monto, &m.Propina, &m.Detalle, &registradoPor, &m.Fecha); err != nil {
+			return nil, fmt.Errorf("leer movimiento de caja: %w", err)
+		}
+		m.FacturaID = nullInt32Ptr(facturaID)
+		m.RegistradoPor = nullInt32Ptr(registradoPor)
+		r.Movimientos = append(r.Movimientos, m)
+
+		if m.Tipo == "retiro" {
+			retiros += centavos(m.Monto)
+			continue
+		}
+		metodo := ""
+		if m.Metodo != nil {
+			metodo = *m.Metodo
+		}
+		t, ok := metodos[metodo]
+		if !ok {
+			t = &MetodoCaja{Metodo: metodo}
+			metodos[metodo] = t
+		}
+		neto := centavos(m.Monto) + centavos(m.Propina)
+		if m.Tipo == "pago" {
+			t.Pagos++
+			t.Cobrado = redondear(t.Cobrado + m.Monto)
+			t.Propinas = redondear(t.Propinas + m.Propina)
+			cobrado += centavos(m.Monto)
+			propinas += centavos(m.Propina)
+		} else {
+			neto = -neto
+			t.Reembolsado = redondear(t.Reembolsado + m.Monto)
+			reembolsado += centavos(m.Monto)
+		}
+		t.Neto = aMonto(centavos(t.Neto) + neto)
+		if metodo == MetodoEfectivo {
+			efectivo += neto
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, metodo := range []string{MetodoEfectivo, MetodoTarjeta, MetodoSinpeMovil, MetodoTransferencia} {
+		if t, ok := metodos[metodo]; ok {
+			r.PorMetodo = append(r.PorMetodo, *t)
+		}
+	}
+	r.Cobrado = aMonto(cobrado)
+	r.Propinas = aMonto(propinas)
+	r.Reembolsado = aMonto(reembolsado)
+	r.Retiros = aMonto(retiros)
+	r.EfectivoEsperado = aMonto(centavos(r.MontoInicial) + efectivo - retiros)
+	return r, nil
+}
+
+func cuadreDeDiferencia(diferencia float64) string {
+	switch {
+	case centavos(diferencia) > 0:
+		return CuadreSobrante
+	case centavos(diferencia) < 0:
+		return CuadreFaltante
+	default:
+		return CuadreExacto
+	}
+}
@@ -0,0 +1,195 @@
+// Resumen imprimible del cierre de caja: totales por método, cuadre del efectivo y
+// el detalle de pagos, reembolsos y retiros de la sesión.
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/phpdave11/gofpdf"
+)
+
+// GenerarPDFCierreCaja dibuja el resumen de la sesión y lo escribe en w. Con la sesión
+// abierta sirve como corte parcial: sin monto contado ni diferencia.
+func GenerarPDFCierreCaja(w io.Writer, s SesionCaja) error {
+	if s.Resumen == nil {
+		return fmt.Errorf("la sesión de caja %d no tiene resumen", s.ID)
+	}
+	r := s.Resumen
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 10, tr(fmt.Sprintf("Caja #%d - Página %d de {nb}", s.ID, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Encabezado
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(110, 8, tr(datosSalon.Nombre), "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 14)
+	titulo := "CIERRE DE CAJA"
+	if s.Estado == SesionCajaAbierta {
+		titulo = "CORTE DE CAJA"
+	}
+	pdf.CellFormat(70, 8, titulo, "", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(110, 5, tr(fmt.Sprintf("Sucursal %s - Terminal %s", s.Sucursal, s.Terminal)), "", 0, "L", false, 0, "")
+	pdf.CellFormat(70, 5, tr(fmt.Sprintf("Sesión #%d", s.ID)), "", 1, "R", false, 0, "")
+
+	apertura := "Apertura: " + fechaHoraPDF(s.AbiertaEn)
+	if s.AbiertaPorNombre != nil {
+		apertura += " por " + *s.AbiertaPorNombre
+	}
+	pdf.CellFormat(0, 5, tr(textoPDF(apertura)), "", 1, "L", false, 0, "")
+	if s.CerradaEn != nil {
+		cierre := "Cierre: " + fechaHoraPDF(*s.CerradaEn)
+		if s.CerradaPorNombre != nil {
+			cierre += " por " + *s.CerradaPorNombre
+		}
+		pdf.CellFormat(0, 5, tr(textoPDF(cierre)), "", 1, "L", false, 0, "")
+	}
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.Line(15, pdf.GetY()+2, 195, pdf.GetY()+2)
+	pdf.Ln(6)
+
+	// Totales por método
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 6, tr("Totales por método de pago"), "", 1, "L", false, 0, "")
+	pdf.SetFillColor(230, 230, 230)
+	for _, col := range []struct {
+		titulo string
+		ancho  float64
+	}{{"Método", 50}, {"Pagos", 18}, {"Cobrado", 28}, {"Propinas", 28}, {"Reembolsos", 28}, {"Neto", 28}} {
+		pdf.CellFormat(col.ancho, 7, tr(col.titulo), "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, m := range r.PorMetodo {
+		pdf.CellFormat(50, 6, tr(nombresMetodoPago[m.Metodo]), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(18, 6, fmt.Sprint(m.Pagos), "1", 0, "C", false, 0, "")
+		pdf.CellFormat(28, 6, tr(montoPDF(m.Cobrado)), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(28, 6, tr(montoPDF(m.Propinas)), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(28, 6, tr(montoPDF(-m.Reembolsado)), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(28, 6, tr(montoPDF(m.Neto)), "1", 1, "R", false, 0, "")
+	}
+	if len(r.PorMetodo) == 0 {
+		pdf.CellFormat(180, 6, "Sin movimientos", "1", 1, "C", false, 0, "")
+	}
+
+	// Cuadre del efectivo
+	type filaCuadre struct {
+		etiqueta string
+		monto    float64
+		negrita  bool
+	}
+	var efectivo MetodoCaja
+	for _, m := range r.PorMetodo {
+		if m.Metodo == MetodoEfectivo {
+			efectivo = m
+		}
+	}
+	filas := []filaCuadre{
+		{"Fondo inicial", r.MontoInicial, false},
+		{"Cobros en efectivo", efectivo.Cobrado, false},
+		{"Propinas en efectivo", efectivo.Propinas, false},
+		{"Reembolsos en efectivo", -efectivo.Reembolsado, false},
+		{"Retiros", -r.Retiros, false},
+		{"Efectivo esperado", r.EfectivoEsperado, true},
+	}
+	if r.MontoContado != nil && r.Diferencia != nil {
+		etiqueta := "Diferencia"
+		switch r.Cuadre {
+		case CuadreSobrante:
+			etiqueta += " (sobrante)"
+		case CuadreFaltante:
+			etiqueta += " (faltante)"
+		}
+		filas = append(filas, filaCuadre{"Efectivo contado", *r.MontoContado, true}, filaCuadre{etiqueta, *r.Diferencia, true})
+	}
+
+	pdf.Ln(6)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 6, "Cuadre de efectivo", "", 1, "L", false, 0, "")
+	for _, fila := range filas {
+		estilo := ""
+		if fila.negrita {
+			estilo = "B"
+		}
+		pdf.SetFont("Helvetica", estilo, 10)
+		pdf.CellFormat(92, 7, tr(fila.etiqueta), "1", 0, "L", fila.negrita, 0, "")
+		pdf.CellFormat(30, 7, tr(montoPDF(fila.monto)), "1", 1, "R", fila.negrita, 0, "")
+	}
+
+	// Movimientos
+	if len(r.Movimientos) > 0 {
+		pdf.Ln(6)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(0, 6, "Movimientos", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		for _, m := range r.Movimientos {
+			pdf.CellFormat(150, 6, tr(textoPDF(descripcionMovimientoPDF(m))), "B", 0, "L", false, 0, "")
+			monto := m.Monto + m.Propina
+			if m.Tipo != "pago" {
+				monto = -monto
+			}
+			pdf.CellFormat(30, 6, tr(montoPDF(monto)), "B", 1, "R", false, 0, "")
+		}
+	}
+
+	for _, obs := range []*string{s.ObservacionesApertura, s.ObservacionesCierre} {
+		if obs != nil && *obs != "" {
+			pdf.Ln(4)
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.MultiCell(0, 5, tr(textoPDF(*obs)), "", "L", false)
+		}
+	}
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("generar PDF de cierre de caja: %w", err)
+	}
+	return pdf.Output(w)
+}
+
+// PDFCierreCaja es un atajo que devuelve el PDF en memoria.
+func PDFCierreCaja(s SesionCaja) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := GenerarPDFCierreCaja(&buf, s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func descripcionMovimientoPDF(m MovimientoCaja) string {
+	texto := fechaHoraPDF(m.Fecha) + "  "
+	switch m.Tipo {
+	case "retiro":
+		texto += "Retiro"
+	case "reembolso":
+		texto += "Reembolso"
+	default:
+		texto += "Pago"
+	}
+	if m.Metodo != nil {
+		texto += " " + nombresMetodoPago[*m.Metodo]
+	}
+	if m.FacturaID != nil {
+		texto += fmt.Sprintf(" - factura #%d", *m.FacturaID)
+	}
+	if m.Detalle != nil && *m.Detalle != "" {
+		texto += " (" + *m.Detalle + ")"
+	}
+	if m.Propina > 0 {
+		texto += " - incluye propina " + montoPDF(m.Propina)
+	}
+	return texto
+}
@@ -4,9 +4,12 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"restapi/dto"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,142 +18,142 @@ import (
 type CrearCitaInput struct {
 	ServicioID int32     `json:"servicio_id"`
 	FechaHora  time.Time `json:"fecha_hora"`
+	EmpleadoID *int32    `json:"empleado_id"` // opcional: estilista elegido en el selector
+	// opcional: el código queda reservado en la cita y se aplica al facturarla
+	CodigoPromocion string `json:"codigo_promocion"`
 }
 
-func CancelarCita(c *gin.Context) {
-	id := c.Param("id")
-
-	// 🔐 Recuperar datos del token con conversión segura
-	rolRaw, _ := c.Get("rol")
-	usuarioIDRaw, _ := c.Get("usuarioID")
+// ConfirmarCitaInput es opcional: sin cuerpo la cita se confirma con el empleado
+// que ya tenga (o sin ninguno, como antes).
+type ConfirmarCitaInput struct {
+	Estrategia string `json:"estrategia"`  // menor_carga, rotacion, especialidad o preferido
+	EmpleadoID *int32 `json:"empleado_id"` // asignación manual del admin, tiene prioridad
+}
 
-	rol, ok := rolRaw.(string)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Rol inválido"})
-		return
-	}
+func ConfirmarCita(c *gin.Context) {
+	id := c.Param("id")
 
-	usuarioIDFloat, ok := usuarioIDRaw.(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "ID de usuario inválido"})
+	var input ConfirmarCitaInput
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
 		return
 	}
-	usuarioID := int(usuarioIDFloat)
 
-	// 🕒 Obtener cita
-	var fechaHora time.Time
-	var dueñoID sql.NullInt64
-	err := dto.DB.QueryRow("SELECT fecha_hora, usuario_id FROM citas WHERE id=@id", sql.Named("id", id)).Scan(&fechaHora, &dueñoID)
-	if err != nil {
+	// Verificar que la cita exista y esté pendiente
+	var estado string
+	var cita CitaAsignable
+	var empleadoActual sql.NullInt32
+	err := dto.DB.QueryRow("SELECT id, estado, servicio_id, fecha_hora, usuario_id, empleado_id FROM citas WHERE id = @id", sql.Named("id", id)).
+		Scan(&cita.ID, &estado, &cita.ServicioID, &cita.FechaHora, &cita.UsuarioID, &empleadoActual)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+		return
 	}
-
-	// Leer motivo desde el body (esperamos JSON)
-	var input struct {
-		Motivo string `json:"motivo"`
+	if !PuedeTransicionar(estado, EstadoConfirmada) {
+		responderErrorTransicion(c, &ErrorTransicion{Desde: estado, Hacia: EstadoConfirmada})
+		return
 	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Motivo requerido"})
+	// El horario del salón pudo cambiar desde que se pidió la cita
+	if err := VerificarHorarioSalon(cita.ServicioID, cita.FechaHora); err != nil {
+		responderErrorDisponibilidad(c, err)
 		return
 	}
 
-	// Admin puede cancelar siempre
-	if rol == "admin" {
-		_, err := dto.DB.Exec("UPDATE citas SET estado='cancelada', cancelacion_motivo=@motivo WHERE id=@id",
-			sql.Named("motivo", input.Motivo),
-			sql.Named("id", id))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cancelar cita"})
+	var asignacion *ResultadoAsignacion
+	switch {
+	case input.EmpleadoID != nil:
+		if err := VerificarEmpleadoEnTurno(*input.EmpleadoID, cita.ServicioID, cita.FechaHora); err != nil {
+			responderErrorDisponibilidad(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"mensaje": "Cita cancelada correctamente por administrador"})
-		return
-	}
-
-	// Cliente puede cancelar solo su propia cita (con 12h de anticipación)
-	if rol == "cliente" && dueñoID.Valid && int(dueñoID.Int64) == usuarioID {
-		if time.Until(fechaHora) < 12*time.Hour {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Solo puede cancelar con al menos 12h de antelación"})
+		if err := VerificarTraslape(*input.EmpleadoID, cita.ServicioID, cita.FechaHora, cita.ID); err != nil {
+			responderErrorDisponibilidad(c, err)
 			return
 		}
-		_, err := dto.DB.Exec("UPDATE citas SET estado='cancelada', cancelacion_motivo=@motivo WHERE id=@id",
-			sql.Named("motivo", input.Motivo),
-			sql.Named("id", id))
+		asignacion = &ResultadoAsignacion{EmpleadoID: *input.EmpleadoID, Estrategia: "manual", Motivo: "Asignado manualmente por el administrador"}
+	case empleadoActual.Valid && input.Estrategia != "":
+		// La estrategia no reemplaza en silencio al empleado que ya tiene la cita
+		c.JSON(http.StatusConflict, gin.H{"error": "La cita ya tiene un empleado asignado; indique empleado_id para cambiarlo"})
+		return
+	case empleadoActual.Valid:
+		asignacion = &ResultadoAsignacion{EmpleadoID: empleadoActual.Int32, Estrategia: "existente", Motivo: "La cita ya tenía un empleado asignado"}
+	case input.Estrategia != "":
+		asignacion, err = AsignarEmpleado(cita, input.Estrategia)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cancelar cita"})
+			responderErrorAsignacion(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"mensaje": "Cita cancelada correctamente"})
-		return
 	}
 
-	// Si no cumple ninguna condición
-	c.JSON(http.StatusForbidden, gin.H{"error": "No tiene permiso para cancelar esta cita"})
-}
-
-func ConfirmarCita(c *gin.Context) {
-	id := c.Param("id")
-	rol, _ := c.Get("rol")
-
-	if rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden confirmar citas"})
-		return
+	var empleadoID sql.NullInt32
+	if asignacion != nil {
+		empleadoID = sql.NullInt32{Int32: asignacion.EmpleadoID, Valid: true}
+		if asignacion.Nombre == "" {
+			err := dto.DB.QueryRow("SELECT nombre FROM usuarios WHERE id = @id", sql.Named("id", asignacion.EmpleadoID)).Scan(&asignacion.Nombre)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Empleado no encontrado"})
+				return
+			} else if err != nil {
+				fmt.Println("❌ Error al consultar el empleado asignado:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al confirmar la cita"})
+				return
+			}
+		}
 	}
 
-	// Verificar que la cita exista y esté pendiente
-	var estado string
-	err := dto.DB.QueryRow("SELECT estado FROM citas WHERE id = @id", sql.Named("id", id)).Scan(&estado)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
-		return
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
-		return
-	}
-	if estado != "pendiente" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Solo se pueden confirmar citas pendientes"})
-		return
+	motivo := ""
+	if asignacion != nil {
+		motivo = fmt.Sprintf("Empleado %d asignado (%s)", asignacion.EmpleadoID, asignacion.Estrategia)
 	}
-
-	// Actualizamos directamente a confirmada SIN asignar empleado
-	_, err = dto.DB.Exec("UPDATE citas SET estado='confirmada' WHERE id=@id", sql.Named("id", id))
+	_, err = CambiarEstadoCita(cita.ID, EstadoConfirmada, actorDeContexto(c), motivo, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE citas SET empleado_id=@empleado_id WHERE id=@id",
+			sql.Named("empleado_id", empleadoID),
+			sql.Named("id", cita.ID),
+		)
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al confirmar cita"})
+		responderErrorTransicion(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"mensaje": "Cita confirmada correctamente"})
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Cita confirmada correctamente", "asignacion": asignacion})
 }
 
-func RechazarCita(c *gin.Context) {
-	id := c.Param("id")
-	rol, _ := c.Get("rol")
+// responderErrorAsignacion traduce los errores de la asignación automática.
+func responderErrorAsignacion(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrEstrategiaDesconocida):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Estrategia inválida. Use menor_carga, rotacion, especialidad o preferido"})
+	case errors.Is(err, ErrSinCandidatos):
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay empleados en turno y libres para la cita"})
+	case errors.Is(err, ErrSinEspecialistas):
+		c.JSON(http.StatusConflict, gin.H{"error": "Ningún empleado disponible tiene la especialidad del servicio"})
+	default:
+		responderErrorDisponibilidad(c, err)
+	}
+}
 
-	if rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden rechazar citas"})
+func RechazarCita(c *gin.Context) {
+	citaID, ok := citaIDParam(c)
+	if !ok {
 		return
 	}
 
-	// Verificar que la cita exista y esté pendiente
-	var estado string
-	err := dto.DB.QueryRow("SELECT estado FROM citas WHERE id = @id", sql.Named("id", id)).Scan(&estado)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
-		return
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
-		return
+	// El motivo es opcional y queda en el historial
+	var input struct {
+		Motivo string `json:"motivo"`
 	}
-	if estado != "pendiente" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Solo se pueden rechazar citas pendientes"})
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
 		return
 	}
 
-	// Realizar el update para rechazar la cita
-	_, err = dto.DB.Exec("UPDATE citas SET estado='rechazada' WHERE id=@id", sql.Named("id", id))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al rechazar cita"})
+	if _, err := CambiarEstadoCita(citaID, EstadoRechazada, actorDeContexto(c), input.Motivo, nil); err != nil {
+		responderErrorTransicion(c, err)
 		return
 	}
 
@@ -163,12 +166,11 @@ func MisCitasCliente(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
 		return
 	}
-	rol, _ := c.Get("rol")
 
 	query := `
 		SELECT c.id, c.servicio_id, c.fecha_hora, c.estado, c.empleado_id,
 		       c.creado_en, c.actualizado_en, s.nombre AS nombre_servicio,
-		       s.precio, u.cedula, u.nombre AS nombre_cliente
+		       s.precio, u.cedula, u.nombre AS nombre_cliente, c.reprogramaciones
 		FROM citas c
 		JOIN servicios s ON c.servicio_id = s.id
 		JOIN usuarios u ON c.usuario_id = u.id`
@@ -176,7 +178,7 @@ func MisCitasCliente(c *gin.Context) {
 	var rows *sql.Rows
 	var err error
 
-	if rol == "admin" {
+	if tienePermiso(c, PermisoCitasVerTodas) {
 		rows, err = dto.DB.Query(query + " ORDER BY c.fecha_hora DESC")
 	} else {
 		rows, err = dto.DB.Query(query+" WHERE c.usuario_id = @usuario_id ORDER BY c.fecha_hora DESC", sql.Named("usuario_id", usuarioID))
@@ -192,7 +194,7 @@ func MisCitasCliente(c *gin.Context) {
 
 	for rows.Next() {
 		var (
-			id, servicioID                        int
+			id, servicioID, reprogramaciones      int
 			empleadoID                            sql.NullInt32
 			fechaHora, estado                     string
 			creadoEn, actualizadoEn               sql.NullTime
@@ -201,7 +203,7 @@ func MisCitasCliente(c *gin.Context) {
 		)
 
 		err := rows.Scan(&id, &servicioID, &fechaHora, &estado, &empleadoID,
-			&creadoEn, &actualizadoEn, &nombreServicio, &precio, &cedula, &nombreCliente)
+			&creadoEn, &actualizadoEn, &nombreServicio, &precio, &cedula, &nombreCliente, &reprogramaciones)
 		if err != nil {
 			fmt.Println("❌ Error en Scan:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar cita"})
@@ -209,9 +211,10 @@ func MisCitasCliente(c *gin.Context) {
 		}
 
 		cita := map[string]interface{}{
-			"id":         id,
-			"fecha_hora": fechaHora,
-			"estado":     estado,
+			"id":               id,
+			"fecha_hora":       fechaHora,
+			"estado":           estado,
+			"reprogramaciones": reprogramaciones,
 			"servicio": map[string]interface{}{
 				"id":     servicioID,
 				"nombre": nombreServicio,
@@ -238,6 +241,174 @@ func MisCitasCliente(c *gin.Context) {
 
 	c.JSON(http.StatusOK, citas)
 }
+
+// ReprogramarCitaInput es el cuerpo de las reprogramaciones hechas por clientes o invitados.
+type ReprogramarCitaInput struct {
+	FechaHora  time.Time `json:"fecha_hora"`
+	EmpleadoID *int32    `json:"empleado_id"` // opcional: por defecto se conserva el asignado
+}
+
+// PUT /mis-citas/:id/reprogramar  {"fecha_hora": "...", "empleado_id": 3}
+// El cliente mueve su propia cita a otro slot libre respetando la política del salón.
+func ReprogramarMiCita(c *gin.Context) {
+	citaID, ok := citaIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input ReprogramarCitaInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.FechaHora.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fecha_hora es obligatoria"})
+		return
+	}
+
+	var usuarioCita sql.NullInt32
+	err := dto.DB.QueryRow("SELECT usuario_id FROM citas WHERE id = @id", sql.Named("id", citaID)).Scan(&usuarioCita)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+		return
+	}
+
+	actor := actorDeContexto(c)
+	if !usuarioCita.Valid || usuarioCita.Int32 != actor.ID.Int32 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tiene permiso para reprogramar esta cita"})
+		return
+	}
+
+	reprogramarCita(c, citaID, actor, input)
+}
+
+// reprogramarCita aplica la política (anticipación, tope de cambios, reconfirmación)
+// y mueve la cita. El llamador ya verificó que el actor es dueño de la cita.
+func reprogramarCita(c *gin.Context, citaID int32, actor ActorCita, input ReprogramarCitaInput) {
+	var (
+		servicioID       int32
+		fechaActual      time.Time
+		estado           string
+		empleadoActual   sql.NullInt32
+		reprogramaciones int
+	)
+	err := dto.DB.QueryRow(`
+		SELECT servicio_id, fecha_hora, estado, empleado_id, reprogramaciones
+		FROM citas WHERE id = @id`, sql.Named("id", citaID)).
+		Scan(&servicioID, &fechaActual, &estado, &empleadoActual, &reprogramaciones)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+		return
+	}
+
+	if estado != EstadoPendiente && estado != EstadoConfirmada {
+		c.JSON(http.StatusConflict, gin.H{"error": "Solo se pueden reprogramar citas pendientes o confirmadas"})
+		return
+	}
+
+	politica, err := ObtenerPoliticaCitas()
+	if err != nil {
+		fmt.Println("❌ Error al obtener política de citas:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar la política de citas"})
+		return
+	}
+	if relojLocal(fechaActual).Sub(relojLocal(time.Now())) < politica.AnticipacionMinima() {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Solo puede reprogramar con al menos %dh de antelación", politica.AnticipacionMinimaHoras)})
+		return
+	}
+	if reprogramaciones >= politica.MaxReprogramaciones {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("La cita ya alcanzó el máximo de %d reprogramaciones", politica.MaxReprogramaciones)})
+		return
+	}
+
+	empleadoID := input.EmpleadoID
+	if empleadoID == nil && empleadoActual.Valid {
+		empleadoID = &empleadoActual.Int32
+	}
+
+	nuevaFecha := relojLocal(input.FechaHora)
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al reprogramar cita"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Igual que al crear: el slot nuevo se revisa con la agenda de ese día bloqueada
+	if err := bloquearAgendaDia(tx, nuevaFecha); err != nil {
+		fmt.Println("❌ Error al bloquear la agenda:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al reprogramar cita"})
+		return
+	}
+	consulta := ConsultaDisponibilidad{ServicioID: servicioID, EmpleadoID: empleadoID, ExcluirCitaID: citaID}
+	if err := VerificarDisponibilidad(consulta, nuevaFecha); err != nil {
+		responderErrorDisponibilidad(c, err)
+		return
+	}
+
+	motivo := fmt.Sprintf("Reprogramada por el %s de %s a %s", actor.Rol,
+		fechaActual.Format("2006-01-02 15:04"), nuevaFecha.Format("2006-01-02 15:04"))
+
+	// Estado y tope se vuelven a comprobar en el UPDATE: la cita pudo cancelarse,
+	// confirmarse o reprogramarse en otra solicitud después de la lectura de arriba.
+	res, err := tx.Exec(`
+		UPDATE citas
+		SET fecha_hora = @fecha_hora, empleado_id = @empleado_id, reprogramaciones = reprogramaciones + 1
+		WHERE id = @id AND estado = @estado AND reprogramaciones < @max`,
+		sql.Named("fecha_hora", nuevaFecha),
+		sql.Named("empleado_id", empleadoID),
+		sql.Named("id", citaID),
+		sql.Named("estado", estado),
+		sql.Named("max", politica.MaxReprogramaciones),
+	)
+	if err != nil {
+		fmt.Println("❌ Error al reprogramar cita:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al reprogramar cita"})
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		fmt.Println("❌ Error al reprogramar cita:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al reprogramar cita"})
+		return
+	} else if n == 0 {
+		var hechas int
+		err := tx.QueryRow("SELECT reprogramaciones FROM citas WHERE id = @id", sql.Named("id", citaID)).Scan(&hechas)
+		if err == nil && hechas >= politica.MaxReprogramaciones {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("La cita ya alcanzó el máximo de %d reprogramaciones", politica.MaxReprogramaciones)})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "La cita cambió mientras se reprogramaba; consulte su estado y vuelva a intentarlo"})
+		return
+	}
+
+	// Si el salón pide reconfirmar, la cita confirmada vuelve a pendiente; si no,
+	// el historial deja constancia del cambio sin mover el estado.
+	nuevoEstado := estado
+	if politica.RequiereReconfirmacion && estado == EstadoConfirmada {
+		nuevoEstado = EstadoPendiente
+		_, err = TransicionarCita(tx, citaID, EstadoPendiente, actor, motivo)
+	} else {
+		err = registrarHistorialCita(tx, citaID, sql.NullString{String: estado, Valid: true}, estado, actor, motivo)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		responderErrorTransicion(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mensaje":                  "Cita reprogramada correctamente",
+		"fecha_hora":               nuevaFecha,
+		"estado":                   nuevoEstado,
+		"reprogramaciones":         reprogramaciones + 1,
+		"reprogramaciones_maximas": politica.MaxReprogramaciones,
+	})
+}
+
 func CrearCita(c *gin.Context) {
 	var input CrearCitaInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -255,23 +426,55 @@ func CrearCita(c *gin.Context) {
 		return
 	}
 
-	// Verificar que el servicio exista
-	var exists int
-	err := dto.DB.QueryRow("SELECT COUNT(*) FROM servicios WHERE id = @id", sql.Named("id", input.ServicioID)).Scan(&exists)
-	if err != nil || exists == 0 {
-		fmt.Printf("❌ Error: El servicio %d no existe o error en consulta: %v\n", input.ServicioID, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "El servicio no existe"})
+	usuarioID, _ := c.Get("usuarioID")
+	fmt.Printf("✅ UsuarioID obtenido del token: %v\n", usuarioID)
+
+	if actor := actorDeContexto(c); actor.Rol == "cliente" {
+		verificado, err := correoVerificado(int(actor.ID.Int32))
+		if err != nil {
+			fmt.Println("❌ Error al consultar verificación de correo:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear cita"})
+			return
+		}
+		if !verificado {
+			c.JSON(http.StatusForbidden, gin.H{"error": ErrCorreoSinVerificar.Error()})
+			return
+		}
+	}
+
+	// La cita y la reserva de la promoción se guardan juntas: un código inválido no deja cita
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear cita"})
 		return
 	}
+	defer tx.Rollback()
 
-	usuarioID, _ := c.Get("usuarioID")
-	fmt.Printf("✅ UsuarioID obtenido del token: %v\n", usuarioID)
+	// Verificar que el servicio exista y que el horario caiga en un slot libre, con la
+	// agenda del día bloqueada hasta el commit
+	fechaHora := relojLocal(input.FechaHora)
+	if err := bloquearAgendaDia(tx, fechaHora); err != nil {
+		fmt.Println("❌ Error al bloquear la agenda:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear cita"})
+		return
+	}
+	err = VerificarDisponibilidad(ConsultaDisponibilidad{ServicioID: input.ServicioID, EmpleadoID: input.EmpleadoID}, fechaHora)
+	if err != nil {
+		fmt.Printf("❌ Error: Horario %s no disponible para el servicio %d: %v\n", fechaHora, input.ServicioID, err)
+		responderErrorDisponibilidad(c, err)
+		return
+	}
 
-	_, err = dto.DB.Exec("INSERT INTO citas (usuario_id, servicio_id, fecha_hora, estado) VALUES (@usuario_id, @servicio_id, @fecha_hora, @estado)",
+	// citas tiene triggers, por eso se usa SCOPE_IDENTITY en lugar de OUTPUT INSERTED
+	var citaID int32
+	err = tx.QueryRow(`
+		INSERT INTO citas (usuario_id, servicio_id, empleado_id, fecha_hora, estado) VALUES (@usuario_id, @servicio_id, @empleado_id, @fecha_hora, @estado);
+		SELECT CAST(SCOPE_IDENTITY() AS INT)`,
 		sql.Named("usuario_id", usuarioID),
 		sql.Named("servicio_id", input.ServicioID),
-		sql.Named("fecha_hora", input.FechaHora),
-		sql.Named("estado", "pendiente"))
+		sql.Named("empleado_id", input.EmpleadoID),
+		sql.Named("fecha_hora", fechaHora),
+		sql.Named("estado", EstadoPendiente)).Scan(&citaID)
 
 	if err != nil {
 		fmt.Println("❌ Error al insertar cita en la base de datos:", err)
@@ -279,11 +482,42 @@ func CrearCita(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"mensaje": "Cita creada exitosamente"})
+	var promocion *ReservaPromocion
+	if strings.TrimSpace(input.CodigoPromocion) != "" {
+		cliente := clientePromocion{usuarioID: actorDeContexto(c).ID}
+		promocion, err = reservarPromocionCita(tx, input.CodigoPromocion, citaID, int(input.ServicioID), fechaHora, cliente)
+		if esErrorPromocion(err) {
+			responderErrorPromocion(c, err)
+			return
+		} else if err != nil {
+			fmt.Println("❌ Error al reservar promoción:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear cita"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("❌ Error al confirmar la cita:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear cita"})
+		return
+	}
+
+	if err := RegistrarCreacionCita(citaID, actorDeContexto(c)); err != nil {
+		fmt.Println("❌ Error al registrar historial de la cita:", err)
+	}
+
+	respuesta := gin.H{"mensaje": "Cita creada exitosamente", "id": citaID}
+	if promocion != nil {
+		respuesta["promocion"] = promocion
+	}
+	c.JSON(http.StatusCreated, respuesta)
 }
 
 func ObtenerCita(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := citaIDParam(c)
+	if !ok || !autorizarCita(c, int(id)) {
+		return
+	}
 
 	var cita struct {
 		ID         int32     `json:"id"`
@@ -309,19 +543,17 @@ func ObtenerCita(c *gin.Context) {
 }
 
 func ActualizarCita(c *gin.Context) {
-	rol, _ := c.Get("rol")
-	if rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden actualizar citas"})
+	citaID, ok := citaIDParam(c)
+	if !ok {
 		return
 	}
 
-	id := c.Param("id")
-
 	var input struct {
 		ServicioID int32     `json:"servicio_id"`
 		FechaHora  time.Time `json:"fecha_hora"`
 		Estado     string    `json:"estado"`
 		EmpleadoID *int32    `json:"empleado_id"`
+		Motivo     string    `json:"motivo"` // opcional, se guarda en el historial si cambia el estado
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -330,30 +562,66 @@ func ActualizarCita(c *gin.Context) {
 	}
 
 	// Validar estado permitido
-	estadosPermitidos := map[string]bool{
-		"pendiente":  true,
-		"confirmada": true,
-		"cancelada":  true,
-		"rechazada":  true,
-		"atendida":   true,
-	}
-	if !estadosPermitidos[input.Estado] {
+	if !EsEstadoCita(input.Estado) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Estado inválido"})
 		return
 	}
 
-	// Ejecutar actualización
-	_, err := dto.DB.Exec(`
+	// Una cita activa debe caer en el horario del salón; con empleado, además, en su
+	// turno y sin traslaparse con otra de sus citas
+	if input.Estado == EstadoPendiente || input.Estado == EstadoConfirmada {
+		if err := VerificarHorarioSalon(input.ServicioID, input.FechaHora); err != nil {
+			responderErrorDisponibilidad(c, err)
+			return
+		}
+	}
+	if input.EmpleadoID != nil && (input.Estado == EstadoPendiente || input.Estado == EstadoConfirmada) {
+		err := VerificarEmpleadoEnTurno(*input.EmpleadoID, input.ServicioID, input.FechaHora)
+		if err == nil {
+			err = VerificarTraslape(*input.EmpleadoID, input.ServicioID, input.FechaHora, citaID)
+		}
+		if err != nil {
+			responderErrorDisponibilidad(c, err)
+			return
+		}
+	}
+
+	// Los datos se actualizan en la misma transacción que el cambio de estado, si lo hay
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar cita"})
+		return
+	}
+	defer tx.Rollback()
+
+	var estadoActual string
+	err = tx.QueryRow("SELECT estado FROM citas WITH (UPDLOCK, ROWLOCK) WHERE id = @id", sql.Named("id", citaID)).Scan(&estadoActual)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+		return
+	}
+	if estadoActual != input.Estado {
+		if _, err := TransicionarCita(tx, citaID, input.Estado, actorDeContexto(c), input.Motivo); err != nil {
+			responderErrorTransicion(c, err)
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
 		UPDATE citas 
-		SET servicio_id=@servicio_id, fecha_hora=@fecha_hora, estado=@estado, empleado_id=@empleado_id
+		SET servicio_id=@servicio_id, fecha_hora=@fecha_hora, empleado_id=@empleado_id
 		WHERE id=@id`,
 		sql.Named("servicio_id", input.ServicioID),
-		sql.Named("fecha_hora", input.FechaHora),
-		sql.Named("estado", input.Estado),
+		sql.Named("fecha_hora", relojLocal(input.FechaHora)),
 		sql.Named("empleado_id", input.EmpleadoID),
-		sql.Named("id", id),
+		sql.Named("id", citaID),
 	)
-
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar cita"})
 		return
@@ -369,6 +637,7 @@ func CrearCitaInvitado(c *gin.Context) {
 		Telefono   string `json:"telefono_invitado"`
 		ServicioID int    `json:"servicio_id"`
 		FechaHora  string `json:"fecha_hora"` // ahora como string para mayor control
+		EmpleadoID *int32 `json:"empleado_id"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -396,43 +665,80 @@ func CrearCitaInvitado(c *gin.Context) {
 		return
 	}
 
-	// Verificar que el servicio existe
-	var exists int
-	err = dto.DB.QueryRow("SELECT COUNT(*) FROM servicios WHERE id = @id", sql.Named("id", input.ServicioID)).Scan(&exists)
-	if err != nil || exists == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "El servicio no existe"})
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la cita"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Verificar que el servicio existe y que el horario caiga en un slot libre, con la
+	// agenda del día bloqueada hasta el commit
+	if err := bloquearAgendaDia(tx, fechaHora); err != nil {
+		fmt.Println("❌ Error al bloquear la agenda:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la cita"})
+		return
+	}
+	err = VerificarDisponibilidad(ConsultaDisponibilidad{ServicioID: int32(input.ServicioID), EmpleadoID: input.EmpleadoID}, fechaHora)
+	if err != nil {
+		responderErrorDisponibilidad(c, err)
 		return
 	}
 
 	// Insertar la cita
-	_, err = dto.DB.Exec(`
-		INSERT INTO citas (servicio_id, fecha_hora, estado, nombre_invitado, cedula_invitado, telefono_invitado)
-		VALUES (@servicio_id, @fecha_hora, 'pendiente', @nombre, @cedula, @telefono)`,
+	var citaID int32
+	err = tx.QueryRow(`
+		INSERT INTO citas (servicio_id, empleado_id, fecha_hora, estado, nombre_invitado, cedula_invitado, telefono_invitado)
+		VALUES (@servicio_id, @empleado_id, @fecha_hora, 'pendiente', @nombre, @cedula, @telefono);
+		SELECT CAST(SCOPE_IDENTITY() AS INT)`,
 		sql.Named("servicio_id", input.ServicioID),
+		sql.Named("empleado_id", input.EmpleadoID),
 		sql.Named("fecha_hora", fechaHora),
 		sql.Named("nombre", input.Nombre),
 		sql.Named("cedula", input.Cedula),
 		sql.Named("telefono", input.Telefono),
-	)
+	).Scan(&citaID)
 
 	if err != nil {
 		fmt.Println("❌ Error al insertar en la base de datos:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la cita"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		fmt.Println("❌ Error al confirmar la cita:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la cita"})
+		return
+	}
 
-	c.JSON(http.StatusCreated, gin.H{"mensaje": "Cita registrada exitosamente como invitado"})
-}
+	if err := RegistrarCreacionCita(citaID, ActorCita{Rol: "invitado"}); err != nil {
+		fmt.Println("❌ Error al registrar historial de la cita:", err)
+	}
 
-func ListarCitasUsuarios(c *gin.Context) {
-	rol, _ := c.Get("rol")
-	if rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "No autorizado"})
+	// Token de gestión limitado a esta cita: ver, cancelar y reprogramar sin cuenta
+	token, err := GenerarTokenInvitado(AccesoInvitado{CitaID: citaID})
+	if err != nil {
+		fmt.Println("❌ Error al generar token de invitado:", err)
+		c.JSON(http.StatusCreated, gin.H{"mensaje": "Cita registrada exitosamente como invitado", "id": citaID})
 		return
 	}
 
+	c.JSON(http.StatusCreated, gin.H{
+		"mensaje": "Cita registrada exitosamente como invitado",
+		"id":      citaID,
+		"token":   token,
+		"enlace":  EnlaceGestionInvitado(token),
+	})
+}
+
+func ListarCitasUsuarios(c *gin.Context) {
 	var citasUsuarios []map[string]interface{}
 
+	// Filtro opcional por día: en ese caso la respuesta incluye quién trabaja
+	dia, filtroFecha, args, ok := filtroFechaCitas(c)
+	if !ok {
+		return
+	}
+
 	queryUsuarios := `
 		SELECT c.id, c.servicio_id, c.fecha_hora, c.estado, c.empleado_id,
 		       c.creado_en, c.actualizado_en, s.nombre AS nombre_servicio,
@@ -440,11 +746,11 @@ func ListarCitasUsuarios(c *gin.Context) {
 		FROM citas c
 		JOIN servicios s ON c.servicio_id = s.id
 		JOIN usuarios u ON c.usuario_id = u.id
-		WHERE c.usuario_id IS NOT NULL
+		WHERE c.usuario_id IS NOT NULL` + filtroFecha + `
 		ORDER BY c.fecha_hora DESC
 	`
 
-	rowsUsuarios, err := dto.DB.Query(queryUsuarios)
+	rowsUsuarios, err := dto.DB.Query(queryUsuarios, args...)
 	if err != nil {
 		fmt.Println("❌ Error al ejecutar query de citas de usuarios:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener citas de usuarios"})
@@ -498,8 +804,28 @@ func ListarCitasUsuarios(c *gin.Context) {
 		citasUsuarios = append(citasUsuarios, cita)
 	}
 
+	if filtroFecha != "" {
+		responderConTurnos(c, dia, citasUsuarios)
+		return
+	}
 	c.JSON(http.StatusOK, citasUsuarios)
 }
+
+// filtroFechaCitas lee el parámetro opcional ?fecha=YYYY-MM-DD de los listados de citas.
+// Si es inválido responde 400 y devuelve ok=false.
+func filtroFechaCitas(c *gin.Context) (dia time.Time, filtro string, args []interface{}, ok bool) {
+	fecha := c.Query("fecha")
+	if fecha == "" {
+		return time.Time{}, "", nil, true
+	}
+	dia, err := time.Parse("2006-01-02", fecha)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+		return time.Time{}, "", nil, false
+	}
+	return dia, " AND CAST(c.fecha_hora AS DATE) = @fecha", []interface{}{sql.Named("fecha", fecha)}, true
+}
+
 func nullStringToString(ns sql.NullString) string {
 	if ns.Valid {
 		return ns.String
@@ -508,23 +834,22 @@ func nullStringToString(ns sql.NullString) string {
 }
 
 func ListarCitasInvitados(c *gin.Context) {
-	rol, _ := c.Get("rol")
-	if rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "No autorizado"})
+	var citasInvitados []map[string]interface{}
+
+	dia, filtroFecha, args, ok := filtroFechaCitas(c)
+	if !ok {
 		return
 	}
 
-	var citasInvitados []map[string]interface{}
-
 	queryInvitados := `
 		SELECT c.id, c.fecha_hora, c.estado, c.servicio_id, 
 		       c.nombre_invitado, c.cedula_invitado, c.telefono_invitado
 		FROM citas c
-		WHERE c.usuario_id IS NULL
+		WHERE c.usuario_id IS NULL` + filtroFecha + `
 		ORDER BY c.fecha_hora DESC
 	`
 
-	rowsInvitados, err := dto.DB.Query(queryInvitados)
+	rowsInvitados, err := dto.DB.Query(queryInvitados, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener citas de invitados"})
 		return
@@ -558,11 +883,18 @@ func ListarCitasInvitados(c *gin.Context) {
 		citasInvitados = append(citasInvitados, cita)
 	}
 
+	if filtroFecha != "" {
+		responderConTurnos(c, dia, citasInvitados)
+		return
+	}
 	c.JSON(http.StatusOK, citasInvitados)
 }
 
 func CancelarCitaConMotivo(c *gin.Context) {
-	id := c.Param("id")
+	citaID, ok := citaIDParam(c)
+	if !ok || !autorizarCita(c, int(citaID)) {
+		return
+	}
 
 	// Leer el motivo del cuerpo del request
 	var datos struct {
@@ -573,30 +905,33 @@ func CancelarCitaConMotivo(c *gin.Context) {
 		return
 	}
 
-	// Verificar que la cita exista y esté pendiente o confirmada
-	var estado string
-	err := dto.DB.QueryRow("SELECT estado FROM citas WHERE id = @id", sql.Named("id", id)).Scan(&estado)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
-		return
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
-		return
-	}
-	if estado != "pendiente" && estado != "confirmada" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Solo se pueden cancelar citas pendientes o confirmadas"})
-		return
+	// El cliente cancela con la anticipación que fije la política; quien puede editar
+	// cualquier cita y el empleado asignado no tienen ese límite.
+	if !tienePermiso(c, PermisoCitasEditar) {
+		var fechaHora time.Time
+		var clienteID sql.NullInt32
+		err := dto.DB.QueryRow("SELECT fecha_hora, usuario_id FROM citas WHERE id = @id", sql.Named("id", citaID)).
+			Scan(&fechaHora, &clienteID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+			return
+		}
+		if clienteID.Valid && int(clienteID.Int32) == usuarioDeContexto(c) {
+			politica, err := ObtenerPoliticaCitas()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar la política de citas"})
+				return
+			}
+			if relojLocal(fechaHora).Sub(relojLocal(time.Now())) < politica.AnticipacionMinima() {
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Solo puede cancelar con al menos %dh de antelación", politica.AnticipacionMinimaHoras)})
+				return
+			}
+		}
 	}
 
-	// Cancelar cita y registrar el motivo
-	_, err = dto.DB.Exec(
-		"UPDATE citas SET estado = @estado, cancelacion_motivo = @motivo, actualizado_en = GETDATE() WHERE id = @id",
-		sql.Named("estado", "cancelada"),
-		sql.Named("motivo", datos.Motivo),
-		sql.Named("id", id),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo cancelar la cita"})
+	// La máquina de estados solo permite cancelar citas pendientes o confirmadas
+	if err := cancelarCitaConMotivo(citaID, actorDeContexto(c), datos.Motivo); err != nil {
+		responderErrorTransicion(c, err)
 		return
 	}
 
@@ -606,6 +941,18 @@ func CancelarCitaConMotivo(c *gin.Context) {
 	})
 }
 
+// cancelarCitaConMotivo pasa la cita a cancelada y guarda el motivo en la misma transacción.
+func cancelarCitaConMotivo(citaID int32, actor ActorCita, motivo string) error {
+	_, err := CambiarEstadoCita(citaID, EstadoCancelada, actor, motivo, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE citas SET cancelacion_motivo = @motivo WHERE id = @id",
+			sql.Named("motivo", motivo),
+			sql.Named("id", citaID),
+		)
+		return err
+	})
+	return err
+}
+
 func ObtenerUltimaCitaInvitado(c *gin.Context) {
 	cedula := c.Param("cedula")
 
@@ -718,34 +1065,16 @@ func ObtenerCitasPorCedulaInvitado(c *gin.Context) {
 	c.JSON(http.StatusOK, citas)
 }
 
-// FinalizarCita - Cambiar estado de cita a finalizada (solo admin/empleado)
+// FinalizarCita - Cambiar estado de cita a finalizada
 func FinalizarCita(c *gin.Context) {
-	rol, _ := c.Get("rol")
-	if rol != "admin" && rol != "empleado" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y empleados pueden finalizar citas"})
-		return
-	}
-
-	citaID := c.Param("id")
-
-	// Verificar que la cita esté confirmada
-	var estadoActual string
-	err := dto.DB.QueryRow("SELECT estado FROM citas WHERE id = @id", sql.Named("id", citaID)).Scan(&estadoActual)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+	citaID, ok := citaIDParam(c)
+	if !ok || !autorizarCita(c, int(citaID)) {
 		return
 	}
 
-	if estadoActual != "confirmada" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Solo se pueden finalizar citas confirmadas"})
-		return
-	}
-
-	// Actualizar estado a finalizada
-	_, err = dto.DB.Exec("UPDATE citas SET estado = 'finalizada', actualizado_en = GETDATE() WHERE id = @id", sql.Named("id", citaID))
-	if err != nil {
-		fmt.Printf("Error al finalizar cita: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al finalizar cita"})
+	// Solo citas confirmadas o atendidas pueden finalizarse
+	if _, err := CambiarEstadoCita(citaID, EstadoFinalizada, actorDeContexto(c), "", nil); err != nil {
+		responderErrorTransicion(c, err)
 		return
 	}
 
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// esperarHorarioSalon simula un servicio de una hora y un día normal de 8:00 a 18:00.
+func esperarHorarioSalon(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(consulta("SELECT duracion_minutos, buffer_minutos FROM servicios WHERE id = @id")).
+		WillReturnRows(sqlmock.NewRows([]string{"duracion_minutos", "buffer_minutos"}).AddRow(60, 15))
+	mock.ExpectQuery(consulta("FROM dias_especiales")).
+		WillReturnRows(sqlmock.NewRows([]string{"abierto", "hora_apertura", "hora_cierre", "tipo", "motivo"}))
+	mock.ExpectQuery(consulta("FROM horario_salon WHERE dia_semana = @dia")).
+		WillReturnRows(sqlmock.NewRows([]string{"abierto", "hora_apertura", "hora_cierre"}).
+			AddRow(true, time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC), time.Date(0, 1, 1, 18, 0, 0, 0, time.UTC)))
+}
+
+func esperarCitaPendiente(mock sqlmock.Sqlmock, fechaHora time.Time, empleado any) {
+	mock.ExpectQuery(consulta("SELECT id, estado, servicio_id, fecha_hora, usuario_id, empleado_id FROM citas WHERE id = @id")).
+		WithArgs(sql.Named("id", "7")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "estado", "servicio_id", "fecha_hora", "usuario_id", "empleado_id"}).
+			AddRow(7, EstadoPendiente, 2, fechaHora, 30, empleado))
+}
+
+// Mañana a la hora indicada, en el reloj del salón.
+func manana(hora, minuto int) time.Time {
+	d := time.Now().AddDate(0, 0, 1)
+	return time.Date(d.Year(), d.Month(), d.Day(), hora, minuto, 0, 0, time.UTC)
+}
+
+// Pedir una estrategia para una cita que ya tiene empleado es un conflicto, no se ignora.
+func TestConfirmarCitaEstrategiaConEmpleado(t *testing.T) {
+	mock := baseSimulada(t)
+	esperarCitaPendiente(mock, manana(10, 0), 20)
+	esperarHorarioSalon(mock)
+
+	w := ejecutar(sesionAdmin, http.MethodPut, "/citas/:id/confirmar", "/citas/7/confirmar", `{"estrategia":"menor_carga"}`, ConfirmarCita)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("código %d, se esperaba 409: %s", w.Code, w.Body)
+	}
+}
+
+// Si no se puede leer el nombre del empleado asignado, la cita no se confirma a medias.
+func TestConfirmarCitaErrorNombreEmpleado(t *testing.T) {
+	mock := baseSimulada(t)
+	esperarCitaPendiente(mock, manana(10, 0), 20)
+	esperarHorarioSalon(mock)
+	mock.ExpectQuery(consulta("SELECT nombre FROM usuarios WHERE id = @id")).
+		WithArgs(sql.Named("id", int32(20))).
+		WillReturnError(errors.New("conexión perdida"))
+
+	w := ejecutar(sesionAdmin, http.MethodPut, "/citas/:id/confirmar", "/citas/7/confirmar", "", ConfirmarCita)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("código %d, se esperaba 500: %s", w.Code, w.Body)
+	}
+}
+
+// Confirmar no deja pasar una cita que ya no cabe en el horario del salón.
+func TestConfirmarCitaFueraDeHorario(t *testing.T) {
+	mock := baseSimulada(t)
+	esperarCitaPendiente(mock, manana(17, 30), nil)
+	esperarHorarioSalon(mock)
+
+	w := ejecutar(sesionAdmin, http.MethodPut, "/citas/:id/confirmar", "/citas/7/confirmar", "", ConfirmarCita)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("código %d, se esperaba 409: %s", w.Code, w.Body)
+	}
+}
+
+// Editar una cita activa fuera del horario del salón se rechaza antes de escribir.
+func TestActualizarCitaFueraDeHorario(t *testing.T) {
+	mock := baseSimulada(t)
+	esperarHorarioSalon(mock)
+
+	cuerpo := `{"servicio_id":2,"fecha_hora":"` + manana(6, 0).Format(time.RFC3339) + `","estado":"confirmada"}`
+	w := ejecutar(sesionAdmin, http.MethodPut, "/citas/:id", "/citas/7", cuerpo, ActualizarCita)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("código %d, se esperaba 409: %s", w.Code, w.Body)
+	}
+}
+
+// La disponibilidad se verifica con la agenda del día ya bloqueada dentro de la
+// transacción del INSERT; si no hay espacio, la transacción se descarta.
+func TestCrearCitaInvitadoBloqueaAgenda(t *testing.T) {
+	mock := baseSimulada(t)
+	fecha := manana(10, 0)
+	dia := time.Date(fecha.Year(), fecha.Month(), fecha.Day(), 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(consulta("SELECT COUNT(*) FROM citas WITH (UPDLOCK, HOLDLOCK)")).
+		WithArgs(sql.Named("desde", dia), sql.Named("hasta", dia.AddDate(0, 0, 1))).
+		WillReturnRows(sqlmock.NewRows([]string{"citas"}).AddRow(3))
+	mock.ExpectQuery(consulta("SELECT duracion_minutos, buffer_minutos FROM servicios WHERE id = @id")).
+		WillReturnRows(sqlmock.NewRows([]string{"duracion_minutos", "buffer_minutos"}))
+	mock.ExpectRollback()
+
+	cuerpo := `{"nombre_invitado":"Ana","cedula_invitado":"112345678","telefono_invitado":"88887777","servicio_id":99,"fecha_hora":"` +
+		fecha.Format("2006-01-02T15:04:05") + `"}`
+	w := ejecutar(sesionPrueba{}, http.MethodPost, "/citas/invitado", "/citas/invitado", cuerpo, CrearCitaInvitado)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("código %d, se esperaba 400: %s", w.Code, w.Body)
+	}
+}
+
+// Un cliente con el correo sin confirmar no reserva.
+func TestCrearCitaCorreoSinVerificar(t *testing.T) {
+	mock := baseSimulada(t)
+	mock.ExpectQuery(consulta("correo_verificado_en IS NULL")).
+		WithArgs(sql.Named("id", sesionCliente.usuarioID)).
+		WillReturnRows(sqlmock.NewRows([]string{"verificado"}).AddRow(false))
+
+	cuerpo := `{"servicio_id":1,"fecha_hora":"` + manana(10, 0).Format(time.RFC3339) + `"}`
+	w := ejecutar(sesionCliente, http.MethodPost, "/citas", "/citas", cuerpo, CrearCita)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "confirme su correo") {
+		t.Fatalf("código %d, se esperaba 403 por correo sin verificar: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,35 @@
+// Envío de correos de la cuenta (verificación, restablecer contraseña). El proveedor
+// se inyecta con EnviadorCorreo; mientras no haya uno real, solo se escribe en el log.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnviadorCorreo abstrae el proveedor de correo.
+type EnviadorCorreo interface {
+	Enviar(destino, asunto, cuerpo string) error
+}
+
+// correoSimulado solo escribe el correo en el log, como smsSimulado.
+type correoSimulado struct{}
+
+func (correoSimulado) Enviar(destino, asunto, cuerpo string) error {
+	fmt.Printf("📧 Simulando correo a %s: %s\n%s\n", destino, asunto, cuerpo)
+	return nil
+}
+
+var enviadorCorreo EnviadorCorreo = correoSimulado{}
+
+// enlaceFrontend arma un enlace a la aplicación web (APP_URL, por defecto la de
+// desarrollo de Angular).
+func enlaceFrontend(ruta, token string) string {
+	base := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if base == "" {
+		base = "http://localhost:4200"
+	}
+	return fmt.Sprintf("%s/%s?token=%s", base, ruta, token)
+}
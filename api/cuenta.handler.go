@@ -0,0 +1,128 @@
+// Manejador de la cuenta: olvido y restablecimiento de contraseña, verificación del
+// correo y cambio de contraseña desde el perfil (ver cuenta.service.go).
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /password/olvido  {"correo": "..."}
+// Siempre responde lo mismo, exista o no la cuenta.
+func OlvidoContrasena(c *gin.Context) {
+	var input struct {
+		Correo string `json:"correo"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Correo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique el correo"})
+		return
+	}
+
+	// Un error aquí solo puede pasar con correos registrados: se registra y se responde
+	// lo mismo que a un correo desconocido, para no revelar cuáles tienen cuenta
+	if err := SolicitarRestablecimiento(input.Correo); err != nil {
+		fmt.Println("❌ Error al solicitar restablecimiento:", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Si el correo está registrado, le enviamos un enlace para restablecer la contraseña"})
+}
+
+// POST /password/restablecer  {"token": "...", "contrasena": "..."}
+func RestablecerContrasenaHandler(c *gin.Context) {
+	var input struct {
+		Token      string `json:"token"`
+		Contrasena string `json:"contrasena"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	err := RestablecerContrasena(input.Token, input.Contrasena)
+	switch {
+	case errors.Is(err, ErrContrasenaDebil), errors.Is(err, ErrTokenCuenta):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al restablecer contraseña:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo restablecer la contraseña"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Contraseña actualizada. Inicie sesión con la contraseña nueva"})
+}
+
+// POST /correo/verificar  {"token": "..."}
+func VerificarCorreoHandler(c *gin.Context) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique el token"})
+		return
+	}
+
+	err := VerificarCorreo(input.Token)
+	switch {
+	case errors.Is(err, ErrTokenCuenta):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al verificar correo:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo verificar el correo"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Correo verificado"})
+}
+
+// POST /correo/verificacion
+// Reenvía el enlace de verificación al correo del usuario autenticado.
+func ReenviarVerificacionCorreo(c *gin.Context) {
+	err := EnviarVerificacionCorreo(usuarioDeContexto(c))
+	switch {
+	case errors.Is(err, ErrCorreoYaVerificado):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrUsuarioNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al reenviar verificación de correo:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo enviar el correo"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Le enviamos un enlace para verificar el correo"})
+}
+
+// PUT /mi-perfil/contrasena  {"contrasena_actual": "...", "contrasena_nueva": "..."}
+// Cierra todas las sesiones, también la actual.
+func CambiarContrasenaHandler(c *gin.Context) {
+	var input struct {
+		Actual string `json:"contrasena_actual"`
+		Nueva  string `json:"contrasena_nueva"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	err := CambiarContrasena(usuarioDeContexto(c), input.Actual, input.Nueva)
+	switch {
+	case errors.Is(err, ErrContrasenaDebil):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrContrasenaActual):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrUsuarioNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al cambiar contraseña:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo cambiar la contraseña"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Contraseña actualizada. Inicie sesión de nuevo"})
+}
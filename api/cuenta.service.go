@@ -0,0 +1,294 @@
+// Cuenta del usuario: verificación del correo al registrarse, restablecimiento de la
+// contraseña olvidada y cambio de contraseña. Los enlaces llevan un token de un solo
+// uso que vence; en la base solo queda su hash.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Tipos de token de cuenta
+const (
+	TokenVerificarCorreo = "verificar_correo"
+	TokenRestablecer     = "restablecer"
+)
+
+const (
+	duracionTokenVerificacion = 48 * time.Hour
+	duracionTokenRestablecer  = time.Hour
+	minimoContrasena          = 8
+)
+
+var (
+	ErrTokenCuenta        = errors.New("el enlace no es válido, ya se usó o venció")
+	ErrContrasenaDebil    = fmt.Errorf("la contraseña debe tener al menos %d caracteres", minimoContrasena)
+	ErrContrasenaActual   = errors.New("la contraseña actual no es correcta")
+	ErrCorreoYaVerificado = errors.New("el correo ya está verificado")
+	ErrCorreoSinVerificar = errors.New("confirme su correo antes de reservar; puede reenviar el enlace desde su perfil")
+	ErrUsuarioNoExiste    = errors.New("el usuario no existe")
+)
+
+func validarContrasena(contrasena string) error {
+	if utf8.RuneCountInString(contrasena) < minimoContrasena {
+		return ErrContrasenaDebil
+	}
+	return nil
+}
+
+// EnviarVerificacionCorreo manda (o reenvía) el enlace para confirmar el correo. Los
+// enlaces anteriores sin usar dejan de servir.
+func EnviarVerificacionCorreo(usuarioID int) error {
+	var nombre, correo string
+	var verificado sql.NullTime
+	err := dto.DB.QueryRow("SELECT nombre, correo, correo_verificado_en FROM usuarios WHERE id = @id", sql.Named("id", usuarioID)).
+		Scan(&nombre, &correo, &verificado)
+	if err == sql.ErrNoRows {
+		return ErrUsuarioNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar usuario: %w", err)
+	}
+	if verificado.Valid {
+		return ErrCorreoYaVerificado
+	}
+
+	token, err := crearTokenCuenta(usuarioID, TokenVerificarCorreo, correo, duracionTokenVerificacion)
+	if err != nil {
+		return err
+	}
+	cuerpo := fmt.Sprintf("Hola %s:\n\nConfirme su correo con este enlace (vence en %d horas):\n%s",
+		nombre, int(duracionTokenVerificacion/time.Hour), enlaceFrontend("verificar-correo", token))
+	return enviadorCorreo.Enviar(correo, "Confirme su correo", cuerpo)
+}
+
+// correoVerificado indica si el usuario ya confirmó su correo. Un cliente sin confirmar
+// no reserva citas: los avisos de la cita van a ese correo.
+func correoVerificado(usuarioID int) (bool, error) {
+	var verificado bool
+	err := dto.DB.QueryRow("SELECT CAST(CASE WHEN correo_verificado_en IS NULL THEN 0 ELSE 1 END AS BIT) FROM usuarios WHERE id = @id",
+		sql.Named("id", usuarioID)).Scan(&verificado)
+	if err == sql.ErrNoRows {
+		return false, ErrUsuarioNoExiste
+	} else if err != nil {
+		return false, fmt.Errorf("consultar usuario: %w", err)
+	}
+	return verificado, nil
+}
+
+// VerificarCorreo consume el token y marca el correo como verificado.
+func VerificarCorreo(token string) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	ahora := time.Now().UTC()
+	usuarioID, err := consumirTokenCuenta(tx, token, TokenVerificarCorreo, ahora)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE usuarios SET correo_verificado_en = @ahora WHERE id = @id AND correo_verificado_en IS NULL",
+		sql.Named("ahora", ahora), sql.Named("id", usuarioID)); err != nil {
+		return fmt.Errorf("marcar correo verificado: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// SolicitarRestablecimiento envía el enlace para elegir una contraseña nueva. Si el
+// correo no está registrado no hace nada y no lo avisa, para no revelar qué correos
+// tienen cuenta.
+func SolicitarRestablecimiento(correo string) error {
+	correo = strings.TrimSpace(correo)
+	var usuarioID int
+	var nombre string
+	err := dto.DB.QueryRow("SELECT id, nombre FROM usuarios WHERE correo = @correo AND desactivado_en IS NULL", sql.Named("correo", correo)).
+		Scan(&usuarioID, &nombre)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("consultar usuario: %w", err)
+	}
+
+	token, err := crearTokenCuenta(usuarioID, TokenRestablecer, correo, duracionTokenRestablecer)
+	if err != nil {
+		return err
+	}
+	cuerpo := fmt.Sprintf("Hola %s:\n\nPara elegir una contraseña nueva abra este enlace (vence en %d minutos):\n%s\n\nSi no lo pidió, ignore este correo.",
+		nombre, int(duracionTokenRestablecer/time.Minute), enlaceFrontend("restablecer-contrasena", token))
+	return enviadorCorreo.Enviar(correo, "Restablecer contraseña", cuerpo)
+}
+
+// RestablecerContrasena consume el token, guarda la contraseña nueva y cierra todas
+// las sesiones abiertas. Como el enlace llegó al correo, también queda verificado.
+func RestablecerContrasena(token, nueva string) error {
+	if err := validarContrasena(nueva); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(nueva), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("encriptar contraseña: %w", err)
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	ahora := time.Now().UTC()
+	usuarioID, err := consumirTokenCuenta(tx, token, TokenRestablecer, ahora)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE usuarios
+		SET contrasena = @hash, correo_verificado_en = COALESCE(correo_verificado_en, @ahora)
+		WHERE id = @id`,
+		sql.Named("hash", string(hash)),
+		sql.Named("ahora", ahora),
+		sql.Named("id", usuarioID),
+	)
+	if err != nil {
+		return fmt.Errorf("guardar contraseña: %w", err)
+	}
+	// Un enlace de restablecimiento sirve una vez: los demás pendientes se anulan
+	if _, err := tx.Exec("UPDATE tokens_cuenta SET usado_en = @ahora WHERE usuario_id = @id AND tipo = @tipo AND usado_en IS NULL",
+		sql.Named("ahora", ahora), sql.Named("id", usuarioID), sql.Named("tipo", TokenRestablecer)); err != nil {
+		return fmt.Errorf("anular enlaces pendientes: %w", err)
+	}
+	if err := revocarTodasLasSesiones(tx, usuarioID, ahora); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// CambiarContrasena pide la contraseña actual y, al cambiarla, cierra todas las
+// sesiones, también la de quien la cambió: debe volver a iniciar sesión.
+func CambiarContrasena(usuarioID int, actual, nueva string) error {
+	if err := validarContrasena(nueva); err != nil {
+		return err
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var hashActual string
+	err = tx.QueryRow("SELECT contrasena FROM usuarios WITH (UPDLOCK, ROWLOCK) WHERE id = @id", sql.Named("id", usuarioID)).Scan(&hashActual)
+	if err == sql.ErrNoRows {
+		return ErrUsuarioNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar usuario: %w", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashActual), []byte(actual)) != nil {
+		return ErrContrasenaActual
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(nueva), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("encriptar contraseña: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE usuarios SET contrasena = @hash WHERE id = @id",
+		sql.Named("hash", string(hash)), sql.Named("id", usuarioID)); err != nil {
+		return fmt.Errorf("guardar contraseña: %w", err)
+	}
+	if err := revocarTodasLasSesiones(tx, usuarioID, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// crearTokenCuenta anula los tokens pendientes del mismo tipo y guarda uno nuevo.
+func crearTokenCuenta(usuarioID int, tipo, correo string, duracion time.Duration) (string, error) {
+	token, err := aleatorioHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	ahora := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE tokens_cuenta SET expira_en = @ahora WHERE usuario_id = @id AND tipo = @tipo AND usado_en IS NULL AND expira_en > @ahora",
+		sql.Named("ahora", ahora), sql.Named("id", usuarioID), sql.Named("tipo", tipo)); err != nil {
+		return "", fmt.Errorf("anular enlaces anteriores: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO tokens_cuenta (usuario_id, tipo, token_hash, correo, expira_en, creado_en)
+		VALUES (@usuario_id, @tipo, @hash, @correo, @expira, @ahora)`,
+		sql.Named("usuario_id", usuarioID),
+		sql.Named("tipo", tipo),
+		sql.Named("hash", hashToken(token)),
+		sql.Named("correo", correo),
+		sql.Named("expira", ahora.Add(duracion)),
+		sql.Named("ahora", ahora),
+	)
+	if err != nil {
+		return "", fmt.Errorf("guardar token de cuenta: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return token, nil
+}
+
+// consumirTokenCuenta valida el token (tipo, sin usar, vigente y enviado al correo que
+// el usuario tiene hoy) y lo marca como usado. Devuelve el usuario.
+func consumirTokenCuenta(tx *sql.Tx, token, tipo string, ahora time.Time) (int, error) {
+	if token == "" {
+		return 0, ErrTokenCuenta
+	}
+	var id, usuarioID int
+	var usadoEn sql.NullTime
+	var expiraEn time.Time
+	var correoToken, correoActual string
+	err := tx.QueryRow(`
+		SELECT t.id, t.usuario_id, t.usado_en, t.expira_en, t.correo, u.correo
+		FROM tokens_cuenta t WITH (UPDLOCK, ROWLOCK)
+		JOIN usuarios u ON u.id = t.usuario_id
+		WHERE t.token_hash = @hash AND t.tipo = @tipo`,
+		sql.Named("hash", hashToken(token)),
+		sql.Named("tipo", tipo),
+	).Scan(&id, &usuarioID, &usadoEn, &expiraEn, &correoToken, &correoActual)
+	if err == sql.ErrNoRows {
+		return 0, ErrTokenCuenta
+	} else if err != nil {
+		return 0, fmt.Errorf("consultar token de cuenta: %w", err)
+	}
+	// Si el correo cambió después de enviar el enlace, el enlace ya no vale
+	if usadoEn.Valid || !ahora.Before(expiraEn) || !strings.EqualFold(correoToken, correoActual) {
+		return 0, ErrTokenCuenta
+	}
+
+	if _, err := tx.Exec("UPDATE tokens_cuenta SET usado_en = @ahora WHERE id = @id", sql.Named("ahora", ahora), sql.Named("id", id)); err != nil {
+		return 0, fmt.Errorf("marcar token de cuenta: %w", err)
+	}
+	return usuarioID, nil
+}
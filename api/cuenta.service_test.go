@@ -0,0 +1,140 @@
+package api
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const sqlTokenCuenta = "FROM tokens_cuenta t WITH (UPDLOCK, ROWLOCK)"
+
+var columnasTokenCuenta = []string{"id", "usuario_id", "usado_en", "expira_en", "correo", "correo"}
+
+// El enlace sirve una sola vez, antes de vencer y para el correo al que se envió.
+func TestVerificarCorreoToken(t *testing.T) {
+	vigente := time.Now().Add(time.Hour)
+	casos := []struct {
+		nombre string
+		fila   []driver.Value // nil: el token no existe
+		valido bool
+	}{
+		{"vigente", []driver.Value{5, 30, nil, vigente, "ana@correo.com", "ana@correo.com"}, true},
+		{"correo con otras mayúsculas", []driver.Value{5, 30, nil, vigente, "Ana@Correo.com", "ana@correo.com"}, true},
+		{"ya usado", []driver.Value{5, 30, time.Now().Add(-time.Minute), vigente, "ana@correo.com", "ana@correo.com"}, false},
+		{"vencido", []driver.Value{5, 30, nil, time.Now().Add(-time.Minute), "ana@correo.com", "ana@correo.com"}, false},
+		{"correo cambiado", []driver.Value{5, 30, nil, vigente, "ana@correo.com", "ana.nueva@correo.com"}, false},
+		{"no existe", nil, false},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			mock := baseSimulada(t)
+			mock.ExpectBegin()
+			filas := sqlmock.NewRows(columnasTokenCuenta)
+			if tc.fila != nil {
+				filas.AddRow(tc.fila...)
+			}
+			mock.ExpectQuery(consulta(sqlTokenCuenta)).
+				WithArgs(sql.Named("hash", hashToken("abc")), sql.Named("tipo", TokenVerificarCorreo)).
+				WillReturnRows(filas)
+			if tc.valido {
+				mock.ExpectExec(consulta("UPDATE tokens_cuenta SET usado_en = @ahora WHERE id = @id")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(consulta("UPDATE usuarios SET correo_verificado_en = @ahora")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err := VerificarCorreo("abc")
+			if tc.valido && err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+			if !tc.valido && !errors.Is(err, ErrTokenCuenta) {
+				t.Fatalf("error %v, se esperaba ErrTokenCuenta", err)
+			}
+		})
+	}
+}
+
+// Un enlace de restablecimiento ya usado no cambia la contraseña.
+func TestRestablecerContrasenaTokenUsado(t *testing.T) {
+	mock := baseSimulada(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(consulta(sqlTokenCuenta)).
+		WithArgs(sql.Named("hash", hashToken("abc")), sql.Named("tipo", TokenRestablecer)).
+		WillReturnRows(sqlmock.NewRows(columnasTokenCuenta).
+			AddRow(5, 30, time.Now().Add(-time.Minute), time.Now().Add(time.Hour), "ana@correo.com", "ana@correo.com"))
+	mock.ExpectRollback()
+
+	if err := RestablecerContrasena("abc", "una contraseña larga"); !errors.Is(err, ErrTokenCuenta) {
+		t.Fatalf("error %v, se esperaba ErrTokenCuenta", err)
+	}
+}
+
+func TestRestablecerContrasenaDebil(t *testing.T) {
+	baseSimulada(t)
+	if err := RestablecerContrasena("abc", "corta"); !errors.Is(err, ErrContrasenaDebil) {
+		t.Fatalf("error %v, se esperaba ErrContrasenaDebil", err)
+	}
+}
+
+// El registro rechaza la contraseña corta antes de tocar la base.
+func TestRegistrarUsuarioContrasenaDebil(t *testing.T) {
+	baseSimulada(t)
+	cuerpo := `{"nombre":"Ana","correo":"ana@correo.com","cedula":"101110111","telefono":"88888888","contrasena":"corta"}`
+	w := ejecutar(sesionPrueba{}, http.MethodPost, "/registro", "/registro", cuerpo, RegistrarUsuario)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrContrasenaDebil.Error()) {
+		t.Fatalf("código %d, se esperaba 400 por contraseña débil: %s", w.Code, w.Body)
+	}
+
+	cuerpo = `{"nombre":"Ana","correo":"ana@correo.com","cedula":"101110111","telefono":"88888888","contrasena":"corta","rol":"empleado"}`
+	w = ejecutar(sesionAdmin, http.MethodPost, "/admin/usuarios", "/admin/usuarios", cuerpo, RegistrarUsuarioComoAdmin)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrContrasenaDebil.Error()) {
+		t.Fatalf("código %d, se esperaba 400 por contraseña débil: %s", w.Code, w.Body)
+	}
+}
+
+// correoFallido simula un proveedor de correo caído.
+type correoFallido struct{}
+
+func (correoFallido) Enviar(string, string, string) error { return errors.New("proveedor caído") }
+
+// La respuesta es la misma si el correo no tiene cuenta o si tiene y el envío falla:
+// un 500 solo en el segundo caso revelaría qué correos están registrados.
+func TestOlvidoContrasenaNoRevelaCuentas(t *testing.T) {
+	anterior := enviadorCorreo
+	enviadorCorreo = correoFallido{}
+	t.Cleanup(func() { enviadorCorreo = anterior })
+
+	var respuestas []string
+	for _, registrado := range []bool{false, true} {
+		mock := baseSimulada(t)
+		filas := sqlmock.NewRows([]string{"id", "nombre"})
+		if registrado {
+			filas.AddRow(30, "Ana")
+		}
+		mock.ExpectQuery(consulta("SELECT id, nombre FROM usuarios WHERE correo = @correo")).WillReturnRows(filas)
+		if registrado {
+			mock.ExpectBegin()
+			mock.ExpectExec(consulta("UPDATE tokens_cuenta SET expira_en = @ahora")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(consulta("INSERT INTO tokens_cuenta")).WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+		}
+
+		w := ejecutar(sesionPrueba{}, http.MethodPost, "/password/olvido", "/password/olvido", `{"correo":"ana@correo.com"}`, OlvidoContrasena)
+		if w.Code != http.StatusOK {
+			t.Fatalf("registrado=%v: código %d, se esperaba 200: %s", registrado, w.Code, w.Body)
+		}
+		respuestas = append(respuestas, w.Body.String())
+	}
+	if respuestas[0] != respuestas[1] {
+		t.Errorf("respuestas distintas: %s / %s", respuestas[0], respuestas[1])
+	}
+}
@@ -0,0 +1,72 @@
+// Consulta pública de horarios disponibles para el selector de citas del frontend.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /disponibilidad?servicio_id=1&fecha=YYYY-MM-DD[&empleado_id=3]
+func ConsultarDisponibilidad(c *gin.Context) {
+	servicioID, err := strconv.Atoi(c.Query("servicio_id"))
+	if err != nil || servicioID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "servicio_id es obligatorio"})
+		return
+	}
+
+	fecha, err := time.Parse("2006-01-02", c.Query("fecha"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+		return
+	}
+
+	consulta := ConsultaDisponibilidad{ServicioID: int32(servicioID), Fecha: fecha}
+	if empleadoStr := c.Query("empleado_id"); empleadoStr != "" {
+		empleadoID, err := strconv.Atoi(empleadoStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "empleado_id inválido"})
+			return
+		}
+		id := int32(empleadoID)
+		consulta.EmpleadoID = &id
+	}
+
+	disponibilidad, err := CalcularDisponibilidad(consulta)
+	if err != nil {
+		responderErrorDisponibilidad(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, disponibilidad)
+}
+
+// responderErrorDisponibilidad traduce los errores del motor de disponibilidad a respuestas HTTP.
+func responderErrorDisponibilidad(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrHorarioNoDisponible):
+		c.JSON(http.StatusConflict, gin.H{"error": "El horario solicitado no está disponible"})
+	case errors.Is(err, ErrSalonCerrado):
+		c.JSON(http.StatusConflict, gin.H{"error": "El salón está cerrado ese día"})
+	case errors.Is(err, ErrFueraDeHorarioSalon):
+		c.JSON(http.StatusConflict, gin.H{"error": "La cita queda fuera del horario de atención del salón"})
+	case errors.Is(err, ErrTraslapeCita):
+		c.JSON(http.StatusConflict, gin.H{"error": "El empleado ya tiene una cita que se traslapa con ese horario"})
+	case errors.Is(err, ErrEmpleadoFueraDeTurno):
+		c.JSON(http.StatusConflict, gin.H{"error": "El empleado no está en turno en ese horario"})
+	case errors.Is(err, ErrEmpleadoAusente):
+		c.JSON(http.StatusConflict, gin.H{"error": "El empleado tiene una ausencia aprobada ese día"})
+	case errors.Is(err, ErrServicioNoExiste):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El servicio no existe"})
+	case errors.Is(err, ErrEmpleadoNoExiste):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El empleado no existe"})
+	default:
+		fmt.Println("❌ Error al calcular disponibilidad:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al calcular disponibilidad"})
+	}
+}
@@ -0,0 +1,367 @@
+// Motor de disponibilidad: calcula los espacios libres por servicio, día y empleado
+// a partir del horario de atención, las citas existentes y la duración del servicio.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+const (
+	// Horario por defecto mientras no se configure horario_salon
+	horaApertura = 8
+	horaCierre   = 18
+
+	intervaloSlot = 30 * time.Minute
+)
+
+var (
+	ErrHorarioNoDisponible = errors.New("el horario solicitado no está disponible")
+	ErrServicioNoExiste    = errors.New("el servicio no existe")
+	ErrEmpleadoNoExiste    = errors.New("el empleado no existe")
+	ErrTraslapeCita        = errors.New("el empleado tiene otra cita activa en ese intervalo")
+)
+
+// Slot es un espacio de tiempo en el que se puede agendar el servicio consultado.
+type Slot struct {
+	Inicio    time.Time `json:"inicio"`
+	Fin       time.Time `json:"fin"`
+	Hora      string    `json:"hora"`
+	Empleados []int32   `json:"empleados_disponibles"`
+}
+
+type EmpleadoDisponible struct {
+	ID     int32  `json:"id"`
+	Nombre string `json:"nombre"`
+}
+
+// ConsultaDisponibilidad agrupa los filtros del cálculo. EmpleadoID es opcional y
+// ExcluirCitaID permite ignorar la propia cita cuando se está modificando.
+type ConsultaDisponibilidad struct {
+	ServicioID    int32
+	Fecha         time.Time
+	EmpleadoID    *int32
+	ExcluirCitaID int32
+}
+
+type Disponibilidad struct {
+	ServicioID      int32                `json:"servicio_id"`
+	Fecha           string               `json:"fecha"`
+	DuracionMinutos int                  `json:"duracion_minutos"`
+	BufferMinutos   int                  `json:"buffer_minutos"`
+	Horario         HorarioDia           `json:"horario"`
+	Empleados       []EmpleadoDisponible `json:"empleados"`
+	Slots           []Slot               `json:"slots"`
+}
+
+// ocupacion representa el intervalo que bloquea una cita activa (duración + limpieza).
+type ocupacion struct {
+	empleadoID sql.NullInt32
+	inicio     time.Time
+	fin        time.Time
+}
+
+// relojLocal descarta la zona horaria y conserva la hora de pared, que es como
+// se guarda fecha_hora (DATETIME) en la base de datos.
+func relojLocal(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+func inicioDelDia(t time.Time) time.Time {
+	t = relojLocal(t)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// CalcularDisponibilidad devuelve los slots libres del servicio para el día consultado.
+func CalcularDisponibilidad(q ConsultaDisponibilidad) (*Disponibilidad, error) {
+	dia := inicioDelDia(q.Fecha)
+
+	duracion, buffer, err := tiemposServicio(q.ServicioID)
+	if err != nil {
+		return nil, err
+	}
+
+	empleados, err := empleadosActivos()
+	if err != nil {
+		return nil, err
+	}
+	if q.EmpleadoID != nil && !contieneEmpleado(empleados, *q.EmpleadoID) {
+		return nil, ErrEmpleadoNoExiste
+	}
+
+	ocupaciones, err := ocupacionesDelDia(dia, q.ExcluirCitaID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int32, 0, len(empleados))
+	for _, e := range empleados {
+		ids = append(ids, e.ID)
+	}
+	jornadas, err := jornadasDelDia(dia, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Solo se ofrecen los empleados que trabajan ese día
+	var agendas []agendaEmpleado
+	enTurno := []EmpleadoDisponible{}
+	for _, e := range empleados {
+		if len(jornadas[e.ID].turnos) == 0 {
+			continue
+		}
+		agendas = append(agendas, agendaEmpleado{id: e.ID, jornada: jornadas[e.ID]})
+		enTurno = append(enTurno, e)
+	}
+	if len(empleados) > 0 && agendas == nil {
+		agendas = []agendaEmpleado{}
+	}
+
+	horario, err := HorarioDelDia(dia)
+	if err != nil {
+		return nil, err
+	}
+
+	disponibilidad := &Disponibilidad{
+		ServicioID:      q.ServicioID,
+		Fecha:           dia.Format("2006-01-02"),
+		DuracionMinutos: int(duracion / time.Minute),
+		BufferMinutos:   int(buffer / time.Minute),
+		Horario:         horario,
+		Empleados:       enTurno,
+		Slots:           []Slot{},
+	}
+
+	if !horario.Abierto {
+		return disponibilidad, nil
+	}
+	disponibilidad.Slots = calcularSlots(horario.jornada.inicio, horario.jornada.fin, duracion, buffer, agendas, q.EmpleadoID, ocupaciones, relojLocal(time.Now()))
+
+	return disponibilidad, nil
+}
+
+// agendaEmpleado une a un empleado con su jornada del día.
+type agendaEmpleado struct {
+	id      int32
+	jornada jornadaEmpleado
+}
+
+// VerificarDisponibilidad confirma que fechaHora coincide con un slot libre.
+// Devuelve ErrSalonCerrado si el salón no abre ese día y ErrHorarioNoDisponible
+// si la hora no está libre.
+func VerificarDisponibilidad(q ConsultaDisponibilidad, fechaHora time.Time) error {
+	fechaHora = relojLocal(fechaHora)
+	q.Fecha = fechaHora
+
+	disponibilidad, err := CalcularDisponibilidad(q)
+	if err != nil {
+		return err
+	}
+	if !disponibilidad.Horario.Abierto {
+		return ErrSalonCerrado
+	}
+
+	for _, slot := range disponibilidad.Slots {
+		if slot.Inicio.Equal(fechaHora) {
+			return nil
+		}
+	}
+	return ErrHorarioNoDisponible
+}
+
+// bloquearAgendaDia bloquea dentro de tx el rango de citas del día de fechaHora. Otra
+// reserva de ese día espera hasta el commit, así lo que VerificarDisponibilidad vio
+// libre sigue libre al insertar la cita.
+func bloquearAgendaDia(tx *sql.Tx, fechaHora time.Time) error {
+	dia := inicioDelDia(fechaHora)
+	var citas int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM citas WITH (UPDLOCK, HOLDLOCK)
+		WHERE fecha_hora >= @desde AND fecha_hora < @hasta`,
+		sql.Named("desde", dia),
+		sql.Named("hasta", dia.AddDate(0, 0, 1)),
+	).Scan(&citas)
+	if err != nil {
+		return fmt.Errorf("bloquear agenda del día: %w", err)
+	}
+	return nil
+}
+
+// calcularSlots recorre la jornada en intervalos fijos y conserva los espacios donde
+// queda al menos un empleado en turno y libre durante la duración más el tiempo de
+// limpieza. Las citas sin empleado asignado consumen capacidad aunque no bloqueen a
+// nadie en particular. Con agendas nil (no hay empleados registrados) el salón se
+// trata como una sola agenda.
+func calcularSlots(apertura, cierre time.Time, duracion, buffer time.Duration, agendas []agendaEmpleado, empleadoID *int32, ocupaciones []ocupacion, ahora time.Time) []Slot {
+	slots := []Slot{}
+
+	for inicio := apertura; !inicio.Add(duracion).After(cierre); inicio = inicio.Add(intervaloSlot) {
+		if inicio.Before(ahora) {
+			continue
+		}
+		fin := inicio.Add(duracion)
+		finBloqueo := fin.Add(buffer)
+
+		ocupados := map[int32]bool{}
+		sinAsignar := 0
+		for _, o := range ocupaciones {
+			if !o.inicio.Before(finBloqueo) || !o.fin.After(inicio) {
+				continue
+			}
+			if o.empleadoID.Valid {
+				ocupados[o.empleadoID.Int32] = true
+			} else {
+				sinAsignar++
+			}
+		}
+
+		if agendas == nil {
+			if len(ocupados) == 0 && sinAsignar == 0 {
+				slots = append(slots, Slot{Inicio: inicio, Fin: fin, Hora: inicio.Format("15:04"), Empleados: []int32{}})
+			}
+			continue
+		}
+
+		libres := []int32{}
+		for _, a := range agendas {
+			if !ocupados[a.id] && a.jornada.cubre(inicio, fin) {
+				libres = append(libres, a.id)
+			}
+		}
+		if len(libres)-sinAsignar <= 0 {
+			continue
+		}
+
+		if empleadoID != nil {
+			if !contieneID(libres, *empleadoID) {
+				continue
+			}
+			libres = []int32{*empleadoID}
+		}
+
+		slots = append(slots, Slot{Inicio: inicio, Fin: fin, Hora: inicio.Format("15:04"), Empleados: libres})
+	}
+
+	return slots
+}
+
+// VerificarTraslape rechaza el intervalo [fechaHora, fechaHora + duración + limpieza)
+// si se cruza con otra cita activa del mismo empleado. A diferencia de los slots no
+// exige horario de atención, por lo que sirve para los cambios manuales del admin.
+func VerificarTraslape(empleadoID, servicioID int32, fechaHora time.Time, excluirCitaID int32) error {
+	duracion, buffer, err := tiemposServicio(servicioID)
+	if err != nil {
+		return err
+	}
+
+	inicio := relojLocal(fechaHora)
+	fin := inicio.Add(duracion + buffer)
+
+	var traslapes int
+	err = dto.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM citas c
+		JOIN servicios s ON s.id = c.servicio_id
+		WHERE c.empleado_id = @empleado_id
+		  AND c.id <> @excluir
+		  AND c.estado IN ('pendiente', 'confirmada')
+		  AND c.fecha_hora < @fin
+		  AND DATEADD(MINUTE, s.duracion_minutos + s.buffer_minutos, c.fecha_hora) > @inicio`,
+		sql.Named("empleado_id", empleadoID),
+		sql.Named("excluir", excluirCitaID),
+		sql.Named("inicio", inicio),
+		sql.Named("fin", fin),
+	).Scan(&traslapes)
+	if err != nil {
+		return fmt.Errorf("consultar traslapes: %w", err)
+	}
+	if traslapes > 0 {
+		return ErrTraslapeCita
+	}
+	return nil
+}
+
+// tiemposServicio devuelve la duración y el tiempo de limpieza configurados del servicio.
+func tiemposServicio(servicioID int32) (time.Duration, time.Duration, error) {
+	var duracionMin, bufferMin int
+	err := dto.DB.QueryRow("SELECT duracion_minutos, buffer_minutos FROM servicios WHERE id = @id", sql.Named("id", servicioID)).
+		Scan(&duracionMin, &bufferMin)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrServicioNoExiste
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("consultar servicio: %w", err)
+	}
+	return time.Duration(duracionMin) * time.Minute, time.Duration(bufferMin) * time.Minute, nil
+}
+
+func empleadosActivos() ([]EmpleadoDisponible, error) {
+	rows, err := dto.DB.Query("SELECT id, nombre FROM usuarios WHERE rol = 'empleado' ORDER BY nombre")
+	if err != nil {
+		return nil, fmt.Errorf("consultar empleados: %w", err)
+	}
+	defer rows.Close()
+
+	empleados := []EmpleadoDisponible{}
+	for rows.Next() {
+		var e EmpleadoDisponible
+		if err := rows.Scan(&e.ID, &e.Nombre); err != nil {
+			return nil, fmt.Errorf("leer empleado: %w", err)
+		}
+		empleados = append(empleados, e)
+	}
+	return empleados, rows.Err()
+}
+
+func contieneID(ids []int32, id int32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func contieneEmpleado(empleados []EmpleadoDisponible, id int32) bool {
+	for _, e := range empleados {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ocupacionesDelDia carga las citas pendientes o confirmadas del día.
+func ocupacionesDelDia(dia time.Time, excluirCitaID int32) ([]ocupacion, error) {
+	rows, err := dto.DB.Query(`
+		SELECT c.empleado_id, c.fecha_hora, s.duracion_minutos + s.buffer_minutos
+		FROM citas c
+		JOIN servicios s ON s.id = c.servicio_id
+		WHERE c.fecha_hora >= @desde AND c.fecha_hora < @hasta
+		  AND c.estado IN ('pendiente', 'confirmada')
+		  AND c.id <> @excluir`,
+		sql.Named("desde", dia),
+		sql.Named("hasta", dia.AddDate(0, 0, 1)),
+		sql.Named("excluir", excluirCitaID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("consultar citas del día: %w", err)
+	}
+	defer rows.Close()
+
+	var ocupaciones []ocupacion
+	for rows.Next() {
+		var o ocupacion
+		var bloqueoMin int
+		if err := rows.Scan(&o.empleadoID, &o.inicio, &bloqueoMin); err != nil {
+			return nil, fmt.Errorf("leer cita: %w", err)
+		}
+		o.inicio = relojLocal(o.inicio)
+		o.fin = o.inicio.Add(time.Duration(bloqueoMin) * time.Minute)
+		ocupaciones = append(ocupaciones, o)
+	}
+	return ocupaciones, rows.Err()
+}
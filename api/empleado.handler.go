@@ -0,0 +1,95 @@
+// Manejador de las especialidades de cada empleado (servicios que domina).
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"restapi/dto"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ServiciosEmpleadoInput struct {
+	ServicioIDs []int32 `json:"servicio_ids"`
+}
+
+// GET /empleados/:id/servicios
+func ListarServiciosEmpleado(c *gin.Context) {
+	rows, err := dto.DB.Query(`
+		SELECT s.id, s.nombre
+		FROM empleado_servicios es
+		JOIN servicios s ON s.id = es.servicio_id
+		WHERE es.empleado_id = @empleado_id
+		ORDER BY s.nombre`,
+		sql.Named("empleado_id", c.Param("id")))
+	if err != nil {
+		fmt.Println("❌ Error al listar especialidades:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener especialidades"})
+		return
+	}
+	defer rows.Close()
+
+	servicios := []gin.H{}
+	for rows.Next() {
+		var id int
+		var nombre string
+		if err := rows.Scan(&id, &nombre); err != nil {
+			fmt.Println("❌ Error en Scan de especialidad:", err)
+			continue
+		}
+		servicios = append(servicios, gin.H{"servicio_id": id, "nombre": nombre})
+	}
+
+	c.JSON(http.StatusOK, servicios)
+}
+
+// PUT /empleados/:id/servicios reemplaza la lista completa de especialidades.
+func ActualizarServiciosEmpleado(c *gin.Context) {
+	empleadoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || !esEmpleado(int32(empleadoID)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El empleado no existe"})
+		return
+	}
+
+	var input ServiciosEmpleadoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al iniciar la transacción"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM empleado_servicios WHERE empleado_id = @empleado_id", sql.Named("empleado_id", empleadoID)); err != nil {
+		fmt.Println("❌ Error al limpiar especialidades:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar especialidades"})
+		return
+	}
+
+	for _, servicioID := range input.ServicioIDs {
+		_, err := tx.Exec(`
+			INSERT INTO empleado_servicios (empleado_id, servicio_id)
+			SELECT @empleado_id, id FROM servicios WHERE id = @servicio_id`,
+			sql.Named("empleado_id", empleadoID),
+			sql.Named("servicio_id", servicioID))
+		if err != nil {
+			fmt.Println("❌ Error al guardar especialidad:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar especialidades"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar especialidades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Especialidades actualizadas correctamente"})
+}
@@ -0,0 +1,190 @@
+// Máquina de estados de las citas: tabla central de transiciones permitidas y
+// registro de cada cambio en citas_historial.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+)
+
+const (
+	EstadoPendiente  = "pendiente"
+	EstadoConfirmada = "confirmada"
+	EstadoRechazada  = "rechazada"
+	EstadoCancelada  = "cancelada"
+	EstadoAtendida   = "atendida"
+	EstadoFinalizada = "finalizada"
+)
+
+// transicionesCita indica a qué estados puede pasar una cita desde cada estado.
+// Rechazada, cancelada y finalizada son finales.
+var transicionesCita = map[string][]string{
+	EstadoPendiente:  {EstadoConfirmada, EstadoRechazada, EstadoCancelada},
+	EstadoConfirmada: {EstadoAtendida, EstadoFinalizada, EstadoCancelada, EstadoPendiente},
+	EstadoAtendida:   {EstadoFinalizada},
+	EstadoRechazada:  {},
+	EstadoCancelada:  {},
+	EstadoFinalizada: {},
+}
+
+var (
+	ErrCitaNoExiste       = errors.New("la cita no existe")
+	ErrTransicionInvalida = errors.New("transición de estado no permitida")
+)
+
+// ErrorTransicion detalla una transición rechazada; errors.Is lo reconoce como ErrTransicionInvalida.
+type ErrorTransicion struct {
+	Desde string
+	Hacia string
+}
+
+func (e *ErrorTransicion) Error() string {
+	return fmt.Sprintf("no se puede pasar una cita de '%s' a '%s'", e.Desde, e.Hacia)
+}
+
+func (e *ErrorTransicion) Is(target error) bool {
+	return target == ErrTransicionInvalida
+}
+
+// ActorCita es quien provoca el cambio. ID vacío para invitados y procesos del sistema.
+type ActorCita struct {
+	ID  sql.NullInt32
+	Rol string
+}
+
+// ejecutorSQL lo cumplen tanto *sql.DB como *sql.Tx.
+type ejecutorSQL interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func EsEstadoCita(estado string) bool {
+	_, ok := transicionesCita[estado]
+	return ok
+}
+
+func PuedeTransicionar(desde, hacia string) bool {
+	for _, e := range transicionesCita[desde] {
+		if e == hacia {
+			return true
+		}
+	}
+	return false
+}
+
+// CambiarEstadoCita aplica la transición en su propia transacción. extra, si no es nil,
+// corre en la misma transacción para guardar los datos que acompañan al cambio
+// (empleado asignado, motivo de cancelación...). Devuelve el estado anterior.
+func CambiarEstadoCita(citaID int32, hacia string, actor ActorCita, motivo string, extra func(tx *sql.Tx) error) (string, error) {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	desde, err := TransicionarCita(tx, citaID, hacia, actor, motivo)
+	if err != nil {
+		return "", err
+	}
+	if extra != nil {
+		if err := extra(tx); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return desde, nil
+}
+
+// TransicionarCita bloquea la cita, valida el cambio contra la tabla de transiciones,
+// lo aplica y lo registra en el historial.
+func TransicionarCita(tx *sql.Tx, citaID int32, hacia string, actor ActorCita, motivo string) (string, error) {
+	var desde string
+	err := tx.QueryRow("SELECT estado FROM citas WITH (UPDLOCK, ROWLOCK) WHERE id = @id", sql.Named("id", citaID)).Scan(&desde)
+	if err == sql.ErrNoRows {
+		return "", ErrCitaNoExiste
+	} else if err != nil {
+		return "", fmt.Errorf("consultar estado de la cita: %w", err)
+	}
+
+	if !PuedeTransicionar(desde, hacia) {
+		return desde, &ErrorTransicion{Desde: desde, Hacia: hacia}
+	}
+
+	_, err = tx.Exec("UPDATE citas SET estado = @estado, actualizado_en = GETDATE() WHERE id = @id",
+		sql.Named("estado", hacia),
+		sql.Named("id", citaID),
+	)
+	if err != nil {
+		return "", fmt.Errorf("actualizar estado de la cita: %w", err)
+	}
+
+	if err := registrarHistorialCita(tx, citaID, sql.NullString{String: desde, Valid: true}, hacia, actor, motivo); err != nil {
+		return "", err
+	}
+	return desde, nil
+}
+
+// RegistrarCreacionCita deja la primera entrada del historial (sin estado anterior).
+func RegistrarCreacionCita(citaID int32, actor ActorCita) error {
+	return registrarHistorialCita(dto.DB, citaID, sql.NullString{}, EstadoPendiente, actor, "Cita creada")
+}
+
+func registrarHistorialCita(db ejecutorSQL, citaID int32, desde sql.NullString, hacia string, actor ActorCita, motivo string) error {
+	_, err := db.Exec(`
+		INSERT INTO citas_historial (cita_id, estado_anterior, estado_nuevo, actor_id, actor_rol, motivo)
+		VALUES (@cita_id, @desde, @hacia, @actor_id, @actor_rol, @motivo)`,
+		sql.Named("cita_id", citaID),
+		sql.Named("desde", desde),
+		sql.Named("hacia", hacia),
+		sql.Named("actor_id", actor.ID),
+		sql.Named("actor_rol", actor.Rol),
+		sql.Named("motivo", nullSiVacio(motivo)),
+	)
+	if err != nil {
+		return fmt.Errorf("registrar historial de la cita: %w", err)
+	}
+	return nil
+}
+
+// HistorialCita es una entrada de la línea de tiempo de una cita.
+type HistorialCita struct {
+	ID             int32   `json:"id"`
+	EstadoAnterior *string `json:"estado_anterior"`
+	EstadoNuevo    string  `json:"estado_nuevo"`
+	ActorID        *int32  `json:"actor_id"`
+	ActorNombre    *string `json:"actor_nombre"`
+	ActorRol       string  `json:"actor_rol"`
+	Motivo         *string `json:"motivo"`
+	Fecha          string  `json:"fecha"`
+}
+
+// ObtenerHistorialDeCita devuelve los cambios de estado en orden cronológico.
+func ObtenerHistorialDeCita(citaID int32) ([]HistorialCita, error) {
+	rows, err := dto.DB.Query(`
+		SELECT h.id, h.estado_anterior, h.estado_nuevo, h.actor_id, u.nombre, h.actor_rol, h.motivo,
+		       CONVERT(VARCHAR(19), h.creado_en, 120)
+		FROM citas_historial h
+		LEFT JOIN usuarios u ON u.id = h.actor_id
+		WHERE h.cita_id = @cita_id
+		ORDER BY h.creado_en, h.id`,
+		sql.Named("cita_id", citaID))
+	if err != nil {
+		return nil, fmt.Errorf("consultar historial: %w", err)
+	}
+	defer rows.Close()
+
+	historial := []HistorialCita{}
+	for rows.Next() {
+		var h HistorialCita
+		if err := rows.Scan(&h.ID, &h.EstadoAnterior, &h.EstadoNuevo, &h.ActorID, &h.ActorNombre, &h.ActorRol, &h.Motivo, &h.Fecha); err != nil {
+			return nil, fmt.Errorf("leer historial: %w", err)
+		}
+		historial = append(historial, h)
+	}
+	return historial, rows.Err()
+}
@@ -0,0 +1,302 @@
+// Repositorio de facturas: único punto de acceso a factura/detallefactura para los
+// manejadores, el PDF y cualquier proceso que necesite leer o crear facturas.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"strings"
+)
+
+var (
+	ErrFacturaNoExiste  = errors.New("la factura no existe")
+	ErrCitaNoFinalizada = errors.New("la cita no está finalizada")
+	ErrCitaYaFacturada  = errors.New("la cita ya tiene factura")
+)
+
+// ResumenFactura es la fila del listado de facturas.
+type ResumenFactura struct {
+	ID            int     `json:"id"`
+	Consecutivo   *string `json:"consecutivo"`
+	Tipo          string  `json:"tipo"`
+	CitaID        *int    `json:"cita_id"`
+	NombreCliente string  `json:"nombre_cliente"`
+	CedulaCliente string  `json:"cedula_cliente"`
+	FechaFactura  string  `json:"fecha_factura"`
+	Total         float64 `json:"total"`
+	Estado        string  `json:"estado"`
+	Anulada       bool    `json:"anulada"`
+	TotalNeto     float64 `json:"total_neto"`
+	EstadoPago    string  `json:"estado_pago"`
+	Pagado        float64 `json:"pagado"`
+	Saldo         float64 `json:"saldo"`
+}
+
+// Las ventas de mostrador no tienen cita: el cliente sale de factura.cliente_id o de
+// los datos del invitado guardados en la propia factura.
+const consultaFactura = `
+	SELECT
+		f.idFact, f.consecutivo, f.tipo_documento, f.tipo, f.idCita, u.id,
+		COALESCE(u.nombre, c.nombre_invitado, f.nombre_cliente, @consumidor_final) as nombre_cliente,
+		COALESCE(u.cedula, c.cedula_invitado, f.cedula_cliente, '') as cedula_cliente,
+		COALESCE(u.telefono, c.telefono_invitado, f.telefono_cliente) as telefono_cliente,
+		COALESCE(u.correo, 'No disponible') as correo_cliente,
+		CONVERT(VARCHAR(10), f.fecha, 23) as fecha_factura, f.subtotal, f.impuesto, f.total, f.estado,
+		CAST(f.observaciones AS NVARCHAR(MAX)) as observaciones, CONVERT(VARCHAR(19), c.fecha_hora, 126) as fecha_cita,
+		pr.codigo as codigo_promocion
+	FROM factura f
+	LEFT JOIN citas c ON f.idCita = c.id
+	LEFT JOIN usuarios u ON u.id = COALESCE(c.usuario_id, f.cliente_id)
+	LEFT JOIN promociones pr ON f.promocion_id = pr.id`
+
+// consumidorFinal es el nombre que se imprime en ventas sin cliente identificado
+const consumidorFinal = "Consumidor final"
+
+// ObtenerFacturaCompleta lee la factura con los datos del cliente y sus detalles.
+func ObtenerFacturaCompleta(facturaID int) (*Factura, error) {
+	return leerFactura(consultaFactura+" WHERE f.idFact = @id", sql.Named("id", facturaID), sql.Named("consumidor_final", consumidorFinal))
+}
+
+// ObtenerFacturaDeCita devuelve la factura emitida para la cita. Si por datos viejos
+// hubiera más de una, se toma la más reciente.
+func ObtenerFacturaDeCita(citaID int) (*Factura, error) {
+	var facturaID int
+	err := dto.DB.QueryRow("SELECT TOP 1 idFact FROM factura WHERE idCita = @cita_id ORDER BY idFact DESC",
+		sql.Named("cita_id", citaID)).Scan(&facturaID)
+	if err == sql.ErrNoRows {
+		return nil, ErrFacturaNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("buscar factura de la cita %d: %w", citaID, err)
+	}
+	return ObtenerFacturaCompleta(facturaID)
+}
+
+func leerFactura(query string, args ...interface{}) (*Factura, error) {
+	var factura Factura
+	var citaID, usuarioID sql.NullInt32
+	err := dto.DB.QueryRow(query, args...).Scan(
+		&factura.ID, &factura.Consecutivo, &factura.TipoDocumento, &factura.Tipo, &citaID, &usuarioID, &factura.NombreCliente, &factura.CedulaCliente,
+		&factura.TelefonoCliente, &factura.CorreoCliente, &factura.FechaFactura, &factura.Subtotal,
+		&factura.Impuestos, &factura.Total, &factura.Estado, &factura.Observaciones, &factura.FechaCita,
+		&factura.CodigoPromocion,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrFacturaNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("consultar factura: %w", err)
+	}
+	factura.CitaID = nullInt32Ptr(citaID)
+	factura.UsuarioID = nullInt32Ptr(usuarioID)
+
+	factura.Detalles, err = DetallesDeFactura(factura.ID)
+	if err != nil {
+		return nil, err
+	}
+	factura.DesgloseImpuestos = desgloseImpuestos(factura.Detalles)
+	for _, d := range factura.Detalles {
+		factura.TotalDescuentos += d.Descuento
+	}
+	factura.TotalDescuentos = redondear(factura.TotalDescuentos)
+
+	factura.NotasCredito, err = NotasCreditoDeFactura(factura.ID)
+	if err != nil {
+		return nil, err
+	}
+	var reembolsado float64
+	for _, n := range factura.NotasCredito {
+		factura.TotalAcreditado += n.Total
+		reembolsado += n.MontoReembolsado
+		factura.Anulada = factura.Anulada || n.Tipo == TipoNotaAnulacion
+	}
+	factura.TotalAcreditado = redondear(factura.TotalAcreditado)
+	factura.TotalNeto = redondear(factura.Total - factura.TotalAcreditado)
+
+	factura.EstadoPagos, err = PagosDeFactura(factura.ID, factura.TotalNeto, redondear(reembolsado))
+	if err != nil {
+		return nil, err
+	}
+	if factura.Anulada {
+		factura.EstadoPago = EstadoPagoAnulada
+	}
+	return &factura, nil
+}
+
+// DetallesDeFactura devuelve las líneas de la factura en el orden en que se agregaron.
+func DetallesDeFactura(facturaID int) ([]DetalleFactura, error) {
+	rows, err := dto.DB.Query(`
+		SELECT
+			df.idDetalle, df.idProducto, df.idServicio, df.cant, df.precio,
+			df.subtotal, CAST(df.detallePersonalizado AS NVARCHAR(MAX)), CAST(df.descripcion AS NVARCHAR(MAX)),
+			COALESCE(p.nombre, s.nombre, CAST(df.descripcion AS NVARCHAR(MAX))) as nombre_item,
+			CASE
+				WHEN df.idProducto IS NOT NULL THEN 'producto'
+				WHEN df.idServicio IS NOT NULL THEN 'servicio'
+				ELSE 'personalizado'
+			END as tipo_item,
+			COALESCE(ci.codigo, ''), COALESCE(ci.nombre, ''), df.tarifa_impuesto, df.impuesto,
+			df.descuento, df.motivo_descuento, df.promocion_id
+		FROM detallefactura df
+		LEFT JOIN productos p ON df.idProducto = p.id
+		LEFT JOIN servicios s ON df.idServicio = s.id
+		LEFT JOIN categorias_impuesto ci ON df.categoria_impuesto_id = ci.id
+		WHERE df.idFact = @factura_id
+		ORDER BY df.idDetalle
+	`, sql.Named("factura_id", facturaID))
+	if err != nil {
+		return nil, fmt.Errorf("consultar detalles de factura: %w", err)
+	}
+	defer rows.Close()
+
+	detalles := []DetalleFactura{}
+	for rows.Next() {
+		var detalle DetalleFactura
+		var promocionID sql.NullInt32
+		err := rows.Scan(
+			&detalle.ID, &detalle.ProductoID, &detalle.ServicioID, &detalle.Cantidad,
+			&detalle.PrecioUnitario, &detalle.Subtotal, &detalle.DetallePersonalizado,
+			&detalle.Descripcion, &detalle.NombreItem, &detalle.TipoItem,
+			&detalle.CodigoImpuesto, &detalle.NombreImpuesto, &detalle.TarifaImpuesto, &detalle.Impuesto,
+			&detalle.Descuento, &detalle.MotivoDescuento, &promocionID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("leer detalle de factura: %w", err)
+		}
+		detalle.PromocionID = nullInt32Ptr(promocionID)
+		detalles = append(detalles, detalle)
+	}
+	return detalles, rows.Err()
+}
+
+// ListarResumenFacturas devuelve todas las facturas, las más recientes primero.
+func ListarResumenFacturas() ([]ResumenFactura, error) {
+	rows, err := dto.DB.Query(`
+		SELECT
+			f.idFact, f.consecutivo, f.tipo, f.idCita,
+			COALESCE(u.nombre, c.nombre_invitado, f.nombre_cliente, @consumidor_final) as nombre_cliente,
+			COALESCE(u.cedula, c.cedula_invitado, f.cedula_cliente, '') as cedula_cliente,
+			CONVERT(VARCHAR(10), f.fecha, 23), f.total, f.estado,
+			(SELECT COALESCE(SUM(pf.monto), 0) FROM pagos_factura pf WHERE pf.idFact = f.idFact) as pagado,
+			COALESCE(nc.acreditado, 0), COALESCE(nc.reembolsado, 0), COALESCE(nc.anulada, 0)
+		FROM factura f
+		OUTER APPLY (
+			SELECT SUM(n.total) as acreditado, SUM(n.monto_reembolsado) as reembolsado,
+			       MAX(CASE WHEN n.tipo = @anulacion THEN 1 ELSE 0 END) as anulada
+			FROM notas_credito n WHERE n.idFact = f.idFact
+		) nc
+		LEFT JOIN citas c ON f.idCita = c.id
+		LEFT JOIN usuarios u ON u.id = COALESCE(c.usuario_id, f.cliente_id)
+		ORDER BY f.fecha DESC, f.idFact DESC
+	`, sql.Named("consumidor_final", consumidorFinal), sql.Named("anulacion", TipoNotaAnulacion))
+	if err != nil {
+		return nil, fmt.Errorf("listar facturas: %w", err)
+	}
+	defer rows.Close()
+
+	facturas := []ResumenFactura{}
+	for rows.Next() {
+		var f ResumenFactura
+		var citaID sql.NullInt32
+		var acreditado, reembolsado float64
+		err := rows.Scan(&f.ID, &f.Consecutivo, &f.Tipo, &citaID, &f.NombreCliente, &f.CedulaCliente, &f.FechaFactura, &f.Total, &f.Estado,
+			&f.Pagado, &acreditado, &reembolsado, &f.Anulada)
+		if err != nil {
+			return nil, fmt.Errorf("leer factura: %w", err)
+		}
+		f.CitaID = nullInt32Ptr(citaID)
+		f.TotalNeto = redondear(f.Total - acreditado)
+		cobrado := aMonto(centavos(f.Pagado) - centavos(reembolsado))
+		f.Saldo = aMonto(max(centavos(f.TotalNeto)-centavos(cobrado), 0))
+		f.EstadoPago = estadoDePago(f.TotalNeto, cobrado)
+		if f.Anulada {
+			f.EstadoPago = EstadoPagoAnulada
+		}
+		facturas = append(facturas, f)
+	}
+	return facturas, rows.Err()
+}
+
+// CrearFacturaDesdeCita abre la factura en borrador de una cita finalizada con la
+// línea del servicio de la cita y su promoción, y devuelve su id. codigoPromocion es
+// opcional y solo se usa si la cita no reservó una al agendar.
+func CrearFacturaDesdeCita(citaID int, codigoPromocion string, creadoPor sql.NullInt32) (int, error) {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var estado string
+	var servicioID int
+	var promocionID sql.NullInt32
+	err = tx.QueryRow("SELECT estado, servicio_id, promocion_id FROM citas WITH (UPDLOCK) WHERE id = @id",
+		sql.Named("id", citaID)).Scan(&estado, &servicioID, &promocionID)
+	if err == sql.ErrNoRows {
+		return 0, ErrCitaNoExiste
+	} else if err != nil {
+		return 0, fmt.Errorf("consultar cita: %w", err)
+	}
+	if estado != EstadoFinalizada {
+		return 0, ErrCitaNoFinalizada
+	}
+
+	var existentes int
+	err = tx.QueryRow("SELECT COUNT(*) FROM factura WHERE idCita = @id", sql.Named("id", citaID)).Scan(&existentes)
+	if err != nil {
+		return 0, fmt.Errorf("consultar facturas de la cita: %w", err)
+	}
+	if existentes > 0 {
+		return 0, ErrCitaYaFacturada
+	}
+
+	var facturaID int
+	err = tx.QueryRow(`
+		INSERT INTO factura (idCita, tipo, creado_por) VALUES (@cita_id, @tipo, @creado_por);
+		SELECT CAST(SCOPE_IDENTITY() AS INT)`,
+		sql.Named("cita_id", citaID),
+		sql.Named("tipo", TipoFacturaCita),
+		sql.Named("creado_por", creadoPor),
+	).Scan(&facturaID)
+	if err != nil {
+		return 0, fmt.Errorf("crear factura: %w", err)
+	}
+
+	if _, err := agregarLineaTx(tx, facturaID, LineaFacturaInput{ServicioID: &servicioID, Cantidad: 1}); err != nil {
+		return 0, err
+	}
+
+	// La promoción reservada al agendar manda sobre un código digitado al facturar
+	if promocionID.Valid {
+		err = usarPromocionDeCita(tx, facturaID, citaID, int(promocionID.Int32))
+	} else if strings.TrimSpace(codigoPromocion) != "" {
+		err = aplicarPromocionTx(tx, facturaID, codigoPromocion)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return facturaID, nil
+}
+
+func nullInt32Ptr(n sql.NullInt32) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int32)
+	return &v
+}
+
+func nullFloat64Ptr(n sql.NullFloat64) *float64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Float64
+}
@@ -0,0 +1,154 @@
+// Manejador del punto de venta: líneas de productos y servicios en facturas en borrador.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /facturas/:id/detalles  {"producto_id": 4, "cantidad": 1}
+func AgregarDetalleFactura(c *gin.Context) {
+	facturaID, ok := facturaEditableParam(c)
+	if !ok {
+		return
+	}
+
+	var input LineaFacturaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	detalleID, err := AgregarLineaFactura(facturaID, input)
+	if err != nil {
+		responderErrorLineaFactura(c, err)
+		return
+	}
+
+	responderFacturaActualizada(c, http.StatusCreated, facturaID, gin.H{"mensaje": "Línea agregada", "detalle_id": detalleID})
+}
+
+// PUT /facturas/:id/detalles/:detalleId  {"cantidad": 2}
+func ActualizarDetalleFactura(c *gin.Context) {
+	facturaID, ok := facturaEditableParam(c)
+	if !ok {
+		return
+	}
+	detalleID, err := strconv.Atoi(c.Param("detalleId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de línea inválido"})
+		return
+	}
+
+	var input CambioLineaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	if err := ActualizarLineaFactura(facturaID, detalleID, input); err != nil {
+		responderErrorLineaFactura(c, err)
+		return
+	}
+
+	responderFacturaActualizada(c, http.StatusOK, facturaID, gin.H{"mensaje": "Línea actualizada"})
+}
+
+// DELETE /facturas/:id/detalles/:detalleId
+func EliminarDetalleFactura(c *gin.Context) {
+	facturaID, ok := facturaEditableParam(c)
+	if !ok {
+		return
+	}
+	detalleID, err := strconv.Atoi(c.Param("detalleId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de línea inválido"})
+		return
+	}
+
+	if err := EliminarLineaFactura(facturaID, detalleID); err != nil {
+		responderErrorLineaFactura(c, err)
+		return
+	}
+
+	responderFacturaActualizada(c, http.StatusOK, facturaID, gin.H{"mensaje": "Línea eliminada"})
+}
+
+// PUT /facturas/:id/cerrar
+func CerrarFacturaHandler(c *gin.Context) {
+	facturaID, ok := facturaEditableParam(c)
+	if !ok {
+		return
+	}
+
+	if err := CerrarFactura(facturaID); err != nil {
+		responderErrorLineaFactura(c, err)
+		return
+	}
+
+	responderFacturaActualizada(c, http.StatusOK, facturaID, gin.H{"mensaje": "Factura cerrada"})
+}
+
+// facturaEditableParam lee el :id de la factura; responde 400 si es inválido.
+func facturaEditableParam(c *gin.Context) (int, bool) {
+	facturaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de factura inválido"})
+		return 0, false
+	}
+	return facturaID, true
+}
+
+// responderFacturaActualizada agrega la factura recalculada a la respuesta para que
+// la caja vea los totales nuevos sin otra consulta.
+func responderFacturaActualizada(c *gin.Context, status, facturaID int, respuesta gin.H) {
+	factura, err := ObtenerFacturaCompleta(facturaID)
+	if err != nil {
+		fmt.Printf("Error al releer factura %d: %v\n", facturaID, err)
+	} else {
+		respuesta["factura"] = factura
+	}
+	c.JSON(status, respuesta)
+}
+
+func responderErrorLineaFactura(c *gin.Context, err error) {
+	var stock *ErrorStock
+	switch {
+	case errors.As(err, &stock):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Stock insuficiente",
+			"producto_id": stock.ProductoID,
+			"producto":    stock.Nombre,
+			"disponible":  stock.Disponible,
+			"solicitados": stock.Solicitados,
+		})
+	case errors.Is(err, ErrFacturaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Factura no encontrada"})
+	case errors.Is(err, ErrLineaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "La línea no existe en esta factura"})
+	case errors.Is(err, ErrItemNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "El producto o servicio no existe"})
+	case errors.Is(err, ErrFacturaNoEditable):
+		c.JSON(http.StatusConflict, gin.H{"error": "La factura ya está cerrada y no se puede modificar"})
+	case errors.Is(err, ErrSinTarifaVigente):
+		c.JSON(http.StatusConflict, gin.H{"error": "La categoría de impuesto del ítem no tiene una tarifa vigente"})
+	case errors.Is(err, ErrSerieNoConfigurada):
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay una serie de numeración activa para esta caja"})
+	case errors.Is(err, ErrFacturaVacia):
+		c.JSON(http.StatusConflict, gin.H{"error": "No se puede cerrar una factura sin líneas"})
+	case errors.Is(err, ErrLineaInvalida):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique producto_id o servicio_id (solo uno), una cantidad mayor a cero y un precio no negativo"})
+	case errors.Is(err, ErrDescuentoInvalido):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case esErrorPromocion(err):
+		responderErrorPromocion(c, err)
+	default:
+		fmt.Println("❌ Error al modificar factura:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al modificar la factura"})
+	}
+}
@@ -0,0 +1,420 @@
+// Punto de venta sobre facturas en borrador: agregar, editar y quitar líneas de
+// productos o servicios, con control de inventario y recálculo de totales.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"restapi/dto"
+	"strings"
+)
+
+// Estados de una factura
+const (
+	EstadoFacturaBorrador = "borrador"
+	EstadoFacturaCerrada  = "cerrada"
+)
+
+var (
+	ErrFacturaNoEditable = errors.New("la factura ya está cerrada")
+	ErrFacturaVacia      = errors.New("la factura no tiene líneas")
+	ErrLineaNoExiste     = errors.New("la línea no existe en esta factura")
+	ErrItemNoExiste      = errors.New("el producto o servicio no existe")
+	ErrLineaInvalida     = errors.New("indique producto_id o servicio_id (solo uno) y una cantidad mayor a cero")
+)
+
+// ErrorStock indica que no hay unidades suficientes del producto.
+type ErrorStock struct {
+	ProductoID  int
+	Nombre      string
+	Disponible  int
+	Solicitados int
+}
+
+func (e *ErrorStock) Error() string {
+	return fmt.Sprintf("stock insuficiente de %s: hay %d, se piden %d", e.Nombre, e.Disponible, e.Solicitados)
+}
+
+// LineaFacturaInput describe una línea nueva. El precio es opcional: si no viene se
+// usa el del catálogo. Descuento es un monto manual sobre precio * cantidad.
+type LineaFacturaInput struct {
+	ProductoID           *int     `json:"producto_id"`
+	ServicioID           *int     `json:"servicio_id"`
+	Cantidad             int      `json:"cantidad"`
+	Precio               *float64 `json:"precio"`
+	DetallePersonalizado *string  `json:"detalle_personalizado"`
+	Descuento            *float64 `json:"descuento"`
+	MotivoDescuento      *string  `json:"motivo_descuento"`
+}
+
+// CambioLineaInput modifica una línea existente; los campos nil se conservan. Un
+// descuento de 0 quita el descuento manual y deja la línea a la promoción de la factura.
+type CambioLineaInput struct {
+	Cantidad             *int     `json:"cantidad"`
+	Precio               *float64 `json:"precio"`
+	DetallePersonalizado *string  `json:"detalle_personalizado"`
+	Descuento            *float64 `json:"descuento"`
+	MotivoDescuento      *string  `json:"motivo_descuento"`
+}
+
+// AgregarLineaFactura agrega un producto o servicio a la factura en borrador y
+// devuelve el id de la línea.
+func AgregarLineaFactura(facturaID int, in LineaFacturaInput) (int, error) {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bloquearFacturaEditable(tx, facturaID); err != nil {
+		return 0, err
+	}
+	detalleID, err := agregarLineaTx(tx, facturaID, in)
+	if err != nil {
+		return 0, err
+	}
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return detalleID, nil
+}
+
+// agregarLineaTx valida el ítem y el stock e inserta la línea. No recalcula totales:
+// quien agrega varias líneas lo hace una vez al final.
+func agregarLineaTx(tx *sql.Tx, facturaID int, in LineaFacturaInput) (int, error) {
+	if (in.ProductoID == nil) == (in.ServicioID == nil) || in.Cantidad <= 0 || (in.Precio != nil && *in.Precio < 0) {
+		return 0, ErrLineaInvalida
+	}
+
+	var nombre, descripcion string
+	var precio float64
+	var categoriaID sql.NullInt32
+	var err error
+	if in.ProductoID != nil {
+		var disponible int
+		err = tx.QueryRow("SELECT nombre, precio, cantidad_disponible, categoria_impuesto_id FROM productos WITH (UPDLOCK) WHERE id = @id",
+			sql.Named("id", *in.ProductoID)).Scan(&nombre, &precio, &disponible, &categoriaID)
+		if err == nil && disponible < in.Cantidad {
+			return 0, &ErrorStock{ProductoID: *in.ProductoID, Nombre: nombre, Disponible: disponible, Solicitados: in.Cantidad}
+		}
+		descripcion = "Producto: " + nombre
+	} else {
+		err = tx.QueryRow("SELECT nombre, precio, categoria_impuesto_id FROM servicios WHERE id = @id",
+			sql.Named("id", *in.ServicioID)).Scan(&nombre, &precio, &categoriaID)
+		descripcion = "Servicio: " + nombre
+	}
+	if err == sql.ErrNoRows {
+		return 0, ErrItemNoExiste
+	} else if err != nil {
+		return 0, fmt.Errorf("consultar catálogo: %w", err)
+	}
+	if in.Precio != nil {
+		precio = *in.Precio
+	}
+
+	categoria, tarifa, err := tarifaParaLinea(tx, facturaID, categoriaID)
+	if err != nil {
+		return 0, err
+	}
+	bruto := redondear(precio * float64(in.Cantidad))
+	descuento, motivo, err := descuentoManual(in.Descuento, in.MotivoDescuento, bruto)
+	if err != nil {
+		return 0, err
+	}
+	subtotal := redondear(bruto - descuento)
+
+	// detallefactura tiene triggers: OUTPUT sin INTO no está permitido
+	var detalleID int
+	err = tx.QueryRow(`
+		INSERT INTO detallefactura (idFact, idProducto, idServicio, cant, precio, subtotal, detallePersonalizado, descripcion,
+		                            categoria_impuesto_id, tarifa_impuesto, impuesto, descuento, motivo_descuento)
+		VALUES (@factura_id, @producto_id, @servicio_id, @cant, @precio, @subtotal, @personalizado, @descripcion,
+		        @categoria_id, @tarifa, @impuesto, @descuento, @motivo_descuento);
+		SELECT CAST(SCOPE_IDENTITY() AS INT)`,
+		sql.Named("factura_id", facturaID),
+		sql.Named("producto_id", in.ProductoID),
+		sql.Named("servicio_id", in.ServicioID),
+		sql.Named("cant", in.Cantidad),
+		sql.Named("precio", precio),
+		sql.Named("subtotal", subtotal),
+		sql.Named("personalizado", in.DetallePersonalizado),
+		sql.Named("descripcion", descripcion),
+		sql.Named("categoria_id", categoria),
+		sql.Named("tarifa", tarifa),
+		sql.Named("impuesto", impuestoDeLinea(subtotal, tarifa)),
+		sql.Named("descuento", descuento),
+		sql.Named("motivo_descuento", motivo),
+	).Scan(&detalleID)
+	if err != nil {
+		return 0, fmt.Errorf("insertar línea: %w", err)
+	}
+	return detalleID, nil
+}
+
+// ActualizarLineaFactura cambia cantidad, precio o detalle de una línea. Si es un
+// producto y la cantidad sube, solo se exige stock para la diferencia.
+func ActualizarLineaFactura(facturaID, detalleID int, in CambioLineaInput) error {
+	if (in.Cantidad != nil && *in.Cantidad <= 0) || (in.Precio != nil && *in.Precio < 0) {
+		return ErrLineaInvalida
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bloquearFacturaEditable(tx, facturaID); err != nil {
+		return err
+	}
+
+	var productoID, promocionID sql.NullInt32
+	var cantidad int
+	var precio, tarifa, descuento float64
+	var motivo sql.NullString
+	err = tx.QueryRow(`
+		SELECT idProducto, cant, precio, tarifa_impuesto, descuento, promocion_id, motivo_descuento
+		FROM detallefactura WITH (UPDLOCK) WHERE idDetalle = @id AND idFact = @factura_id`,
+		sql.Named("id", detalleID), sql.Named("factura_id", facturaID)).Scan(&productoID, &cantidad, &precio, &tarifa, &descuento, &promocionID, &motivo)
+	if err == sql.ErrNoRows {
+		return ErrLineaNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar línea: %w", err)
+	}
+
+	nuevaCantidad := cantidad
+	if in.Cantidad != nil {
+		nuevaCantidad = *in.Cantidad
+	}
+	if in.Precio != nil {
+		precio = *in.Precio
+	}
+
+	if productoID.Valid && nuevaCantidad > cantidad {
+		var nombre string
+		var disponible int
+		err := tx.QueryRow("SELECT nombre, cantidad_disponible FROM productos WITH (UPDLOCK) WHERE id = @id",
+			sql.Named("id", productoID.Int32)).Scan(&nombre, &disponible)
+		if err != nil {
+			return fmt.Errorf("consultar stock: %w", err)
+		}
+		if extra := nuevaCantidad - cantidad; disponible < extra {
+			return &ErrorStock{ProductoID: int(productoID.Int32), Nombre: nombre, Disponible: disponible, Solicitados: extra}
+		}
+	}
+
+	// Un descuento manual se conserva si no se indica otro; el de la promoción lo
+	// vuelve a calcular recalcularTotalesFactura
+	bruto := redondear(precio * float64(nuevaCantidad))
+	if in.Descuento != nil {
+		if descuento, motivo, err = descuentoManual(in.Descuento, in.MotivoDescuento, bruto); err != nil {
+			return err
+		}
+		promocionID = sql.NullInt32{}
+	} else if promocionID.Valid {
+		descuento = 0
+	} else if descuento > bruto {
+		return ErrDescuentoInvalido
+	}
+
+	// La línea conserva la tarifa con que se agregó
+	subtotal := redondear(bruto - descuento)
+	query := `UPDATE detallefactura SET cant = @cant, precio = @precio, subtotal = @subtotal, impuesto = @impuesto,
+		descuento = @descuento, promocion_id = @promocion_id, motivo_descuento = @motivo_descuento`
+	args := []interface{}{
+		sql.Named("cant", nuevaCantidad),
+		sql.Named("precio", precio),
+		sql.Named("subtotal", subtotal),
+		sql.Named("impuesto", impuestoDeLinea(subtotal, tarifa)),
+		sql.Named("descuento", descuento),
+		sql.Named("promocion_id", promocionID),
+		sql.Named("motivo_descuento", motivo),
+		sql.Named("id", detalleID),
+	}
+	if in.DetallePersonalizado != nil {
+		query += ", detallePersonalizado = @personalizado"
+		args = append(args, sql.Named("personalizado", *in.DetallePersonalizado))
+	}
+	if _, err := tx.Exec(query+" WHERE idDetalle = @id", args...); err != nil {
+		return fmt.Errorf("actualizar línea: %w", err)
+	}
+
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// EliminarLineaFactura quita la línea; el trigger de inventario devuelve el stock.
+func EliminarLineaFactura(facturaID, detalleID int) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bloquearFacturaEditable(tx, facturaID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM detallefactura WHERE idDetalle = @id AND idFact = @factura_id",
+		sql.Named("id", detalleID), sql.Named("factura_id", facturaID))
+	if err != nil {
+		return fmt.Errorf("eliminar línea: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLineaNoExiste
+	}
+
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// CerrarFactura congela la factura: a partir de aquí no se pueden cambiar sus líneas.
+func CerrarFactura(facturaID int) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bloquearFacturaEditable(tx, facturaID); err != nil {
+		return err
+	}
+
+	var lineas int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM detallefactura WHERE idFact = @id", sql.Named("id", facturaID)).Scan(&lineas); err != nil {
+		return fmt.Errorf("contar líneas: %w", err)
+	}
+	if lineas == 0 {
+		return ErrFacturaVacia
+	}
+
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return err
+	}
+	if err := cerrarFacturaTx(tx, facturaID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// cerrarFacturaTx emite la factura: le asigna el consecutivo de su serie y la marca
+// cerrada. Con cliente identificado es factura electrónica; sin él, tiquete.
+func cerrarFacturaTx(tx *sql.Tx, facturaID int) error {
+	var cedula string
+	err := tx.QueryRow(`
+		SELECT COALESCE(u.cedula, c.cedula_invitado, f.cedula_cliente, '')
+		FROM factura f
+		LEFT JOIN citas c ON f.idCita = c.id
+		LEFT JOIN usuarios u ON u.id = COALESCE(c.usuario_id, f.cliente_id)
+		WHERE f.idFact = @id`, sql.Named("id", facturaID)).Scan(&cedula)
+	if err != nil {
+		return fmt.Errorf("consultar cliente de la factura: %w", err)
+	}
+	// Sin una identificación válida para Hacienda se emite tiquete
+	tipoDocumento := DocTiqueteElectronico
+	if _, _, ok := identificacionFiscal(cedula); ok {
+		tipoDocumento = DocFacturaElectronica
+	}
+
+	serieID, consecutivo, err := asignarConsecutivo(tx, tipoDocumento)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE factura
+		SET estado = @estado, cerrada_en = GETDATE(), serie_id = @serie_id, tipo_documento = @tipo_documento, consecutivo = @consecutivo
+		WHERE idFact = @id`,
+		sql.Named("estado", EstadoFacturaCerrada),
+		sql.Named("serie_id", serieID),
+		sql.Named("tipo_documento", tipoDocumento),
+		sql.Named("consecutivo", consecutivo),
+		sql.Named("id", facturaID),
+	)
+	if err != nil {
+		return fmt.Errorf("cerrar factura: %w", err)
+	}
+	return nil
+}
+
+// bloquearFacturaEditable toma el candado de la factura para serializar cambios
+// concurrentes y verifica que siga en borrador.
+func bloquearFacturaEditable(tx *sql.Tx, facturaID int) error {
+	var estado string
+	err := tx.QueryRow("SELECT estado FROM factura WITH (UPDLOCK, ROWLOCK) WHERE idFact = @id", sql.Named("id", facturaID)).Scan(&estado)
+	if err == sql.ErrNoRows {
+		return ErrFacturaNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar factura: %w", err)
+	}
+	if estado != EstadoFacturaBorrador {
+		return ErrFacturaNoEditable
+	}
+	return nil
+}
+
+// recalcularTotalesFactura vuelve a aplicar la promoción de la factura y suma
+// subtotales e impuestos de las líneas.
+func recalcularTotalesFactura(tx *sql.Tx, facturaID int) error {
+	if err := aplicarDescuentosPromocion(tx, facturaID); err != nil {
+		return err
+	}
+
+	var subtotal, impuesto float64
+	err := tx.QueryRow("SELECT COALESCE(SUM(subtotal), 0), COALESCE(SUM(impuesto), 0) FROM detallefactura WHERE idFact = @id",
+		sql.Named("id", facturaID)).Scan(&subtotal, &impuesto)
+	if err != nil {
+		return fmt.Errorf("sumar líneas: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE factura SET subtotal = @subtotal, impuesto = @impuesto, total = @total WHERE idFact = @id",
+		sql.Named("subtotal", subtotal),
+		sql.Named("impuesto", impuesto),
+		sql.Named("total", redondear(subtotal+impuesto)),
+		sql.Named("id", facturaID),
+	)
+	if err != nil {
+		return fmt.Errorf("actualizar totales: %w", err)
+	}
+	return nil
+}
+
+// descuentoManual valida el descuento que digita el personal. Sin motivo se imprime
+// "Descuento".
+func descuentoManual(monto *float64, motivo *string, bruto float64) (float64, sql.NullString, error) {
+	if monto == nil || *monto == 0 {
+		return 0, sql.NullString{}, nil
+	}
+	if *monto < 0 || *monto > bruto {
+		return 0, sql.NullString{}, ErrDescuentoInvalido
+	}
+	texto := "Descuento"
+	if motivo != nil && strings.TrimSpace(*motivo) != "" {
+		texto = recortar(*motivo, 100)
+	}
+	return redondear(*monto), sql.NullString{String: texto, Valid: true}, nil
+}
+
+// redondear deja dos decimales, como las columnas DECIMAL(10,2).
+func redondear(monto float64) float64 {
+	return math.Round(monto*100) / 100
+}
@@ -0,0 +1,432 @@
+// Render de facturas en PDF con gofpdf. No depende de gin: escribe en cualquier
+// io.Writer, así sirve para la descarga y para adjuntar la factura a un correo.
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/phpdave11/gofpdf"
+)
+
+// DatosSalon es el encabezado que se imprime en cada factura.
+type DatosSalon struct {
+	Nombre    string
+	Direccion string
+	Telefono  string
+	Correo    string
+	Logo      string // ruta a un PNG/JPG; si no existe se omite
+}
+
+var datosSalon = DatosSalon{
+	Nombre:    "Salón de Belleza",
+	Direccion: "San José, Costa Rica",
+	Logo:      rutaLogo(),
+}
+
+// rutaLogo toma el logo de FACTURA_LOGO; sin la variable se busca recursos/logo.png.
+func rutaLogo() string {
+	if ruta := strings.TrimSpace(os.Getenv("FACTURA_LOGO")); ruta != "" {
+		return ruta
+	}
+	return "recursos/logo.png"
+}
+
+// avisoLogo evita repetir en cada factura que el logo no está.
+var avisoLogo sync.Once
+
+// Columnas de la tabla de detalle (A4 con márgenes de 15 mm = 180 mm útiles)
+var columnasDetallePDF = []struct {
+	titulo string
+	ancho  float64
+	alinea string
+}{
+	{"Descripción", 72, "L"},
+	{"Tipo", 20, "C"},
+	{"Cant.", 13, "C"},
+	{"Precio", 28, "R"},
+	{"IVA", 17, "C"},
+	{"Subtotal", 30, "R"},
+}
+
+// GenerarPDFFactura dibuja la factura completa (encabezado del salón, cliente,
+// líneas de detalle, totales y observaciones) y la escribe en w.
+func GenerarPDFFactura(w io.Writer, f Factura) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 10, tr(fmt.Sprintf("%s - Página %d de {nb}", numeroDocumentoPDF(f), pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	encabezadoSalonPDF(pdf, tr, f)
+	clientePDF(pdf, tr, f)
+	detallesPDF(pdf, tr, f.Detalles)
+	totalesPDF(pdf, tr, f)
+	pagosPDF(pdf, tr, f)
+
+	if f.Observaciones != nil && strings.TrimSpace(*f.Observaciones) != "" {
+		pdf.Ln(6)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(0, 6, "Observaciones", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(0, 5, tr(textoPDF(*f.Observaciones)), "", "L", false)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("generar PDF de factura: %w", err)
+	}
+	return pdf.Output(w)
+}
+
+// PDFFactura es un atajo que devuelve el PDF en memoria.
+func PDFFactura(f Factura) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := GenerarPDFFactura(&buf, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encabezadoSalonPDF(pdf *gofpdf.Fpdf, tr func(string) string, f Factura) {
+	izquierda, arriba, _, _ := pdf.GetMargins()
+	x := izquierda
+	if _, err := os.Stat(datosSalon.Logo); err != nil {
+		avisoLogo.Do(func() {
+			fmt.Println("⚠️ Las facturas salen sin logo; configure FACTURA_LOGO:", err)
+		})
+	} else {
+		pdf.ImageOptions(datosSalon.Logo, izquierda, arriba, 0, 22, false, gofpdf.ImageOptions{ReadDpi: true}, 0, "")
+		if pdf.Err() {
+			// Un logo corrupto no debe impedir la factura
+			pdf.ClearError()
+		} else {
+			x += 28
+		}
+	}
+
+	pdf.SetXY(x, arriba)
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(100, 8, tr(datosSalon.Nombre), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, linea := range []string{datosSalon.Direccion, datosSalon.Telefono, datosSalon.Correo} {
+		if linea != "" {
+			pdf.CellFormat(100, 5, tr(linea), "", 2, "L", false, 0, "")
+		}
+	}
+
+	pdf.SetXY(125, arriba)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(70, 8, tr(tituloDocumentoPDF(f)), "", 2, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(70, 5, tr(numeroDocumentoPDF(f)), "", 2, "R", false, 0, "")
+	pdf.CellFormat(70, 5, tr("Fecha: "+fechaCortaPDF(f.FechaFactura)), "", 2, "R", false, 0, "")
+	if f.CitaID != nil {
+		pdf.CellFormat(70, 5, tr(fmt.Sprintf("Cita #%d", *f.CitaID)), "", 2, "R", false, 0, "")
+	} else {
+		pdf.CellFormat(70, 5, "Venta de mostrador", "", 2, "R", false, 0, "")
+	}
+	if f.Estado != "" {
+		pdf.CellFormat(70, 5, tr("Estado: "+f.Estado), "", 2, "R", false, 0, "")
+	}
+	if f.Anulada {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetTextColor(200, 0, 0)
+		pdf.CellFormat(70, 5, "ANULADA", "", 2, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont("Helvetica", "", 9)
+	} else if f.EstadoPago != "" {
+		pdf.CellFormat(70, 5, tr("Pago: "+strings.ReplaceAll(f.EstadoPago, "_", " ")), "", 2, "R", false, 0, "")
+	}
+
+	pdf.SetY(arriba + 28)
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.Line(izquierda, pdf.GetY(), 195, pdf.GetY())
+	pdf.Ln(4)
+}
+
+func clientePDF(pdf *gofpdf.Fpdf, tr func(string) string, f Factura) {
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 6, "Cliente", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+
+	filas := [][2]string{
+		{"Nombre", f.NombreCliente},
+		{"Cédula", f.CedulaCliente},
+	}
+	if f.TelefonoCliente != nil && *f.TelefonoCliente != "" {
+		filas = append(filas, [2]string{"Teléfono", *f.TelefonoCliente})
+	}
+	if f.CorreoCliente != nil && *f.CorreoCliente != "" {
+		filas = append(filas, [2]string{"Correo", *f.CorreoCliente})
+	}
+	if f.FechaCita != nil && *f.FechaCita != "" {
+		filas = append(filas, [2]string{"Fecha de la cita", fechaHoraPDF(*f.FechaCita)})
+	}
+	for _, fila := range filas {
+		pdf.CellFormat(32, 5, tr(fila[0]+":"), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, tr(textoPDF(fila[1])), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(5)
+}
+
+func detallesPDF(pdf *gofpdf.Fpdf, tr func(string) string, detalles []DetalleFactura) {
+	encabezado := func() {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(235, 235, 235)
+		for _, col := range columnasDetallePDF {
+			pdf.CellFormat(col.ancho, 7, tr(col.titulo), "1", 0, col.alinea, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 9)
+	}
+	encabezado()
+
+	if len(detalles) == 0 {
+		pdf.CellFormat(0, 7, tr("Sin líneas de detalle"), "1", 1, "C", false, 0, "")
+		return
+	}
+
+	const altoLinea = 5.0
+	_, altoPagina := pdf.GetPageSize()
+	_, _, _, abajo := pdf.GetMargins()
+	for _, d := range detalles {
+		lineas := pdf.SplitText(textoPDF(descripcionDetallePDF(d)), columnasDetallePDF[0].ancho-2)
+		alto := altoLinea * float64(len(lineas))
+		if alto < 7 {
+			alto = 7
+		}
+		// Una fila no se parte entre páginas; si no cabe, se repite el encabezado
+		if pdf.GetY()+alto > altoPagina-abajo {
+			pdf.AddPage()
+			encabezado()
+		}
+
+		x, y := pdf.GetXY()
+		pdf.Rect(x, y, columnasDetallePDF[0].ancho, alto, "D")
+		for i, linea := range lineas {
+			pdf.SetXY(x, y+float64(i)*altoLinea+(alto-altoLinea*float64(len(lineas)))/2)
+			pdf.CellFormat(columnasDetallePDF[0].ancho, altoLinea, tr(linea), "", 0, "L", false, 0, "")
+		}
+		pdf.SetXY(x+columnasDetallePDF[0].ancho, y)
+
+		// Con descuento, la línea muestra el monto bruto y el descuento va en su propia fila
+		valores := []string{
+			d.TipoItem,
+			fmt.Sprintf("%d", d.Cantidad),
+			montoPDF(d.PrecioUnitario),
+			tarifaPDF(d.TarifaImpuesto),
+			montoPDF(redondear(d.Subtotal + d.Descuento)),
+		}
+		for i, v := range valores {
+			col := columnasDetallePDF[i+1]
+			pdf.CellFormat(col.ancho, alto, tr(v), "1", 0, col.alinea, false, 0, "")
+		}
+		pdf.SetXY(x, y+alto)
+
+		if d.Descuento > 0 {
+			descuentoPDF(pdf, tr, d)
+		}
+	}
+}
+
+func descuentoPDF(pdf *gofpdf.Fpdf, tr func(string) string, d DetalleFactura) {
+	motivo := "Descuento"
+	if d.MotivoDescuento != nil && *d.MotivoDescuento != "" {
+		motivo = *d.MotivoDescuento
+	}
+	var ancho float64
+	for _, col := range columnasDetallePDF[:len(columnasDetallePDF)-1] {
+		ancho += col.ancho
+	}
+	pdf.SetFont("Helvetica", "I", 8)
+	pdf.SetTextColor(90, 90, 90)
+	pdf.CellFormat(ancho, 6, tr("   "+textoPDF(motivo)), "1", 0, "L", false, 0, "")
+	pdf.CellFormat(columnasDetallePDF[len(columnasDetallePDF)-1].ancho, 6, tr(montoPDF(-d.Descuento)), "1", 1, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "", 9)
+}
+
+func totalesPDF(pdf *gofpdf.Fpdf, tr func(string) string, f Factura) {
+	type filaTotal struct {
+		etiqueta string
+		monto    float64
+		negrita  bool
+	}
+	filas := []filaTotal{{"Subtotal", f.Subtotal, false}}
+	if f.TotalDescuentos > 0 {
+		etiqueta := "Descuentos aplicados"
+		if f.CodigoPromocion != nil {
+			etiqueta += " (" + *f.CodigoPromocion + ")"
+		}
+		filas = []filaTotal{{"Subtotal antes de descuentos", redondear(f.Subtotal + f.TotalDescuentos), false}, {etiqueta, -f.TotalDescuentos, false}, filas[0]}
+	}
+	if len(f.DesgloseImpuestos) == 0 {
+		filas = append(filas, filaTotal{"Impuesto", f.Impuestos, false})
+	}
+	for _, d := range f.DesgloseImpuestos {
+		filas = append(filas, filaTotal{"IVA " + tarifaPDF(d.Tarifa) + " s/ " + montoPDF(d.Base), d.Impuesto, false})
+	}
+	filas = append(filas, filaTotal{"Total", f.Total, true})
+	if f.TotalAcreditado > 0 {
+		filas = append(filas, filaTotal{"Notas de crédito", -f.TotalAcreditado, false}, filaTotal{"Total neto", f.TotalNeto, true})
+	}
+
+	pdf.Ln(4)
+	for _, fila := range filas {
+		estilo := ""
+		if fila.negrita {
+			estilo = "B"
+		}
+		pdf.SetFont("Helvetica", estilo, 10)
+		pdf.CellFormat(92, 7, "", "", 0, "L", false, 0, "")
+		pdf.CellFormat(58, 7, tr(fila.etiqueta), "1", 0, "L", fila.negrita, 0, "")
+		pdf.CellFormat(30, 7, tr(montoPDF(fila.monto)), "1", 1, "R", fila.negrita, 0, "")
+	}
+}
+
+// tituloDocumentoPDF nombra el comprobante según el tipo de documento asignado al cerrar.
+func tituloDocumentoPDF(f Factura) string {
+	if f.TipoDocumento != nil && *f.TipoDocumento == DocTiqueteElectronico {
+		return "TIQUETE ELECTRÓNICO"
+	}
+	if f.TipoDocumento != nil && *f.TipoDocumento == DocFacturaElectronica {
+		return "FACTURA ELECTRÓNICA"
+	}
+	return "FACTURA"
+}
+
+func numeroDocumentoPDF(f Factura) string {
+	if f.Consecutivo != nil {
+		return "N.º " + *f.Consecutivo
+	}
+	return fmt.Sprintf("Borrador #%d", f.ID)
+}
+
+// nombresMetodoPago son las etiquetas impresas de cada método de pago
+var nombresMetodoPago = map[string]string{
+	MetodoEfectivo:      "Efectivo",
+	MetodoTarjeta:       "Tarjeta",
+	MetodoSinpeMovil:    "SINPE Móvil",
+	MetodoTransferencia: "Transferencia",
+}
+
+// pagosPDF lista los pagos recibidos y el saldo pendiente, si hay pagos.
+func pagosPDF(pdf *gofpdf.Fpdf, tr func(string) string, f Factura) {
+	if len(f.Pagos) == 0 {
+		return
+	}
+
+	pdf.Ln(6)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 6, "Pagos", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, p := range f.Pagos {
+		detalle := fechaHoraPDF(p.Fecha) + "  " + nombresMetodoPago[p.Metodo]
+		if p.Referencia != nil && *p.Referencia != "" {
+			detalle += " (ref. " + *p.Referencia + ")"
+		}
+		if p.Propina > 0 {
+			detalle += " - propina " + montoPDF(p.Propina)
+		}
+		if p.Recibido != nil {
+			detalle += " - recibido " + montoPDF(*p.Recibido) + ", vuelto " + montoPDF(p.Vuelto)
+		}
+		pdf.CellFormat(150, 6, tr(textoPDF(detalle)), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 6, tr(montoPDF(p.Monto)), "B", 1, "R", false, 0, "")
+	}
+	for _, n := range f.NotasCredito {
+		if n.MontoReembolsado <= 0 || n.MetodoReembolso == nil {
+			continue
+		}
+		nota := fmt.Sprintf("#%d", n.ID)
+		if n.Consecutivo != nil {
+			nota = *n.Consecutivo
+		}
+		detalle := fechaHoraPDF(n.Fecha) + "  Reembolso " + nombresMetodoPago[*n.MetodoReembolso] + " (nota de crédito " + nota + ")"
+		pdf.CellFormat(150, 6, tr(textoPDF(detalle)), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 6, tr(montoPDF(-n.MontoReembolsado)), "B", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(150, 7, "Saldo pendiente", "", 0, "R", false, 0, "")
+	pdf.CellFormat(30, 7, tr(montoPDF(f.Saldo)), "", 1, "R", false, 0, "")
+}
+
+func descripcionDetallePDF(d DetalleFactura) string {
+	var partes []string
+	if d.NombreItem != nil && *d.NombreItem != "" {
+		partes = append(partes, *d.NombreItem)
+	} else if d.Descripcion != nil && *d.Descripcion != "" {
+		partes = append(partes, *d.Descripcion)
+	}
+	if d.DetallePersonalizado != nil && *d.DetallePersonalizado != "" {
+		partes = append(partes, *d.DetallePersonalizado)
+	}
+	if len(partes) == 0 {
+		return "-"
+	}
+	return strings.Join(partes, " - ")
+}
+
+// montoPDF formatea colones con separador de miles: "CRC 12,345.00". El símbolo del
+// colón no existe en las fuentes estándar del PDF.
+func montoPDF(monto float64) string {
+	signo := ""
+	if monto < 0 {
+		signo, monto = "-", -monto
+	}
+	texto := fmt.Sprintf("%.2f", monto)
+	entero, decimales := texto[:len(texto)-3], texto[len(texto)-3:]
+	var b strings.Builder
+	for i, r := range entero {
+		if i > 0 && (len(entero)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return "CRC " + signo + b.String() + decimales
+}
+
+// tarifaPDF muestra la tarifa sin decimales innecesarios: 13%, 0%, 2.5%.
+func tarifaPDF(tarifa float64) string {
+	return strconv.FormatFloat(tarifa, 'f', -1, 64) + "%"
+}
+
+// Las fechas llegan del driver como texto RFC 3339; para la factura basta la parte útil.
+func fechaCortaPDF(fecha string) string {
+	if len(fecha) >= 10 {
+		return fecha[:10]
+	}
+	return fecha
+}
+
+func fechaHoraPDF(fecha string) string {
+	if len(fecha) >= 16 && fecha[10] == 'T' {
+		return fecha[:10] + " " + fecha[11:16]
+	}
+	return fecha
+}
+
+// textoPDF deja solo caracteres que existen en las fuentes estándar (Latin-1);
+// el resto se reemplaza para que SplitText no se salga de la tabla de anchos.
+func textoPDF(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xFF {
+			return '?'
+		}
+		return r
+	}, s)
+}
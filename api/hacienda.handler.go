@@ -0,0 +1,143 @@
+// Manejador de comprobantes electrónicos de Hacienda: generar el XML firmado,
+// descargarlo, enviarlo y consultar su estado (comprobantes:gestionar).
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /facturas/:id/comprobante
+func GenerarComprobanteFacturaHandler(c *gin.Context) {
+	generarComprobante(c, GenerarComprobanteFactura)
+}
+
+// POST /notas-credito/:id/comprobante
+func GenerarComprobanteNotaCreditoHandler(c *gin.Context) {
+	generarComprobante(c, GenerarComprobanteNotaCredito)
+}
+
+func generarComprobante(c *gin.Context, generar func(int) (*ComprobanteElectronico, error)) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	comprobante, err := generar(id)
+	if err != nil {
+		responderErrorComprobante(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comprobante": comprobante})
+}
+
+// GET /comprobantes/:clave
+func ObtenerComprobanteHandler(c *gin.Context) {
+	comprobante, err := ObtenerComprobante(c.Param("clave"))
+	if err != nil {
+		responderErrorComprobante(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comprobante": comprobante})
+}
+
+// GET /comprobantes/:clave/xml descarga el XML firmado
+func DescargarComprobanteXML(c *gin.Context) {
+	clave := c.Param("clave")
+	documento, err := XMLComprobante(clave)
+	if err != nil {
+		responderErrorComprobante(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xml"`, clave))
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", []byte(documento))
+}
+
+// POST /comprobantes/:clave/enviar
+func EnviarComprobanteHandler(c *gin.Context) {
+	comprobante, err := EnviarComprobante(c.Param("clave"))
+	if err != nil {
+		responderErrorComprobante(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comprobante": comprobante})
+}
+
+// POST /comprobantes/:clave/consultar
+func ConsultarComprobanteHandler(c *gin.Context) {
+	comprobante, err := ConsultarComprobante(c.Param("clave"))
+	if err != nil {
+		responderErrorComprobante(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comprobante": comprobante})
+}
+
+func responderErrorComprobante(c *gin.Context, err error) {
+	var invalido *ErrorComprobanteInvalido
+	switch {
+	case errors.Is(err, ErrFacturaNoExiste), errors.Is(err, ErrComprobanteNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Documento no encontrado"})
+	case errors.Is(err, ErrDocumentoSinConsecutivo):
+		c.JSON(http.StatusConflict, gin.H{"error": "El documento debe estar cerrado para emitir su comprobante"})
+	case errors.Is(err, ErrComprobanteYaAceptado):
+		c.JSON(http.StatusConflict, gin.H{"error": "El comprobante ya fue aceptado por Hacienda"})
+	case errors.Is(err, ErrLineaSinCABYS), errors.Is(err, ErrTarifaSinCodigoIVA), errors.Is(err, ErrReceptorInvalido):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.As(err, &invalido):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "El comprobante no cumple el esquema de Hacienda", "detalles": invalido.Detalles})
+	case errors.Is(err, ErrHaciendaSinConfigurar), errors.Is(err, ErrCertificadoInvalido):
+		fmt.Println("❌ Configuración de Hacienda:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "La facturación electrónica no está configurada"})
+	default:
+		fmt.Println("❌ Error de comprobante electrónico:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo procesar el comprobante electrónico"})
+	}
+}
+
+// PUT /servicios/:id/cabys  {"codigo_cabys": "9609100000100"}
+func AsignarCABYSServicio(c *gin.Context) {
+	asignarCABYS(c, "servicios")
+}
+
+// PUT /productos/:id/cabys  {"codigo_cabys": "3401100000000"}
+func AsignarCABYSProducto(c *gin.Context) {
+	asignarCABYS(c, "productos")
+}
+
+func asignarCABYS(c *gin.Context, tabla string) {
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var input struct {
+		CodigoCABYS string `json:"codigo_cabys"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	err = AsignarCABYS(tabla, itemID, input.CodigoCABYS)
+	switch {
+	case errors.Is(err, ErrCABYSInvalido):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrItemNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "El producto o servicio no existe"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al asignar código CABYS:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo asignar el código CABYS"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Código CABYS asignado"})
+}
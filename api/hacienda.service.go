@@ -0,0 +1,811 @@
+// Comprobantes electrónicos de Hacienda, formato v4.4: factura electrónica, tiquete
+// electrónico y nota de crédito electrónica. Cada documento cerrado se convierte en
+// un XML firmado con la clave de 50 dígitos y el consecutivo de su serie, y se guarda
+// para descargarlo o enviarlo.
+
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"restapi/dto"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	nsFacturaElectronica     = "https://cdn.comprobanteselectronicos.go.cr/xml-schemas/v4.4/facturaElectronica"
+	nsTiqueteElectronico     = "https://cdn.comprobanteselectronicos.go.cr/xml-schemas/v4.4/tiqueteElectronico"
+	nsNotaCreditoElectronica = "https://cdn.comprobanteselectronicos.go.cr/xml-schemas/v4.4/notaCreditoElectronica"
+)
+
+// Estados de un comprobante
+const (
+	ComprobanteGenerado  = "generado"
+	ComprobanteEnviado   = "enviado"
+	ComprobanteAceptado  = "aceptado"
+	ComprobanteRechazado = "rechazado"
+	ComprobanteError     = "error"
+)
+
+var (
+	ErrHaciendaSinConfigurar   = errors.New("faltan datos del emisor para Hacienda")
+	ErrDocumentoSinConsecutivo = errors.New("el documento no tiene consecutivo: debe estar cerrado")
+	ErrComprobanteNoExiste     = errors.New("el comprobante no existe")
+	ErrLineaSinCABYS           = errors.New("hay líneas sin código CABYS")
+	ErrCABYSInvalido           = errors.New("el código CABYS debe tener 13 dígitos")
+	ErrTarifaSinCodigoIVA      = errors.New("la tarifa de IVA no tiene código de Hacienda")
+	ErrReceptorInvalido        = errors.New("la cédula del cliente no es una identificación válida para Hacienda")
+)
+
+// ErrorComprobanteInvalido agrupa lo que no cumple el esquema del comprobante.
+type ErrorComprobanteInvalido struct {
+	Detalles []string
+}
+
+func (e *ErrorComprobanteInvalido) Error() string {
+	return "el comprobante no cumple el esquema: " + strings.Join(e.Detalles, "; ")
+}
+
+// ConfiguracionHacienda son los datos fiscales del salón, tomados de variables HACIENDA_*.
+type ConfiguracionHacienda struct {
+	Ambiente           string // pruebas, produccion o simulado
+	TipoIdentificacion string
+	Identificacion     string
+	Nombre             string
+	NombreComercial    string
+	ActividadEconomica string
+	Provincia          string
+	Canton             string
+	Distrito           string
+	OtrasSenas         string
+	Telefono           string
+	Correo             string
+	ProveedorSistemas  string
+	CertificadoP12     string
+	PinP12             string
+	Usuario            string // credenciales del API de recepción
+	Clave              string
+}
+
+func configuracionHacienda() (ConfiguracionHacienda, error) {
+	c := ConfiguracionHacienda{
+		Ambiente:           os.Getenv("HACIENDA_AMBIENTE"),
+		TipoIdentificacion: os.Getenv("HACIENDA_EMISOR_TIPO_ID"),
+		Identificacion:     soloDigitos(os.Getenv("HACIENDA_EMISOR_ID")),
+		Nombre:             os.Getenv("HACIENDA_EMISOR_NOMBRE"),
+		NombreComercial:    datosSalon.Nombre,
+		ActividadEconomica: os.Getenv("HACIENDA_ACTIVIDAD"),
+		Provincia:          os.Getenv("HACIENDA_PROVINCIA"),
+		Canton:             os.Getenv("HACIENDA_CANTON"),
+		Distrito:           os.Getenv("HACIENDA_DISTRITO"),
+		OtrasSenas:         os.Getenv("HACIENDA_OTRAS_SENAS"),
+		Telefono:           soloDigitos(os.Getenv("HACIENDA_TELEFONO")),
+		Correo:             os.Getenv("HACIENDA_CORREO"),
+		ProveedorSistemas:  soloDigitos(os.Getenv("HACIENDA_PROVEEDOR_SISTEMAS")),
+		CertificadoP12:     os.Getenv("HACIENDA_P12"),
+		PinP12:             os.Getenv("HACIENDA_P12_PIN"),
+		Usuario:            os.Getenv("HACIENDA_USUARIO"),
+		Clave:              os.Getenv("HACIENDA_CLAVE"),
+	}
+	if c.Ambiente == "" {
+		c.Ambiente = "pruebas"
+	}
+	if c.ProveedorSistemas == "" {
+		// Sistema propio: el proveedor es el mismo emisor
+		c.ProveedorSistemas = c.Identificacion
+	}
+
+	var faltan []string
+	for nombre, valor := range map[string]string{
+		"HACIENDA_EMISOR_TIPO_ID": c.TipoIdentificacion, "HACIENDA_EMISOR_ID": c.Identificacion,
+		"HACIENDA_EMISOR_NOMBRE": c.Nombre, "HACIENDA_ACTIVIDAD": c.ActividadEconomica,
+		"HACIENDA_PROVINCIA": c.Provincia, "HACIENDA_CANTON": c.Canton, "HACIENDA_DISTRITO": c.Distrito,
+		"HACIENDA_OTRAS_SENAS": c.OtrasSenas, "HACIENDA_CORREO": c.Correo,
+		"HACIENDA_P12": c.CertificadoP12, "HACIENDA_P12_PIN": c.PinP12,
+	} {
+		if strings.TrimSpace(valor) == "" {
+			faltan = append(faltan, nombre)
+		}
+	}
+	if len(faltan) > 0 {
+		sort.Strings(faltan)
+		return c, fmt.Errorf("%w: %s", ErrHaciendaSinConfigurar, strings.Join(faltan, ", "))
+	}
+	return c, nil
+}
+
+type ComprobanteElectronico struct {
+	ID                int     `json:"id"`
+	Clave             string  `json:"clave"`
+	Consecutivo       string  `json:"consecutivo"`
+	TipoDocumento     string  `json:"tipo_documento"`
+	FacturaID         *int    `json:"factura_id"`
+	NotaCreditoID     *int    `json:"nota_credito_id"`
+	FechaEmision      string  `json:"fecha_emision"`
+	Estado            string  `json:"estado"`
+	RespuestaHacienda *string `json:"respuesta_hacienda"`
+	CreadoEn          string  `json:"creado_en"`
+	EnviadoEn         *string `json:"enviado_en"`
+}
+
+// lineaComprobante es una línea ya resuelta para el XML.
+type lineaComprobante struct {
+	detalle  string
+	servicio bool
+	cabys    string
+	cantidad int
+	precio   float64
+	subtotal float64
+	tarifa   float64
+	impuesto float64
+	// Descuento de la línea: 06 promocional o 07 comercial (manual)
+	codigoDescuento string
+	motivo          string
+}
+
+type referenciaComprobante struct {
+	tipoDocumento string
+	clave         string
+	fecha         time.Time
+	codigo        string // 01 anula el documento, 03 corrige monto
+	razon         string
+}
+
+type datosComprobante struct {
+	tipoDocumento string
+	consecutivo   string
+	fechaEmision  time.Time
+	receptor      *receptorComprobante
+	lineas        []lineaComprobante
+	pagos         map[string]float64 // medio de pago de Hacienda -> total
+	referencia    *referenciaComprobante
+}
+
+type receptorComprobante struct {
+	nombre string
+	tipoID string
+	numero string
+	correo string
+}
+
+var (
+	formatoCABYS  = regexp.MustCompile(`^\d{13}$`)
+	formatoCorreo = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// mediosPagoHacienda traduce los métodos de pago a la nota 6 de Hacienda.
+var mediosPagoHacienda = map[string]string{
+	MetodoEfectivo:      "01",
+	MetodoTarjeta:       "02",
+	MetodoTransferencia: "04",
+	MetodoSinpeMovil:    "06",
+}
+
+// identificacionFiscal normaliza una cédula ("1-1111-1111") y deduce el tipo: 01 física
+// (9 dígitos), 02 jurídica (10, inicia con 3), 03 DIMEX (11 o 12) y 04 NITE (otras de 10).
+func identificacionFiscal(cedula string) (string, string, bool) {
+	numero := soloDigitos(cedula)
+	switch {
+	case len(numero) == 9 && numero[0] != '0':
+		return "01", numero, true
+	case len(numero) == 10 && numero[0] == '3':
+		return "02", numero, true
+	case len(numero) == 10:
+		return "04", numero, true
+	case len(numero) == 11 || len(numero) == 12:
+		return "03", numero, true
+	}
+	return "", numero, false
+}
+
+func soloDigitos(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// codigoTarifaIVA traduce la tarifa de la línea a la nota 8.1 de Hacienda.
+func codigoTarifaIVA(tarifa float64) (string, error) {
+	switch centavos(tarifa) {
+	case 1300:
+		return "08", nil
+	case 800:
+		return "07", nil
+	case 400:
+		return "04", nil
+	case 200:
+		return "03", nil
+	case 100:
+		return "02", nil
+	case 50:
+		return "09", nil
+	case 0:
+		return "10", nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrTarifaSinCodigoIVA, tarifaPDF(tarifa))
+}
+
+// generarClave arma la clave de 50 dígitos: país, fecha DDMMAA, identificación del emisor
+// (12), consecutivo (20), situación (1 = normal) y código de seguridad (8).
+func generarClave(emisorID, consecutivo string, fecha time.Time) (string, error) {
+	seguridad, err := rand.Int(rand.Reader, big.NewInt(100000000))
+	if err != nil {
+		return "", fmt.Errorf("generar código de seguridad: %w", err)
+	}
+	return fmt.Sprintf("506%s%012s%s1%08d", fecha.Format("020106"), emisorID, consecutivo, seguridad.Int64()), nil
+}
+
+// GenerarComprobanteFactura firma el XML de una factura o tiquete cerrado. Si ya
+// existe, devuelve el que se generó antes: la clave de un documento no cambia.
+func GenerarComprobanteFactura(facturaID int) (*ComprobanteElectronico, error) {
+	if c, err := comprobanteDe("idFact", facturaID); !errors.Is(err, ErrComprobanteNoExiste) {
+		return c, err
+	}
+
+	factura, err := ObtenerFacturaCompleta(facturaID)
+	if err != nil {
+		return nil, err
+	}
+	if factura.Consecutivo == nil || factura.TipoDocumento == nil {
+		return nil, ErrDocumentoSinConsecutivo
+	}
+
+	datos := datosComprobante{tipoDocumento: *factura.TipoDocumento, consecutivo: *factura.Consecutivo, pagos: map[string]float64{}}
+	if datos.fechaEmision, err = fechaCierre("SELECT CONVERT(VARCHAR(19), cerrada_en, 126) FROM factura WHERE idFact = @id", facturaID); err != nil {
+		return nil, err
+	}
+	if datos.tipoDocumento == DocFacturaElectronica {
+		if datos.receptor, err = receptorDeFactura(factura); err != nil {
+			return nil, err
+		}
+	}
+
+	cabys, err := cabysDeLineas(facturaID)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range factura.Detalles {
+		linea := lineaComprobante{
+			detalle:  descripcionDetallePDF(d),
+			servicio: d.TipoItem != "producto",
+			cabys:    cabys[d.ID],
+			cantidad: d.Cantidad,
+			precio:   d.PrecioUnitario,
+			subtotal: d.Subtotal,
+			tarifa:   d.TarifaImpuesto,
+			impuesto: d.Impuesto,
+		}
+		linea.codigoDescuento, linea.motivo = descuentoDeDetalle(d)
+		datos.lineas = append(datos.lineas, linea)
+	}
+	for _, p := range factura.Pagos {
+		datos.pagos[mediosPagoHacienda[p.Metodo]] += p.Monto
+	}
+
+	return guardarComprobante(datos, sql.Named("factura_id", facturaID), sql.NullInt32{})
+}
+
+// GenerarComprobanteNotaCredito firma la nota de crédito electrónica. Referencia el
+// comprobante de la factura original, que se genera si todavía no existe.
+func GenerarComprobanteNotaCredito(notaID int) (*ComprobanteElectronico, error) {
+	if c, err := comprobanteDe("nota_credito_id", notaID); !errors.Is(err, ErrComprobanteNoExiste) {
+		return c, err
+	}
+
+	var facturaID int
+	var tipo, motivo string
+	var consecutivo sql.NullString
+	err := dto.DB.QueryRow("SELECT idFact, tipo, motivo, consecutivo FROM notas_credito WHERE id = @id",
+		sql.Named("id", notaID)).Scan(&facturaID, &tipo, &motivo, &consecutivo)
+	if err == sql.ErrNoRows {
+		return nil, ErrComprobanteNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("consultar nota de crédito: %w", err)
+	}
+	if !consecutivo.Valid {
+		return nil, ErrDocumentoSinConsecutivo
+	}
+
+	original, err := GenerarComprobanteFactura(facturaID)
+	if err != nil {
+		return nil, fmt.Errorf("comprobante de la factura original: %w", err)
+	}
+	factura, err := ObtenerFacturaCompleta(facturaID)
+	if err != nil {
+		return nil, err
+	}
+
+	datos := datosComprobante{tipoDocumento: DocNotaCredito, consecutivo: consecutivo.String}
+	if datos.fechaEmision, err = fechaCierre("SELECT CONVERT(VARCHAR(19), creado_en, 126) FROM notas_credito WHERE id = @id", notaID); err != nil {
+		return nil, err
+	}
+	fechaOriginal, err := time.ParseInLocation("2006-01-02T15:04:05", original.FechaEmision, zonaCostaRica)
+	if err != nil {
+		return nil, fmt.Errorf("fecha del comprobante original: %w", err)
+	}
+	datos.referencia = &referenciaComprobante{tipoDocumento: original.TipoDocumento, clave: original.Clave, fecha: fechaOriginal, codigo: "03", razon: motivo}
+	if tipo == TipoNotaAnulacion {
+		datos.referencia.codigo = "01"
+	}
+	if original.TipoDocumento == DocFacturaElectronica {
+		if datos.receptor, err = receptorDeFactura(factura); err != nil {
+			return nil, err
+		}
+	}
+
+	cabys, err := cabysDeLineas(facturaID)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range factura.NotasCredito {
+		if n.ID != notaID {
+			continue
+		}
+		for _, d := range n.Detalles {
+			linea := lineaComprobante{cabys: cabys[d.DetalleID], cantidad: d.Cantidad, precio: d.PrecioUnitario,
+				subtotal: d.Subtotal, tarifa: d.TarifaImpuesto, impuesto: d.Impuesto, servicio: true}
+			for _, o := range factura.Detalles {
+				if o.ID == d.DetalleID {
+					linea.detalle = descripcionDetallePDF(o)
+					linea.servicio = o.TipoItem != "producto"
+					linea.codigoDescuento, linea.motivo = descuentoDeDetalle(o)
+				}
+			}
+			datos.lineas = append(datos.lineas, linea)
+		}
+	}
+
+	return guardarComprobante(datos, sql.Named("factura_id", nil), sql.NullInt32{Int32: int32(notaID), Valid: true})
+}
+
+// guardarComprobante arma, firma, valida y guarda el XML.
+func guardarComprobante(datos datosComprobante, facturaID sql.NamedArg, notaID sql.NullInt32) (*ComprobanteElectronico, error) {
+	config, err := configuracionHacienda()
+	if err != nil {
+		return nil, err
+	}
+	clave, err := generarClave(config.Identificacion, datos.consecutivo, datos.fechaEmision)
+	if err != nil {
+		return nil, err
+	}
+	raiz, ns, err := xmlComprobante(config, clave, datos)
+	if err != nil {
+		return nil, err
+	}
+
+	firma, err := cargarFirmante(config.CertificadoP12, config.PinP12)
+	if err != nil {
+		return nil, err
+	}
+	documento, err := firma.firmar(raiz, ns, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := validarComprobante(datos.tipoDocumento, []byte(documento)); err != nil {
+		return nil, err
+	}
+
+	// El documento queda bloqueado hasta el INSERT: si otra solicitud generó el
+	// comprobante mientras se firmaba este, se devuelve el suyo
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	bloqueo, columna, documentoID := "SELECT idFact FROM factura WITH (UPDLOCK, ROWLOCK) WHERE idFact = @id", "idFact", facturaID.Value
+	if notaID.Valid {
+		bloqueo, columna, documentoID = "SELECT id FROM notas_credito WITH (UPDLOCK, ROWLOCK) WHERE id = @id", "nota_credito_id", notaID.Int32
+	}
+	var id int
+	if err := tx.QueryRow(bloqueo, sql.Named("id", documentoID)).Scan(&id); err != nil {
+		return nil, fmt.Errorf("bloquear documento: %w", err)
+	}
+	var existente string
+	err = tx.QueryRow("SELECT clave FROM comprobantes_electronicos WHERE "+columna+" = @id", sql.Named("id", documentoID)).Scan(&existente)
+	if err == nil {
+		return ObtenerComprobante(existente)
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("consultar comprobante: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO comprobantes_electronicos (clave, consecutivo, tipo_documento, idFact, nota_credito_id, fecha_emision, xml_firmado)
+		VALUES (@clave, @consecutivo, @tipo, @factura_id, @nota_id, @fecha, @xml)`,
+		sql.Named("clave", clave),
+		sql.Named("consecutivo", datos.consecutivo),
+		sql.Named("tipo", datos.tipoDocumento),
+		facturaID,
+		sql.Named("nota_id", notaID),
+		sql.Named("fecha", datos.fechaEmision.Format("2006-01-02T15:04:05")),
+		sql.Named("xml", documento),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("guardar comprobante: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return ObtenerComprobante(clave)
+}
+
+// xmlComprobante arma el documento sin firma y devuelve su namespace.
+func xmlComprobante(config ConfiguracionHacienda, clave string, datos datosComprobante) (*nodoXML, string, error) {
+	if err := validarDatosComprobante(clave, datos); err != nil {
+		return nil, "", err
+	}
+
+	raizNombre, ns := "FacturaElectronica", nsFacturaElectronica
+	switch datos.tipoDocumento {
+	case DocTiqueteElectronico:
+		raizNombre, ns = "TiqueteElectronico", nsTiqueteElectronico
+	case DocNotaCredito:
+		raizNombre, ns = "NotaCreditoElectronica", nsNotaCreditoElectronica
+	}
+
+	emisor := nodo("Emisor",
+		hoja("Nombre", recortar(config.Nombre, 100)),
+		nodo("Identificacion", hoja("Tipo", config.TipoIdentificacion), hoja("Numero", config.Identificacion)),
+		hojaOpcional("NombreComercial", recortar(config.NombreComercial, 80)),
+		nodo("Ubicacion",
+			hoja("Provincia", config.Provincia),
+			hoja("Canton", config.Canton),
+			hoja("Distrito", config.Distrito),
+			hoja("OtrasSenas", recortar(config.OtrasSenas, 250)),
+		),
+		telefonoXML(config.Telefono),
+		hoja("CorreoElectronico", config.Correo),
+	)
+
+	var receptor *nodoXML
+	if datos.receptor != nil {
+		var correo string
+		if formatoCorreo.MatchString(datos.receptor.correo) {
+			correo = datos.receptor.correo
+		}
+		receptor = nodo("Receptor",
+			hoja("Nombre", recortar(datos.receptor.nombre, 100)),
+			nodo("Identificacion", hoja("Tipo", datos.receptor.tipoID), hoja("Numero", datos.receptor.numero)),
+			hojaOpcional("CorreoElectronico", correo),
+		)
+	}
+
+	detalle, resumen, err := detalleYResumenXML(datos)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var referencia *nodoXML
+	if r := datos.referencia; r != nil {
+		referencia = nodo("InformacionReferencia",
+			hoja("TipoDocIR", r.tipoDocumento),
+			hoja("Numero", r.clave),
+			hoja("FechaEmisionIR", r.fecha.In(zonaCostaRica).Format(time.RFC3339)),
+			hoja("Codigo", r.codigo),
+			hoja("Razon", recortar(r.razon, 180)),
+		)
+	}
+
+	raiz := nodo(raizNombre,
+		hoja("Clave", clave),
+		hoja("ProveedorSistemas", config.ProveedorSistemas),
+		hoja("CodigoActividadEmisor", config.ActividadEconomica),
+		hoja("NumeroConsecutivo", datos.consecutivo),
+		hoja("FechaEmision", datos.fechaEmision.In(zonaCostaRica).Format(time.RFC3339)),
+		emisor,
+		receptor,
+		hoja("CondicionVenta", "01"), // contado
+		detalle,
+		resumen,
+		referencia,
+	).attr("xmlns", ns)
+	return raiz, ns, nil
+}
+
+func detalleYResumenXML(datos datosComprobante) (*nodoXML, *nodoXML, error) {
+	var servGravados, servExentos, mercGravadas, mercExentas, totalImpuesto float64
+	desglose := map[string]float64{}
+
+	detalle := nodo("DetalleServicio")
+	for i, l := range datos.lineas {
+		codigoIVA, err := codigoTarifaIVA(l.tarifa)
+		if err != nil {
+			return nil, nil, err
+		}
+		unidad := "Unid"
+		if l.servicio {
+			unidad = "Sp"
+		}
+		montoTotal := redondear(l.precio * float64(l.cantidad))
+		detalle.hijos = append(detalle.hijos, nodo("LineaDetalle",
+			hoja("NumeroLinea", fmt.Sprint(i+1)),
+			hoja("CodigoCABYS", l.cabys),
+			hoja("Cantidad", montoXML(float64(l.cantidad))),
+			hoja("UnidadMedida", unidad),
+			hoja("Detalle", recortar(l.detalle, 200)),
+			hoja("PrecioUnitario", montoXML(l.precio)),
+			hoja("MontoTotal", montoXML(montoTotal)),
+			descuentoXML(montoTotal-l.subtotal, l.codigoDescuento, l.motivo),
+			hoja("SubTotal", montoXML(l.subtotal)),
+			hoja("BaseImponible", montoXML(l.subtotal)),
+			nodo("Impuesto",
+				hoja("Codigo", "01"), // IVA
+				hoja("CodigoTarifaIVA", codigoIVA),
+				hoja("Tarifa", montoXML(l.tarifa)),
+				hoja("Monto", montoXML(l.impuesto)),
+			),
+			hoja("ImpuestoAsumidoEmisorFabrica", montoXML(0)),
+			hoja("ImpuestoNeto", montoXML(l.impuesto)),
+			hoja("MontoTotalLinea", montoXML(l.subtotal+l.impuesto)),
+		))
+
+		exento := l.tarifa == 0
+		switch {
+		case l.servicio && exento:
+			servExentos += l.subtotal
+		case l.servicio:
+			servGravados += l.subtotal
+		case exento:
+			mercExentas += l.subtotal
+		default:
+			mercGravadas += l.subtotal
+		}
+		if !exento {
+			desglose[codigoIVA] += l.impuesto
+		}
+		totalImpuesto += l.impuesto
+	}
+
+	gravado, exento := servGravados+mercGravadas, servExentos+mercExentas
+	var totalDescuentos float64
+	for _, l := range datos.lineas {
+		totalDescuentos += redondear(l.precio*float64(l.cantidad)) - l.subtotal
+	}
+	totalVentaNeta := gravado + exento
+
+	resumen := nodo("ResumenFactura",
+		nodo("CodigoTipoMoneda", hoja("CodigoMoneda", "CRC"), hoja("TipoCambio", montoXML(1))),
+		hoja("TotalServGravados", montoXML(servGravados)),
+		hoja("TotalServExentos", montoXML(servExentos)),
+		hoja("TotalServExonerado", montoXML(0)),
+		hoja("TotalServNoSujeto", montoXML(0)),
+		hoja("TotalMercanciasGravadas", montoXML(mercGravadas)),
+		hoja("TotalMercanciasExentas", montoXML(mercExentas)),
+		hoja("TotalMercExonerada", montoXML(0)),
+		hoja("TotalMercNoSujeta", montoXML(0)),
+		hoja("TotalGravado", montoXML(gravado)),
+		hoja("TotalExento", montoXML(exento)),
+		hoja("TotalExonerado", montoXML(0)),
+		hoja("TotalNoSujeto", montoXML(0)),
+		hoja("TotalVenta", montoXML(totalVentaNeta+totalDescuentos)),
+		hoja("TotalDescuentos", montoXML(totalDescuentos)),
+		hoja("TotalVentaNeta", montoXML(totalVentaNeta)),
+	)
+	codigos := make([]string, 0, len(desglose))
+	for c := range desglose {
+		codigos = append(codigos, c)
+	}
+	sort.Strings(codigos)
+	for _, c := range codigos {
+		resumen.hijos = append(resumen.hijos, nodo("TotalDesgloseImpuesto",
+			hoja("Codigo", "01"), hoja("CodigoTarifaIVA", c), hoja("TotalMontoImpuesto", montoXML(desglose[c]))))
+	}
+	resumen.hijos = append(resumen.hijos, hoja("TotalImpuesto", montoXML(totalImpuesto)))
+
+	// Medios de pago según lo cobrado; las notas de crédito no los llevan
+	medios := make([]string, 0, len(datos.pagos))
+	for m := range datos.pagos {
+		medios = append(medios, m)
+	}
+	sort.Strings(medios)
+	for _, m := range medios {
+		resumen.hijos = append(resumen.hijos, nodo("MedioPago", hoja("TipoMedioPago", m), hoja("TotalMedioPago", montoXML(datos.pagos[m]))))
+	}
+	resumen.hijos = append(resumen.hijos, hoja("TotalComprobante", montoXML(totalVentaNeta+totalImpuesto)))
+	return detalle, resumen, nil
+}
+
+func descuentoXML(monto float64, codigo, motivo string) *nodoXML {
+	if centavos(monto) <= 0 {
+		return nil
+	}
+	if codigo == "" {
+		codigo = "07"
+	}
+	return nodo("Descuento",
+		hoja("MontoDescuento", montoXML(monto)),
+		hoja("CodigoDescuento", codigo),
+		hojaOpcional("NaturalezaDescuento", recortar(motivo, 80)),
+	)
+}
+
+// descuentoDeDetalle clasifica el descuento de la línea según la nota de Hacienda.
+func descuentoDeDetalle(d DetalleFactura) (string, string) {
+	var motivo string
+	if d.MotivoDescuento != nil {
+		motivo = *d.MotivoDescuento
+	}
+	if d.PromocionID != nil {
+		return "06", motivo
+	}
+	return "07", motivo
+}
+
+func telefonoXML(numero string) *nodoXML {
+	if numero == "" {
+		return nil
+	}
+	return nodo("Telefono", hoja("CodigoPais", "506"), hoja("NumTelefono", numero))
+}
+
+// montoXML usa cinco decimales, el máximo que admite el esquema.
+func montoXML(monto float64) string {
+	return fmt.Sprintf("%.5f", monto)
+}
+
+func recortar(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if r := []rune(s); len(r) > max {
+		return string(r[:max])
+	}
+	return s
+}
+
+// validarDatosComprobante revisa las restricciones del XSD que dependen de los datos
+// (patrones, longitudes y obligatorios) antes de armar el XML.
+func validarDatosComprobante(clave string, datos datosComprobante) error {
+	var detalles []string
+	if len(clave) != 50 || soloDigitos(clave) != clave {
+		detalles = append(detalles, "la clave debe tener 50 dígitos")
+	}
+	if len(datos.consecutivo) != 20 || soloDigitos(datos.consecutivo) != datos.consecutivo {
+		detalles = append(detalles, "el consecutivo debe tener 20 dígitos")
+	}
+	if len(datos.lineas) == 0 || len(datos.lineas) > 1000 {
+		detalles = append(detalles, "el comprobante debe tener entre 1 y 1000 líneas")
+	}
+	for i, l := range datos.lineas {
+		if l.cabys == "" {
+			return fmt.Errorf("%w (línea %d: %s)", ErrLineaSinCABYS, i+1, l.detalle)
+		}
+		if !formatoCABYS.MatchString(l.cabys) {
+			detalles = append(detalles, fmt.Sprintf("línea %d: CABYS de 13 dígitos", i+1))
+		}
+		if strings.TrimSpace(l.detalle) == "" {
+			detalles = append(detalles, fmt.Sprintf("línea %d: falta el detalle", i+1))
+		}
+	}
+	if datos.tipoDocumento == DocFacturaElectronica && datos.receptor == nil {
+		detalles = append(detalles, "la factura electrónica requiere receptor")
+	}
+	if datos.tipoDocumento == DocNotaCredito && datos.referencia == nil {
+		detalles = append(detalles, "la nota de crédito requiere información de referencia")
+	}
+	if len(detalles) > 0 {
+		return &ErrorComprobanteInvalido{Detalles: detalles}
+	}
+	return nil
+}
+
+func receptorDeFactura(f *Factura) (*receptorComprobante, error) {
+	tipo, numero, ok := identificacionFiscal(f.CedulaCliente)
+	if !ok {
+		return nil, ErrReceptorInvalido
+	}
+	r := &receptorComprobante{nombre: f.NombreCliente, tipoID: tipo, numero: numero}
+	if f.CorreoCliente != nil {
+		r.correo = *f.CorreoCliente
+	}
+	return r, nil
+}
+
+// cabysDeLineas devuelve el código CABYS de cada línea (idDetalle) de la factura.
+func cabysDeLineas(facturaID int) (map[int]string, error) {
+	rows, err := dto.DB.Query(`
+		SELECT df.idDetalle, COALESCE(p.codigo_cabys, s.codigo_cabys, '')
+		FROM detallefactura df
+		LEFT JOIN productos p ON df.idProducto = p.id
+		LEFT JOIN servicios s ON df.idServicio = s.id
+		WHERE df.idFact = @id`, sql.Named("id", facturaID))
+	if err != nil {
+		return nil, fmt.Errorf("consultar códigos CABYS: %w", err)
+	}
+	defer rows.Close()
+
+	cabys := map[int]string{}
+	for rows.Next() {
+		var id int
+		var codigo string
+		if err := rows.Scan(&id, &codigo); err != nil {
+			return nil, fmt.Errorf("leer código CABYS: %w", err)
+		}
+		cabys[id] = strings.TrimSpace(codigo)
+	}
+	return cabys, rows.Err()
+}
+
+// fechaCierre lee una fecha DATETIME (hora de pared de Costa Rica).
+func fechaCierre(query string, id int) (time.Time, error) {
+	var fecha sql.NullString
+	if err := dto.DB.QueryRow(query, sql.Named("id", id)).Scan(&fecha); err != nil {
+		return time.Time{}, fmt.Errorf("consultar fecha de emisión: %w", err)
+	}
+	if !fecha.Valid {
+		return time.Time{}, ErrDocumentoSinConsecutivo
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", fecha.String, zonaCostaRica)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fecha de emisión: %w", err)
+	}
+	return t, nil
+}
+
+// AsignarCABYS fija el código CABYS de un servicio o producto ("servicios" o "productos").
+func AsignarCABYS(tabla string, itemID int, codigo string) error {
+	if tabla != "servicios" && tabla != "productos" {
+		return fmt.Errorf("tabla sin código CABYS: %s", tabla)
+	}
+	if !formatoCABYS.MatchString(codigo) {
+		return ErrCABYSInvalido
+	}
+	res, err := dto.DB.Exec("UPDATE "+tabla+" SET codigo_cabys = @codigo WHERE id = @id", sql.Named("codigo", codigo), sql.Named("id", itemID))
+	if err != nil {
+		return fmt.Errorf("asignar código CABYS: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrItemNoExiste
+	}
+	return nil
+}
+
+const columnasComprobante = `
+	SELECT id, clave, consecutivo, tipo_documento, idFact, nota_credito_id, CONVERT(VARCHAR(19), fecha_emision, 126),
+	       estado, CAST(respuesta_hacienda AS NVARCHAR(MAX)), CONVERT(VARCHAR(19), creado_en, 126), CONVERT(VARCHAR(19), enviado_en, 126)
+	FROM comprobantes_electronicos`
+
+// ObtenerComprobante busca el comprobante por su clave.
+func ObtenerComprobante(clave string) (*ComprobanteElectronico, error) {
+	return leerComprobante(columnasComprobante+" WHERE clave = @clave", sql.Named("clave", clave))
+}
+
+func comprobanteDe(columna string, id int) (*ComprobanteElectronico, error) {
+	return leerComprobante(columnasComprobante+" WHERE "+columna+" = @id", sql.Named("id", id))
+}
+
+func leerComprobante(query string, args ...interface{}) (*ComprobanteElectronico, error) {
+	var c ComprobanteElectronico
+	var facturaID, notaID sql.NullInt32
+	err := dto.DB.QueryRow(query, args...).Scan(&c.ID, &c.Clave, &c.Consecutivo, &c.TipoDocumento, &facturaID, &notaID,
+		&c.FechaEmision, &c.Estado, &c.RespuestaHacienda, &c.CreadoEn, &c.EnviadoEn)
+	if err == sql.ErrNoRows {
+		return nil, ErrComprobanteNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("consultar comprobante: %w", err)
+	}
+	c.FacturaID = nullInt32Ptr(facturaID)
+	c.NotaCreditoID = nullInt32Ptr(notaID)
+	return &c, nil
+}
+
+// XMLComprobante devuelve el XML firmado tal como se guardó.
+func XMLComprobante(clave string) (string, error) {
+	var documento string
+	err := dto.DB.QueryRow("SELECT CAST(xml_firmado AS NVARCHAR(MAX)) FROM comprobantes_electronicos WHERE clave = @clave",
+		sql.Named("clave", clave)).Scan(&documento)
+	if err == sql.ErrNoRows {
+		return "", ErrComprobanteNoExiste
+	} else if err != nil {
+		return "", fmt.Errorf("consultar XML: %w", err)
+	}
+	return documento, nil
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var configPrueba = ConfiguracionHacienda{
+	Ambiente:           "simulado",
+	TipoIdentificacion: "02",
+	Identificacion:     "3101123456",
+	Nombre:             "Salón de Prueba S.A.",
+	NombreComercial:    "Salón de Prueba",
+	ActividadEconomica: "960201",
+	Provincia:          "1",
+	Canton:             "01",
+	Distrito:           "01",
+	OtrasSenas:         "Frente al parque",
+	Telefono:           "22223333",
+	Correo:             "facturas@salon.cr",
+	ProveedorSistemas:  "3101123456",
+}
+
+// datosTiquete: un servicio con descuento promocional y dos productos, todo al 13 %.
+func datosTiquete() datosComprobante {
+	return datosComprobante{
+		tipoDocumento: DocTiqueteElectronico,
+		consecutivo:   "00100001040000000123",
+		fechaEmision:  time.Date(2026, 3, 14, 10, 30, 0, 0, zonaCostaRica),
+		lineas: []lineaComprobante{
+			{detalle: "Corte de cabello", servicio: true, cabys: "9609100000100", cantidad: 1, precio: 10000,
+				subtotal: 9000, tarifa: 13, impuesto: 1170, codigoDescuento: "06", motivo: "Promoción de marzo"},
+			{detalle: "Champú", cabys: "3401100000000", cantidad: 2, precio: 2500, subtotal: 5000, tarifa: 13, impuesto: 650},
+		},
+		pagos: map[string]float64{"01": 10000, "02": 5820},
+	}
+}
+
+func clavePrueba(t *testing.T, datos datosComprobante) string {
+	t.Helper()
+	clave, err := generarClave(configPrueba.Identificacion, datos.consecutivo, datos.fechaEmision)
+	if err != nil {
+		t.Fatalf("generar clave: %v", err)
+	}
+	return clave
+}
+
+// firmantePrueba usa una llave nueva con un certificado autofirmado.
+func firmantePrueba(t *testing.T) *firmante {
+	t.Helper()
+	llave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generar llave: %v", err)
+	}
+	plantilla := &x509.Certificate{
+		SerialNumber: big.NewInt(20260314),
+		Subject:      pkix.Name{CommonName: "SALON DE PRUEBA S.A.", SerialNumber: "CPJ-3-101-123456"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, plantilla, &llave.PublicKey, llave)
+	if err != nil {
+		t.Fatalf("crear certificado: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("leer certificado: %v", err)
+	}
+	return &firmante{llave: llave, cert: cert}
+}
+
+func TestGenerarClave(t *testing.T) {
+	datos := datosTiquete()
+	clave := clavePrueba(t, datos)
+	if len(clave) != 50 || soloDigitos(clave) != clave {
+		t.Fatalf("la clave %q debe tener 50 dígitos", clave)
+	}
+	if !strings.HasPrefix(clave, "506140326003101123456"+datos.consecutivo+"1") {
+		t.Errorf("clave %q: país, fecha, emisor, consecutivo o situación incorrectos", clave)
+	}
+}
+
+func TestXMLComprobanteTiquete(t *testing.T) {
+	datos := datosTiquete()
+	clave := clavePrueba(t, datos)
+	raiz, ns, err := xmlComprobante(configPrueba, clave, datos)
+	if err != nil {
+		t.Fatalf("armar XML: %v", err)
+	}
+	if ns != nsTiqueteElectronico {
+		t.Errorf("namespace %q, se esperaba el del tiquete", ns)
+	}
+
+	var doc struct {
+		XMLName      xml.Name
+		Clave        string
+		FechaEmision string
+		Receptor     *struct{}
+		Lineas       []struct {
+			NumeroLinea  int
+			UnidadMedida string
+			MontoTotal   string
+			Descuento    *struct {
+				MontoDescuento  string
+				CodigoDescuento string
+			}
+			MontoTotalLinea string
+		} `xml:"DetalleServicio>LineaDetalle"`
+		Resumen struct {
+			TotalServGravados       string
+			TotalMercanciasGravadas string
+			TotalVenta              string
+			TotalDescuentos         string
+			TotalVentaNeta          string
+			TotalImpuesto           string
+			TotalComprobante        string
+			MedioPago               []struct {
+				TipoMedioPago  string
+				TotalMedioPago string
+			}
+		} `xml:"ResumenFactura"`
+	}
+	if err := xml.Unmarshal([]byte(raiz.canonico()), &doc); err != nil {
+		t.Fatalf("leer XML generado: %v", err)
+	}
+
+	if doc.XMLName.Local != "TiqueteElectronico" || doc.XMLName.Space != nsTiqueteElectronico {
+		t.Errorf("raíz %v, se esperaba TiqueteElectronico", doc.XMLName)
+	}
+	if doc.Clave != clave || doc.FechaEmision != "2026-03-14T10:30:00-06:00" {
+		t.Errorf("clave %q y fecha %q", doc.Clave, doc.FechaEmision)
+	}
+	if doc.Receptor != nil {
+		t.Error("el tiquete no lleva receptor")
+	}
+	if len(doc.Lineas) != 2 {
+		t.Fatalf("%d líneas, se esperaban 2", len(doc.Lineas))
+	}
+	servicio, producto := doc.Lineas[0], doc.Lineas[1]
+	if servicio.UnidadMedida != "Sp" || producto.UnidadMedida != "Unid" {
+		t.Errorf("unidades %q y %q, se esperaban Sp y Unid", servicio.UnidadMedida, producto.UnidadMedida)
+	}
+	if servicio.Descuento == nil || servicio.Descuento.MontoDescuento != "1000.00000" || servicio.Descuento.CodigoDescuento != "06" {
+		t.Errorf("descuento del servicio: %+v", servicio.Descuento)
+	}
+	if producto.Descuento != nil {
+		t.Errorf("el producto no tiene descuento: %+v", producto.Descuento)
+	}
+	if producto.MontoTotal != "5000.00000" || producto.MontoTotalLinea != "5650.00000" {
+		t.Errorf("montos del producto %q y %q", producto.MontoTotal, producto.MontoTotalLinea)
+	}
+
+	r := doc.Resumen
+	for nombre, par := range map[string][2]string{
+		"TotalServGravados":       {r.TotalServGravados, "9000.00000"},
+		"TotalMercanciasGravadas": {r.TotalMercanciasGravadas, "5000.00000"},
+		"TotalVenta":              {r.TotalVenta, "15000.00000"},
+		"TotalDescuentos":         {r.TotalDescuentos, "1000.00000"},
+		"TotalVentaNeta":          {r.TotalVentaNeta, "14000.00000"},
+		"TotalImpuesto":           {r.TotalImpuesto, "1820.00000"},
+		"TotalComprobante":        {r.TotalComprobante, "15820.00000"},
+	} {
+		if par[0] != par[1] {
+			t.Errorf("%s = %q, se esperaba %q", nombre, par[0], par[1])
+		}
+	}
+	if len(r.MedioPago) != 2 || r.MedioPago[0].TipoMedioPago != "01" || r.MedioPago[1].TotalMedioPago != "5820.00000" {
+		t.Errorf("medios de pago: %+v", r.MedioPago)
+	}
+}
+
+func TestValidarDatosComprobante(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		modificar func(*datosComprobante)
+		esperado  error
+	}{
+		{"línea sin CABYS", func(d *datosComprobante) { d.lineas[0].cabys = "" }, ErrLineaSinCABYS},
+		{"CABYS corto", func(d *datosComprobante) { d.lineas[1].cabys = "123" }, &ErrorComprobanteInvalido{}},
+		{"consecutivo corto", func(d *datosComprobante) { d.consecutivo = "001" }, &ErrorComprobanteInvalido{}},
+		{"sin líneas", func(d *datosComprobante) { d.lineas = nil }, &ErrorComprobanteInvalido{}},
+		{"factura sin receptor", func(d *datosComprobante) { d.tipoDocumento = DocFacturaElectronica }, &ErrorComprobanteInvalido{}},
+		{"nota sin referencia", func(d *datosComprobante) { d.tipoDocumento = DocNotaCredito }, &ErrorComprobanteInvalido{}},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			datos := datosTiquete()
+			tc.modificar(&datos)
+			_, _, err := xmlComprobante(configPrueba, clavePrueba(t, datosTiquete()), datos)
+			var invalido *ErrorComprobanteInvalido
+			if _, esquema := tc.esperado.(*ErrorComprobanteInvalido); esquema {
+				if !errors.As(err, &invalido) {
+					t.Fatalf("error %v, se esperaba ErrorComprobanteInvalido", err)
+				}
+			} else if !errors.Is(err, tc.esperado) {
+				t.Fatalf("error %v, se esperaba %v", err, tc.esperado)
+			}
+		})
+	}
+}
+
+// firmadoPrueba arma y firma el comprobante con un certificado de prueba.
+func firmadoPrueba(t *testing.T, datos datosComprobante) string {
+	t.Helper()
+	raiz, ns, err := xmlComprobante(configPrueba, clavePrueba(t, datos), datos)
+	if err != nil {
+		t.Fatalf("armar XML: %v", err)
+	}
+	documento, err := firmantePrueba(t).firmar(raiz, ns, time.Now())
+	if err != nil {
+		t.Fatalf("firmar: %v", err)
+	}
+	return documento
+}
+
+// Los tres tipos de documento firmados cumplen la estructura v4.4.
+func TestValidarComprobanteEsquema(t *testing.T) {
+	factura := datosTiquete()
+	factura.tipoDocumento = DocFacturaElectronica
+	factura.receptor = &receptorComprobante{nombre: "Ana Mora", tipoID: "01", numero: "112345678", correo: "ana@correo.cr"}
+
+	nota := datosTiquete()
+	nota.tipoDocumento, nota.pagos = DocNotaCredito, nil
+	nota.referencia = &referenciaComprobante{tipoDocumento: DocTiqueteElectronico, clave: clavePrueba(t, nota),
+		fecha: nota.fechaEmision.Add(-time.Hour), codigo: "01", razon: "Anulación"}
+
+	for _, datos := range []datosComprobante{datosTiquete(), factura, nota} {
+		if err := validarComprobante(datos.tipoDocumento, []byte(firmadoPrueba(t, datos))); err != nil {
+			t.Errorf("tipo %s: %v", datos.tipoDocumento, err)
+		}
+	}
+}
+
+// Cambios en el orden, la cardinalidad o los tipos de las líneas y del resumen se rechazan.
+func TestValidarComprobanteEsquemaInvalido(t *testing.T) {
+	datos := datosTiquete()
+	documento := firmadoPrueba(t, datos)
+	casos := []struct {
+		nombre  string
+		cambiar func(string) string
+		detalle string
+	}{
+		{"consecutivo corto", func(d string) string {
+			return strings.Replace(d, "<NumeroConsecutivo>"+datos.consecutivo, "<NumeroConsecutivo>123", 1)
+		}, "/TiqueteElectronico/NumeroConsecutivo"},
+		{"descuento después del subtotal", func(d string) string {
+			inicio, fin := strings.Index(d, "<Descuento>"), strings.Index(d, "</Descuento>")+len("</Descuento>")
+			descuento := d[inicio:fin]
+			d = d[:inicio] + d[fin:]
+			return strings.Replace(d, "</SubTotal>", "</SubTotal>"+descuento, 1)
+		}, "LineaDetalle: Descuento no va en esa posición"},
+		{"monto con seis decimales", func(d string) string {
+			return strings.Replace(d, "<PrecioUnitario>10000.00000", "<PrecioUnitario>10000.000001", 1)
+		}, "LineaDetalle/PrecioUnitario"},
+		{"tarifa de IVA desconocida", func(d string) string {
+			return strings.Replace(d, "<CodigoTarifaIVA>08</CodigoTarifaIVA><Tarifa>", "<CodigoTarifaIVA>99</CodigoTarifaIVA><Tarifa>", 1)
+		}, "Impuesto/CodigoTarifaIVA"},
+		{"sin total del comprobante", func(d string) string {
+			return regexp.MustCompile(`<TotalComprobante>[^<]*</TotalComprobante>`).ReplaceAllString(d, "")
+		}, "ResumenFactura: falta TotalComprobante"},
+		{"elemento desconocido en el resumen", func(d string) string {
+			return strings.Replace(d, "<TotalImpuesto>", "<TotalPropina>1.00000</TotalPropina><TotalImpuesto>", 1)
+		}, "ResumenFactura: TotalPropina no va en esa posición"},
+		{"sin firma", func(d string) string {
+			inicio, fin := strings.Index(d, "<ds:Signature "), strings.Index(d, "</ds:Signature>")+len("</ds:Signature>")
+			return d[:inicio] + d[fin:]
+		}, "falta Signature"},
+		{"XML cortado", func(d string) string { return d[:len(d)-10] }, "XML mal formado"},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			err := validarComprobante(DocTiqueteElectronico, []byte(tc.cambiar(documento)))
+			var invalido *ErrorComprobanteInvalido
+			if !errors.As(err, &invalido) {
+				t.Fatalf("error %v, se esperaba ErrorComprobanteInvalido", err)
+			}
+			if !strings.Contains(err.Error(), tc.detalle) {
+				t.Errorf("el error %q no menciona %q", err, tc.detalle)
+			}
+		})
+	}
+
+	if err := validarComprobante(DocFacturaElectronica, []byte(documento)); err == nil {
+		t.Error("un tiquete no debe pasar como factura electrónica")
+	}
+}
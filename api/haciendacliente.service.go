@@ -0,0 +1,295 @@
+// Envío de comprobantes al API de recepción de Hacienda. El envío pasa por la interfaz
+// ClienteHacienda: en producción y pruebas se usa el API real y con
+// HACIENDA_AMBIENTE=simulado un cliente en memoria que acepta todo.
+
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"restapi/dto"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrComprobanteYaAceptado = errors.New("el comprobante ya fue aceptado por Hacienda")
+
+// EnvioHacienda es el cuerpo que pide el API de recepción.
+type EnvioHacienda struct {
+	Clave        string
+	Fecha        time.Time
+	EmisorTipo   string
+	EmisorID     string
+	ReceptorTipo string
+	ReceptorID   string
+	XMLFirmado   string
+}
+
+// RespuestaHacienda es el estado que reporta Hacienda: recibido, procesando, aceptado,
+// rechazado o error. Mensaje trae el XML de respuesta cuando ya fue procesado.
+type RespuestaHacienda struct {
+	Estado  string
+	Mensaje string
+}
+
+type ClienteHacienda interface {
+	Enviar(envio EnvioHacienda) (RespuestaHacienda, error)
+	ConsultarEstado(clave string) (RespuestaHacienda, error)
+}
+
+// ClienteHaciendaFalso guarda los envíos en memoria y los da por aceptados.
+type ClienteHaciendaFalso struct {
+	mu     sync.Mutex
+	envios map[string]EnvioHacienda
+}
+
+func NuevoClienteHaciendaFalso() *ClienteHaciendaFalso {
+	return &ClienteHaciendaFalso{envios: map[string]EnvioHacienda{}}
+}
+
+func (c *ClienteHaciendaFalso) Enviar(envio EnvioHacienda) (RespuestaHacienda, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.envios[envio.Clave] = envio
+	return RespuestaHacienda{Estado: "recibido"}, nil
+}
+
+func (c *ClienteHaciendaFalso) ConsultarEstado(clave string) (RespuestaHacienda, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.envios[clave]; !ok {
+		return RespuestaHacienda{}, ErrComprobanteNoExiste
+	}
+	return RespuestaHacienda{Estado: "aceptado", Mensaje: "Aceptado (simulado)"}, nil
+}
+
+// clienteHaciendaHTTP usa el API de recepción con un token del IDP de Hacienda.
+type clienteHaciendaHTTP struct {
+	urlToken     string
+	urlRecepcion string
+	clientID     string
+	usuario      string
+	clave        string
+	http         *http.Client
+}
+
+func nuevoClienteHaciendaHTTP(config ConfiguracionHacienda) *clienteHaciendaHTTP {
+	c := &clienteHaciendaHTTP{
+		urlToken:     "https://idp.comprobanteselectronicos.go.cr/auth/realms/rut-stag/protocol/openid-connect/token",
+		urlRecepcion: "https://api-sandbox.comprobanteselectronicos.go.cr/recepcion/v1/",
+		clientID:     "api-stag",
+		usuario:      config.Usuario,
+		clave:        config.Clave,
+		http:         &http.Client{Timeout: 30 * time.Second},
+	}
+	if config.Ambiente == "produccion" {
+		c.urlToken = "https://idp.comprobanteselectronicos.go.cr/auth/realms/rut/protocol/openid-connect/token"
+		c.urlRecepcion = "https://api.comprobanteselectronicos.go.cr/recepcion/v1/"
+		c.clientID = "api-prod"
+	}
+	return c
+}
+
+func (c *clienteHaciendaHTTP) token() (string, error) {
+	form := url.Values{
+		"grant_type": {"password"},
+		"client_id":  {c.clientID},
+		"username":   {c.usuario},
+		"password":   {c.clave},
+	}
+	resp, err := c.http.PostForm(c.urlToken, form)
+	if err != nil {
+		return "", fmt.Errorf("solicitar token de Hacienda: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token de Hacienda: HTTP %d", resp.StatusCode)
+	}
+	var cuerpo struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cuerpo); err != nil {
+		return "", fmt.Errorf("leer token de Hacienda: %w", err)
+	}
+	return cuerpo.AccessToken, nil
+}
+
+func (c *clienteHaciendaHTTP) Enviar(envio EnvioHacienda) (RespuestaHacienda, error) {
+	cuerpo := map[string]interface{}{
+		"clave":          envio.Clave,
+		"fecha":          envio.Fecha.In(zonaCostaRica).Format(time.RFC3339),
+		"emisor":         map[string]string{"tipoIdentificacion": envio.EmisorTipo, "numeroIdentificacion": envio.EmisorID},
+		"comprobanteXml": base64.StdEncoding.EncodeToString([]byte(envio.XMLFirmado)),
+	}
+	if envio.ReceptorID != "" {
+		cuerpo["receptor"] = map[string]string{"tipoIdentificacion": envio.ReceptorTipo, "numeroIdentificacion": envio.ReceptorID}
+	}
+	datos, err := json.Marshal(cuerpo)
+	if err != nil {
+		return RespuestaHacienda{}, err
+	}
+
+	resp, err := c.solicitud(http.MethodPost, "recepcion", datos)
+	if err != nil {
+		return RespuestaHacienda{}, err
+	}
+	defer resp.Body.Close()
+	// 201/202: recibido para procesar; cualquier otro código trae el motivo en X-Error-Cause
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+		return RespuestaHacienda{Estado: "error", Mensaje: fmt.Sprintf("HTTP %d: %s", resp.StatusCode, resp.Header.Get("X-Error-Cause"))}, nil
+	}
+	return RespuestaHacienda{Estado: "recibido"}, nil
+}
+
+func (c *clienteHaciendaHTTP) ConsultarEstado(clave string) (RespuestaHacienda, error) {
+	resp, err := c.solicitud(http.MethodGet, "recepcion/"+clave, nil)
+	if err != nil {
+		return RespuestaHacienda{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return RespuestaHacienda{}, ErrComprobanteNoExiste
+	}
+	if resp.StatusCode != http.StatusOK {
+		return RespuestaHacienda{Estado: "error", Mensaje: fmt.Sprintf("HTTP %d: %s", resp.StatusCode, resp.Header.Get("X-Error-Cause"))}, nil
+	}
+
+	var cuerpo struct {
+		Estado    string `json:"ind-estado"`
+		Respuesta string `json:"respuesta-xml"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cuerpo); err != nil {
+		return RespuestaHacienda{}, fmt.Errorf("leer estado de Hacienda: %w", err)
+	}
+	mensaje := cuerpo.Respuesta
+	if xmlRespuesta, err := base64.StdEncoding.DecodeString(cuerpo.Respuesta); err == nil {
+		mensaje = string(xmlRespuesta)
+	}
+	return RespuestaHacienda{Estado: strings.ToLower(cuerpo.Estado), Mensaje: mensaje}, nil
+}
+
+func (c *clienteHaciendaHTTP) solicitud(metodo, ruta string, cuerpo []byte) (*http.Response, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if cuerpo != nil {
+		body = bytes.NewReader(cuerpo)
+	}
+	req, err := http.NewRequest(metodo, c.urlRecepcion+ruta, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("conectar con Hacienda: %w", err)
+	}
+	return resp, nil
+}
+
+var (
+	clienteHaciendaSimulado = NuevoClienteHaciendaFalso()
+	// clienteHaciendaActual se puede reemplazar (por ejemplo en pruebas) por otro ClienteHacienda
+	clienteHaciendaActual = func(config ConfiguracionHacienda) ClienteHacienda {
+		if config.Ambiente == "simulado" {
+			return clienteHaciendaSimulado
+		}
+		return nuevoClienteHaciendaHTTP(config)
+	}
+)
+
+// EnviarComprobante manda el comprobante a Hacienda y deja registro del resultado.
+func EnviarComprobante(clave string) (*ComprobanteElectronico, error) {
+	comprobante, err := ObtenerComprobante(clave)
+	if err != nil {
+		return nil, err
+	}
+	if comprobante.Estado == ComprobanteAceptado {
+		return nil, ErrComprobanteYaAceptado
+	}
+	config, err := configuracionHacienda()
+	if err != nil {
+		return nil, err
+	}
+	documento, err := XMLComprobante(clave)
+	if err != nil {
+		return nil, err
+	}
+	fecha, err := time.ParseInLocation("2006-01-02T15:04:05", comprobante.FechaEmision, zonaCostaRica)
+	if err != nil {
+		return nil, fmt.Errorf("fecha del comprobante: %w", err)
+	}
+
+	envio := EnvioHacienda{Clave: clave, Fecha: fecha, EmisorTipo: config.TipoIdentificacion, EmisorID: config.Identificacion, XMLFirmado: documento}
+	if comprobante.FacturaID != nil && comprobante.TipoDocumento == DocFacturaElectronica {
+		if f, err := ObtenerFacturaCompleta(*comprobante.FacturaID); err == nil {
+			envio.ReceptorTipo, envio.ReceptorID, _ = identificacionFiscal(f.CedulaCliente)
+		}
+	}
+
+	respuesta, err := clienteHaciendaActual(config).Enviar(envio)
+	if err != nil {
+		return nil, err
+	}
+	estado := ComprobanteEnviado
+	if respuesta.Estado == "error" {
+		estado = ComprobanteError
+	}
+	if err := actualizarEstadoComprobante(clave, estado, respuesta.Mensaje, true); err != nil {
+		return nil, err
+	}
+	return ObtenerComprobante(clave)
+}
+
+// ConsultarComprobante pregunta a Hacienda si el comprobante ya fue aceptado o rechazado.
+func ConsultarComprobante(clave string) (*ComprobanteElectronico, error) {
+	if _, err := ObtenerComprobante(clave); err != nil {
+		return nil, err
+	}
+	config, err := configuracionHacienda()
+	if err != nil {
+		return nil, err
+	}
+	respuesta, err := clienteHaciendaActual(config).ConsultarEstado(clave)
+	if err != nil {
+		return nil, err
+	}
+
+	estado := ComprobanteEnviado // recibido o procesando
+	switch respuesta.Estado {
+	case "aceptado":
+		estado = ComprobanteAceptado
+	case "rechazado":
+		estado = ComprobanteRechazado
+	case "error":
+		estado = ComprobanteError
+	}
+	if err := actualizarEstadoComprobante(clave, estado, respuesta.Mensaje, false); err != nil {
+		return nil, err
+	}
+	return ObtenerComprobante(clave)
+}
+
+func actualizarEstadoComprobante(clave, estado, mensaje string, enviado bool) error {
+	query := "UPDATE comprobantes_electronicos SET estado = @estado, respuesta_hacienda = COALESCE(@mensaje, respuesta_hacienda), actualizado_en = GETDATE()"
+	if enviado {
+		query += ", enviado_en = GETDATE()"
+	}
+	_, err := dto.DB.Exec(query+" WHERE clave = @clave",
+		sql.Named("estado", estado), sql.Named("mensaje", textoONulo(mensaje)), sql.Named("clave", clave))
+	if err != nil {
+		return fmt.Errorf("actualizar estado del comprobante: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const clavePruebaEnvio = "50614032600310112345600100001040000000123112345678"
+
+// configurarHaciendaPrueba deja las variables HACIENDA_* completas y el cliente de
+// Hacienda reemplazado por cliente mientras dure la prueba.
+func configurarHaciendaPrueba(t *testing.T, cliente ClienteHacienda) {
+	t.Helper()
+	for nombre, valor := range map[string]string{
+		"HACIENDA_AMBIENTE": "simulado", "HACIENDA_EMISOR_TIPO_ID": "02", "HACIENDA_EMISOR_ID": "3-101-123456",
+		"HACIENDA_EMISOR_NOMBRE": "Salón de Prueba S.A.", "HACIENDA_ACTIVIDAD": "960201",
+		"HACIENDA_PROVINCIA": "1", "HACIENDA_CANTON": "01", "HACIENDA_DISTRITO": "01",
+		"HACIENDA_OTRAS_SENAS": "Frente al parque", "HACIENDA_CORREO": "facturas@salon.cr",
+		"HACIENDA_P12": "no-se-lee.p12", "HACIENDA_P12_PIN": "1234",
+	} {
+		t.Setenv(nombre, valor)
+	}
+	anterior := clienteHaciendaActual
+	clienteHaciendaActual = func(ConfiguracionHacienda) ClienteHacienda { return cliente }
+	t.Cleanup(func() { clienteHaciendaActual = anterior })
+}
+
+// esperarComprobante simula la lectura del tiquete con el estado indicado.
+func esperarComprobante(mock sqlmock.Sqlmock, estado string) {
+	mock.ExpectQuery(consulta("FROM comprobantes_electronicos WHERE clave = @clave")).
+		WithArgs(sql.Named("clave", clavePruebaEnvio)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "clave", "consecutivo", "tipo_documento", "idFact", "nota_credito_id",
+			"fecha_emision", "estado", "respuesta_hacienda", "creado_en", "enviado_en"}).
+			AddRow(1, clavePruebaEnvio, "00100001040000000123", DocTiqueteElectronico, 5, nil,
+				"2026-03-14T10:30:00", estado, nil, "2026-03-14T10:30:05", nil))
+}
+
+func esperarEstado(mock sqlmock.Sqlmock, estado string, mensaje interface{}) {
+	mock.ExpectExec(consulta("UPDATE comprobantes_electronicos SET estado = @estado")).
+		WithArgs(sql.Named("estado", estado), mensaje, sql.Named("clave", clavePruebaEnvio)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// Con ClienteHaciendaFalso: se envía (enviado), se consulta (aceptado) y un
+// comprobante aceptado ya no se vuelve a enviar.
+func TestEnviarYConsultarComprobante(t *testing.T) {
+	falso := NuevoClienteHaciendaFalso()
+	configurarHaciendaPrueba(t, falso)
+	mock := baseSimulada(t)
+
+	esperarComprobante(mock, ComprobanteGenerado)
+	mock.ExpectQuery(consulta("SELECT CAST(xml_firmado AS NVARCHAR(MAX)) FROM comprobantes_electronicos")).
+		WillReturnRows(sqlmock.NewRows([]string{"xml_firmado"}).AddRow("<TiqueteElectronico/>"))
+	esperarEstado(mock, ComprobanteEnviado, sqlmock.AnyArg())
+	esperarComprobante(mock, ComprobanteEnviado)
+
+	c, err := EnviarComprobante(clavePruebaEnvio)
+	if err != nil {
+		t.Fatalf("enviar: %v", err)
+	}
+	if c.Estado != ComprobanteEnviado {
+		t.Errorf("estado %q tras enviar, se esperaba %q", c.Estado, ComprobanteEnviado)
+	}
+	envio, ok := falso.envios[clavePruebaEnvio]
+	if !ok {
+		t.Fatal("el comprobante no llegó al cliente de Hacienda")
+	}
+	if envio.EmisorTipo != "02" || envio.EmisorID != "3101123456" || envio.XMLFirmado != "<TiqueteElectronico/>" || envio.ReceptorID != "" {
+		t.Errorf("envío inesperado: %+v", envio)
+	}
+
+	esperarComprobante(mock, ComprobanteEnviado)
+	esperarEstado(mock, ComprobanteAceptado, sql.Named("mensaje", sql.NullString{String: "Aceptado (simulado)", Valid: true}))
+	esperarComprobante(mock, ComprobanteAceptado)
+
+	if c, err = ConsultarComprobante(clavePruebaEnvio); err != nil {
+		t.Fatalf("consultar: %v", err)
+	}
+	if c.Estado != ComprobanteAceptado {
+		t.Errorf("estado %q tras consultar, se esperaba %q", c.Estado, ComprobanteAceptado)
+	}
+
+	esperarComprobante(mock, ComprobanteAceptado)
+	if _, err := EnviarComprobante(clavePruebaEnvio); !errors.Is(err, ErrComprobanteYaAceptado) {
+		t.Errorf("reenviar un aceptado: error %v, se esperaba ErrComprobanteYaAceptado", err)
+	}
+}
+
+// Consultar algo que Hacienda no recibió no cambia el estado guardado.
+func TestConsultarComprobanteNoEnviado(t *testing.T) {
+	configurarHaciendaPrueba(t, NuevoClienteHaciendaFalso())
+	mock := baseSimulada(t)
+	esperarComprobante(mock, ComprobanteGenerado)
+
+	if _, err := ConsultarComprobante(clavePruebaEnvio); !errors.Is(err, ErrComprobanteNoExiste) {
+		t.Errorf("error %v, se esperaba ErrComprobanteNoExiste", err)
+	}
+}
+
+// clienteHaciendaFijo responde siempre lo mismo, para recorrer los estados de Hacienda.
+type clienteHaciendaFijo struct {
+	respuesta RespuestaHacienda
+}
+
+func (c clienteHaciendaFijo) Enviar(EnvioHacienda) (RespuestaHacienda, error) {
+	return c.respuesta, nil
+}
+func (c clienteHaciendaFijo) ConsultarEstado(string) (RespuestaHacienda, error) {
+	return c.respuesta, nil
+}
+
+func TestEstadosComprobante(t *testing.T) {
+	t.Run("envío con error", func(t *testing.T) {
+		configurarHaciendaPrueba(t, clienteHaciendaFijo{RespuestaHacienda{Estado: "error", Mensaje: "HTTP 400: clave duplicada"}})
+		mock := baseSimulada(t)
+		esperarComprobante(mock, ComprobanteGenerado)
+		mock.ExpectQuery(consulta("SELECT CAST(xml_firmado AS NVARCHAR(MAX)) FROM comprobantes_electronicos")).
+			WillReturnRows(sqlmock.NewRows([]string{"xml_firmado"}).AddRow("<TiqueteElectronico/>"))
+		esperarEstado(mock, ComprobanteError, sql.Named("mensaje", sql.NullString{String: "HTTP 400: clave duplicada", Valid: true}))
+		esperarComprobante(mock, ComprobanteError)
+
+		if _, err := EnviarComprobante(clavePruebaEnvio); err != nil {
+			t.Fatalf("enviar: %v", err)
+		}
+	})
+
+	casos := []struct {
+		hacienda string
+		estado   string
+	}{
+		{"recibido", ComprobanteEnviado},
+		{"procesando", ComprobanteEnviado},
+		{"aceptado", ComprobanteAceptado},
+		{"rechazado", ComprobanteRechazado},
+		{"error", ComprobanteError},
+	}
+	for _, tc := range casos {
+		t.Run("consulta "+tc.hacienda, func(t *testing.T) {
+			configurarHaciendaPrueba(t, clienteHaciendaFijo{RespuestaHacienda{Estado: tc.hacienda}})
+			mock := baseSimulada(t)
+			esperarComprobante(mock, ComprobanteEnviado)
+			esperarEstado(mock, tc.estado, sql.Named("mensaje", sql.NullString{}))
+			esperarComprobante(mock, tc.estado)
+
+			if _, err := ConsultarComprobante(clavePruebaEnvio); err != nil {
+				t.Fatalf("consultar: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Estructura v4.4 de los comprobantes electrónicos, escrita en Go a partir de los XSD
+// de Hacienda. Cubre los elementos que emite el sistema, con el orden, la cardinalidad
+// y los tipos simples del esquema; cualquier otro elemento se rechaza. Así cada
+// documento se revisa antes de guardarlo sin depender de archivos XSD en el servidor.
+
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// tipoXSD es un tipo simple del esquema: una descripción para el error y la regla.
+type tipoXSD struct {
+	descripcion string
+	valido      func(string) bool
+}
+
+func patronXSD(descripcion, expresion string) *tipoXSD {
+	patron := regexp.MustCompile(`^(?:` + expresion + `)$`)
+	return &tipoXSD{descripcion, patron.MatchString}
+}
+
+// textoXSD es un xs:string con minLength y maxLength (en caracteres).
+func textoXSD(min, max int) *tipoXSD {
+	return &tipoXSD{fmt.Sprintf("texto de %d a %d caracteres", min, max), func(s string) bool {
+		n := utf8.RuneCountInString(s)
+		return n >= min && n <= max && strings.TrimSpace(s) != ""
+	}}
+}
+
+var formatoDecimalXSD = regexp.MustCompile(`^[+-]?(\d*)(?:\.(\d*))?$`)
+
+// decimalXSD es un xs:decimal con totalDigits y fractionDigits. Como en XSD, los
+// facetas se aplican al valor: los ceros a la izquierda y los decimales en cero no cuentan.
+func decimalXSD(digitos, decimales int) *tipoXSD {
+	return &tipoXSD{fmt.Sprintf("decimal de hasta %d dígitos con %d decimales", digitos, decimales), func(s string) bool {
+		partes := formatoDecimalXSD.FindStringSubmatch(s)
+		if partes == nil || partes[1]+partes[2] == "" {
+			return false
+		}
+		entero := strings.TrimLeft(partes[1], "0")
+		fraccion := strings.TrimRight(partes[2], "0")
+		return len(fraccion) <= decimales && len(entero)+len(fraccion) <= digitos
+	}}
+}
+
+func enumeracionXSD(valores ...string) *tipoXSD {
+	return &tipoXSD{"uno de " + strings.Join(valores, ", "), func(s string) bool {
+		for _, v := range valores {
+			if s == v {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+var fechaXSD = &tipoXSD{"fecha y hora con zona (xs:dateTime)", func(s string) bool {
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}}
+
+var (
+	claveXSD       = patronXSD("clave de 50 dígitos", `\d{50}`)
+	codigoXSD      = patronXSD("código de 2 dígitos", `\d{2}`)
+	montoXSD       = decimalXSD(18, 5)
+	correoXSD      = patronXSD("correo electrónico", `[^@\s]{1,64}@[^@\s]+\.[^@\s]+`)
+	identificacion = regla("Identificacion",
+		reglaHoja("Tipo", enumeracionXSD("01", "02", "03", "04", "05", "06")),
+		reglaHoja("Numero", patronXSD("identificación de 9 a 12 dígitos", `\d{9,12}`)),
+	)
+)
+
+// reglaXSD es un elemento del esquema: hoja con tipo simple o secuencia de hijos.
+type reglaXSD struct {
+	nombre   string
+	ns       string // vacío: el namespace del documento
+	min, max int
+	tipo     *tipoXSD
+	hijos    []reglaXSD
+	libre    bool // contenido que no se revisa aquí (la firma)
+}
+
+func regla(nombre string, hijos ...reglaXSD) reglaXSD {
+	return reglaXSD{nombre: nombre, min: 1, max: 1, hijos: hijos}
+}
+
+func reglaHoja(nombre string, tipo *tipoXSD) reglaXSD {
+	return reglaXSD{nombre: nombre, min: 1, max: 1, tipo: tipo}
+}
+
+func (r reglaXSD) veces(min, max int) reglaXSD {
+	r.min, r.max = min, max
+	return r
+}
+
+func (r reglaXSD) opcional() reglaXSD {
+	return r.veces(0, 1)
+}
+
+var emisorXSD = regla("Emisor",
+	reglaHoja("Nombre", textoXSD(1, 100)),
+	identificacion,
+	reglaHoja("NombreComercial", textoXSD(1, 80)).opcional(),
+	regla("Ubicacion",
+		reglaHoja("Provincia", patronXSD("provincia de 1 dígito", `\d`)),
+		reglaHoja("Canton", codigoXSD),
+		reglaHoja("Distrito", codigoXSD),
+		reglaHoja("OtrasSenas", textoXSD(1, 250)),
+	),
+	regla("Telefono",
+		reglaHoja("CodigoPais", patronXSD("código de país de 3 dígitos", `\d{3}`)),
+		reglaHoja("NumTelefono", patronXSD("teléfono de hasta 20 dígitos", `\d{1,20}`)),
+	).opcional(),
+	reglaHoja("CorreoElectronico", correoXSD).veces(1, 4),
+)
+
+var receptorXSD = regla("Receptor",
+	reglaHoja("Nombre", textoXSD(1, 100)),
+	identificacion.opcional(),
+	reglaHoja("CorreoElectronico", correoXSD).veces(0, 4),
+)
+
+var lineaDetalleXSD = regla("LineaDetalle",
+	reglaHoja("NumeroLinea", patronXSD("número de línea de 1 a 1000", `[1-9]\d{0,2}|1000`)),
+	reglaHoja("CodigoCABYS", patronXSD("CABYS de 13 dígitos", `\d{13}`)),
+	reglaHoja("Cantidad", decimalXSD(16, 3)),
+	// El catálogo oficial de unidades es más largo; el sistema solo usa estas dos
+	reglaHoja("UnidadMedida", enumeracionXSD("Sp", "Unid")),
+	reglaHoja("Detalle", textoXSD(1, 200)),
+	reglaHoja("PrecioUnitario", montoXSD),
+	reglaHoja("MontoTotal", montoXSD),
+	regla("Descuento",
+		reglaHoja("MontoDescuento", montoXSD),
+		reglaHoja("CodigoDescuento", codigoXSD),
+		reglaHoja("NaturalezaDescuento", textoXSD(1, 80)).opcional(),
+	).veces(0, 5),
+	reglaHoja("SubTotal", montoXSD),
+	reglaHoja("BaseImponible", montoXSD),
+	regla("Impuesto",
+		reglaHoja("Codigo", codigoXSD),
+		reglaHoja("CodigoTarifaIVA", enumeracionXSD("01", "02", "03", "04", "05", "06", "07", "08", "09", "10", "11")).opcional(),
+		reglaHoja("Tarifa", decimalXSD(4, 2)).opcional(),
+		reglaHoja("Monto", montoXSD),
+	).veces(0, 1000),
+	reglaHoja("ImpuestoAsumidoEmisorFabrica", montoXSD).opcional(),
+	reglaHoja("ImpuestoNeto", montoXSD).opcional(),
+	reglaHoja("MontoTotalLinea", montoXSD),
+)
+
+var resumenFacturaXSD = regla("ResumenFactura",
+	regla("CodigoTipoMoneda",
+		reglaHoja("CodigoMoneda", patronXSD("moneda ISO 4217", `[A-Z]{3}`)),
+		reglaHoja("TipoCambio", montoXSD),
+	).opcional(),
+	reglaHoja("TotalServGravados", montoXSD).opcional(),
+	reglaHoja("TotalServExentos", montoXSD).opcional(),
+	reglaHoja("TotalServExonerado", montoXSD).opcional(),
+	reglaHoja("TotalServNoSujeto", montoXSD).opcional(),
+	reglaHoja("TotalMercanciasGravadas", montoXSD).opcional(),
+	reglaHoja("TotalMercanciasExentas", montoXSD).opcional(),
+	reglaHoja("TotalMercExonerada", montoXSD).opcional(),
+	reglaHoja("TotalMercNoSujeta", montoXSD).opcional(),
+	reglaHoja("TotalGravado", montoXSD).opcional(),
+	reglaHoja("TotalExento", montoXSD).opcional(),
+	reglaHoja("TotalExonerado", montoXSD).opcional(),
+	reglaHoja("TotalNoSujeto", montoXSD).opcional(),
+	reglaHoja("TotalVenta", montoXSD),
+	reglaHoja("TotalDescuentos", montoXSD).opcional(),
+	reglaHoja("TotalVentaNeta", montoXSD),
+	regla("TotalDesgloseImpuesto",
+		reglaHoja("Codigo", codigoXSD),
+		reglaHoja("CodigoTarifaIVA", codigoXSD).opcional(),
+		reglaHoja("TotalMontoImpuesto", montoXSD),
+	).veces(0, 1000),
+	reglaHoja("TotalImpuesto", montoXSD).opcional(),
+	regla("MedioPago",
+		reglaHoja("TipoMedioPago", codigoXSD),
+		reglaHoja("TotalMedioPago", montoXSD).opcional(),
+	).veces(0, 4),
+	reglaHoja("TotalComprobante", montoXSD),
+)
+
+var informacionReferenciaXSD = regla("InformacionReferencia",
+	reglaHoja("TipoDocIR", codigoXSD),
+	reglaHoja("Numero", textoXSD(1, 50)).opcional(),
+	reglaHoja("FechaEmisionIR", fechaXSD),
+	reglaHoja("Codigo", codigoXSD).opcional(),
+	reglaHoja("Razon", textoXSD(1, 180)).opcional(),
+)
+
+// esquemaComprobante devuelve la raíz y el namespace del tipo de documento. La factura
+// exige receptor y la nota de crédito, la referencia al documento que corrige.
+func esquemaComprobante(tipoDocumento string) (reglaXSD, string, bool) {
+	nombre, ns := "FacturaElectronica", nsFacturaElectronica
+	receptor, referencia := receptorXSD, informacionReferenciaXSD.veces(0, 10)
+	switch tipoDocumento {
+	case DocFacturaElectronica:
+	case DocTiqueteElectronico:
+		nombre, ns = "TiqueteElectronico", nsTiqueteElectronico
+		receptor = receptor.opcional()
+	case DocNotaCredito:
+		nombre, ns = "NotaCreditoElectronica", nsNotaCreditoElectronica
+		receptor, referencia = receptor.opcional(), referencia.veces(1, 10)
+	default:
+		return reglaXSD{}, "", false
+	}
+
+	return regla(nombre,
+		reglaHoja("Clave", claveXSD),
+		reglaHoja("ProveedorSistemas", textoXSD(1, 20)),
+		reglaHoja("CodigoActividadEmisor", textoXSD(6, 6)),
+		reglaHoja("NumeroConsecutivo", patronXSD("consecutivo de 20 dígitos", `\d{20}`)),
+		reglaHoja("FechaEmision", fechaXSD),
+		emisorXSD,
+		receptor,
+		reglaHoja("CondicionVenta", codigoXSD),
+		regla("DetalleServicio", lineaDetalleXSD.veces(1, 1000)),
+		resumenFacturaXSD,
+		referencia,
+		reglaXSD{nombre: "Signature", ns: nsDsig, min: 1, max: 1, libre: true},
+	), ns, true
+}
+
+// elementoLeido es un elemento del documento ya parseado.
+type elementoLeido struct {
+	nombre xml.Name
+	texto  string
+	hijos  []*elementoLeido
+}
+
+func leerDocumento(documento []byte) (*elementoLeido, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(documento))
+	var raiz *elementoLeido
+	var abiertos []*elementoLeido
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &elementoLeido{nombre: t.Name}
+			if len(abiertos) > 0 {
+				padre := abiertos[len(abiertos)-1]
+				padre.hijos = append(padre.hijos, e)
+			} else if raiz == nil {
+				raiz = e
+			}
+			abiertos = append(abiertos, e)
+		case xml.EndElement:
+			abiertos = abiertos[:len(abiertos)-1]
+		case xml.CharData:
+			if len(abiertos) > 0 {
+				abiertos[len(abiertos)-1].texto += string(t)
+			}
+		}
+	}
+	if raiz == nil {
+		return nil, fmt.Errorf("el documento está vacío")
+	}
+	return raiz, nil
+}
+
+// revisar valida un elemento que ya coincide en nombre con la regla.
+func (r reglaXSD) revisar(e *elementoLeido, ns, ruta string) []string {
+	ruta += "/" + r.nombre
+	switch {
+	case r.libre:
+		return nil
+	case r.tipo != nil:
+		if len(e.hijos) > 0 {
+			return []string{ruta + ": no admite elementos hijos"}
+		}
+		if !r.tipo.valido(e.texto) {
+			return []string{fmt.Sprintf("%s: %q no es %s", ruta, e.texto, r.tipo.descripcion)}
+		}
+		return nil
+	}
+	if strings.TrimSpace(e.texto) != "" {
+		return []string{ruta + ": no admite texto"}
+	}
+	return revisarSecuencia(r.hijos, e.hijos, ns, ruta)
+}
+
+// revisarSecuencia recorre los hijos contra un xs:sequence: cada regla consume los
+// hijos consecutivos con su nombre; lo que sobra está fuera de orden o no existe.
+func revisarSecuencia(reglas []reglaXSD, hijos []*elementoLeido, ns, ruta string) []string {
+	var detalles []string
+	i := 0
+	for _, r := range reglas {
+		espacio := ns
+		if r.ns != "" {
+			espacio = r.ns
+		}
+		n := 0
+		for ; i < len(hijos) && n < r.max && hijos[i].nombre == (xml.Name{Space: espacio, Local: r.nombre}); i, n = i+1, n+1 {
+			detalles = append(detalles, r.revisar(hijos[i], ns, ruta)...)
+		}
+		if n < r.min {
+			detalles = append(detalles, fmt.Sprintf("%s: falta %s", ruta, r.nombre))
+		}
+	}
+	for ; i < len(hijos); i++ {
+		detalles = append(detalles, fmt.Sprintf("%s: %s no va en esa posición", ruta, hijos[i].nombre.Local))
+	}
+	return detalles
+}
+
+// validarComprobante revisa el documento firmado contra la estructura v4.4 de su tipo.
+func validarComprobante(tipoDocumento string, documento []byte) error {
+	esquema, ns, ok := esquemaComprobante(tipoDocumento)
+	if !ok {
+		return &ErrorComprobanteInvalido{Detalles: []string{"tipo de documento desconocido: " + tipoDocumento}}
+	}
+	raiz, err := leerDocumento(documento)
+	if err != nil {
+		return &ErrorComprobanteInvalido{Detalles: []string{"XML mal formado: " + err.Error()}}
+	}
+	if raiz.nombre != (xml.Name{Space: ns, Local: esquema.nombre}) {
+		return &ErrorComprobanteInvalido{Detalles: []string{fmt.Sprintf("la raíz debe ser %s en %s", esquema.nombre, ns)}}
+	}
+	if detalles := esquema.revisar(raiz, ns, ""); len(detalles) > 0 {
+		return &ErrorComprobanteInvalido{Detalles: detalles}
+	}
+	return nil
+}
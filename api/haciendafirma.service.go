@@ -0,0 +1,284 @@
+// Firma XAdES-EPES de comprobantes electrónicos con el certificado .p12 del emisor.
+// El XML se arma directamente en forma canónica (C14N 1.0 inclusivo: sin elementos
+// vacíos abreviados, atributos ordenados, sin espacios entre etiquetas), así los
+// digest se calculan sobre los mismos bytes que se guardan y se envían.
+
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+const (
+	nsDsig               = "http://www.w3.org/2000/09/xmldsig#"
+	nsXades              = "http://uri.etsi.org/01903/v1.3.2#"
+	algC14N              = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	algRSASHA256         = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algSHA256            = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algEnveloped         = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	tipoSignedProperties = "http://uri.etsi.org/01903#SignedProperties"
+
+	// Política de firma publicada por Hacienda y el SHA-256 del documento
+	politicaFirma     = "https://cdn.comprobanteselectronicos.go.cr/xml-schemas/Resoluci%C3%B3n_General_sobre_disposiciones_t%C3%A9cnicas_comprobantes_electr%C3%B3nicos_para_efectos_tributarios.pdf"
+	politicaFirmaHash = "DWxin1xWOeI8OuWQXazh4VjLWAaCLAA954em7DMh0h8="
+)
+
+// Costa Rica no tiene horario de verano
+var zonaCostaRica = time.FixedZone("CST", -6*60*60)
+
+var ErrCertificadoInvalido = errors.New("el certificado .p12 no tiene una llave RSA con su certificado")
+
+// nodoXML es un elemento del comprobante. Los hijos nil se omiten, así los elementos
+// opcionales se arman con hojaOpcional sin condicionales.
+type nodoXML struct {
+	nombre string
+	attrs  [][2]string
+	texto  string
+	hijos  []*nodoXML
+}
+
+func nodo(nombre string, hijos ...*nodoXML) *nodoXML {
+	return &nodoXML{nombre: nombre, hijos: hijos}
+}
+
+func hoja(nombre, texto string) *nodoXML {
+	return &nodoXML{nombre: nombre, texto: texto}
+}
+
+func hojaOpcional(nombre, texto string) *nodoXML {
+	if texto == "" {
+		return nil
+	}
+	return hoja(nombre, texto)
+}
+
+func (n *nodoXML) attr(nombre, valor string) *nodoXML {
+	n.attrs = append(n.attrs, [2]string{nombre, valor})
+	return n
+}
+
+// canonico devuelve el elemento en C14N. heredados son las declaraciones de namespace
+// en alcance que C14N repite en el primer elemento de un subconjunto del documento
+// (SignedInfo, KeyInfo y SignedProperties se firman por separado).
+func (n *nodoXML) canonico(heredados ...[2]string) string {
+	var b strings.Builder
+	n.escribir(&b, heredados)
+	return b.String()
+}
+
+func (n *nodoXML) escribir(b *strings.Builder, heredados [][2]string) {
+	ns := map[string]string{}
+	for _, h := range heredados {
+		ns[h[0]] = h[1]
+	}
+	var otros [][2]string
+	for _, a := range n.attrs {
+		if a[0] == "xmlns" || strings.HasPrefix(a[0], "xmlns:") {
+			ns[a[0]] = a[1]
+		} else {
+			otros = append(otros, a)
+		}
+	}
+	// C14N: primero los namespaces (el predeterminado antes que los prefijos), luego
+	// los atributos por nombre
+	nombresNS := make([]string, 0, len(ns))
+	for k := range ns {
+		nombresNS = append(nombresNS, k)
+	}
+	sort.Strings(nombresNS)
+	sort.SliceStable(otros, func(i, j int) bool { return otros[i][0] < otros[j][0] })
+
+	b.WriteString("<" + n.nombre)
+	for _, k := range nombresNS {
+		b.WriteString(" " + k + `="` + escaparAtributoXML(ns[k]) + `"`)
+	}
+	for _, a := range otros {
+		b.WriteString(" " + a[0] + `="` + escaparAtributoXML(a[1]) + `"`)
+	}
+	b.WriteString(">")
+	b.WriteString(escaparTextoXML(n.texto))
+	for _, h := range n.hijos {
+		if h != nil {
+			h.escribir(b, nil)
+		}
+	}
+	b.WriteString("</" + n.nombre + ">")
+}
+
+func escaparTextoXML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;").Replace(limpiarTextoXML(s))
+}
+
+func escaparAtributoXML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;").Replace(limpiarTextoXML(s))
+}
+
+// limpiarTextoXML quita caracteres de control que XML 1.0 no admite.
+func limpiarTextoXML(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// firmante guarda la llave y el certificado del emisor.
+type firmante struct {
+	llave *rsa.PrivateKey
+	cert  *x509.Certificate
+}
+
+// cargarFirmante lee el .p12. El paquete pkcs12 solo descifra los algoritmos clásicos
+// (3DES/RC2); un .p12 exportado con AES se reexporta con `openssl pkcs12 -legacy`.
+func cargarFirmante(ruta, pin string) (*firmante, error) {
+	datos, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("leer certificado: %w", err)
+	}
+	bloques, err := pkcs12.ToPEM(datos, pin)
+	if err != nil {
+		return nil, fmt.Errorf("abrir certificado: %w", err)
+	}
+
+	var llave *rsa.PrivateKey
+	var certs []*x509.Certificate
+	for _, b := range bloques {
+		switch b.Type {
+		case "PRIVATE KEY":
+			// ToPEM entrega las llaves RSA en PKCS #1 aunque el tipo diga PRIVATE KEY
+			if k, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+				llave = k
+			}
+		case "CERTIFICATE":
+			if c, err := x509.ParseCertificate(b.Bytes); err == nil {
+				certs = append(certs, c)
+			}
+		}
+	}
+	if llave == nil {
+		return nil, ErrCertificadoInvalido
+	}
+	for _, c := range certs {
+		if pub, ok := c.PublicKey.(*rsa.PublicKey); ok && pub.N.Cmp(llave.N) == 0 {
+			return &firmante{llave: llave, cert: c}, nil
+		}
+	}
+	return nil, ErrCertificadoInvalido
+}
+
+// firmar agrega ds:Signature como último hijo de raiz (firma enveloped) y devuelve el
+// documento completo. nsRaiz es el namespace predeterminado del comprobante.
+func (f *firmante) firmar(raiz *nodoXML, nsRaiz string, momento time.Time) (string, error) {
+	id, err := idAleatorio()
+	if err != nil {
+		return "", err
+	}
+	enAlcance := [][2]string{{"xmlns", nsRaiz}, {"xmlns:ds", nsDsig}}
+
+	digestDocumento := digestSHA256(raiz.canonico())
+
+	pub := f.llave.PublicKey
+	keyInfo := nodo("ds:KeyInfo",
+		nodo("ds:X509Data", hoja("ds:X509Certificate", base64.StdEncoding.EncodeToString(f.cert.Raw))),
+		nodo("ds:KeyValue", nodo("ds:RSAKeyValue",
+			hoja("ds:Modulus", base64.StdEncoding.EncodeToString(pub.N.Bytes())),
+			hoja("ds:Exponent", base64.StdEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())),
+		)),
+	).attr("Id", "KeyInfoId-"+id)
+
+	certDigest := sha256.Sum256(f.cert.Raw)
+	signedProperties := nodo("xades:SignedProperties",
+		nodo("xades:SignedSignatureProperties",
+			hoja("xades:SigningTime", momento.In(zonaCostaRica).Format(time.RFC3339)),
+			nodo("xades:SigningCertificate", nodo("xades:Cert",
+				nodo("xades:CertDigest",
+					nodo("ds:DigestMethod").attr("Algorithm", algSHA256),
+					hoja("ds:DigestValue", base64.StdEncoding.EncodeToString(certDigest[:])),
+				),
+				nodo("xades:IssuerSerial",
+					hoja("ds:X509IssuerName", f.cert.Issuer.String()),
+					hoja("ds:X509SerialNumber", f.cert.SerialNumber.String()),
+				),
+			)),
+			nodo("xades:SignaturePolicyIdentifier", nodo("xades:SignaturePolicyId",
+				nodo("xades:SigPolicyId", hoja("xades:Identifier", politicaFirma)),
+				nodo("xades:SigPolicyHash",
+					nodo("ds:DigestMethod").attr("Algorithm", algSHA256),
+					hoja("ds:DigestValue", politicaFirmaHash),
+				),
+			)),
+		),
+		nodo("xades:SignedDataObjectProperties",
+			nodo("xades:DataObjectFormat",
+				hoja("xades:MimeType", "text/xml"),
+				hoja("xades:Encoding", "UTF-8"),
+			).attr("ObjectReference", "#Reference-"+id),
+		),
+	).attr("Id", "SignedProperties-"+id)
+
+	signedInfo := nodo("ds:SignedInfo",
+		nodo("ds:CanonicalizationMethod").attr("Algorithm", algC14N),
+		nodo("ds:SignatureMethod").attr("Algorithm", algRSASHA256),
+		nodo("ds:Reference",
+			nodo("ds:Transforms", nodo("ds:Transform").attr("Algorithm", algEnveloped)),
+			nodo("ds:DigestMethod").attr("Algorithm", algSHA256),
+			hoja("ds:DigestValue", digestDocumento),
+		).attr("Id", "Reference-"+id).attr("URI", ""),
+		nodo("ds:Reference",
+			nodo("ds:DigestMethod").attr("Algorithm", algSHA256),
+			hoja("ds:DigestValue", digestSHA256(keyInfo.canonico(enAlcance...))),
+		).attr("URI", "#KeyInfoId-"+id),
+		nodo("ds:Reference",
+			nodo("ds:DigestMethod").attr("Algorithm", algSHA256),
+			hoja("ds:DigestValue", digestSHA256(signedProperties.canonico(append(enAlcance, [2]string{"xmlns:xades", nsXades})...))),
+		).attr("Type", tipoSignedProperties).attr("URI", "#SignedProperties-"+id),
+	)
+
+	hash := sha256.Sum256([]byte(signedInfo.canonico(enAlcance...)))
+	valor, err := rsa.SignPKCS1v15(rand.Reader, f.llave, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("firmar comprobante: %w", err)
+	}
+
+	firma := nodo("ds:Signature",
+		signedInfo,
+		hoja("ds:SignatureValue", base64.StdEncoding.EncodeToString(valor)).attr("Id", "SignatureValue-"+id),
+		keyInfo,
+		nodo("ds:Object",
+			nodo("xades:QualifyingProperties", signedProperties).
+				attr("xmlns:xades", nsXades).attr("Id", "QualifyingProperties-"+id).attr("Target", "#Signature-"+id),
+		).attr("Id", "XadesObjectId-"+id),
+	).attr("xmlns:ds", nsDsig).attr("Id", "Signature-"+id)
+
+	raiz.hijos = append(raiz.hijos, firma)
+	return `<?xml version="1.0" encoding="utf-8"?>` + raiz.canonico(), nil
+}
+
+func digestSHA256(s string) string {
+	suma := sha256.Sum256([]byte(s))
+	return base64.StdEncoding.EncodeToString(suma[:])
+}
+
+func idAleatorio() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generar id de firma: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
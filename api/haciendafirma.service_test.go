@@ -0,0 +1,152 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Formas canónicas escritas a mano según C14N 1.0: namespaces antes que atributos (el
+// predeterminado primero), atributos por nombre, sin elementos vacíos abreviados y el
+// escape propio de texto y de atributos.
+func TestNodoXMLCanonico(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		nodo      *nodoXML
+		heredados [][2]string
+		esperado  string
+	}{
+		{"vacío", nodo("Vacio"), nil, `<Vacio></Vacio>`},
+		{
+			"orden de namespaces y atributos",
+			nodo("a:Raiz").attr("z", "1").attr("xmlns:a", "urn:a").attr("b", "2").attr("xmlns", "urn:def"),
+			nil,
+			`<a:Raiz xmlns="urn:def" xmlns:a="urn:a" b="2" z="1"></a:Raiz>`,
+		},
+		{
+			"escape de texto",
+			hoja("Detalle", "1 < 2 & \"3\" > 0 'x'\r"),
+			nil,
+			`<Detalle>1 &lt; 2 &amp; "3" &gt; 0 'x'&#xD;</Detalle>`,
+		},
+		{
+			"escape de atributo",
+			nodo("R").attr("v", "a\"b\tc\nd<e>&"),
+			nil,
+			`<R v="a&quot;b&#x9;c&#xA;d&lt;e>&amp;"></R>`,
+		},
+		{"controles fuera", hoja("T", "a\x01b\x1fc"), nil, `<T>abc</T>`},
+		{"hijos nil omitidos", nodo("P", nil, hoja("H", "x"), nil), nil, `<P><H>x</H></P>`},
+		{
+			"namespaces heredados",
+			nodo("ds:KeyInfo").attr("Id", "k"),
+			[][2]string{{"xmlns:ds", nsDsig}, {"xmlns", "urn:def"}},
+			`<ds:KeyInfo xmlns="urn:def" xmlns:ds="` + nsDsig + `" Id="k"></ds:KeyInfo>`,
+		},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			if got := tc.nodo.canonico(tc.heredados...); got != tc.esperado {
+				t.Errorf("\nobtenido: %s\nesperado: %s", got, tc.esperado)
+			}
+		})
+	}
+}
+
+// subarbol recorta del documento el elemento que abre con apertura y le agrega los
+// namespaces en alcance: es la forma canónica del subconjunto que firma XAdES.
+func subarbol(t *testing.T, documento, apertura, cierre, namespaces string) string {
+	t.Helper()
+	i := strings.Index(documento, apertura)
+	j := strings.Index(documento, cierre)
+	if i < 0 || j < i {
+		t.Fatalf("no se encontró %s en el documento firmado", apertura)
+	}
+	sub := documento[i : j+len(cierre)]
+	nombre := strings.TrimRight(apertura, " >")
+	return nombre + " " + namespaces + strings.TrimPrefix(sub, nombre)
+}
+
+func digestPrueba(s string) string {
+	suma := sha256.Sum256([]byte(s))
+	return base64.StdEncoding.EncodeToString(suma[:])
+}
+
+// Verifica la firma sobre los bytes que se guardan y se envían: los tres digest de
+// SignedInfo (documento sin la firma, KeyInfo y SignedProperties) y el valor RSA.
+func TestFirmarComprobante(t *testing.T) {
+	f := firmantePrueba(t)
+	datos := datosTiquete()
+	raiz, ns, err := xmlComprobante(configPrueba, clavePrueba(t, datos), datos)
+	if err != nil {
+		t.Fatalf("armar XML: %v", err)
+	}
+	sinFirma := raiz.canonico()
+
+	momento := time.Date(2026, 3, 14, 16, 45, 0, 0, time.UTC)
+	documento, err := f.firmar(raiz, ns, momento)
+	if err != nil {
+		t.Fatalf("firmar: %v", err)
+	}
+
+	const declaracion = `<?xml version="1.0" encoding="utf-8"?>`
+	if !strings.HasPrefix(documento, declaracion) {
+		t.Fatalf("falta la declaración XML: %.60s", documento)
+	}
+	cuerpo := strings.TrimPrefix(documento, declaracion)
+	if err := xml.Unmarshal([]byte(cuerpo), new(struct{})); err != nil {
+		t.Fatalf("el documento firmado no es XML válido: %v", err)
+	}
+
+	// Firma enveloped: es el último hijo de la raíz y quitarla devuelve el documento original
+	inicio := strings.Index(cuerpo, "<ds:Signature ")
+	fin := strings.Index(cuerpo, "</ds:Signature>") + len("</ds:Signature>")
+	if inicio < 0 || cuerpo[fin:] != "</TiqueteElectronico>" {
+		t.Fatalf("ds:Signature debe ser el último hijo de la raíz")
+	}
+	if sinLaFirma := cuerpo[:inicio] + cuerpo[fin:]; sinLaFirma != sinFirma {
+		t.Fatalf("firmar alteró el documento:\n%s\n%s", sinLaFirma, sinFirma)
+	}
+
+	enAlcance := `xmlns="` + ns + `" xmlns:ds="` + nsDsig + `"`
+	signedInfo := subarbol(t, cuerpo, "<ds:SignedInfo>", "</ds:SignedInfo>", enAlcance)
+	keyInfo := subarbol(t, cuerpo, "<ds:KeyInfo ", "</ds:KeyInfo>", enAlcance)
+	signedProperties := subarbol(t, cuerpo, "<xades:SignedProperties ", "</xades:SignedProperties>",
+		enAlcance+` xmlns:xades="`+nsXades+`"`)
+
+	digests := regexp.MustCompile(`<ds:DigestValue>([^<]+)</ds:DigestValue>`).FindAllStringSubmatch(signedInfo, -1)
+	if len(digests) != 3 {
+		t.Fatalf("SignedInfo tiene %d referencias, se esperaban 3", len(digests))
+	}
+	for i, esperado := range []string{digestPrueba(sinFirma), digestPrueba(keyInfo), digestPrueba(signedProperties)} {
+		if digests[i][1] != esperado {
+			t.Errorf("referencia %d: digest %s, se esperaba %s", i+1, digests[i][1], esperado)
+		}
+	}
+
+	valor := regexp.MustCompile(`<ds:SignatureValue Id="[^"]+">([^<]+)</ds:SignatureValue>`).FindStringSubmatch(cuerpo)
+	if valor == nil {
+		t.Fatal("falta ds:SignatureValue")
+	}
+	firma, err := base64.StdEncoding.DecodeString(valor[1])
+	if err != nil {
+		t.Fatalf("SignatureValue no es base64: %v", err)
+	}
+	hash := sha256.Sum256([]byte(signedInfo))
+	if err := rsa.VerifyPKCS1v15(&f.llave.PublicKey, crypto.SHA256, hash[:], firma); err != nil {
+		t.Errorf("la firma RSA no corresponde a SignedInfo: %v", err)
+	}
+
+	if !strings.Contains(keyInfo, base64.StdEncoding.EncodeToString(f.cert.Raw)) {
+		t.Error("KeyInfo no lleva el certificado del firmante")
+	}
+	if !strings.Contains(signedProperties, "<xades:SigningTime>2026-03-14T10:45:00-06:00</xades:SigningTime>") {
+		t.Error("SigningTime debe ir en hora de Costa Rica")
+	}
+}
@@ -0,0 +1,74 @@
+// Manejador de la línea de tiempo de estados de una cita.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /citas/:id/historial
+func ObtenerHistorialCita(c *gin.Context) {
+	citaID, ok := citaIDParam(c)
+	if !ok || !autorizarCita(c, int(citaID)) {
+		return
+	}
+
+	historial, err := ObtenerHistorialDeCita(citaID)
+	if err != nil {
+		fmt.Println("❌ Error al obtener historial de cita:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener historial"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cita_id": citaID, "historial": historial})
+}
+
+// actorDeContexto arma el actor a partir del token. Sin token se registra como invitado.
+func actorDeContexto(c *gin.Context) ActorCita {
+	actor := ActorCita{Rol: "invitado"}
+	if rol, ok := c.Get("rol"); ok {
+		if r, ok := rol.(string); ok {
+			actor.Rol = r
+		}
+	}
+	if id, ok := c.Get("usuarioID"); ok {
+		if v, ok := id.(int); ok {
+			actor.ID = sql.NullInt32{Int32: int32(v), Valid: true}
+		}
+	}
+	return actor
+}
+
+// citaIDParam lee el :id de la ruta; si es inválido responde 400 y devuelve ok=false.
+func citaIDParam(c *gin.Context) (int32, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de cita inválido"})
+		return 0, false
+	}
+	return int32(id), true
+}
+
+// responderErrorTransicion traduce los errores de la máquina de estados.
+func responderErrorTransicion(c *gin.Context, err error) {
+	var transicion *ErrorTransicion
+	switch {
+	case errors.As(err, &transicion):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":           fmt.Sprintf("No se puede pasar una cita de '%s' a '%s'", transicion.Desde, transicion.Hacia),
+			"estado_actual":   transicion.Desde,
+			"estados_validos": transicionesCita[transicion.Desde],
+		})
+	case errors.Is(err, ErrCitaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+	default:
+		fmt.Println("❌ Error al cambiar estado de cita:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cambiar el estado de la cita"})
+	}
+}
@@ -0,0 +1,652 @@
+// Manejador de horarios de empleados: plantillas semanales de turnos, excepciones
+// puntuales y solicitudes de ausencia con flujo de aprobación.
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"restapi/dto"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TurnoInput struct {
+	EmpleadoID int32  `json:"empleado_id"`
+	DiaSemana  int    `json:"dia_semana"`  // 0 = domingo ... 6 = sábado
+	HoraInicio string `json:"hora_inicio"` // HH:MM
+	HoraFin    string `json:"hora_fin"`    // HH:MM
+}
+
+type ExcepcionHorarioInput struct {
+	EmpleadoID int32  `json:"empleado_id"`
+	Fecha      string `json:"fecha"` // YYYY-MM-DD
+	Trabaja    bool   `json:"trabaja"`
+	HoraInicio string `json:"hora_inicio"`
+	HoraFin    string `json:"hora_fin"`
+	Motivo     string `json:"motivo"`
+}
+
+type AusenciaInput struct {
+	EmpleadoID  int32  `json:"empleado_id"` // solo lo usa el admin; el empleado solicita para sí mismo
+	FechaInicio string `json:"fecha_inicio"`
+	FechaFin    string `json:"fecha_fin"`
+	Tipo        string `json:"tipo"` // vacaciones, enfermedad, personal
+	Motivo      string `json:"motivo"`
+}
+
+// validarRangoHoras verifica el formato HH:MM y que la hora de fin sea posterior.
+func validarRangoHoras(inicio, fin string) bool {
+	hi, err1 := time.Parse("15:04", inicio)
+	hf, err2 := time.Parse("15:04", fin)
+	return err1 == nil && err2 == nil && hf.After(hi)
+}
+
+func esEmpleado(id int32) bool {
+	var count int
+	err := dto.DB.QueryRow("SELECT COUNT(*) FROM usuarios WHERE id = @id AND rol = 'empleado'", sql.Named("id", id)).Scan(&count)
+	return err == nil && count > 0
+}
+
+// GET /horarios/turnos?empleado_id=
+func ListarTurnos(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+	verTodos := tienePermiso(c, PermisoHorariosVerTodos)
+
+	query := `
+		SELECT t.id, t.empleado_id, u.nombre, t.dia_semana,
+		       CONVERT(VARCHAR(5), t.hora_inicio, 108), CONVERT(VARCHAR(5), t.hora_fin, 108)
+		FROM turnos_empleados t
+		JOIN usuarios u ON u.id = t.empleado_id`
+	var args []interface{}
+
+	// Sin horarios:ver_todos cada empleado solo ve su propia plantilla
+	if !verTodos {
+		query += " WHERE t.empleado_id = @empleado_id"
+		args = append(args, sql.Named("empleado_id", usuarioID))
+	} else if empleadoID := c.Query("empleado_id"); empleadoID != "" {
+		query += " WHERE t.empleado_id = @empleado_id"
+		args = append(args, sql.Named("empleado_id", empleadoID))
+	}
+
+	rows, err := dto.DB.Query(query+" ORDER BY u.nombre, t.dia_semana, t.hora_inicio", args...)
+	if err != nil {
+		fmt.Println("❌ Error al listar turnos:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener turnos"})
+		return
+	}
+	defer rows.Close()
+
+	turnos := []gin.H{}
+	for rows.Next() {
+		var id, empleadoID, diaSemana int
+		var nombre, horaInicio, horaFin string
+		if err := rows.Scan(&id, &empleadoID, &nombre, &diaSemana, &horaInicio, &horaFin); err != nil {
+			fmt.Println("❌ Error en Scan de turno:", err)
+			continue
+		}
+		turnos = append(turnos, gin.H{
+			"id":              id,
+			"empleado_id":     empleadoID,
+			"nombre_empleado": nombre,
+			"dia_semana":      diaSemana,
+			"hora_inicio":     horaInicio,
+			"hora_fin":        horaFin,
+		})
+	}
+
+	c.JSON(http.StatusOK, turnos)
+}
+
+// POST /horarios/turnos
+func CrearTurno(c *gin.Context) {
+	var input TurnoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if input.DiaSemana < 0 || input.DiaSemana > 6 || !validarRangoHoras(input.HoraInicio, input.HoraFin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Día (0-6) y horas HH:MM válidas son obligatorios"})
+		return
+	}
+	if !esEmpleado(input.EmpleadoID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El empleado no existe"})
+		return
+	}
+
+	var id int
+	err := dto.DB.QueryRow(`
+		INSERT INTO turnos_empleados (empleado_id, dia_semana, hora_inicio, hora_fin)
+		OUTPUT INSERTED.id
+		VALUES (@empleado_id, @dia_semana, @hora_inicio, @hora_fin)`,
+		sql.Named("empleado_id", input.EmpleadoID),
+		sql.Named("dia_semana", input.DiaSemana),
+		sql.Named("hora_inicio", input.HoraInicio),
+		sql.Named("hora_fin", input.HoraFin),
+	).Scan(&id)
+	if err != nil {
+		fmt.Println("❌ Error al crear turno:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear turno"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Turno creado correctamente", "id": id})
+}
+
+// PUT /horarios/turnos/:id
+func ActualizarTurno(c *gin.Context) {
+	var input TurnoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if input.DiaSemana < 0 || input.DiaSemana > 6 || !validarRangoHoras(input.HoraInicio, input.HoraFin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Día (0-6) y horas HH:MM válidas son obligatorios"})
+		return
+	}
+
+	res, err := dto.DB.Exec(`
+		UPDATE turnos_empleados
+		SET dia_semana = @dia_semana, hora_inicio = @hora_inicio, hora_fin = @hora_fin, actualizado_en = GETDATE()
+		WHERE id = @id`,
+		sql.Named("dia_semana", input.DiaSemana),
+		sql.Named("hora_inicio", input.HoraInicio),
+		sql.Named("hora_fin", input.HoraFin),
+		sql.Named("id", c.Param("id")),
+	)
+	if err != nil {
+		fmt.Println("❌ Error al actualizar turno:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar turno"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Turno no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Turno actualizado correctamente"})
+}
+
+// DELETE /horarios/turnos/:id
+func EliminarTurno(c *gin.Context) {
+	res, err := dto.DB.Exec("DELETE FROM turnos_empleados WHERE id = @id", sql.Named("id", c.Param("id")))
+	if err != nil {
+		fmt.Println("❌ Error al eliminar turno:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar turno"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Turno no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Turno eliminado correctamente"})
+}
+
+// GET /horarios/excepciones?empleado_id=&desde=&hasta=
+func ListarExcepcionesHorario(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+	verTodos := tienePermiso(c, PermisoHorariosVerTodos)
+
+	query := `
+		SELECT e.id, e.empleado_id, u.nombre, CONVERT(VARCHAR(10), e.fecha, 23), e.trabaja,
+		       CONVERT(VARCHAR(5), e.hora_inicio, 108), CONVERT(VARCHAR(5), e.hora_fin, 108), e.motivo
+		FROM excepciones_horario e
+		JOIN usuarios u ON u.id = e.empleado_id
+		WHERE 1 = 1`
+	var args []interface{}
+
+	if !verTodos {
+		query += " AND e.empleado_id = @empleado_id"
+		args = append(args, sql.Named("empleado_id", usuarioID))
+	} else if empleadoID := c.Query("empleado_id"); empleadoID != "" {
+		query += " AND e.empleado_id = @empleado_id"
+		args = append(args, sql.Named("empleado_id", empleadoID))
+	}
+	if desde := c.Query("desde"); desde != "" {
+		query += " AND e.fecha >= @desde"
+		args = append(args, sql.Named("desde", desde))
+	}
+	if hasta := c.Query("hasta"); hasta != "" {
+		query += " AND e.fecha <= @hasta"
+		args = append(args, sql.Named("hasta", hasta))
+	}
+
+	rows, err := dto.DB.Query(query+" ORDER BY e.fecha", args...)
+	if err != nil {
+		fmt.Println("❌ Error al listar excepciones de horario:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener excepciones de horario"})
+		return
+	}
+	defer rows.Close()
+
+	excepciones := []gin.H{}
+	for rows.Next() {
+		var id, empleadoID int
+		var nombre, fecha string
+		var trabaja bool
+		var horaInicio, horaFin, motivo sql.NullString
+		if err := rows.Scan(&id, &empleadoID, &nombre, &fecha, &trabaja, &horaInicio, &horaFin, &motivo); err != nil {
+			fmt.Println("❌ Error en Scan de excepción:", err)
+			continue
+		}
+		excepciones = append(excepciones, gin.H{
+			"id":              id,
+			"empleado_id":     empleadoID,
+			"nombre_empleado": nombre,
+			"fecha":           fecha,
+			"trabaja":         trabaja,
+			"hora_inicio":     nullStringToString(horaInicio),
+			"hora_fin":        nullStringToString(horaFin),
+			"motivo":          nullStringToString(motivo),
+		})
+	}
+
+	c.JSON(http.StatusOK, excepciones)
+}
+
+// validarExcepcion revisa la fecha y, si el empleado trabaja, el rango de horas.
+func validarExcepcion(input ExcepcionHorarioInput) string {
+	if _, err := time.Parse("2006-01-02", input.Fecha); err != nil {
+		return "Formato de fecha inválido. Use YYYY-MM-DD"
+	}
+	if input.Trabaja && !validarRangoHoras(input.HoraInicio, input.HoraFin) {
+		return "Si el empleado trabaja, indique horas HH:MM válidas"
+	}
+	return ""
+}
+
+// nullSiVacio convierte un texto vacío en NULL para la base de datos.
+func nullSiVacio(valor string) sql.NullString {
+	return sql.NullString{String: valor, Valid: valor != ""}
+}
+
+// POST /horarios/excepciones
+func CrearExcepcionHorario(c *gin.Context) {
+	var input ExcepcionHorarioInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := validarExcepcion(input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if !esEmpleado(input.EmpleadoID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El empleado no existe"})
+		return
+	}
+	if !input.Trabaja {
+		input.HoraInicio, input.HoraFin = "", ""
+	}
+
+	var id int
+	err := dto.DB.QueryRow(`
+		INSERT INTO excepciones_horario (empleado_id, fecha, trabaja, hora_inicio, hora_fin, motivo)
+		OUTPUT INSERTED.id
+		VALUES (@empleado_id, @fecha, @trabaja, @hora_inicio, @hora_fin, @motivo)`,
+		sql.Named("empleado_id", input.EmpleadoID),
+		sql.Named("fecha", input.Fecha),
+		sql.Named("trabaja", input.Trabaja),
+		sql.Named("hora_inicio", nullSiVacio(input.HoraInicio)),
+		sql.Named("hora_fin", nullSiVacio(input.HoraFin)),
+		sql.Named("motivo", nullSiVacio(input.Motivo)),
+	).Scan(&id)
+	if err != nil {
+		fmt.Println("❌ Error al crear excepción de horario:", err)
+		c.JSON(http.StatusConflict, gin.H{"error": "No se pudo crear la excepción. ¿Ya existe una para ese empleado y fecha?"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Excepción de horario creada correctamente", "id": id})
+}
+
+// PUT /horarios/excepciones/:id
+func ActualizarExcepcionHorario(c *gin.Context) {
+	var input ExcepcionHorarioInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := validarExcepcion(input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if !input.Trabaja {
+		input.HoraInicio, input.HoraFin = "", ""
+	}
+
+	res, err := dto.DB.Exec(`
+		UPDATE excepciones_horario
+		SET fecha = @fecha, trabaja = @trabaja, hora_inicio = @hora_inicio, hora_fin = @hora_fin, motivo = @motivo
+		WHERE id = @id`,
+		sql.Named("fecha", input.Fecha),
+		sql.Named("trabaja", input.Trabaja),
+		sql.Named("hora_inicio", nullSiVacio(input.HoraInicio)),
+		sql.Named("hora_fin", nullSiVacio(input.HoraFin)),
+		sql.Named("motivo", nullSiVacio(input.Motivo)),
+		sql.Named("id", c.Param("id")),
+	)
+	if err != nil {
+		fmt.Println("❌ Error al actualizar excepción de horario:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar excepción de horario"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Excepción de horario no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Excepción de horario actualizada correctamente"})
+}
+
+// DELETE /horarios/excepciones/:id
+func EliminarExcepcionHorario(c *gin.Context) {
+	res, err := dto.DB.Exec("DELETE FROM excepciones_horario WHERE id = @id", sql.Named("id", c.Param("id")))
+	if err != nil {
+		fmt.Println("❌ Error al eliminar excepción de horario:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar excepción de horario"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Excepción de horario no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Excepción de horario eliminada correctamente"})
+}
+
+// GET /ausencias?estado=&empleado_id=
+func ListarAusencias(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+	verTodos := tienePermiso(c, PermisoHorariosVerTodos)
+
+	query := `
+		SELECT a.id, a.empleado_id, u.nombre, CONVERT(VARCHAR(10), a.fecha_inicio, 23),
+		       CONVERT(VARCHAR(10), a.fecha_fin, 23), a.tipo, a.motivo, a.estado,
+		       a.revisado_por, a.comentario_revision, a.creado_en
+		FROM ausencias_empleados a
+		JOIN usuarios u ON u.id = a.empleado_id
+		WHERE 1 = 1`
+	var args []interface{}
+
+	if !verTodos {
+		query += " AND a.empleado_id = @empleado_id"
+		args = append(args, sql.Named("empleado_id", usuarioID))
+	} else if empleadoID := c.Query("empleado_id"); empleadoID != "" {
+		query += " AND a.empleado_id = @empleado_id"
+		args = append(args, sql.Named("empleado_id", empleadoID))
+	}
+	if estado := c.Query("estado"); estado != "" {
+		query += " AND a.estado = @estado"
+		args = append(args, sql.Named("estado", estado))
+	}
+
+	rows, err := dto.DB.Query(query+" ORDER BY a.fecha_inicio DESC", args...)
+	if err != nil {
+		fmt.Println("❌ Error al listar ausencias:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener ausencias"})
+		return
+	}
+	defer rows.Close()
+
+	ausencias := []gin.H{}
+	for rows.Next() {
+		var id, empleadoID int
+		var nombre, fechaInicio, fechaFin, tipo, estado string
+		var motivo, comentario sql.NullString
+		var revisadoPor sql.NullInt32
+		var creadoEn sql.NullTime
+		if err := rows.Scan(&id, &empleadoID, &nombre, &fechaInicio, &fechaFin, &tipo, &motivo, &estado, &revisadoPor, &comentario, &creadoEn); err != nil {
+			fmt.Println("❌ Error en Scan de ausencia:", err)
+			continue
+		}
+		ausencia := gin.H{
+			"id":                  id,
+			"empleado_id":         empleadoID,
+			"nombre_empleado":     nombre,
+			"fecha_inicio":        fechaInicio,
+			"fecha_fin":           fechaFin,
+			"tipo":                tipo,
+			"motivo":              nullStringToString(motivo),
+			"estado":              estado,
+			"revisado_por":        nil,
+			"comentario_revision": nullStringToString(comentario),
+			"creado_en":           creadoEn.Time,
+		}
+		if revisadoPor.Valid {
+			ausencia["revisado_por"] = revisadoPor.Int32
+		}
+		ausencias = append(ausencias, ausencia)
+	}
+
+	c.JSON(http.StatusOK, ausencias)
+}
+
+// POST /ausencias - el empleado solicita para sí mismo; quien revisa ausencias registra ya aprobada
+func SolicitarAusencia(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+
+	var input AusenciaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	inicio, err1 := time.Parse("2006-01-02", input.FechaInicio)
+	fin, err2 := time.Parse("2006-01-02", input.FechaFin)
+	if err1 != nil || err2 != nil || fin.Before(inicio) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rango de fechas inválido. Use YYYY-MM-DD"})
+		return
+	}
+	tiposPermitidos := map[string]bool{"vacaciones": true, "enfermedad": true, "personal": true}
+	if !tiposPermitidos[input.Tipo] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de ausencia inválido (vacaciones, enfermedad, personal)"})
+		return
+	}
+
+	estado := "pendiente"
+	var revisadoPor interface{}
+	// Quien puede revisar ausencias la registra ya aprobada y para cualquier empleado
+	if !tienePermiso(c, PermisoAusenciasRevisar) {
+		input.EmpleadoID = int32(usuarioID.(int))
+	} else {
+		if !esEmpleado(input.EmpleadoID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El empleado no existe"})
+			return
+		}
+		estado = "aprobada"
+		revisadoPor = usuarioID
+	}
+
+	var id int
+	err := dto.DB.QueryRow(`
+		INSERT INTO ausencias_empleados (empleado_id, fecha_inicio, fecha_fin, tipo, motivo, estado, revisado_por, revisado_en)
+		OUTPUT INSERTED.id
+		VALUES (@empleado_id, @fecha_inicio, @fecha_fin, @tipo, @motivo, @estado, @revisado_por,
+		        CASE WHEN @estado = 'aprobada' THEN GETDATE() END)`,
+		sql.Named("empleado_id", input.EmpleadoID),
+		sql.Named("fecha_inicio", input.FechaInicio),
+		sql.Named("fecha_fin", input.FechaFin),
+		sql.Named("tipo", input.Tipo),
+		sql.Named("motivo", nullSiVacio(input.Motivo)),
+		sql.Named("estado", estado),
+		sql.Named("revisado_por", revisadoPor),
+	).Scan(&id)
+	if err != nil {
+		fmt.Println("❌ Error al registrar ausencia:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar ausencia"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Ausencia registrada correctamente", "id": id, "estado": estado})
+}
+
+// citasAfectadasPorAusencia devuelve las citas activas asignadas al empleado dentro del rango.
+func citasAfectadasPorAusencia(ausenciaID string) ([]gin.H, error) {
+	rows, err := dto.DB.Query(`
+		SELECT c.id, c.fecha_hora, c.estado
+		FROM ausencias_empleados a
+		JOIN citas c ON c.empleado_id = a.empleado_id
+		WHERE a.id = @id
+		  AND CAST(c.fecha_hora AS DATE) BETWEEN a.fecha_inicio AND a.fecha_fin
+		  AND c.estado IN ('pendiente', 'confirmada')
+		ORDER BY c.fecha_hora`,
+		sql.Named("id", ausenciaID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	citas := []gin.H{}
+	for rows.Next() {
+		var id int
+		var fechaHora time.Time
+		var estado string
+		if err := rows.Scan(&id, &fechaHora, &estado); err != nil {
+			return nil, err
+		}
+		citas = append(citas, gin.H{"id": id, "fecha_hora": fechaHora, "estado": estado})
+	}
+	return citas, rows.Err()
+}
+
+// revisarAusencia cambia una solicitud pendiente a aprobada o rechazada.
+func revisarAusencia(c *gin.Context, nuevoEstado string) {
+	usuarioID, _ := c.Get("usuarioID")
+
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var input struct {
+		Comentario string `json:"comentario"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	var estado string
+	err := dto.DB.QueryRow("SELECT estado FROM ausencias_empleados WHERE id = @id", sql.Named("id", id)).Scan(&estado)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ausencia no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar ausencia"})
+		return
+	}
+	if estado != "pendiente" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solo se pueden revisar ausencias pendientes"})
+		return
+	}
+
+	_, err = dto.DB.Exec(`
+		UPDATE ausencias_empleados
+		SET estado = @estado, revisado_por = @revisado_por, revisado_en = GETDATE(), comentario_revision = @comentario
+		WHERE id = @id`,
+		sql.Named("estado", nuevoEstado),
+		sql.Named("revisado_por", usuarioID),
+		sql.Named("comentario", nullSiVacio(input.Comentario)),
+		sql.Named("id", id),
+	)
+	if err != nil {
+		fmt.Println("❌ Error al revisar ausencia:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al revisar ausencia"})
+		return
+	}
+
+	respuesta := gin.H{"mensaje": "Ausencia " + nuevoEstado + " correctamente"}
+	if nuevoEstado == "aprobada" {
+		// Avisamos qué citas quedan con un empleado ausente para reasignarlas
+		citas, err := citasAfectadasPorAusencia(id)
+		if err != nil {
+			fmt.Println("⚠️ No se pudieron consultar las citas afectadas:", err)
+		}
+		respuesta["citas_afectadas"] = citas
+	}
+
+	c.JSON(http.StatusOK, respuesta)
+}
+
+// PUT /ausencias/:id/aprobar
+func AprobarAusencia(c *gin.Context) {
+	revisarAusencia(c, "aprobada")
+}
+
+// PUT /ausencias/:id/rechazar
+func RechazarAusencia(c *gin.Context) {
+	revisarAusencia(c, "rechazada")
+}
+
+// PUT /ausencias/:id/cancelar - el empleado retira su solicitud pendiente
+func CancelarAusencia(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+	id := c.Param("id")
+
+	var empleadoID int
+	var estado string
+	err := dto.DB.QueryRow("SELECT empleado_id, estado FROM ausencias_empleados WHERE id = @id", sql.Named("id", id)).
+		Scan(&empleadoID, &estado)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ausencia no encontrada"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar ausencia"})
+		return
+	}
+
+	revisor := tienePermiso(c, PermisoAusenciasRevisar)
+	if !revisor && usuarioID != empleadoID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tiene permiso para cancelar esta ausencia"})
+		return
+	}
+	if !revisor && estado != "pendiente" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solo se pueden cancelar solicitudes pendientes"})
+		return
+	}
+
+	_, err = dto.DB.Exec("UPDATE ausencias_empleados SET estado = 'cancelada' WHERE id = @id", sql.Named("id", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cancelar ausencia"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Ausencia cancelada correctamente"})
+}
+
+// responderConTurnos envuelve un listado de citas del día junto con quién trabaja ese día.
+func responderConTurnos(c *gin.Context, dia time.Time, citas interface{}) {
+	empleados, err := EmpleadosEnTurno(dia)
+	if err != nil {
+		fmt.Println("❌ Error al calcular empleados en turno:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener empleados en turno"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"fecha":              dia.Format("2006-01-02"),
+		"citas":              citas,
+		"empleados_en_turno": empleados,
+	})
+}
+
+// GET /empleados/en-turno?fecha=YYYY-MM-DD
+func ListarEmpleadosEnTurno(c *gin.Context) {
+	fecha, err := time.Parse("2006-01-02", c.Query("fecha"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+		return
+	}
+
+	empleados, err := EmpleadosEnTurno(fecha)
+	if err != nil {
+		fmt.Println("❌ Error al calcular empleados en turno:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener empleados en turno"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"fecha": fecha.Format("2006-01-02"), "empleados": empleados})
+}
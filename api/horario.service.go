@@ -0,0 +1,215 @@
+// Jornadas de trabajo de los empleados: plantillas semanales, excepciones puntuales
+// y ausencias aprobadas. Alimenta el motor de disponibilidad y la asignación de citas.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+var (
+	ErrEmpleadoFueraDeTurno = errors.New("el empleado no trabaja en ese horario")
+	ErrEmpleadoAusente      = errors.New("el empleado tiene una ausencia aprobada ese día")
+)
+
+// Origen de la jornada calculada para un empleado
+const (
+	origenPlantilla    = "plantilla"
+	origenExcepcion    = "excepcion"
+	origenAusencia     = "ausencia"
+	origenHorarioSalon = "horario_salon"
+)
+
+type intervalo struct {
+	inicio time.Time
+	fin    time.Time
+}
+
+func (i intervalo) contiene(inicio, fin time.Time) bool {
+	return !inicio.Before(i.inicio) && !fin.After(i.fin)
+}
+
+// jornadaEmpleado son las ventanas en que el empleado trabaja un día concreto.
+// Sin turnos significa que ese día no trabaja.
+type jornadaEmpleado struct {
+	turnos []intervalo
+	origen string
+}
+
+func (j jornadaEmpleado) cubre(inicio, fin time.Time) bool {
+	for _, t := range j.turnos {
+		if t.contiene(inicio, fin) {
+			return true
+		}
+	}
+	return false
+}
+
+// enDia combina la fecha del día con la hora de una columna TIME.
+func enDia(dia, hora time.Time) time.Time {
+	return time.Date(dia.Year(), dia.Month(), dia.Day(), hora.Hour(), hora.Minute(), 0, 0, time.UTC)
+}
+
+// jornadasDelDia calcula la jornada de cada empleado con esta prioridad: ausencia
+// aprobada, excepción del día, plantilla semanal. Los empleados que nunca han tenido
+// plantilla se consideran disponibles durante el horario del salón.
+func jornadasDelDia(dia time.Time, empleados []int32) (map[int32]jornadaEmpleado, error) {
+	dia = inicioDelDia(dia)
+	fecha := dia.Format("2006-01-02")
+	jornadas := make(map[int32]jornadaEmpleado, len(empleados))
+
+	ausentes := map[int32]bool{}
+	rows, err := dto.DB.Query(`
+		SELECT DISTINCT empleado_id FROM ausencias_empleados
+		WHERE estado = 'aprobada' AND @fecha BETWEEN fecha_inicio AND fecha_fin`,
+		sql.Named("fecha", fecha))
+	if err != nil {
+		return nil, fmt.Errorf("consultar ausencias: %w", err)
+	}
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("leer ausencia: %w", err)
+		}
+		ausentes[id] = true
+	}
+	rows.Close()
+
+	excepciones := map[int32]jornadaEmpleado{}
+	rows, err = dto.DB.Query(`
+		SELECT empleado_id, trabaja, hora_inicio, hora_fin FROM excepciones_horario
+		WHERE fecha = @fecha`,
+		sql.Named("fecha", fecha))
+	if err != nil {
+		return nil, fmt.Errorf("consultar excepciones de horario: %w", err)
+	}
+	for rows.Next() {
+		var id int32
+		var trabaja bool
+		var horaInicio, horaFin sql.NullTime
+		if err := rows.Scan(&id, &trabaja, &horaInicio, &horaFin); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("leer excepción de horario: %w", err)
+		}
+		j := jornadaEmpleado{origen: origenExcepcion}
+		if trabaja && horaInicio.Valid && horaFin.Valid {
+			j.turnos = append(j.turnos, intervalo{inicio: enDia(dia, horaInicio.Time), fin: enDia(dia, horaFin.Time)})
+		}
+		excepciones[id] = j
+	}
+	rows.Close()
+
+	plantillas := map[int32][]intervalo{}
+	conPlantilla := map[int32]bool{}
+	rows, err = dto.DB.Query("SELECT empleado_id, dia_semana, hora_inicio, hora_fin FROM turnos_empleados")
+	if err != nil {
+		return nil, fmt.Errorf("consultar turnos: %w", err)
+	}
+	for rows.Next() {
+		var id int32
+		var diaSemana int
+		var horaInicio, horaFin time.Time
+		if err := rows.Scan(&id, &diaSemana, &horaInicio, &horaFin); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("leer turno: %w", err)
+		}
+		conPlantilla[id] = true
+		if time.Weekday(diaSemana) == dia.Weekday() {
+			plantillas[id] = append(plantillas[id], intervalo{inicio: enDia(dia, horaInicio), fin: enDia(dia, horaFin)})
+		}
+	}
+	rows.Close()
+
+	salon, abierto, err := jornadaSalon(dia)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range empleados {
+		switch {
+		case ausentes[id]:
+			jornadas[id] = jornadaEmpleado{origen: origenAusencia}
+		case excepciones[id].origen != "":
+			jornadas[id] = excepciones[id]
+		case conPlantilla[id]:
+			jornadas[id] = jornadaEmpleado{turnos: plantillas[id], origen: origenPlantilla}
+		case abierto:
+			jornadas[id] = jornadaEmpleado{turnos: []intervalo{salon}, origen: origenHorarioSalon}
+		default:
+			jornadas[id] = jornadaEmpleado{origen: origenHorarioSalon}
+		}
+	}
+
+	return jornadas, nil
+}
+
+// VerificarEmpleadoEnTurno comprueba que el empleado trabaje durante todo el servicio.
+func VerificarEmpleadoEnTurno(empleadoID, servicioID int32, fechaHora time.Time) error {
+	duracion, _, err := tiemposServicio(servicioID)
+	if err != nil {
+		return err
+	}
+
+	inicio := relojLocal(fechaHora)
+	jornadas, err := jornadasDelDia(inicio, []int32{empleadoID})
+	if err != nil {
+		return err
+	}
+
+	jornada := jornadas[empleadoID]
+	if jornada.origen == origenAusencia {
+		return ErrEmpleadoAusente
+	}
+	if !jornada.cubre(inicio, inicio.Add(duracion)) {
+		return ErrEmpleadoFueraDeTurno
+	}
+	return nil
+}
+
+// EmpleadoEnTurno describe a un empleado que trabaja en la fecha consultada.
+type EmpleadoEnTurno struct {
+	ID     int32         `json:"id"`
+	Nombre string        `json:"nombre"`
+	Origen string        `json:"origen"`
+	Turnos []TurnoDelDia `json:"turnos"`
+}
+
+type TurnoDelDia struct {
+	Inicio string `json:"inicio"`
+	Fin    string `json:"fin"`
+}
+
+// EmpleadosEnTurno lista quién trabaja en la fecha indicada.
+func EmpleadosEnTurno(fecha time.Time) ([]EmpleadoEnTurno, error) {
+	empleados, err := empleadosActivos()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int32, 0, len(empleados))
+	for _, e := range empleados {
+		ids = append(ids, e.ID)
+	}
+	jornadas, err := jornadasDelDia(fecha, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	enTurno := []EmpleadoEnTurno{}
+	for _, e := range empleados {
+		jornada := jornadas[e.ID]
+		if len(jornada.turnos) == 0 {
+			continue
+		}
+		item := EmpleadoEnTurno{ID: e.ID, Nombre: e.Nombre, Origen: jornada.origen}
+		for _, t := range jornada.turnos {
+			item.Turnos = append(item.Turnos, TurnoDelDia{Inicio: t.inicio.Format("15:04"), Fin: t.fin.Format("15:04")})
+		}
+		enTurno = append(enTurno, item)
+	}
+	return enTurno, nil
+}
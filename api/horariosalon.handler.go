@@ -0,0 +1,348 @@
+// Manejador del horario de atención del salón: plantilla semanal y días especiales
+// (feriados, cierres y horarios reducidos).
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"restapi/dto"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HorarioSalonInput struct {
+	Abierto      bool   `json:"abierto"`
+	HoraApertura string `json:"hora_apertura"` // HH:MM
+	HoraCierre   string `json:"hora_cierre"`   // HH:MM
+}
+
+type DiaEspecialInput struct {
+	FechaInicio  string `json:"fecha_inicio"` // YYYY-MM-DD
+	FechaFin     string `json:"fecha_fin"`    // opcional: igual a fecha_inicio si viene vacía
+	Abierto      bool   `json:"abierto"`
+	HoraApertura string `json:"hora_apertura"`
+	HoraCierre   string `json:"hora_cierre"`
+	Tipo         string `json:"tipo"` // feriado, cierre, horario_especial
+	Motivo       string `json:"motivo"`
+}
+
+var tiposDiaEspecial = map[string]bool{"feriado": true, "cierre": true, "horario_especial": true}
+
+// validar normaliza el rango y devuelve un mensaje de error o "" si es válido.
+func (in *DiaEspecialInput) validar() string {
+	if in.FechaFin == "" {
+		in.FechaFin = in.FechaInicio
+	}
+	inicio, err1 := time.Parse("2006-01-02", in.FechaInicio)
+	fin, err2 := time.Parse("2006-01-02", in.FechaFin)
+	if err1 != nil || err2 != nil {
+		return "Formato de fecha inválido. Use YYYY-MM-DD"
+	}
+	if fin.Before(inicio) {
+		return "La fecha final no puede ser anterior a la inicial"
+	}
+	if !tiposDiaEspecial[in.Tipo] {
+		return "Tipo inválido. Use feriado, cierre u horario_especial"
+	}
+	if in.Abierto && !validarRangoHoras(in.HoraApertura, in.HoraCierre) {
+		return "Si el salón abre, indique hora_apertura y hora_cierre (HH:MM) válidas"
+	}
+	if !in.Abierto {
+		in.HoraApertura, in.HoraCierre = "", ""
+	}
+	return ""
+}
+
+// GET /horario-salon
+func ListarHorarioSalon(c *gin.Context) {
+	rows, err := dto.DB.Query(`
+		SELECT dia_semana, abierto, CONVERT(VARCHAR(5), hora_apertura, 108), CONVERT(VARCHAR(5), hora_cierre, 108)
+		FROM horario_salon ORDER BY dia_semana`)
+	if err != nil {
+		fmt.Println("❌ Error al listar horario del salón:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el horario"})
+		return
+	}
+	defer rows.Close()
+
+	configurados := map[int]gin.H{}
+	for rows.Next() {
+		var dia int
+		var abierto bool
+		var apertura, cierre sql.NullString
+		if err := rows.Scan(&dia, &abierto, &apertura, &cierre); err != nil {
+			fmt.Println("❌ Error en Scan de horario del salón:", err)
+			continue
+		}
+		configurados[dia] = gin.H{
+			"dia_semana":    dia,
+			"abierto":       abierto,
+			"hora_apertura": nullStringToString(apertura),
+			"hora_cierre":   nullStringToString(cierre),
+		}
+	}
+
+	// Los días sin configurar muestran el horario por defecto
+	semana := make([]gin.H, 0, 7)
+	for dia := 0; dia < 7; dia++ {
+		if h, ok := configurados[dia]; ok {
+			semana = append(semana, h)
+			continue
+		}
+		semana = append(semana, gin.H{
+			"dia_semana":    dia,
+			"abierto":       true,
+			"hora_apertura": fmt.Sprintf("%02d:00", horaApertura),
+			"hora_cierre":   fmt.Sprintf("%02d:00", horaCierre),
+		})
+	}
+
+	c.JSON(http.StatusOK, semana)
+}
+
+// GET /horario-salon/dia?fecha=YYYY-MM-DD devuelve el horario efectivo de una fecha.
+func ObtenerHorarioDia(c *gin.Context) {
+	fecha, err := time.Parse("2006-01-02", c.Query("fecha"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+		return
+	}
+
+	horario, err := HorarioDelDia(fecha)
+	if err != nil {
+		fmt.Println("❌ Error al obtener horario del día:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el horario"})
+		return
+	}
+
+	c.JSON(http.StatusOK, horario)
+}
+
+// PUT /horario-salon/:dia  (0 = domingo ... 6 = sábado)
+func ActualizarHorarioSalon(c *gin.Context) {
+	dia, err := strconv.Atoi(c.Param("dia"))
+	if err != nil || dia < 0 || dia > 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dia debe estar entre 0 (domingo) y 6 (sábado)"})
+		return
+	}
+
+	var input HorarioSalonInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if input.Abierto && !validarRangoHoras(input.HoraApertura, input.HoraCierre) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Si el salón abre, indique hora_apertura y hora_cierre (HH:MM) válidas"})
+		return
+	}
+	if !input.Abierto {
+		input.HoraApertura, input.HoraCierre = "", ""
+	}
+
+	_, err = dto.DB.Exec(`
+		MERGE horario_salon AS destino
+		USING (SELECT @dia AS dia_semana) AS origen ON destino.dia_semana = origen.dia_semana
+		WHEN MATCHED THEN
+			UPDATE SET abierto = @abierto, hora_apertura = @apertura, hora_cierre = @cierre, actualizado_en = GETDATE()
+		WHEN NOT MATCHED THEN
+			INSERT (dia_semana, abierto, hora_apertura, hora_cierre) VALUES (@dia, @abierto, @apertura, @cierre);`,
+		sql.Named("dia", dia),
+		sql.Named("abierto", input.Abierto),
+		sql.Named("apertura", nullSiVacio(input.HoraApertura)),
+		sql.Named("cierre", nullSiVacio(input.HoraCierre)),
+	)
+	if err != nil {
+		fmt.Println("❌ Error al actualizar horario del salón:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el horario"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Horario del salón actualizado correctamente"})
+}
+
+// GET /dias-especiales?desde=YYYY-MM-DD
+func ListarDiasEspeciales(c *gin.Context) {
+	query := `
+		SELECT id, CONVERT(VARCHAR(10), fecha_inicio, 23), CONVERT(VARCHAR(10), fecha_fin, 23), abierto,
+		       CONVERT(VARCHAR(5), hora_apertura, 108), CONVERT(VARCHAR(5), hora_cierre, 108), tipo, motivo
+		FROM dias_especiales`
+	var args []interface{}
+	if desde := c.Query("desde"); desde != "" {
+		if _, err := time.Parse("2006-01-02", desde); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+			return
+		}
+		query += " WHERE fecha_fin >= @desde"
+		args = append(args, sql.Named("desde", desde))
+	}
+
+	rows, err := dto.DB.Query(query+" ORDER BY fecha_inicio", args...)
+	if err != nil {
+		fmt.Println("❌ Error al listar días especiales:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener días especiales"})
+		return
+	}
+	defer rows.Close()
+
+	dias := []gin.H{}
+	for rows.Next() {
+		var id int
+		var inicio, fin, tipo string
+		var abierto bool
+		var apertura, cierre, motivo sql.NullString
+		if err := rows.Scan(&id, &inicio, &fin, &abierto, &apertura, &cierre, &tipo, &motivo); err != nil {
+			fmt.Println("❌ Error en Scan de día especial:", err)
+			continue
+		}
+		dias = append(dias, gin.H{
+			"id":            id,
+			"fecha_inicio":  inicio,
+			"fecha_fin":     fin,
+			"abierto":       abierto,
+			"hora_apertura": nullStringToString(apertura),
+			"hora_cierre":   nullStringToString(cierre),
+			"tipo":          tipo,
+			"motivo":        nullStringToString(motivo),
+		})
+	}
+
+	c.JSON(http.StatusOK, dias)
+}
+
+// POST /dias-especiales
+func CrearDiaEspecial(c *gin.Context) {
+	var input DiaEspecialInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := input.validar(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var id int
+	err := dto.DB.QueryRow(`
+		INSERT INTO dias_especiales (fecha_inicio, fecha_fin, abierto, hora_apertura, hora_cierre, tipo, motivo)
+		OUTPUT INSERTED.id
+		VALUES (@inicio, @fin, @abierto, @apertura, @cierre, @tipo, @motivo)`,
+		sql.Named("inicio", input.FechaInicio),
+		sql.Named("fin", input.FechaFin),
+		sql.Named("abierto", input.Abierto),
+		sql.Named("apertura", nullSiVacio(input.HoraApertura)),
+		sql.Named("cierre", nullSiVacio(input.HoraCierre)),
+		sql.Named("tipo", input.Tipo),
+		sql.Named("motivo", nullSiVacio(input.Motivo)),
+	).Scan(&id)
+	if err != nil {
+		fmt.Println("❌ Error al crear día especial:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear el día especial"})
+		return
+	}
+
+	citas, err := citasActivasEnRango(input.FechaInicio, input.FechaFin)
+	if err != nil {
+		fmt.Println("❌ Error al buscar citas afectadas:", err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Día especial creado correctamente", "id": id, "citas_activas_en_rango": citas})
+}
+
+// PUT /dias-especiales/:id
+func ActualizarDiaEspecial(c *gin.Context) {
+	var input DiaEspecialInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := input.validar(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	res, err := dto.DB.Exec(`
+		UPDATE dias_especiales
+		SET fecha_inicio = @inicio, fecha_fin = @fin, abierto = @abierto, hora_apertura = @apertura,
+		    hora_cierre = @cierre, tipo = @tipo, motivo = @motivo
+		WHERE id = @id`,
+		sql.Named("inicio", input.FechaInicio),
+		sql.Named("fin", input.FechaFin),
+		sql.Named("abierto", input.Abierto),
+		sql.Named("apertura", nullSiVacio(input.HoraApertura)),
+		sql.Named("cierre", nullSiVacio(input.HoraCierre)),
+		sql.Named("tipo", input.Tipo),
+		sql.Named("motivo", nullSiVacio(input.Motivo)),
+		sql.Named("id", c.Param("id")),
+	)
+	if err != nil {
+		fmt.Println("❌ Error al actualizar día especial:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el día especial"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Día especial no encontrado"})
+		return
+	}
+
+	citas, err := citasActivasEnRango(input.FechaInicio, input.FechaFin)
+	if err != nil {
+		fmt.Println("❌ Error al buscar citas afectadas:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Día especial actualizado correctamente", "citas_activas_en_rango": citas})
+}
+
+// DELETE /dias-especiales/:id
+func EliminarDiaEspecial(c *gin.Context) {
+	res, err := dto.DB.Exec("DELETE FROM dias_especiales WHERE id = @id", sql.Named("id", c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar el día especial"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Día especial no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Día especial eliminado correctamente"})
+}
+
+// citasActivasEnRango lista las citas pendientes o confirmadas entre dos fechas para
+// que el admin sepa a quién reprogramar cuando marca un cierre.
+func citasActivasEnRango(desde, hasta string) ([]gin.H, error) {
+	rows, err := dto.DB.Query(`
+		SELECT id, fecha_hora, estado, usuario_id, nombre_invitado
+		FROM citas
+		WHERE CAST(fecha_hora AS DATE) BETWEEN @desde AND @hasta
+		  AND estado IN ('pendiente', 'confirmada')
+		ORDER BY fecha_hora`,
+		sql.Named("desde", desde),
+		sql.Named("hasta", hasta),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	citas := []gin.H{}
+	for rows.Next() {
+		var id int
+		var fechaHora time.Time
+		var estado string
+		var usuarioID sql.NullInt32
+		var invitado sql.NullString
+		if err := rows.Scan(&id, &fechaHora, &estado, &usuarioID, &invitado); err != nil {
+			return nil, err
+		}
+		cita := gin.H{"id": id, "fecha_hora": fechaHora, "estado": estado, "usuario_id": nil, "nombre_invitado": nullStringToString(invitado)}
+		if usuarioID.Valid {
+			cita["usuario_id"] = usuarioID.Int32
+		}
+		citas = append(citas, cita)
+	}
+	return citas, rows.Err()
+}
@@ -0,0 +1,123 @@
+// Horario de atención del salón: plantilla semanal, horarios especiales y días de
+// cierre (feriados, remodelaciones). Lo consumen la disponibilidad y las jornadas.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+var (
+	ErrSalonCerrado        = errors.New("el salón está cerrado ese día")
+	ErrFueraDeHorarioSalon = errors.New("la cita queda fuera del horario de atención del salón")
+)
+
+// Origen del horario calculado para un día
+const (
+	origenSemanal  = "semanal"
+	origenEspecial = "especial"
+	origenDefecto  = "defecto"
+)
+
+// HorarioDia es el horario efectivo del salón en una fecha concreta.
+type HorarioDia struct {
+	Fecha    string `json:"fecha"`
+	Abierto  bool   `json:"abierto"`
+	Apertura string `json:"apertura,omitempty"`
+	Cierre   string `json:"cierre,omitempty"`
+	Origen   string `json:"origen"`
+	Tipo     string `json:"tipo,omitempty"`
+	Motivo   string `json:"motivo,omitempty"`
+
+	jornada intervalo
+}
+
+// HorarioDelDia resuelve el horario con esta prioridad: día especial (el rango más
+// corto que contenga la fecha), plantilla semanal y, si no hay plantilla, 8:00 a 18:00.
+func HorarioDelDia(dia time.Time) (HorarioDia, error) {
+	dia = inicioDelDia(dia)
+	h := HorarioDia{Fecha: dia.Format("2006-01-02")}
+
+	var abierto bool
+	var apertura, cierre sql.NullTime
+	var tipo string
+	var motivo sql.NullString
+	err := dto.DB.QueryRow(`
+		SELECT TOP 1 abierto, hora_apertura, hora_cierre, tipo, motivo
+		FROM dias_especiales
+		WHERE @fecha BETWEEN fecha_inicio AND fecha_fin
+		ORDER BY DATEDIFF(DAY, fecha_inicio, fecha_fin), id DESC`,
+		sql.Named("fecha", h.Fecha)).Scan(&abierto, &apertura, &cierre, &tipo, &motivo)
+	switch {
+	case err == nil:
+		h.Origen, h.Tipo, h.Motivo = origenEspecial, tipo, motivo.String
+		return completarHorario(h, dia, abierto, apertura, cierre), nil
+	case err != sql.ErrNoRows:
+		return h, fmt.Errorf("consultar días especiales: %w", err)
+	}
+
+	err = dto.DB.QueryRow(`
+		SELECT abierto, hora_apertura, hora_cierre FROM horario_salon WHERE dia_semana = @dia`,
+		sql.Named("dia", int(dia.Weekday()))).Scan(&abierto, &apertura, &cierre)
+	switch {
+	case err == nil:
+		h.Origen = origenSemanal
+		return completarHorario(h, dia, abierto, apertura, cierre), nil
+	case err != sql.ErrNoRows:
+		return h, fmt.Errorf("consultar horario semanal: %w", err)
+	}
+
+	h.Origen = origenDefecto
+	h.Abierto = true
+	h.jornada = intervalo{inicio: dia.Add(horaApertura * time.Hour), fin: dia.Add(horaCierre * time.Hour)}
+	h.Apertura, h.Cierre = h.jornada.inicio.Format("15:04"), h.jornada.fin.Format("15:04")
+	return h, nil
+}
+
+func completarHorario(h HorarioDia, dia time.Time, abierto bool, apertura, cierre sql.NullTime) HorarioDia {
+	if !abierto || !apertura.Valid || !cierre.Valid {
+		return h
+	}
+	h.Abierto = true
+	h.jornada = intervalo{inicio: enDia(dia, apertura.Time), fin: enDia(dia, cierre.Time)}
+	h.Apertura, h.Cierre = h.jornada.inicio.Format("15:04"), h.jornada.fin.Format("15:04")
+	return h
+}
+
+// VerificarHorarioSalon comprueba que la cita quepa en el horario de atención del día.
+// La creación y la reprogramación ya lo cumplen al pasar por VerificarDisponibilidad;
+// esta es la comprobación de las rutas que escriben la cita sin buscar un slot
+// (edición del admin, confirmación). Igual que en los slots, la limpieza puede
+// terminar después del cierre.
+func VerificarHorarioSalon(servicioID int32, fechaHora time.Time) error {
+	duracion, _, err := tiemposServicio(servicioID)
+	if err != nil {
+		return err
+	}
+
+	inicio := relojLocal(fechaHora)
+	jornada, abierto, err := jornadaSalon(inicio)
+	if err != nil {
+		return err
+	}
+	if !abierto {
+		return ErrSalonCerrado
+	}
+	if !jornada.contiene(inicio, inicio.Add(duracion)) {
+		return ErrFueraDeHorarioSalon
+	}
+	return nil
+}
+
+// jornadaSalon devuelve la ventana de atención del día y si el salón abre.
+func jornadaSalon(dia time.Time) (intervalo, bool, error) {
+	h, err := HorarioDelDia(dia)
+	if err != nil {
+		return intervalo{}, false, err
+	}
+	return h.jornada, h.Abierto, nil
+}
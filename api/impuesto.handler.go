@@ -0,0 +1,150 @@
+// Manejador de categorías de IVA, sus tarifas por vigencia y su asignación a
+// servicios y productos.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TarifaImpuestoInput struct {
+	Tarifa       *float64 `json:"tarifa"`        // porcentaje: 13 = 13 %
+	VigenteDesde string   `json:"vigente_desde"` // YYYY-MM-DD; vacío = hoy
+}
+
+// validar revisa la tarifa y devuelve la fecha de vigencia.
+func (in TarifaImpuestoInput) validar() (float64, time.Time, error) {
+	if in.Tarifa == nil || *in.Tarifa < 0 || *in.Tarifa > 100 {
+		return 0, time.Time{}, errors.New("La tarifa debe estar entre 0 y 100")
+	}
+	if in.VigenteDesde == "" {
+		return *in.Tarifa, inicioDelDia(relojLocal(time.Now())), nil
+	}
+	desde, err := time.Parse("2006-01-02", in.VigenteDesde)
+	if err != nil {
+		return 0, time.Time{}, errors.New("vigente_desde debe tener formato YYYY-MM-DD")
+	}
+	return *in.Tarifa, desde, nil
+}
+
+// GET /impuestos/categorias
+func ListarCategoriasImpuestoHandler(c *gin.Context) {
+	categorias, err := ListarCategoriasImpuesto()
+	if err != nil {
+		fmt.Println("❌ Error al listar categorías de impuesto:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar categorías de impuesto"})
+		return
+	}
+	c.JSON(http.StatusOK, categorias)
+}
+
+// POST /impuestos/categorias  {"codigo": "...", "nombre": "...", "tarifa": 13, "vigente_desde": "2025-01-01"}
+func CrearCategoriaImpuestoHandler(c *gin.Context) {
+	var input struct {
+		Codigo      string  `json:"codigo"`
+		Nombre      string  `json:"nombre"`
+		Descripcion *string `json:"descripcion"`
+		TarifaImpuestoInput
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Codigo) == "" || strings.TrimSpace(input.Nombre) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código y nombre son obligatorios"})
+		return
+	}
+	tarifa, desde, err := input.validar()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := CrearCategoriaImpuesto(strings.TrimSpace(input.Codigo), strings.TrimSpace(input.Nombre), input.Descripcion, tarifa, desde)
+	if err != nil {
+		fmt.Println("❌ Error al crear categoría de impuesto:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo crear la categoría (¿código repetido?)"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Categoría de impuesto creada", "id": id})
+}
+
+// POST /impuestos/categorias/:id/tasas  {"tarifa": 4, "vigente_desde": "2026-07-01"}
+func ProgramarTarifaImpuestoHandler(c *gin.Context) {
+	categoriaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de categoría inválido"})
+		return
+	}
+
+	var input TarifaImpuestoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	tarifa, desde, err := input.validar()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = ProgramarTarifaImpuesto(categoriaID, tarifa, desde)
+	switch {
+	case errors.Is(err, ErrCategoriaImpuestoNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "La categoría de impuesto no existe"})
+		return
+	case errors.Is(err, ErrTarifaDuplicada):
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya hay una tarifa con esa fecha de vigencia"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al programar tarifa:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo guardar la tarifa"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Tarifa programada", "vigente_desde": desde.Format("2006-01-02")})
+}
+
+// PUT /servicios/:id/categoria-impuesto  {"categoria_id": 2}
+func AsignarImpuestoServicio(c *gin.Context) {
+	asignarCategoriaImpuesto(c, "servicios")
+}
+
+// PUT /productos/:id/categoria-impuesto  {"categoria_id": 2}
+func AsignarImpuestoProducto(c *gin.Context) {
+	asignarCategoriaImpuesto(c, "productos")
+}
+
+func asignarCategoriaImpuesto(c *gin.Context, tabla string) {
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	// categoria_id null vuelve a la categoría general
+	var input struct {
+		CategoriaID *int `json:"categoria_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	err = AsignarCategoriaImpuesto(tabla, itemID, input.CategoriaID)
+	switch {
+	case errors.Is(err, ErrCategoriaImpuestoNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "La categoría de impuesto no existe o está inactiva"})
+		return
+	case errors.Is(err, ErrItemNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "El producto o servicio no existe"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al asignar categoría de impuesto:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo asignar la categoría"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Categoría de impuesto asignada"})
+}
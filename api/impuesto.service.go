@@ -0,0 +1,248 @@
+// Categorías de IVA y sus tarifas por fecha de vigencia. Las líneas de factura guardan
+// la tarifa con que se emitieron; aquí solo se decide cuál aplica a una línea nueva.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"sort"
+	"time"
+)
+
+// codigoCategoriaGeneral es la categoría de los ítems sin categoría asignada
+const codigoCategoriaGeneral = "general"
+
+var (
+	ErrCategoriaImpuestoNoExiste = errors.New("la categoría de impuesto no existe")
+	ErrSinTarifaVigente          = errors.New("la categoría no tiene una tarifa vigente para la fecha de la factura")
+	ErrTarifaDuplicada           = errors.New("ya hay una tarifa con esa fecha de vigencia")
+)
+
+type TasaImpuesto struct {
+	ID           int     `json:"id"`
+	Tarifa       float64 `json:"tarifa"`
+	VigenteDesde string  `json:"vigente_desde"`
+}
+
+type CategoriaImpuesto struct {
+	ID            int            `json:"id"`
+	Codigo        string         `json:"codigo"`
+	Nombre        string         `json:"nombre"`
+	Descripcion   *string        `json:"descripcion"`
+	Activo        bool           `json:"activo"`
+	TarifaVigente *float64       `json:"tarifa_vigente"`
+	Tasas         []TasaImpuesto `json:"tasas"`
+}
+
+// DesgloseImpuesto agrupa las líneas de una factura por categoría y tarifa.
+type DesgloseImpuesto struct {
+	Codigo   string  `json:"codigo"`
+	Nombre   string  `json:"nombre"`
+	Tarifa   float64 `json:"tarifa"`
+	Base     float64 `json:"base"`
+	Impuesto float64 `json:"impuesto"`
+}
+
+// ListarCategoriasImpuesto devuelve las categorías con su historial de tarifas y la
+// tarifa vigente hoy.
+func ListarCategoriasImpuesto() ([]CategoriaImpuesto, error) {
+	rows, err := dto.DB.Query(`
+		SELECT c.id, c.codigo, c.nombre, c.descripcion, c.activo,
+		       t.id, t.tarifa, CONVERT(VARCHAR(10), t.vigente_desde, 23), CASE WHEN t.vigente_desde <= CAST(GETDATE() AS DATE) THEN 1 ELSE 0 END
+		FROM categorias_impuesto c
+		LEFT JOIN tasas_impuesto t ON t.categoria_id = c.id
+		ORDER BY c.id, t.vigente_desde`)
+	if err != nil {
+		return nil, fmt.Errorf("listar categorías de impuesto: %w", err)
+	}
+	defer rows.Close()
+
+	categorias := []CategoriaImpuesto{}
+	for rows.Next() {
+		var cat CategoriaImpuesto
+		var tasaID sql.NullInt32
+		var tarifa sql.NullFloat64
+		var vigenteDesde sql.NullString
+		var vigente bool
+		if err := rows.Scan(&cat.ID, &cat.Codigo, &cat.Nombre, &cat.Descripcion, &cat.Activo, &tasaID, &tarifa, &vigenteDesde, &vigente); err != nil {
+			return nil, fmt.Errorf("leer categoría de impuesto: %w", err)
+		}
+		if n := len(categorias); n == 0 || categorias[n-1].ID != cat.ID {
+			cat.Tasas = []TasaImpuesto{}
+			categorias = append(categorias, cat)
+		}
+		actual := &categorias[len(categorias)-1]
+		if tasaID.Valid {
+			actual.Tasas = append(actual.Tasas, TasaImpuesto{ID: int(tasaID.Int32), Tarifa: tarifa.Float64, VigenteDesde: vigenteDesde.String})
+			// Vienen ordenadas por fecha: la última ya vigente es la actual
+			if vigente {
+				t := tarifa.Float64
+				actual.TarifaVigente = &t
+			}
+		}
+	}
+	return categorias, rows.Err()
+}
+
+// CrearCategoriaImpuesto registra la categoría con su primera tarifa.
+func CrearCategoriaImpuesto(codigo, nombre string, descripcion *string, tarifa float64, vigenteDesde time.Time) (int, error) {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO categorias_impuesto (codigo, nombre, descripcion) OUTPUT INSERTED.id
+		VALUES (@codigo, @nombre, @descripcion)`,
+		sql.Named("codigo", codigo),
+		sql.Named("nombre", nombre),
+		sql.Named("descripcion", descripcion),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("crear categoría de impuesto: %w", err)
+	}
+	if err := insertarTasaImpuesto(tx, id, tarifa, vigenteDesde); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return id, nil
+}
+
+// ProgramarTarifaImpuesto agrega una tarifa nueva a partir de la fecha indicada. Las
+// líneas ya emitidas conservan la tarifa que tenían.
+func ProgramarTarifaImpuesto(categoriaID int, tarifa float64, vigenteDesde time.Time) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var existe int
+	err = tx.QueryRow("SELECT 1 FROM categorias_impuesto WHERE id = @id", sql.Named("id", categoriaID)).Scan(&existe)
+	if err == sql.ErrNoRows {
+		return ErrCategoriaImpuestoNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar categoría de impuesto: %w", err)
+	}
+	if err := insertarTasaImpuesto(tx, categoriaID, tarifa, vigenteDesde); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+func insertarTasaImpuesto(tx *sql.Tx, categoriaID int, tarifa float64, vigenteDesde time.Time) error {
+	var duplicada int
+	err := tx.QueryRow("SELECT COUNT(*) FROM tasas_impuesto WHERE categoria_id = @categoria_id AND vigente_desde = @desde",
+		sql.Named("categoria_id", categoriaID), sql.Named("desde", vigenteDesde.Format("2006-01-02"))).Scan(&duplicada)
+	if err != nil {
+		return fmt.Errorf("consultar tarifas: %w", err)
+	}
+	if duplicada > 0 {
+		return ErrTarifaDuplicada
+	}
+
+	_, err = tx.Exec("INSERT INTO tasas_impuesto (categoria_id, tarifa, vigente_desde) VALUES (@categoria_id, @tarifa, @desde)",
+		sql.Named("categoria_id", categoriaID),
+		sql.Named("tarifa", tarifa),
+		sql.Named("desde", vigenteDesde.Format("2006-01-02")),
+	)
+	if err != nil {
+		return fmt.Errorf("guardar tarifa: %w", err)
+	}
+	return nil
+}
+
+// AsignarCategoriaImpuesto fija la categoría de un servicio o producto (tabla
+// "servicios" o "productos"). categoriaID nil vuelve a la categoría general.
+func AsignarCategoriaImpuesto(tabla string, itemID int, categoriaID *int) error {
+	if tabla != "servicios" && tabla != "productos" {
+		return fmt.Errorf("tabla sin categoría de impuesto: %s", tabla)
+	}
+	if categoriaID != nil {
+		var existe int
+		err := dto.DB.QueryRow("SELECT 1 FROM categorias_impuesto WHERE id = @id AND activo = 1", sql.Named("id", *categoriaID)).Scan(&existe)
+		if err == sql.ErrNoRows {
+			return ErrCategoriaImpuestoNoExiste
+		} else if err != nil {
+			return fmt.Errorf("consultar categoría de impuesto: %w", err)
+		}
+	}
+
+	res, err := dto.DB.Exec("UPDATE "+tabla+" SET categoria_impuesto_id = @categoria_id WHERE id = @id",
+		sql.Named("categoria_id", categoriaID), sql.Named("id", itemID))
+	if err != nil {
+		return fmt.Errorf("asignar categoría de impuesto: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrItemNoExiste
+	}
+	return nil
+}
+
+// tarifaParaLinea resuelve la categoría (la general si el ítem no tiene) y la tarifa
+// vigente en la fecha de la factura.
+func tarifaParaLinea(tx *sql.Tx, facturaID int, categoriaID sql.NullInt32) (int, float64, error) {
+	var id int
+	var tarifa float64
+	err := tx.QueryRow(`
+		SELECT TOP 1 t.categoria_id, t.tarifa
+		FROM tasas_impuesto t
+		JOIN factura f ON f.idFact = @factura_id
+		WHERE t.categoria_id = COALESCE(@categoria_id, (SELECT id FROM categorias_impuesto WHERE codigo = @general))
+		  AND t.vigente_desde <= f.fecha
+		ORDER BY t.vigente_desde DESC`,
+		sql.Named("factura_id", facturaID),
+		sql.Named("categoria_id", categoriaID),
+		sql.Named("general", codigoCategoriaGeneral),
+	).Scan(&id, &tarifa)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrSinTarifaVigente
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("consultar tarifa de impuesto: %w", err)
+	}
+	return id, tarifa, nil
+}
+
+// impuestoDeLinea aplica la tarifa (en porcentaje) al subtotal de la línea.
+func impuestoDeLinea(subtotal, tarifa float64) float64 {
+	return redondear(subtotal * tarifa / 100)
+}
+
+// desgloseImpuestos agrupa las líneas por categoría y tarifa, de mayor a menor tarifa.
+func desgloseImpuestos(detalles []DetalleFactura) []DesgloseImpuesto {
+	type clave struct {
+		codigo string
+		tarifa float64
+	}
+	grupos := map[clave]*DesgloseImpuesto{}
+	var orden []clave
+	for _, d := range detalles {
+		k := clave{d.CodigoImpuesto, d.TarifaImpuesto}
+		g, ok := grupos[k]
+		if !ok {
+			g = &DesgloseImpuesto{Codigo: d.CodigoImpuesto, Nombre: d.NombreImpuesto, Tarifa: d.TarifaImpuesto}
+			grupos[k] = g
+			orden = append(orden, k)
+		}
+		g.Base = redondear(g.Base + d.Subtotal)
+		g.Impuesto = redondear(g.Impuesto + d.Impuesto)
+	}
+
+	sort.SliceStable(orden, func(i, j int) bool { return orden[i].tarifa > orden[j].tarifa })
+	desglose := make([]DesgloseImpuesto, 0, len(orden))
+	for _, k := range orden {
+		desglose = append(desglose, *grupos[k])
+	}
+	return desglose
+}
@@ -0,0 +1,84 @@
+// Ingresos por día: lo facturado, lo acreditado en notas de crédito (anulaciones
+// incluidas), lo cobrado y lo reembolsado. Cada movimiento cuenta el día en que ocurre.
+// Las propinas se muestran aparte: son de los empleados, no ingreso del salón.
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+type IngresoDia struct {
+	Fecha       string  `json:"fecha,omitempty"` // vacío en los totales
+	Facturas    int     `json:"facturas"`
+	Facturado   float64 `json:"facturado"`
+	Acreditado  float64 `json:"acreditado"`
+	Anulado     float64 `json:"anulado"` // parte de lo acreditado que viene de anulaciones
+	Neto        float64 `json:"neto"`
+	Cobrado     float64 `json:"cobrado"`
+	Reembolsado float64 `json:"reembolsado"`
+	Propinas    float64 `json:"propinas"`
+}
+
+// IngresosPorDia resume el rango [inicio, fin]. Las facturas en borrador no cuentan:
+// una factura entra el día en que se cerró.
+func IngresosPorDia(inicio, fin time.Time) ([]IngresoDia, error) {
+	rows, err := dto.DB.Query(`
+		SELECT CONVERT(VARCHAR(10), m.dia, 23), SUM(m.facturas), SUM(m.facturado), SUM(m.acreditado),
+		       SUM(m.anulado), SUM(m.cobrado), SUM(m.reembolsado), SUM(m.propinas)
+		FROM (
+			SELECT COALESCE(CAST(f.cerrada_en AS DATE), f.fecha) AS dia, 1 AS facturas, f.total AS facturado,
+			       0 AS acreditado, 0 AS anulado, 0 AS cobrado, 0 AS reembolsado, 0 AS propinas
+			FROM factura f
+			WHERE f.estado <> @borrador
+			UNION ALL
+			SELECT CAST(n.creado_en AS DATE), 0, 0, n.total,
+			       CASE WHEN n.tipo = @anulacion THEN n.total ELSE 0 END, 0, n.monto_reembolsado, 0
+			FROM notas_credito n
+			UNION ALL
+			SELECT CAST(p.creado_en AS DATE), 0, 0, 0, 0, p.monto, 0, p.propina
+			FROM pagos_factura p
+		) m
+		WHERE m.dia BETWEEN @inicio AND @fin
+		GROUP BY m.dia
+		ORDER BY m.dia`,
+		sql.Named("borrador", EstadoFacturaBorrador),
+		sql.Named("anulacion", TipoNotaAnulacion),
+		sql.Named("inicio", inicio.Format("2006-01-02")),
+		sql.Named("fin", fin.Format("2006-01-02")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("consultar ingresos: %w", err)
+	}
+	defer rows.Close()
+
+	dias := []IngresoDia{}
+	for rows.Next() {
+		var d IngresoDia
+		if err := rows.Scan(&d.Fecha, &d.Facturas, &d.Facturado, &d.Acreditado, &d.Anulado, &d.Cobrado, &d.Reembolsado, &d.Propinas); err != nil {
+			return nil, fmt.Errorf("leer ingresos: %w", err)
+		}
+		d.Neto = redondear(d.Facturado - d.Acreditado)
+		dias = append(dias, d)
+	}
+	return dias, rows.Err()
+}
+
+// totalIngresos suma los días del reporte.
+func totalIngresos(dias []IngresoDia) IngresoDia {
+	var t IngresoDia
+	for _, d := range dias {
+		t.Facturas += d.Facturas
+		t.Facturado = redondear(t.Facturado + d.Facturado)
+		t.Acreditado = redondear(t.Acreditado + d.Acreditado)
+		t.Anulado = redondear(t.Anulado + d.Anulado)
+		t.Neto = redondear(t.Neto + d.Neto)
+		t.Cobrado = redondear(t.Cobrado + d.Cobrado)
+		t.Reembolsado = redondear(t.Reembolsado + d.Reembolsado)
+		t.Propinas = redondear(t.Propinas + d.Propinas)
+	}
+	return t
+}
@@ -0,0 +1,200 @@
+// Manejador del autoservicio de invitados: código por SMS, consulta, cancelación y
+// reprogramación de sus citas con el token de gestión.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"restapi/dto"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /invitados/codigo  {"cedula": "..."}
+func SolicitarCodigoInvitado(c *gin.Context) {
+	var input struct {
+		Cedula string `json:"cedula"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Cedula == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La cédula es obligatoria"})
+		return
+	}
+
+	err := EnviarCodigoInvitado(input.Cedula)
+	switch {
+	case errors.Is(err, ErrCodigoMuyPronto):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Espere un momento antes de pedir otro código"})
+		return
+	case err != nil && !errors.Is(err, ErrCedulaSinTelefono):
+		fmt.Println("❌ Error al enviar código de invitado:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo enviar el código"})
+		return
+	}
+
+	// Misma respuesta exista o no la cédula, para no revelar quién tiene citas
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Si la cédula tiene citas registradas, enviamos un código al teléfono asociado"})
+}
+
+// POST /invitados/verificar  {"cedula": "...", "codigo": "123456"}
+func VerificarCodigoInvitado(c *gin.Context) {
+	var input struct {
+		Cedula string `json:"cedula"`
+		Codigo string `json:"codigo"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Cedula == "" || input.Codigo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cédula y código son obligatorios"})
+		return
+	}
+
+	token, err := CanjearCodigoInvitado(input.Cedula, input.Codigo)
+	if errors.Is(err, ErrCodigoInvalido) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Código inválido o vencido"})
+		return
+	} else if err != nil {
+		fmt.Println("❌ Error al verificar código de invitado:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo verificar el código"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "enlace": EnlaceGestionInvitado(token)})
+}
+
+// GET /invitados/citas
+func ListarCitasInvitado(c *gin.Context) {
+	acceso := c.MustGet("accesoInvitado").(AccesoInvitado)
+
+	query := `
+		SELECT c.id, c.fecha_hora, c.estado, c.servicio_id, s.nombre, c.empleado_id,
+		       c.nombre_invitado, c.telefono_invitado, c.reprogramaciones
+		FROM citas c
+		JOIN servicios s ON s.id = c.servicio_id
+		WHERE c.usuario_id IS NULL`
+	var args []interface{}
+	if acceso.CitaID != 0 {
+		query += " AND c.id = @cita_id"
+		args = append(args, sql.Named("cita_id", acceso.CitaID))
+	} else {
+		query += " AND c.cedula_invitado = @cedula"
+		args = append(args, sql.Named("cedula", acceso.Cedula))
+	}
+
+	rows, err := dto.DB.Query(query+" ORDER BY c.fecha_hora DESC", args...)
+	if err != nil {
+		fmt.Println("❌ Error al listar citas del invitado:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar citas"})
+		return
+	}
+	defer rows.Close()
+
+	citas := []gin.H{}
+	for rows.Next() {
+		var (
+			id, servicioID, reprogramaciones int
+			fechaHora                        time.Time
+			estado, nombreServicio           string
+			empleadoID                       sql.NullInt32
+			nombre, telefono                 sql.NullString
+		)
+		if err := rows.Scan(&id, &fechaHora, &estado, &servicioID, &nombreServicio, &empleadoID, &nombre, &telefono, &reprogramaciones); err != nil {
+			fmt.Println("❌ Error en Scan de cita de invitado:", err)
+			continue
+		}
+		cita := gin.H{
+			"id":                id,
+			"fecha_hora":        fechaHora,
+			"estado":            estado,
+			"servicio_id":       servicioID,
+			"nombre_servicio":   nombreServicio,
+			"nombre_invitado":   nullStringToString(nombre),
+			"telefono_invitado": nullStringToString(telefono),
+			"reprogramaciones":  reprogramaciones,
+			"empleado_id":       nil,
+		}
+		if empleadoID.Valid {
+			cita["empleado_id"] = empleadoID.Int32
+		}
+		citas = append(citas, cita)
+	}
+
+	c.JSON(http.StatusOK, citas)
+}
+
+// PUT /invitados/citas/:id/cancelar  {"motivo": "..."}
+func CancelarCitaInvitado(c *gin.Context) {
+	citaID, ok := citaDeInvitado(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Motivo string `json:"motivo"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Motivo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Motivo de cancelación es requerido"})
+		return
+	}
+
+	// Los invitados siguen la misma anticipación mínima que los clientes
+	var fechaHora time.Time
+	if err := dto.DB.QueryRow("SELECT fecha_hora FROM citas WHERE id = @id", sql.Named("id", citaID)).Scan(&fechaHora); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+		return
+	}
+	politica, err := ObtenerPoliticaCitas()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar la política de citas"})
+		return
+	}
+	if relojLocal(fechaHora).Sub(relojLocal(time.Now())) < politica.AnticipacionMinima() {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Solo puede cancelar con al menos %dh de antelación", politica.AnticipacionMinimaHoras)})
+		return
+	}
+
+	if err := cancelarCitaConMotivo(citaID, actorDeContexto(c), input.Motivo); err != nil {
+		responderErrorTransicion(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Cita cancelada correctamente", "motivo": input.Motivo})
+}
+
+// PUT /invitados/citas/:id/reprogramar  {"fecha_hora": "...", "empleado_id": 3}
+func ReprogramarCitaInvitado(c *gin.Context) {
+	citaID, ok := citaDeInvitado(c)
+	if !ok {
+		return
+	}
+
+	var input ReprogramarCitaInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.FechaHora.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fecha_hora es obligatoria"})
+		return
+	}
+
+	reprogramarCita(c, citaID, actorDeContexto(c), input)
+}
+
+// citaDeInvitado lee el :id y confirma que el token del invitado da acceso a esa cita.
+// Las citas ajenas responden 404 para no revelar que existen.
+func citaDeInvitado(c *gin.Context) (int32, bool) {
+	citaID, ok := citaIDParam(c)
+	if !ok {
+		return 0, false
+	}
+	acceso := c.MustGet("accesoInvitado").(AccesoInvitado)
+
+	var cedula sql.NullString
+	err := dto.DB.QueryRow("SELECT cedula_invitado FROM citas WHERE id = @id AND usuario_id IS NULL", sql.Named("id", citaID)).Scan(&cedula)
+	if err == sql.ErrNoRows || (err == nil && !acceso.PuedeVer(citaID, cedula.String)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+		return 0, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar cita"})
+		return 0, false
+	}
+	return citaID, true
+}
@@ -0,0 +1,244 @@
+// Acceso de invitados a sus citas sin cuenta: token firmado al reservar (enlace mágico)
+// y código de un solo uso enviado por SMS al teléfono registrado.
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"restapi/dto"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	tipoTokenInvitado = "invitado"
+
+	duracionTokenInvitado = 7 * 24 * time.Hour
+	duracionCodigo        = 10 * time.Minute
+	esperaEntreCodigos    = time.Minute
+	maxIntentosCodigo     = 5
+	digitosCodigo         = 6
+)
+
+var (
+	ErrCodigoInvalido    = errors.New("código inválido o vencido")
+	ErrCodigoMuyPronto   = errors.New("ya se envió un código hace poco")
+	ErrTokenInvitado     = errors.New("token de invitado inválido")
+	ErrCedulaSinTelefono = errors.New("la cédula no tiene citas con teléfono registrado")
+)
+
+// EnviadorSMS abstrae el proveedor de mensajes de texto.
+type EnviadorSMS interface {
+	Enviar(telefono, mensaje string) error
+}
+
+// smsSimulado solo escribe el mensaje en el log, igual que las notificaciones por correo.
+type smsSimulado struct{}
+
+func (smsSimulado) Enviar(telefono, mensaje string) error {
+	fmt.Printf("📱 Simulando SMS a %s: %s\n", telefono, mensaje)
+	return nil
+}
+
+var enviadorSMS EnviadorSMS = smsSimulado{}
+
+// AccesoInvitado es el alcance de un token de invitado: una sola cita (token de la
+// reserva) o todas las citas de una cédula (token obtenido con código).
+type AccesoInvitado struct {
+	CitaID int32
+	Cedula string
+}
+
+func (a AccesoInvitado) PuedeVer(citaID int32, cedula string) bool {
+	if a.CitaID != 0 {
+		return a.CitaID == citaID
+	}
+	return a.Cedula != "" && a.Cedula == cedula
+}
+
+// GenerarTokenInvitado firma un token de gestión con el alcance indicado.
+func GenerarTokenInvitado(acceso AccesoInvitado) (string, error) {
+	claims := jwt.MapClaims{
+		"tipo": tipoTokenInvitado,
+		"exp":  time.Now().Add(duracionTokenInvitado).Unix(),
+	}
+	if acceso.CitaID != 0 {
+		claims["cita_id"] = acceso.CitaID
+	} else {
+		claims["cedula"] = acceso.Cedula
+	}
+	return firmarToken(claims)
+}
+
+// EnlaceGestionInvitado arma el enlace mágico que se entrega al reservar.
+func EnlaceGestionInvitado(token string) string {
+	return enlaceFrontend("invitado/citas", token)
+}
+
+// LeerTokenInvitado valida la firma y el tipo del token y devuelve su alcance.
+func LeerTokenInvitado(tokenString string) (AccesoInvitado, error) {
+	claims, err := leerToken(tokenString)
+	if err != nil || claims["tipo"] != tipoTokenInvitado {
+		return AccesoInvitado{}, ErrTokenInvitado
+	}
+
+	var acceso AccesoInvitado
+	if id, ok := claims["cita_id"].(float64); ok {
+		acceso.CitaID = int32(id)
+	}
+	acceso.Cedula, _ = claims["cedula"].(string)
+	if acceso.CitaID == 0 && acceso.Cedula == "" {
+		return AccesoInvitado{}, ErrTokenInvitado
+	}
+	return acceso, nil
+}
+
+// EnviarCodigoInvitado genera un código y lo envía al teléfono de la cita más reciente
+// de la cédula. Solo se guarda el hash del código.
+func EnviarCodigoInvitado(cedula string) error {
+	var telefono string
+	err := dto.DB.QueryRow(`
+		SELECT TOP 1 telefono_invitado FROM citas
+		WHERE cedula_invitado = @cedula AND telefono_invitado IS NOT NULL AND telefono_invitado <> ''
+		ORDER BY creado_en DESC, id DESC`,
+		sql.Named("cedula", cedula)).Scan(&telefono)
+	if err == sql.ErrNoRows {
+		return ErrCedulaSinTelefono
+	} else if err != nil {
+		return fmt.Errorf("consultar teléfono del invitado: %w", err)
+	}
+
+	codigo, err := generarCodigo()
+	if err != nil {
+		return err
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// HOLDLOCK bloquea el rango de la cédula aunque no haya códigos: dos solicitudes
+	// simultáneas no pasan juntas la espera entre envíos
+	var recientes int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM codigos_invitado WITH (UPDLOCK, HOLDLOCK)
+		WHERE cedula = @cedula AND creado_en > DATEADD(SECOND, -@espera, GETDATE())`,
+		sql.Named("cedula", cedula),
+		sql.Named("espera", int(esperaEntreCodigos/time.Second))).Scan(&recientes)
+	if err != nil {
+		return fmt.Errorf("consultar códigos recientes: %w", err)
+	}
+	if recientes > 0 {
+		return ErrCodigoMuyPronto
+	}
+
+	// Un código nuevo invalida los anteriores de la misma cédula
+	_, err = tx.Exec(`
+		UPDATE codigos_invitado SET usado_en = GETDATE() WHERE cedula = @cedula AND usado_en IS NULL;
+		INSERT INTO codigos_invitado (cedula, telefono, codigo_hash, expira_en)
+		VALUES (@cedula, @telefono, @hash, DATEADD(SECOND, @duracion, GETDATE()))`,
+		sql.Named("cedula", cedula),
+		sql.Named("telefono", telefono),
+		sql.Named("hash", hashCodigo(cedula, codigo)),
+		sql.Named("duracion", int(duracionCodigo/time.Second)),
+	)
+	if err != nil {
+		return fmt.Errorf("guardar código de invitado: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+
+	mensaje := fmt.Sprintf("Su código para consultar sus citas es %s. Vence en %d minutos.", codigo, int(duracionCodigo/time.Minute))
+	return enviadorSMS.Enviar(telefono, mensaje)
+}
+
+// CanjearCodigoInvitado consume el código si es correcto y devuelve un token con
+// acceso a todas las citas de la cédula.
+func CanjearCodigoInvitado(cedula, codigo string) (string, error) {
+	if err := consumirCodigoInvitado(cedula, codigo); err != nil {
+		return "", err
+	}
+	return GenerarTokenInvitado(AccesoInvitado{Cedula: cedula})
+}
+
+// consumirCodigoInvitado marca el código como usado si coincide con el último vigente
+// de la cédula. Cada intento fallido cuenta contra el límite; el código queda
+// bloqueado durante la revisión, así los intentos simultáneos se cuentan uno por uno.
+func consumirCodigoInvitado(cedula, codigo string) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id, intentos int
+	var hash string
+	err = tx.QueryRow(`
+		SELECT TOP 1 id, codigo_hash, intentos FROM codigos_invitado WITH (UPDLOCK, ROWLOCK)
+		WHERE cedula = @cedula AND usado_en IS NULL AND expira_en > GETDATE()
+		ORDER BY creado_en DESC, id DESC`,
+		sql.Named("cedula", cedula)).Scan(&id, &hash, &intentos)
+	if err == sql.ErrNoRows {
+		return ErrCodigoInvalido
+	} else if err != nil {
+		return fmt.Errorf("consultar código de invitado: %w", err)
+	}
+
+	if intentos >= maxIntentosCodigo || subtle.ConstantTimeCompare([]byte(hash), []byte(hashCodigo(cedula, codigo))) != 1 {
+		_, err := tx.Exec(`
+			UPDATE codigos_invitado
+			SET intentos = intentos + 1,
+			    usado_en = CASE WHEN intentos + 1 >= @max THEN GETDATE() ELSE usado_en END
+			WHERE id = @id`,
+			sql.Named("max", maxIntentosCodigo),
+			sql.Named("id", id))
+		if err != nil {
+			return fmt.Errorf("registrar intento de código: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("confirmar transacción: %w", err)
+		}
+		return ErrCodigoInvalido
+	}
+
+	res, err := tx.Exec("UPDATE codigos_invitado SET usado_en = GETDATE() WHERE id = @id AND usado_en IS NULL", sql.Named("id", id))
+	if err != nil {
+		return fmt.Errorf("marcar código como usado: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCodigoInvalido
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+func generarCodigo() (string, error) {
+	limite := big.NewInt(1)
+	for i := 0; i < digitosCodigo; i++ {
+		limite.Mul(limite, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limite)
+	if err != nil {
+		return "", fmt.Errorf("generar código: %w", err)
+	}
+	return fmt.Sprintf("%0*d", digitosCodigo, n), nil
+}
+
+// hashCodigo liga el código a la cédula para que un hash filtrado no sirva con otra.
+func hashCodigo(cedula, codigo string) string {
+	suma := sha256.Sum256([]byte(cedula + ":" + codigo))
+	return hex.EncodeToString(suma[:])
+}
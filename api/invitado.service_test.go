@@ -0,0 +1,70 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const sqlCodigoVigente = "FROM codigos_invitado WITH (UPDLOCK, ROWLOCK)"
+
+// El código se revisa con la fila bloqueada y solo se canjea si sigue sin usar.
+func TestConsumirCodigoInvitado(t *testing.T) {
+	const cedula = "112345678"
+	casos := []struct {
+		nombre   string
+		codigo   string
+		intentos int
+		usado    int64 // filas del UPDATE que canjea el código
+		esperado error
+	}{
+		{"correcto", "123456", 0, 1, nil},
+		{"incorrecto", "654321", 0, 0, ErrCodigoInvalido},
+		{"correcto tras agotar intentos", "123456", maxIntentosCodigo, 0, ErrCodigoInvalido},
+		{"canjeado por otra solicitud", "123456", 0, 0, ErrCodigoInvalido},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			mock := baseSimulada(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(consulta(sqlCodigoVigente)).WithArgs(sql.Named("cedula", cedula)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "codigo_hash", "intentos"}).AddRow(4, hashCodigo(cedula, "123456"), tc.intentos))
+			if tc.codigo != "123456" || tc.intentos >= maxIntentosCodigo {
+				mock.ExpectExec(consulta("SET intentos = intentos + 1")).
+					WithArgs(sql.Named("max", maxIntentosCodigo), sql.Named("id", 4)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectExec(consulta("UPDATE codigos_invitado SET usado_en = GETDATE() WHERE id = @id AND usado_en IS NULL")).
+					WithArgs(sql.Named("id", 4)).
+					WillReturnResult(sqlmock.NewResult(0, tc.usado))
+				if tc.usado > 0 {
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			if err := consumirCodigoInvitado(cedula, tc.codigo); !errors.Is(err, tc.esperado) {
+				t.Fatalf("error %v, se esperaba %v", err, tc.esperado)
+			}
+		})
+	}
+}
+
+// La espera entre códigos se revisa con el rango de la cédula bloqueado.
+func TestEnviarCodigoInvitadoMuyPronto(t *testing.T) {
+	mock := baseSimulada(t)
+	mock.ExpectQuery(consulta("SELECT TOP 1 telefono_invitado FROM citas")).
+		WillReturnRows(sqlmock.NewRows([]string{"telefono_invitado"}).AddRow("88887777"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(consulta("SELECT COUNT(*) FROM codigos_invitado WITH (UPDLOCK, HOLDLOCK)")).
+		WillReturnRows(sqlmock.NewRows([]string{"recientes"}).AddRow(1))
+	mock.ExpectRollback()
+
+	if err := EnviarCodigoInvitado("112345678"); !errors.Is(err, ErrCodigoMuyPronto) {
+		t.Fatalf("error %v, se esperaba ErrCodigoMuyPronto", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Manejador de anulaciones y notas de crédito sobre facturas cerradas.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /facturas/:id/anular
+// {"motivo": "...", "devolver_inventario": true, "reembolso": {"metodo": "efectivo"}}
+func AnularFactura(c *gin.Context) {
+	emitirNotaCredito(c, TipoNotaAnulacion)
+}
+
+// POST /facturas/:id/notas-credito
+// {"motivo": "...", "lineas": [{"detalle_id": 10, "cantidad": 1}], "devolver_inventario": true}
+func CrearNotaCredito(c *gin.Context) {
+	emitirNotaCredito(c, TipoNotaParcial)
+}
+
+// GET /facturas/:id/notas-credito
+func ListarNotasCreditoFactura(c *gin.Context) {
+	factura, ok := facturaVisibleParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notas_credito": factura.NotasCredito, "total_acreditado": factura.TotalAcreditado, "anulada": factura.Anulada})
+}
+
+func emitirNotaCredito(c *gin.Context, tipo string) {
+	facturaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de factura inválido"})
+		return
+	}
+
+	var input NotaCreditoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	notaID, err := EmitirNotaCredito(facturaID, tipo, input, actorDeContexto(c).ID)
+	switch {
+	case errors.Is(err, ErrFacturaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Factura no encontrada"})
+		return
+	case errors.Is(err, ErrLineaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "La línea no existe en esta factura"})
+		return
+	case errors.Is(err, ErrFacturaAnulada):
+		c.JSON(http.StatusConflict, gin.H{"error": "La factura ya está anulada"})
+		return
+	case errors.Is(err, ErrNotaFacturaBorrador):
+		c.JSON(http.StatusConflict, gin.H{"error": "La factura está en borrador: quite las líneas en lugar de acreditarlas"})
+		return
+	case errors.Is(err, ErrNotaSinLineas):
+		c.JSON(http.StatusConflict, gin.H{"error": "No queda nada pendiente de acreditar en esta factura"})
+		return
+	case errors.Is(err, ErrNotaExcedeCantidad):
+		c.JSON(http.StatusConflict, gin.H{"error": "La cantidad excede lo pendiente de acreditar en la línea"})
+		return
+	case errors.Is(err, ErrSerieNoConfigurada):
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay una serie de numeración activa para notas de crédito en esta caja"})
+		return
+	case errors.Is(err, ErrCajaCerrada):
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay una caja abierta en esta terminal para registrar el reembolso"})
+		return
+	case errors.Is(err, ErrReembolsoExcede):
+		c.JSON(http.StatusConflict, gin.H{"error": "El reembolso excede lo cobrado o el total de la nota"})
+		return
+	case errors.Is(err, ErrNotaSinMotivo), errors.Is(err, ErrNotaLineaInvalida), errors.Is(err, ErrReembolsoSinMetodo),
+		errors.Is(err, ErrPagoMetodo), errors.Is(err, ErrPagoSinReferencia):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Printf("Error al emitir nota de crédito para factura %d: %v\n", facturaID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al emitir la nota de crédito"})
+		return
+	}
+
+	mensaje := "Nota de crédito emitida"
+	if tipo == TipoNotaAnulacion {
+		mensaje = "Factura anulada"
+	}
+	responderFacturaActualizada(c, http.StatusCreated, facturaID, gin.H{"mensaje": mensaje, "nota_credito_id": notaID})
+}
@@ -0,0 +1,423 @@
+// Anulaciones y notas de crédito. La factura original nunca se modifica: cada nota
+// acredita líneas (o lo pendiente de todas, si es anulación), puede devolver productos
+// al inventario y registrar el reembolso de lo cobrado.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"strings"
+)
+
+// Tipos de nota de crédito
+const (
+	TipoNotaAnulacion = "anulacion"
+	TipoNotaParcial   = "parcial"
+)
+
+var (
+	ErrFacturaAnulada      = errors.New("la factura ya está anulada")
+	ErrNotaSinMotivo       = errors.New("indique el motivo de la nota de crédito")
+	ErrNotaSinLineas       = errors.New("no hay nada pendiente de acreditar")
+	ErrNotaLineaInvalida   = errors.New("cada línea necesita detalle_id y una cantidad mayor a cero")
+	ErrNotaExcedeCantidad  = errors.New("la cantidad excede lo pendiente de acreditar en la línea")
+	ErrReembolsoExcede     = errors.New("el reembolso excede lo cobrado o el total de la nota")
+	ErrReembolsoSinMetodo  = errors.New("indique el método del reembolso")
+	ErrNotaFacturaBorrador = errors.New("la factura está en borrador: quite las líneas en lugar de acreditarlas")
+)
+
+// LineaNotaInput acredita una cantidad de una línea de la factura.
+type LineaNotaInput struct {
+	DetalleID int `json:"detalle_id"`
+	Cantidad  int `json:"cantidad"`
+}
+
+// ReembolsoInput devuelve dinero al cliente. Sin monto se reembolsa el total de la
+// nota, limitado a lo cobrado.
+type ReembolsoInput struct {
+	Metodo     string   `json:"metodo"`
+	Monto      *float64 `json:"monto"`
+	Referencia string   `json:"referencia"`
+}
+
+type NotaCreditoInput struct {
+	Motivo             string           `json:"motivo"`
+	Lineas             []LineaNotaInput `json:"lineas"` // se ignora en anulaciones
+	DevolverInventario bool             `json:"devolver_inventario"`
+	Reembolso          *ReembolsoInput  `json:"reembolso"`
+}
+
+type DetalleNotaCredito struct {
+	ID                 int     `json:"id"`
+	DetalleID          int     `json:"detalle_id"`
+	NombreItem         *string `json:"nombre_item"`
+	Cantidad           int     `json:"cantidad"`
+	PrecioUnitario     float64 `json:"precio_unitario"`
+	Subtotal           float64 `json:"subtotal"`
+	TarifaImpuesto     float64 `json:"tarifa_impuesto"`
+	Impuesto           float64 `json:"impuesto"`
+	DevueltoInventario bool    `json:"devuelto_inventario"`
+}
+
+type NotaCredito struct {
+	ID                  int                  `json:"id"`
+	Consecutivo         *string              `json:"consecutivo"`
+	FacturaID           int                  `json:"factura_id"`
+	Tipo                string               `json:"tipo"`
+	Motivo              string               `json:"motivo"`
+	Subtotal            float64              `json:"subtotal"`
+	Impuesto            float64              `json:"impuesto"`
+	Total               float64              `json:"total"`
+	DevolverInventario  bool                 `json:"devolver_inventario"`
+	MetodoReembolso     *string              `json:"metodo_reembolso"`
+	MontoReembolsado    float64              `json:"monto_reembolsado"`
+	ReferenciaReembolso *string              `json:"referencia_reembolso"`
+	CreadoPor           *int                 `json:"creado_por"`
+	Fecha               string               `json:"fecha"`
+	Detalles            []DetalleNotaCredito `json:"detalles"`
+}
+
+// movimientosFactura resume lo cobrado, acreditado y reembolsado de una factura.
+type movimientosFactura struct {
+	Pagado      float64
+	Acreditado  float64
+	Reembolsado float64
+	Anulada     bool
+}
+
+// cobradoNeto es lo que el cliente ha pagado descontando reembolsos, en céntimos.
+func (m movimientosFactura) cobradoNeto() int64 {
+	return centavos(m.Pagado) - centavos(m.Reembolsado)
+}
+
+// lineaAcreditable es una línea de la factura con lo que ya se acreditó de ella.
+type lineaAcreditable struct {
+	detalleID            int
+	productoID           sql.NullInt32
+	cantidad             int
+	precio               float64
+	subtotal             float64
+	tarifa               float64
+	impuesto             float64
+	cantidadAcreditada   int
+	subtotalAcreditado   float64
+	impuestoAcreditado   float64
+	cantidadPorAcreditar int
+}
+
+// EmitirNotaCredito crea la nota (tipo anulacion o parcial) sobre una factura cerrada
+// y devuelve su id.
+func EmitirNotaCredito(facturaID int, tipo string, in NotaCreditoInput, creadoPor sql.NullInt32) (int, error) {
+	in.Motivo = strings.TrimSpace(in.Motivo)
+	if in.Motivo == "" {
+		return 0, ErrNotaSinMotivo
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Mismo candado que los pagos: una nota y un cobro simultáneos no se cruzan
+	var estado string
+	err = tx.QueryRow("SELECT estado FROM factura WITH (UPDLOCK, ROWLOCK) WHERE idFact = @id", sql.Named("id", facturaID)).Scan(&estado)
+	if err == sql.ErrNoRows {
+		return 0, ErrFacturaNoExiste
+	} else if err != nil {
+		return 0, fmt.Errorf("consultar factura: %w", err)
+	}
+	if estado == EstadoFacturaBorrador {
+		return 0, ErrNotaFacturaBorrador
+	}
+
+	mov, err := movimientosFacturaTx(tx, facturaID)
+	if err != nil {
+		return 0, err
+	}
+	if mov.Anulada {
+		return 0, ErrFacturaAnulada
+	}
+
+	lineas, err := lineasAcreditables(tx, facturaID)
+	if err != nil {
+		return 0, err
+	}
+	if tipo == TipoNotaAnulacion {
+		for i := range lineas {
+			lineas[i].cantidadPorAcreditar = lineas[i].cantidad - lineas[i].cantidadAcreditada
+		}
+	} else if err := repartirLineasNota(lineas, in.Lineas); err != nil {
+		return 0, err
+	}
+
+	// Montos por línea. Si se acredita todo lo que queda, se toma la diferencia exacta
+	// para que la suma de notas cuadre con la factura pese al redondeo.
+	var subtotal, impuesto int64
+	var acreditar []DetalleNotaCredito
+	for _, l := range lineas {
+		if l.cantidadPorAcreditar <= 0 {
+			continue
+		}
+		d := DetalleNotaCredito{DetalleID: l.detalleID, Cantidad: l.cantidadPorAcreditar, PrecioUnitario: l.precio, TarifaImpuesto: l.tarifa}
+		if l.cantidadAcreditada+l.cantidadPorAcreditar == l.cantidad {
+			d.Subtotal = redondear(l.subtotal - l.subtotalAcreditado)
+			d.Impuesto = redondear(l.impuesto - l.impuestoAcreditado)
+		} else {
+			// Proporcional al subtotal: respeta el descuento que tuvo la línea
+			d.Subtotal = redondear(l.subtotal * float64(l.cantidadPorAcreditar) / float64(l.cantidad))
+			d.Impuesto = impuestoDeLinea(d.Subtotal, l.tarifa)
+		}
+		d.DevueltoInventario = in.DevolverInventario && l.productoID.Valid
+		subtotal += centavos(d.Subtotal)
+		impuesto += centavos(d.Impuesto)
+		acreditar = append(acreditar, d)
+	}
+	if len(acreditar) == 0 {
+		return 0, ErrNotaSinLineas
+	}
+	total := subtotal + impuesto
+
+	metodo, reembolso, referencia, err := reembolsoDeNota(in.Reembolso, total, mov.cobradoNeto())
+	if err != nil {
+		return 0, err
+	}
+	// El dinero devuelto sale de la caja abierta; una nota sin reembolso no la necesita
+	var sesionCaja sql.NullInt32
+	if reembolso > 0 {
+		sesionID, err := sesionCajaAbiertaTx(tx)
+		if err != nil {
+			return 0, err
+		}
+		sesionCaja = sql.NullInt32{Int32: int32(sesionID), Valid: true}
+	}
+
+	serieID, consecutivo, err := asignarConsecutivo(tx, DocNotaCredito)
+	if err != nil {
+		return 0, err
+	}
+
+	var notaID int
+	err = tx.QueryRow(`
+		INSERT INTO notas_credito (idFact, tipo, motivo, subtotal, impuesto, total, devolver_inventario,
+		                           metodo_reembolso, monto_reembolsado, referencia_reembolso, creado_por, serie_id, consecutivo, sesion_caja_id)
+		OUTPUT INSERTED.id
+		VALUES (@factura_id, @tipo, @motivo, @subtotal, @impuesto, @total, @devolver,
+		        @metodo, @reembolso, @referencia, @creado_por, @serie_id, @consecutivo, @sesion_caja)`,
+		sql.Named("factura_id", facturaID),
+		sql.Named("tipo", tipo),
+		sql.Named("motivo", in.Motivo),
+		sql.Named("subtotal", aMonto(subtotal)),
+		sql.Named("impuesto", aMonto(impuesto)),
+		sql.Named("total", aMonto(total)),
+		sql.Named("devolver", in.DevolverInventario),
+		sql.Named("metodo", metodo),
+		sql.Named("reembolso", aMonto(reembolso)),
+		sql.Named("referencia", referencia),
+		sql.Named("creado_por", creadoPor),
+		sql.Named("serie_id", serieID),
+		sql.Named("consecutivo", consecutivo),
+		sql.Named("sesion_caja", sesionCaja),
+	).Scan(&notaID)
+	if err != nil {
+		return 0, fmt.Errorf("crear nota de crédito: %w", err)
+	}
+
+	for _, d := range acreditar {
+		_, err := tx.Exec(`
+			INSERT INTO detalle_nota_credito (nota_id, idDetalle, cant, precio, subtotal, tarifa_impuesto, impuesto, devuelto_inventario)
+			VALUES (@nota_id, @detalle_id, @cant, @precio, @subtotal, @tarifa, @impuesto, @devuelto)`,
+			sql.Named("nota_id", notaID),
+			sql.Named("detalle_id", d.DetalleID),
+			sql.Named("cant", d.Cantidad),
+			sql.Named("precio", d.PrecioUnitario),
+			sql.Named("subtotal", d.Subtotal),
+			sql.Named("tarifa", d.TarifaImpuesto),
+			sql.Named("impuesto", d.Impuesto),
+			sql.Named("devuelto", d.DevueltoInventario),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("guardar línea de nota de crédito: %w", err)
+		}
+		if d.DevueltoInventario {
+			_, err := tx.Exec(`
+				UPDATE productos SET cantidad_disponible = cantidad_disponible + @cant, actualizado_en = GETDATE()
+				WHERE id = (SELECT idProducto FROM detallefactura WHERE idDetalle = @detalle_id)`,
+				sql.Named("cant", d.Cantidad), sql.Named("detalle_id", d.DetalleID))
+			if err != nil {
+				return 0, fmt.Errorf("devolver inventario: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return notaID, nil
+}
+
+// repartirLineasNota marca en lineas la cantidad pedida de cada una, sumando si una
+// línea viene repetida, y valida que no pase de lo pendiente.
+func repartirLineasNota(lineas []lineaAcreditable, pedidas []LineaNotaInput) error {
+	if len(pedidas) == 0 {
+		return ErrNotaLineaInvalida
+	}
+	porID := map[int]*lineaAcreditable{}
+	for i := range lineas {
+		porID[lineas[i].detalleID] = &lineas[i]
+	}
+	for _, p := range pedidas {
+		if p.DetalleID <= 0 || p.Cantidad <= 0 {
+			return ErrNotaLineaInvalida
+		}
+		l, ok := porID[p.DetalleID]
+		if !ok {
+			return ErrLineaNoExiste
+		}
+		l.cantidadPorAcreditar += p.Cantidad
+		if l.cantidadAcreditada+l.cantidadPorAcreditar > l.cantidad {
+			return ErrNotaExcedeCantidad
+		}
+	}
+	return nil
+}
+
+// reembolsoDeNota valida el reembolso pedido y devuelve método, monto (céntimos) y
+// referencia. Sin reembolso o sin nada cobrado, el monto es cero.
+func reembolsoDeNota(in *ReembolsoInput, totalNota, cobrado int64) (sql.NullString, int64, sql.NullString, error) {
+	if in == nil {
+		return sql.NullString{}, 0, sql.NullString{}, nil
+	}
+	metodo := strings.ToLower(strings.TrimSpace(in.Metodo))
+	if metodo == "" {
+		return sql.NullString{}, 0, sql.NullString{}, ErrReembolsoSinMetodo
+	}
+	if !metodosPagoPermitidos[metodo] {
+		return sql.NullString{}, 0, sql.NullString{}, ErrPagoMetodo
+	}
+	if (metodo == MetodoSinpeMovil || metodo == MetodoTransferencia) && strings.TrimSpace(in.Referencia) == "" {
+		return sql.NullString{}, 0, sql.NullString{}, ErrPagoSinReferencia
+	}
+
+	monto := min(totalNota, max(cobrado, 0))
+	if in.Monto != nil {
+		monto = centavos(*in.Monto)
+		if monto < 0 || monto > totalNota || monto > cobrado {
+			return sql.NullString{}, 0, sql.NullString{}, ErrReembolsoExcede
+		}
+	}
+	if monto == 0 {
+		return sql.NullString{}, 0, sql.NullString{}, nil
+	}
+	referencia := sql.NullString{String: strings.TrimSpace(in.Referencia), Valid: strings.TrimSpace(in.Referencia) != ""}
+	return sql.NullString{String: metodo, Valid: true}, monto, referencia, nil
+}
+
+func lineasAcreditables(tx *sql.Tx, facturaID int) ([]lineaAcreditable, error) {
+	rows, err := tx.Query(`
+		SELECT df.idDetalle, df.idProducto, df.cant, df.precio, df.subtotal, df.tarifa_impuesto, df.impuesto,
+		       COALESCE(SUM(dnc.cant), 0), COALESCE(SUM(dnc.subtotal), 0), COALESCE(SUM(dnc.impuesto), 0)
+		FROM detallefactura df
+		LEFT JOIN detalle_nota_credito dnc ON dnc.idDetalle = df.idDetalle
+		WHERE df.idFact = @factura_id
+		GROUP BY df.idDetalle, df.idProducto, df.cant, df.precio, df.subtotal, df.tarifa_impuesto, df.impuesto
+		ORDER BY df.idDetalle`, sql.Named("factura_id", facturaID))
+	if err != nil {
+		return nil, fmt.Errorf("consultar líneas acreditables: %w", err)
+	}
+	defer rows.Close()
+
+	var lineas []lineaAcreditable
+	for rows.Next() {
+		var l lineaAcreditable
+		err := rows.Scan(&l.detalleID, &l.productoID, &l.cantidad, &l.precio, &l.subtotal, &l.tarifa, &l.impuesto,
+			&l.cantidadAcreditada, &l.subtotalAcreditado, &l.impuestoAcreditado)
+		if err != nil {
+			return nil, fmt.Errorf("leer línea acreditable: %w", err)
+		}
+		lineas = append(lineas, l)
+	}
+	return lineas, rows.Err()
+}
+
+func movimientosFacturaTx(tx *sql.Tx, facturaID int) (movimientosFactura, error) {
+	var m movimientosFactura
+	err := tx.QueryRow(`
+		SELECT
+			(SELECT COALESCE(SUM(monto), 0) FROM pagos_factura WHERE idFact = @id),
+			(SELECT COALESCE(SUM(total), 0) FROM notas_credito WHERE idFact = @id),
+			(SELECT COALESCE(SUM(monto_reembolsado), 0) FROM notas_credito WHERE idFact = @id),
+			CASE WHEN EXISTS (SELECT 1 FROM notas_credito WHERE idFact = @id AND tipo = @anulacion) THEN 1 ELSE 0 END`,
+		sql.Named("id", facturaID), sql.Named("anulacion", TipoNotaAnulacion),
+	).Scan(&m.Pagado, &m.Acreditado, &m.Reembolsado, &m.Anulada)
+	if err != nil {
+		return m, fmt.Errorf("consultar movimientos de factura: %w", err)
+	}
+	return m, nil
+}
+
+// NotasCreditoDeFactura devuelve las notas de la factura con sus líneas, en orden de emisión.
+func NotasCreditoDeFactura(facturaID int) ([]NotaCredito, error) {
+	rows, err := dto.DB.Query(`
+		SELECT id, consecutivo, idFact, tipo, motivo, subtotal, impuesto, total, devolver_inventario,
+		       metodo_reembolso, monto_reembolsado, referencia_reembolso, creado_por, CONVERT(VARCHAR(19), creado_en, 126)
+		FROM notas_credito WHERE idFact = @id ORDER BY id`, sql.Named("id", facturaID))
+	if err != nil {
+		return nil, fmt.Errorf("consultar notas de crédito: %w", err)
+	}
+	defer rows.Close()
+
+	notas := []NotaCredito{}
+	indice := map[int]int{}
+	for rows.Next() {
+		var n NotaCredito
+		var creadoPor sql.NullInt32
+		err := rows.Scan(&n.ID, &n.Consecutivo, &n.FacturaID, &n.Tipo, &n.Motivo, &n.Subtotal, &n.Impuesto, &n.Total, &n.DevolverInventario,
+			&n.MetodoReembolso, &n.MontoReembolsado, &n.ReferenciaReembolso, &creadoPor, &n.Fecha)
+		if err != nil {
+			return nil, fmt.Errorf("leer nota de crédito: %w", err)
+		}
+		n.CreadoPor = nullInt32Ptr(creadoPor)
+		n.Detalles = []DetalleNotaCredito{}
+		indice[n.ID] = len(notas)
+		notas = append(notas, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(notas) == 0 {
+		return notas, nil
+	}
+
+	detalles, err := dto.DB.Query(`
+		SELECT dnc.id, dnc.nota_id, dnc.idDetalle, COALESCE(p.nombre, s.nombre, CAST(df.descripcion AS NVARCHAR(MAX))),
+		       dnc.cant, dnc.precio, dnc.subtotal, dnc.tarifa_impuesto, dnc.impuesto, dnc.devuelto_inventario
+		FROM detalle_nota_credito dnc
+		JOIN notas_credito n ON n.id = dnc.nota_id
+		JOIN detallefactura df ON df.idDetalle = dnc.idDetalle
+		LEFT JOIN productos p ON df.idProducto = p.id
+		LEFT JOIN servicios s ON df.idServicio = s.id
+		WHERE n.idFact = @id
+		ORDER BY dnc.id`, sql.Named("id", facturaID))
+	if err != nil {
+		return nil, fmt.Errorf("consultar líneas de notas de crédito: %w", err)
+	}
+	defer detalles.Close()
+
+	for detalles.Next() {
+		var d DetalleNotaCredito
+		var notaID int
+		err := detalles.Scan(&d.ID, &notaID, &d.DetalleID, &d.NombreItem, &d.Cantidad, &d.PrecioUnitario,
+			&d.Subtotal, &d.TarifaImpuesto, &d.Impuesto, &d.DevueltoInventario)
+		if err != nil {
+			return nil, fmt.Errorf("leer línea de nota de crédito: %w", err)
+		}
+		if i, ok := indice[notaID]; ok {
+			notas[i].Detalles = append(notas[i].Detalles, d)
+		}
+	}
+	return notas, detalles.Err()
+}
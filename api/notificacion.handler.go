@@ -16,13 +16,6 @@ import (
 func EnviarNotificacion(c *gin.Context) {
 	id := c.Param("id")
 
-	// Verificamos que el rol sea empleado o admin
-	rol, _ := c.Get("rol")
-	if rol != "empleado" && rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo empleados o administradores pueden enviar recordatorios"})
-		return
-	}
-
 	var correo string
 	var fecha time.Time
 
@@ -0,0 +1,83 @@
+// Manejador de series de numeración de documentos (facturas:numeracion).
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /series-documento
+func ListarSeriesDocumentoHandler(c *gin.Context) {
+	series, err := ListarSeriesDocumento()
+	if err != nil {
+		fmt.Println("❌ Error al listar series:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar las series"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"series": series, "punto_emision": puntoEmisionActual()})
+}
+
+// POST /series-documento  {"sucursal": "001", "terminal": "00002", "tipo_documento": "04", "ultimo_numero": 0}
+func CrearSerieDocumentoHandler(c *gin.Context) {
+	var input SerieDocumento
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	id, err := CrearSerieDocumento(input)
+	switch {
+	case errors.Is(err, ErrSerieInvalida), errors.Is(err, ErrNumeroRetrocede):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrSerieDuplicada):
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya existe una serie para esa sucursal, terminal y tipo de documento"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al crear serie:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo crear la serie"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Serie creada", "id": id})
+}
+
+// PUT /series-documento/:id  {"activa": false} o {"ultimo_numero": 1500}
+func ActualizarSerieDocumentoHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de serie inválido"})
+		return
+	}
+
+	var input struct {
+		Activa       *bool  `json:"activa"`
+		UltimoNumero *int64 `json:"ultimo_numero"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	err = ActualizarSerieDocumento(id, input.Activa, input.UltimoNumero)
+	switch {
+	case errors.Is(err, ErrSerieNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "La serie no existe"})
+		return
+	case errors.Is(err, ErrNumeroRetrocede):
+		c.JSON(http.StatusConflict, gin.H{"error": "El último número no puede ser menor al actual"})
+		return
+	case errors.Is(err, ErrSerieEnUso):
+		c.JSON(http.StatusConflict, gin.H{"error": "La serie ya emitió documentos; su último número no se puede cambiar"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al actualizar serie:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo actualizar la serie"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Serie actualizada"})
+}
@@ -0,0 +1,189 @@
+// Numeración consecutiva de documentos por serie (sucursal, terminal, tipo de
+// documento). El número se toma dentro de la transacción que emite el documento: si
+// esta se revierte, el contador también, y no quedan huecos.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"restapi/dto"
+)
+
+// Tipos de documento de Hacienda
+const (
+	DocFacturaElectronica = "01"
+	DocNotaCredito        = "03"
+	DocTiqueteElectronico = "04"
+)
+
+var (
+	ErrSerieNoConfigurada = errors.New("no hay una serie activa para la sucursal, terminal y tipo de documento")
+	ErrSerieNoExiste      = errors.New("la serie no existe")
+	ErrSerieInvalida      = errors.New("la sucursal debe tener 3 dígitos, la terminal 5 y el tipo de documento ser 01, 03 o 04")
+	ErrSerieDuplicada     = errors.New("ya existe una serie para esa sucursal, terminal y tipo de documento")
+	ErrNumeroRetrocede    = errors.New("el último número no puede ser menor al actual")
+	ErrSerieEnUso         = errors.New("la serie ya emitió documentos: su último número no se puede cambiar")
+)
+
+var (
+	formatoSucursal = regexp.MustCompile(`^\d{3}$`)
+	formatoTerminal = regexp.MustCompile(`^\d{5}$`)
+	tiposDocumento  = map[string]bool{DocFacturaElectronica: true, DocNotaCredito: true, DocTiqueteElectronico: true}
+)
+
+// PuntoEmision identifica la sucursal y la terminal (caja) que emite los documentos.
+type PuntoEmision struct {
+	Sucursal string `json:"sucursal"`
+	Terminal string `json:"terminal"`
+}
+
+// puntoEmisionActual lee FACTURA_SUCURSAL y FACTURA_TERMINAL; sin configurar se usa la
+// caja principal que crea la migración.
+func puntoEmisionActual() PuntoEmision {
+	p := PuntoEmision{Sucursal: "001", Terminal: "00001"}
+	if s := os.Getenv("FACTURA_SUCURSAL"); s != "" {
+		p.Sucursal = s
+	}
+	if t := os.Getenv("FACTURA_TERMINAL"); t != "" {
+		p.Terminal = t
+	}
+	return p
+}
+
+type SerieDocumento struct {
+	ID            int     `json:"id"`
+	Sucursal      string  `json:"sucursal"`
+	Terminal      string  `json:"terminal"`
+	TipoDocumento string  `json:"tipo_documento"`
+	UltimoNumero  int64   `json:"ultimo_numero"`
+	Descripcion   *string `json:"descripcion"`
+	Activa        bool    `json:"activa"`
+}
+
+// asignarConsecutivo incrementa la serie del punto de emisión actual y devuelve su id
+// y el consecutivo de 20 dígitos. El UPDATE deja la fila bloqueada hasta el commit,
+// así dos cajas no pueden tomar el mismo número.
+func asignarConsecutivo(tx *sql.Tx, tipoDocumento string) (int, string, error) {
+	punto := puntoEmisionActual()
+	var serieID int
+	var sucursal, terminal string
+	var numero int64
+	err := tx.QueryRow(`
+		UPDATE series_documento SET ultimo_numero = ultimo_numero + 1
+		OUTPUT INSERTED.id, INSERTED.sucursal, INSERTED.terminal, INSERTED.ultimo_numero
+		WHERE sucursal = @sucursal AND terminal = @terminal AND tipo_documento = @tipo AND activa = 1`,
+		sql.Named("sucursal", punto.Sucursal),
+		sql.Named("terminal", punto.Terminal),
+		sql.Named("tipo", tipoDocumento),
+	).Scan(&serieID, &sucursal, &terminal, &numero)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrSerieNoConfigurada
+	} else if err != nil {
+		return 0, "", fmt.Errorf("asignar consecutivo: %w", err)
+	}
+	return serieID, formatoConsecutivo(sucursal, terminal, tipoDocumento, numero), nil
+}
+
+func formatoConsecutivo(sucursal, terminal, tipoDocumento string, numero int64) string {
+	return fmt.Sprintf("%s%s%s%010d", sucursal, terminal, tipoDocumento, numero)
+}
+
+// ListarSeriesDocumento devuelve todas las series con su último número emitido.
+func ListarSeriesDocumento() ([]SerieDocumento, error) {
+	rows, err := dto.DB.Query(`
+		SELECT id, sucursal, terminal, tipo_documento, ultimo_numero, descripcion, activa
+		FROM series_documento ORDER BY sucursal, terminal, tipo_documento`)
+	if err != nil {
+		return nil, fmt.Errorf("listar series: %w", err)
+	}
+	defer rows.Close()
+
+	series := []SerieDocumento{}
+	for rows.Next() {
+		var s SerieDocumento
+		if err := rows.Scan(&s.ID, &s.Sucursal, &s.Terminal, &s.TipoDocumento, &s.UltimoNumero, &s.Descripcion, &s.Activa); err != nil {
+			return nil, fmt.Errorf("leer serie: %w", err)
+		}
+		series = append(series, s)
+	}
+	return series, rows.Err()
+}
+
+// CrearSerieDocumento registra una serie nueva. ultimoNumero permite continuar la
+// numeración de un sistema anterior.
+func CrearSerieDocumento(s SerieDocumento) (int, error) {
+	if !formatoSucursal.MatchString(s.Sucursal) || !formatoTerminal.MatchString(s.Terminal) || !tiposDocumento[s.TipoDocumento] {
+		return 0, ErrSerieInvalida
+	}
+	if s.UltimoNumero < 0 {
+		return 0, ErrNumeroRetrocede
+	}
+
+	var existe int
+	err := dto.DB.QueryRow("SELECT COUNT(*) FROM series_documento WHERE sucursal = @sucursal AND terminal = @terminal AND tipo_documento = @tipo",
+		sql.Named("sucursal", s.Sucursal), sql.Named("terminal", s.Terminal), sql.Named("tipo", s.TipoDocumento)).Scan(&existe)
+	if err != nil {
+		return 0, fmt.Errorf("consultar series: %w", err)
+	}
+	if existe > 0 {
+		return 0, ErrSerieDuplicada
+	}
+
+	var id int
+	err = dto.DB.QueryRow(`
+		INSERT INTO series_documento (sucursal, terminal, tipo_documento, ultimo_numero, descripcion)
+		OUTPUT INSERTED.id
+		VALUES (@sucursal, @terminal, @tipo, @ultimo, @descripcion)`,
+		sql.Named("sucursal", s.Sucursal),
+		sql.Named("terminal", s.Terminal),
+		sql.Named("tipo", s.TipoDocumento),
+		sql.Named("ultimo", s.UltimoNumero),
+		sql.Named("descripcion", s.Descripcion),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("crear serie: %w", err)
+	}
+	return id, nil
+}
+
+// ActualizarSerieDocumento activa o desactiva la serie y, si se indica, fija el último
+// número. Eso solo se permite mientras la serie no ha emitido nada (para continuar la
+// numeración de un sistema anterior): después, retroceder repetiría consecutivos y
+// adelantar dejaría huecos en la numeración.
+func ActualizarSerieDocumento(id int, activa *bool, ultimoNumero *int64) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var actual int64
+	err = tx.QueryRow("SELECT ultimo_numero FROM series_documento WITH (UPDLOCK) WHERE id = @id", sql.Named("id", id)).Scan(&actual)
+	if err == sql.ErrNoRows {
+		return ErrSerieNoExiste
+	} else if err != nil {
+		return fmt.Errorf("consultar serie: %w", err)
+	}
+	if ultimoNumero != nil && *ultimoNumero != actual {
+		if actual > 0 {
+			return ErrSerieEnUso
+		}
+		if *ultimoNumero < 0 {
+			return ErrNumeroRetrocede
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE series_documento
+		SET activa = COALESCE(@activa, activa), ultimo_numero = COALESCE(@ultimo, ultimo_numero)
+		WHERE id = @id`,
+		sql.Named("activa", activa), sql.Named("ultimo", ultimoNumero), sql.Named("id", id))
+	if err != nil {
+		return fmt.Errorf("actualizar serie: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// El último número solo se fija mientras la serie no ha emitido documentos.
+func TestActualizarSerieUltimoNumero(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		actual   int64
+		nuevo    int64
+		esperado error
+	}{
+		{"serie sin usar", 0, 1500, nil},
+		{"mismo número", 42, 42, nil},
+		{"salto hacia adelante", 42, 100, ErrSerieEnUso},
+		{"retroceso", 42, 10, ErrSerieEnUso},
+		{"negativo", 0, -1, ErrNumeroRetrocede},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			mock := baseSimulada(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(consulta("SELECT ultimo_numero FROM series_documento WITH (UPDLOCK) WHERE id = @id")).
+				WithArgs(sql.Named("id", 3)).
+				WillReturnRows(sqlmock.NewRows([]string{"ultimo_numero"}).AddRow(tc.actual))
+			if tc.esperado == nil {
+				mock.ExpectExec(consulta("UPDATE series_documento")).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			nuevo := tc.nuevo
+			if err := ActualizarSerieDocumento(3, nil, &nuevo); !errors.Is(err, tc.esperado) {
+				t.Fatalf("error %v, se esperaba %v", err, tc.esperado)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Manejador de pagos de facturas: cobro en caja (uno o varios métodos) e historial.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /facturas/:id/pagos
+// {"pagos": [{"metodo": "tarjeta", "monto": 10000, "referencia": "123456"}, {"metodo": "efectivo", "recibido": 5000}]}
+// {"pagos": [{"metodo": "efectivo", "recibido": 20000, "propina": 2000}]}
+func RegistrarPagosFactura(c *gin.Context) {
+	factura, ok := facturaDeParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Pagos []PagoInput `json:"pagos"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	vuelto, err := RegistrarPagos(factura.ID, input.Pagos, actorDeContexto(c).ID)
+	switch {
+	case errors.Is(err, ErrFacturaNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Factura no encontrada"})
+		return
+	case errors.Is(err, ErrFacturaNoCerrada):
+		c.JSON(http.StatusConflict, gin.H{"error": "La factura debe estar cerrada antes de cobrarla"})
+		return
+	case errors.Is(err, ErrCajaCerrada):
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay una caja abierta en esta terminal; abra la caja antes de cobrar"})
+		return
+	case errors.Is(err, ErrFacturaYaPagada):
+		c.JSON(http.StatusConflict, gin.H{"error": "La factura ya está pagada"})
+		return
+	case errors.Is(err, ErrPagoExcedeSaldo):
+		c.JSON(http.StatusConflict, gin.H{"error": "El pago excede el saldo pendiente", "saldo": factura.Saldo})
+		return
+	case errors.Is(err, ErrSinPagos), errors.Is(err, ErrPagoMetodo), errors.Is(err, ErrPagoSinMonto),
+		errors.Is(err, ErrPagoSinReferencia), errors.Is(err, ErrPagoRecibido),
+		errors.Is(err, ErrPropinaInvalida), errors.Is(err, ErrPropinaSinEmpleado):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrEmpleadoNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Printf("Error al registrar pagos de factura %d: %v\n", factura.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar los pagos"})
+		return
+	}
+
+	responderFacturaActualizada(c, http.StatusCreated, factura.ID, gin.H{"mensaje": "Pago registrado", "vuelto": vuelto})
+}
+
+// GET /facturas/:id/pagos
+func ListarPagosFactura(c *gin.Context) {
+	factura, ok := facturaVisibleParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, factura.EstadoPagos)
+}
@@ -0,0 +1,305 @@
+// Pagos de facturas con varios métodos, pagos parciales y divididos. El estado de
+// pago no se guarda: se deriva de lo pagado contra el total.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"restapi/dto"
+	"slices"
+	"strings"
+)
+
+// Métodos de pago aceptados
+const (
+	MetodoEfectivo      = "efectivo"
+	MetodoTarjeta       = "tarjeta"
+	MetodoSinpeMovil    = "sinpe_movil"
+	MetodoTransferencia = "transferencia"
+)
+
+// Estados de pago derivados
+const (
+	EstadoPagoPendiente = "pendiente"
+	EstadoPagoParcial   = "pagada_parcialmente"
+	EstadoPagoPagada    = "pagada"
+	EstadoPagoAnulada   = "anulada"
+)
+
+var (
+	ErrPagoSinMonto       = errors.New("el monto del pago debe ser mayor a cero")
+	ErrPagoExcedeSaldo    = errors.New("el pago excede el saldo pendiente")
+	ErrPagoMetodo         = errors.New("método de pago no válido")
+	ErrPagoSinReferencia  = errors.New("SINPE Móvil y transferencia requieren referencia")
+	ErrPagoRecibido       = errors.New("el efectivo recibido no alcanza para el monto")
+	ErrFacturaNoCerrada   = errors.New("la factura debe estar cerrada para registrar pagos")
+	ErrSinPagos           = errors.New("no se indicó ningún pago")
+	ErrFacturaYaPagada    = errors.New("la factura ya está pagada")
+	ErrPropinaInvalida    = errors.New("la propina no puede ser negativa")
+	ErrPropinaSinEmpleado = errors.New("la factura no tiene un empleado asignado; indique empleado_id para la propina")
+	metodosPagoPermitidos = map[string]bool{MetodoEfectivo: true, MetodoTarjeta: true, MetodoSinpeMovil: true, MetodoTransferencia: true}
+)
+
+// PagoInput es un pago individual. En efectivo basta con "recibido": se aplica lo
+// necesario para cubrir el saldo y el resto es vuelto. La propina va aparte del monto
+// y se atribuye al empleado de la cita, o al indicado en empleado_id.
+type PagoInput struct {
+	Metodo     string   `json:"metodo"`
+	Monto      *float64 `json:"monto"`
+	Recibido   *float64 `json:"recibido"`
+	Referencia string   `json:"referencia"`
+	Propina    *float64 `json:"propina"`
+	EmpleadoID *int     `json:"empleado_id"`
+}
+
+type PagoFactura struct {
+	ID            int      `json:"id"`
+	Metodo        string   `json:"metodo"`
+	Monto         float64  `json:"monto"`
+	Recibido      *float64 `json:"recibido"`
+	Vuelto        float64  `json:"vuelto"`
+	Referencia    *string  `json:"referencia"`
+	Propina       float64  `json:"propina"`
+	EmpleadoID    *int     `json:"empleado_propina_id"`
+	RegistradoPor *int     `json:"registrado_por"`
+	Fecha         string   `json:"fecha"`
+}
+
+// EstadoPagos resume los pagos de una factura.
+type EstadoPagos struct {
+	EstadoPago  string        `json:"estado_pago"`
+	Pagado      float64       `json:"pagado"`
+	Reembolsado float64       `json:"reembolsado"`
+	Saldo       float64       `json:"saldo"`
+	Propinas    float64       `json:"propinas"` // no cuentan para el saldo
+	Pagos       []PagoFactura `json:"pagos"`
+}
+
+// RegistrarPagos aplica uno o varios pagos (pago dividido) a una factura cerrada en
+// una sola transacción. Devuelve el vuelto total a entregar. Una factura ya pagada
+// solo admite pagos de propina.
+func RegistrarPagos(facturaID int, pagos []PagoInput, registradoPor sql.NullInt32) (float64, error) {
+	if len(pagos) == 0 {
+		return 0, ErrSinPagos
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// El candado sobre la factura serializa cobros simultáneos de la misma cuenta
+	var estado string
+	var total float64
+	var empleadoCita sql.NullInt32
+	err = tx.QueryRow(`
+		SELECT f.estado, f.total, c.empleado_id
+		FROM factura f WITH (UPDLOCK, ROWLOCK)
+		LEFT JOIN citas c ON f.idCita = c.id
+		WHERE f.idFact = @id`,
+		sql.Named("id", facturaID)).Scan(&estado, &total, &empleadoCita)
+	if err == sql.ErrNoRows {
+		return 0, ErrFacturaNoExiste
+	} else if err != nil {
+		return 0, fmt.Errorf("consultar factura: %w", err)
+	}
+	if estado != EstadoFacturaCerrada {
+		return 0, ErrFacturaNoCerrada
+	}
+
+	// Lo acreditado en notas de crédito ya no se cobra; lo reembolsado vuelve a deberse
+	mov, err := movimientosFacturaTx(tx, facturaID)
+	if err != nil {
+		return 0, err
+	}
+	if mov.Anulada {
+		return 0, ErrFacturaAnulada
+	}
+	saldo := centavos(total) - centavos(mov.Acreditado) - mov.cobradoNeto()
+	// Todo cobro entra en la sesión de caja abierta de esta terminal
+	sesionID, err := sesionCajaAbiertaTx(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if saldo <= 0 && !slices.ContainsFunc(pagos, func(p PagoInput) bool { return p.Propina != nil && *p.Propina > 0 }) {
+		return 0, ErrFacturaYaPagada
+	}
+
+	var vueltoTotal int64
+	for _, p := range pagos {
+		p.Metodo = strings.ToLower(strings.TrimSpace(p.Metodo))
+		propina, empleado, err := propinaDePago(tx, p, empleadoCita)
+		if err != nil {
+			return 0, err
+		}
+		monto, recibido, vuelto, err := validarPago(p, max(saldo, 0), propina)
+		if err != nil {
+			return 0, err
+		}
+
+		var recibidoSQL sql.NullFloat64
+		if recibido >= 0 {
+			recibidoSQL = sql.NullFloat64{Float64: aMonto(recibido), Valid: true}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO pagos_factura (idFact, metodo, monto, recibido, vuelto, referencia, propina, empleado_propina_id, registrado_por, sesion_caja_id)
+			VALUES (@factura_id, @metodo, @monto, @recibido, @vuelto, @referencia, @propina, @empleado, @registrado_por, @sesion_id)`,
+			sql.Named("factura_id", facturaID),
+			sql.Named("metodo", p.Metodo),
+			sql.Named("monto", aMonto(monto)),
+			sql.Named("recibido", recibidoSQL),
+			sql.Named("vuelto", aMonto(vuelto)),
+			sql.Named("referencia", textoONulo(p.Referencia)),
+			sql.Named("propina", aMonto(propina)),
+			sql.Named("empleado", empleado),
+			sql.Named("registrado_por", registradoPor),
+			sql.Named("sesion_id", sesionID),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("registrar pago: %w", err)
+		}
+		saldo -= monto
+		vueltoTotal += vuelto
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return aMonto(vueltoTotal), nil
+}
+
+// propinaDePago devuelve la propina en céntimos y el empleado al que se atribuye: el
+// indicado en el pago o, si no, el que atendió la cita de la factura.
+func propinaDePago(tx *sql.Tx, p PagoInput, empleadoCita sql.NullInt32) (int64, sql.NullInt32, error) {
+	if p.Propina == nil || centavos(*p.Propina) == 0 {
+		return 0, sql.NullInt32{}, nil
+	}
+	propina := centavos(*p.Propina)
+	if propina < 0 {
+		return 0, sql.NullInt32{}, ErrPropinaInvalida
+	}
+	if p.EmpleadoID == nil {
+		if !empleadoCita.Valid {
+			return 0, sql.NullInt32{}, ErrPropinaSinEmpleado
+		}
+		return propina, empleadoCita, nil
+	}
+
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM usuarios WHERE id = @id AND rol IN ('empleado', 'admin')",
+		sql.Named("id", *p.EmpleadoID)).Scan(&count)
+	if err != nil {
+		return 0, sql.NullInt32{}, fmt.Errorf("consultar empleado de la propina: %w", err)
+	}
+	if count == 0 {
+		return 0, sql.NullInt32{}, ErrEmpleadoNoExiste
+	}
+	return propina, sql.NullInt32{Int32: int32(*p.EmpleadoID), Valid: true}, nil
+}
+
+// validarPago devuelve monto aplicado, recibido (-1 si no aplica) y vuelto, en céntimos.
+// El efectivo recibido cubre primero la propina y luego el saldo.
+func validarPago(p PagoInput, saldo, propina int64) (int64, int64, int64, error) {
+	if !metodosPagoPermitidos[p.Metodo] {
+		return 0, 0, 0, ErrPagoMetodo
+	}
+	if (p.Metodo == MetodoSinpeMovil || p.Metodo == MetodoTransferencia) && strings.TrimSpace(p.Referencia) == "" {
+		return 0, 0, 0, ErrPagoSinReferencia
+	}
+
+	recibido := int64(-1)
+	if p.Metodo == MetodoEfectivo && p.Recibido != nil {
+		recibido = centavos(*p.Recibido)
+	}
+
+	var monto int64
+	switch {
+	case p.Monto != nil:
+		monto = centavos(*p.Monto)
+	case recibido >= 0:
+		monto = max(min(recibido-propina, saldo), 0)
+	}
+	if monto < 0 || (monto == 0 && propina == 0) {
+		return 0, 0, 0, ErrPagoSinMonto
+	}
+	if monto > saldo {
+		return 0, 0, 0, ErrPagoExcedeSaldo
+	}
+
+	var vuelto int64
+	if recibido >= 0 {
+		if recibido < monto+propina {
+			return 0, 0, 0, ErrPagoRecibido
+		}
+		vuelto = recibido - monto - propina
+	}
+	return monto, recibido, vuelto, nil
+}
+
+// PagosDeFactura devuelve el historial de pagos y el estado derivado. totalNeto es el
+// total de la factura menos lo acreditado en notas de crédito.
+func PagosDeFactura(facturaID int, totalNeto, reembolsado float64) (EstadoPagos, error) {
+	rows, err := dto.DB.Query(`
+		SELECT id, metodo, monto, recibido, vuelto, referencia, propina, empleado_propina_id, registrado_por, CONVERT(VARCHAR(19), creado_en, 126)
+		FROM pagos_factura WHERE idFact = @id ORDER BY creado_en, id`, sql.Named("id", facturaID))
+	if err != nil {
+		return EstadoPagos{}, fmt.Errorf("consultar pagos: %w", err)
+	}
+	defer rows.Close()
+
+	estado := EstadoPagos{Pagos: []PagoFactura{}}
+	for rows.Next() {
+		var p PagoFactura
+		var recibido sql.NullFloat64
+		var empleado, registradoPor sql.NullInt32
+		if err := rows.Scan(&p.ID, &p.Metodo, &p.Monto, &recibido, &p.Vuelto, &p.Referencia, &p.Propina, &empleado, &registradoPor, &p.Fecha); err != nil {
+			return EstadoPagos{}, fmt.Errorf("leer pago: %w", err)
+		}
+		if recibido.Valid {
+			p.Recibido = &recibido.Float64
+		}
+		p.EmpleadoID = nullInt32Ptr(empleado)
+		p.RegistradoPor = nullInt32Ptr(registradoPor)
+		estado.Pagos = append(estado.Pagos, p)
+		estado.Pagado += p.Monto
+		estado.Propinas += p.Propina
+	}
+	if err := rows.Err(); err != nil {
+		return EstadoPagos{}, err
+	}
+
+	estado.Pagado = redondear(estado.Pagado)
+	estado.Propinas = redondear(estado.Propinas)
+	estado.Reembolsado = reembolsado
+	cobrado := aMonto(centavos(estado.Pagado) - centavos(reembolsado))
+	estado.Saldo = aMonto(max(centavos(totalNeto)-centavos(cobrado), 0))
+	estado.EstadoPago = estadoDePago(totalNeto, cobrado)
+	return estado, nil
+}
+
+// estadoDePago compara lo cobrado con lo adeudado. Una factura acreditada por completo
+// no debe nada y queda como pagada.
+func estadoDePago(total, pagado float64) string {
+	switch {
+	case centavos(pagado) <= 0 && centavos(total) > 0:
+		return EstadoPagoPendiente
+	case centavos(pagado) < centavos(total):
+		return EstadoPagoParcial
+	default:
+		return EstadoPagoPagada
+	}
+}
+
+// Los montos se comparan en céntimos para no arrastrar errores de punto flotante.
+func centavos(monto float64) int64 {
+	return int64(math.Round(monto * 100))
+}
+
+func aMonto(centimos int64) float64 {
+	return float64(centimos) / 100
+}
@@ -0,0 +1,339 @@
+// Permisos por rol: cada ruta protegida declara el permiso que exige (ver
+// InicializarServidor) y cada rol tiene un conjunto de permisos guardado en
+// roles_permisos que el admin puede editar. Los roles siguen siendo los de usuarios.rol.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Catálogo de permisos. Un permiso nuevo se agrega aquí, en catalogoPermisos y en
+// permisosPredeterminados para los roles que corresponda; SembrarPermisos lo asigna
+// también en las bases ya cargadas.
+const (
+	PermisoCitasVerTodas          = "citas:ver_todas"
+	PermisoCitasBuscarCedula      = "citas:buscar_cedula"
+	PermisoCitasConfirmar         = "citas:confirmar"
+	PermisoCitasEditar            = "citas:editar"
+	PermisoCitasFinalizar         = "citas:finalizar"
+	PermisoCitasPropias           = "citas:propias"
+	PermisoFacturasVer            = "facturas:ver"
+	PermisoFacturasCrear          = "facturas:crear"
+	PermisoFacturasAnular         = "facturas:anular"
+	PermisoFacturasNumeracion     = "facturas:numeracion"
+	PermisoComprobantesGestionar  = "comprobantes:gestionar"
+	PermisoPagosRegistrar         = "pagos:registrar"
+	PermisoCajaOperar             = "caja:operar"
+	PermisoCajaAuditar            = "caja:auditar"
+	PermisoPromocionesVer         = "promociones:ver"
+	PermisoPromocionesAdministrar = "promociones:administrar"
+	PermisoCatalogoAdministrar    = "catalogo:administrar"
+	PermisoImpuestosVer           = "impuestos:ver"
+	PermisoImpuestosAdministrar   = "impuestos:administrar"
+	PermisoHorariosVer            = "horarios:ver"
+	PermisoHorariosVerTodos       = "horarios:ver_todos"
+	PermisoHorariosAdministrar    = "horarios:administrar"
+	PermisoAusenciasSolicitar     = "ausencias:solicitar"
+	PermisoAusenciasRevisar       = "ausencias:revisar"
+	PermisoEmpleadosVer           = "empleados:ver"
+	PermisoEmpleadosAdministrar   = "empleados:administrar"
+	PermisoSalonAdministrar       = "salon:administrar"
+	PermisoReportesCitas          = "reportes:citas"
+	PermisoReportesPropinas       = "reportes:propinas"
+	PermisoReportesIngresos       = "reportes:ingresos"
+	PermisoReportesVerTodos       = "reportes:ver_todos"
+	PermisoNotificacionesEnviar   = "notificaciones:enviar"
+	PermisoUsuariosVer            = "usuarios:ver"
+	PermisoUsuariosAdministrar    = "usuarios:administrar"
+	PermisoAuditoriaVer           = "auditoria:ver"
+	PermisoInventarioAlertas      = "inventario:alertas"
+	PermisoEstadisticasVer        = "estadisticas:ver"
+	PermisoRolesAdministrar       = "roles:administrar"
+)
+
+// Permiso describe una entrada del catálogo para la pantalla de roles.
+type Permiso struct {
+	Codigo      string `json:"codigo"`
+	Descripcion string `json:"descripcion"`
+}
+
+var catalogoPermisos = []Permiso{
+	{PermisoCitasVerTodas, "Ver las citas de todos los clientes e invitados"},
+	{PermisoCitasBuscarCedula, "Buscar citas de invitados por cédula"},
+	{PermisoCitasConfirmar, "Confirmar o rechazar citas"},
+	{PermisoCitasEditar, "Modificar cualquier cita"},
+	{PermisoCitasFinalizar, "Marcar citas como atendidas"},
+	{PermisoCitasPropias, "Reprogramar sus citas y reclamar las hechas como invitado"},
+	{PermisoFacturasVer, "Ver el listado de todas las facturas"},
+	{PermisoFacturasCrear, "Facturar citas, vender en mostrador y editar borradores"},
+	{PermisoFacturasAnular, "Anular facturas y emitir notas de crédito"},
+	{PermisoFacturasNumeracion, "Administrar las series de numeración"},
+	{PermisoComprobantesGestionar, "Generar, enviar y consultar comprobantes de Hacienda"},
+	{PermisoPagosRegistrar, "Registrar pagos de facturas"},
+	{PermisoCajaOperar, "Abrir, cerrar y retirar efectivo de la caja"},
+	{PermisoCajaAuditar, "Consultar sesiones de caja pasadas"},
+	{PermisoPromocionesVer, "Ver promociones"},
+	{PermisoPromocionesAdministrar, "Crear y modificar promociones"},
+	{PermisoCatalogoAdministrar, "Administrar servicios y productos"},
+	{PermisoImpuestosVer, "Ver categorías de impuesto"},
+	{PermisoImpuestosAdministrar, "Crear categorías de impuesto y programar tarifas"},
+	{PermisoHorariosVer, "Ver turnos, excepciones y ausencias propias"},
+	{PermisoHorariosVerTodos, "Ver turnos, excepciones y ausencias de todos los empleados"},
+	{PermisoHorariosAdministrar, "Administrar turnos y excepciones de horario"},
+	{PermisoAusenciasSolicitar, "Solicitar y cancelar ausencias"},
+	{PermisoAusenciasRevisar, "Aprobar o rechazar ausencias de cualquier empleado"},
+	{PermisoEmpleadosVer, "Ver los servicios que ofrece cada empleado"},
+	{PermisoEmpleadosAdministrar, "Asignar servicios a los empleados"},
+	{PermisoSalonAdministrar, "Administrar horario del salón, días especiales y política de citas"},
+	{PermisoReportesCitas, "Reporte de citas por fechas"},
+	{PermisoReportesPropinas, "Reporte de propinas"},
+	{PermisoReportesIngresos, "Reporte de ingresos"},
+	{PermisoReportesVerTodos, "Ver los reportes de todos los empleados, no solo los propios"},
+	{PermisoNotificacionesEnviar, "Enviar notificaciones a clientes"},
+	{PermisoUsuariosVer, "Ver el listado de usuarios"},
+	{PermisoUsuariosAdministrar, "Registrar y fusionar usuarios"},
+	{PermisoAuditoriaVer, "Ver la auditoría de usuarios"},
+	{PermisoInventarioAlertas, "Ver y resolver alertas de inventario"},
+	{PermisoEstadisticasVer, "Ver estadísticas de clientes e historial de precios"},
+	{PermisoRolesAdministrar, "Editar los permisos de cada rol"},
+}
+
+// Roles que existen en usuarios.rol
+var rolesSistema = []string{"admin", "empleado", "cliente"}
+
+// permisosPredeterminados es la carga inicial de roles_permisos (ver SembrarPermisos):
+// reproduce el acceso que tenían admin, empleado y cliente antes de los permisos.
+var permisosPredeterminados = map[string][]string{
+	"admin": {
+		PermisoCitasVerTodas, PermisoCitasBuscarCedula, PermisoCitasConfirmar, PermisoCitasEditar, PermisoCitasFinalizar,
+		PermisoFacturasVer, PermisoFacturasCrear, PermisoFacturasAnular, PermisoFacturasNumeracion,
+		PermisoComprobantesGestionar, PermisoPagosRegistrar, PermisoCajaOperar, PermisoCajaAuditar,
+		PermisoPromocionesVer, PermisoPromocionesAdministrar, PermisoCatalogoAdministrar,
+		PermisoImpuestosVer, PermisoImpuestosAdministrar,
+		PermisoHorariosVer, PermisoHorariosVerTodos, PermisoHorariosAdministrar,
+		PermisoAusenciasSolicitar, PermisoAusenciasRevisar, PermisoEmpleadosVer, PermisoEmpleadosAdministrar,
+		PermisoSalonAdministrar, PermisoReportesCitas, PermisoReportesPropinas, PermisoReportesIngresos, PermisoReportesVerTodos,
+		PermisoNotificacionesEnviar, PermisoUsuariosVer, PermisoUsuariosAdministrar, PermisoAuditoriaVer,
+		PermisoInventarioAlertas, PermisoEstadisticasVer, PermisoRolesAdministrar,
+	},
+	"empleado": {
+		PermisoCitasBuscarCedula, PermisoCitasFinalizar, PermisoFacturasCrear, PermisoPagosRegistrar, PermisoCajaOperar,
+		PermisoPromocionesVer, PermisoImpuestosVer, PermisoHorariosVer, PermisoAusenciasSolicitar, PermisoEmpleadosVer,
+		PermisoReportesCitas, PermisoReportesPropinas, PermisoNotificacionesEnviar, PermisoUsuariosVer,
+		PermisoInventarioAlertas, PermisoEstadisticasVer,
+	},
+	"cliente": {PermisoCitasPropias},
+}
+
+// Los permisos se releen cada tanto para que un cambio hecho en otra instancia llegue
+const duracionCachePermisos = time.Minute
+
+var (
+	ErrRolNoExiste          = errors.New("el rol no existe")
+	ErrPermisoDesconocido   = errors.New("permiso desconocido")
+	ErrRolSinAdministracion = errors.New("el rol admin no puede perder el permiso de administrar roles")
+)
+
+// RolPermisos es un rol con su conjunto de permisos.
+type RolPermisos struct {
+	Rol      string   `json:"rol"`
+	Permisos []string `json:"permisos"`
+}
+
+var cachePermisos struct {
+	sync.RWMutex
+	porRol    map[string]map[string]bool
+	cargadoEn time.Time
+}
+
+// RolTienePermiso indica si el rol incluye el permiso.
+func RolTienePermiso(rol, permiso string) (bool, error) {
+	porRol, err := permisosPorRol()
+	if err != nil {
+		return false, err
+	}
+	return porRol[rol][permiso], nil
+}
+
+func permisosPorRol() (map[string]map[string]bool, error) {
+	cachePermisos.RLock()
+	porRol, cargadoEn := cachePermisos.porRol, cachePermisos.cargadoEn
+	cachePermisos.RUnlock()
+	if porRol != nil && time.Since(cargadoEn) < duracionCachePermisos {
+		return porRol, nil
+	}
+
+	rows, err := dto.DB.Query("SELECT rol, permiso FROM roles_permisos")
+	if err != nil {
+		return nil, fmt.Errorf("consultar permisos: %w", err)
+	}
+	defer rows.Close()
+
+	porRol = map[string]map[string]bool{}
+	for rows.Next() {
+		var rol, permiso string
+		if err := rows.Scan(&rol, &permiso); err != nil {
+			return nil, fmt.Errorf("leer permisos: %w", err)
+		}
+		if porRol[rol] == nil {
+			porRol[rol] = map[string]bool{}
+		}
+		porRol[rol][permiso] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("leer permisos: %w", err)
+	}
+
+	cachePermisos.Lock()
+	cachePermisos.porRol, cachePermisos.cargadoEn = porRol, time.Now()
+	cachePermisos.Unlock()
+	return porRol, nil
+}
+
+// SembrarPermisos asigna los permisosPredeterminados de cada permiso del catálogo que
+// todavía no está en permisos_sembrados. Se llama al arrancar: una base nueva recibe la
+// matriz completa y un permiso agregado después recibe sus valores predeterminados,
+// sin devolver a un rol lo que el admin le quitó desde /roles.
+func SembrarPermisos() error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Dos instancias que arrancan juntas no siembran dos veces
+	rows, err := tx.Query("SELECT permiso FROM permisos_sembrados WITH (UPDLOCK, HOLDLOCK)")
+	if err != nil {
+		return fmt.Errorf("consultar permisos sembrados: %w", err)
+	}
+	sembrados := map[string]bool{}
+	for rows.Next() {
+		var permiso string
+		if err := rows.Scan(&permiso); err != nil {
+			rows.Close()
+			return fmt.Errorf("leer permisos sembrados: %w", err)
+		}
+		sembrados[permiso] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("leer permisos sembrados: %w", err)
+	}
+
+	var nuevos []string
+	for _, p := range catalogoPermisos {
+		if sembrados[p.Codigo] {
+			continue
+		}
+		for _, rol := range rolesSistema {
+			if !slices.Contains(permisosPredeterminados[rol], p.Codigo) {
+				continue
+			}
+			_, err := tx.Exec(`
+				INSERT INTO roles_permisos (rol, permiso)
+				SELECT @rol, @permiso
+				WHERE NOT EXISTS (SELECT 1 FROM roles_permisos WHERE rol = @rol AND permiso = @permiso)`,
+				sql.Named("rol", rol),
+				sql.Named("permiso", p.Codigo),
+			)
+			if err != nil {
+				return fmt.Errorf("guardar permiso %s de %s: %w", p.Codigo, rol, err)
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO permisos_sembrados (permiso) VALUES (@permiso)", sql.Named("permiso", p.Codigo)); err != nil {
+			return fmt.Errorf("registrar permiso %s: %w", p.Codigo, err)
+		}
+		nuevos = append(nuevos, p.Codigo)
+	}
+	if len(nuevos) == 0 {
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	invalidarCachePermisos()
+	fmt.Printf("Permisos predeterminados cargados: %s\n", strings.Join(nuevos, ", "))
+	return nil
+}
+
+func invalidarCachePermisos() {
+	cachePermisos.Lock()
+	cachePermisos.porRol = nil
+	cachePermisos.Unlock()
+}
+
+// ListarRolesPermisos devuelve cada rol con sus permisos en el orden del catálogo.
+func ListarRolesPermisos() ([]RolPermisos, error) {
+	porRol, err := permisosPorRol()
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]RolPermisos, 0, len(rolesSistema))
+	for _, rol := range rolesSistema {
+		r := RolPermisos{Rol: rol, Permisos: []string{}}
+		for _, p := range catalogoPermisos {
+			if porRol[rol][p.Codigo] {
+				r.Permisos = append(r.Permisos, p.Codigo)
+			}
+		}
+		roles = append(roles, r)
+	}
+	return roles, nil
+}
+
+// ActualizarPermisosRol reemplaza el conjunto de permisos del rol.
+func ActualizarPermisosRol(rol string, permisos []string) error {
+	if !slices.Contains(rolesSistema, rol) {
+		return ErrRolNoExiste
+	}
+	for _, p := range permisos {
+		if !permisoConocido(p) {
+			return fmt.Errorf("%w: %s", ErrPermisoDesconocido, p)
+		}
+	}
+	// Sin esto nadie podría volver a editar los roles
+	if rol == "admin" && !slices.Contains(permisos, PermisoRolesAdministrar) {
+		return ErrRolSinAdministracion
+	}
+	permisos = slices.Clone(permisos)
+	slices.Sort(permisos)
+	permisos = slices.Compact(permisos)
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM roles_permisos WHERE rol = @rol", sql.Named("rol", rol)); err != nil {
+		return fmt.Errorf("borrar permisos del rol: %w", err)
+	}
+	for _, p := range permisos {
+		_, err := tx.Exec("INSERT INTO roles_permisos (rol, permiso) VALUES (@rol, @permiso)",
+			sql.Named("rol", rol),
+			sql.Named("permiso", p),
+		)
+		if err != nil {
+			return fmt.Errorf("guardar permiso %s: %w", p, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	invalidarCachePermisos()
+	return nil
+}
+
+func permisoConocido(codigo string) bool {
+	return slices.ContainsFunc(catalogoPermisos, func(p Permiso) bool { return p.Codigo == codigo })
+}
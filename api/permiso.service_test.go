@@ -0,0 +1,138 @@
+package api
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// La matriz predeterminada decide quién entra a cada ruta en una base nueva; un cambio
+// aquí tiene que ser a propósito.
+func TestPermisosPredeterminados(t *testing.T) {
+	casos := []struct {
+		permiso                  string
+		admin, empleado, cliente bool
+	}{
+		{PermisoCitasVerTodas, true, false, false},
+		{PermisoCitasBuscarCedula, true, true, false},
+		{PermisoCitasConfirmar, true, false, false},
+		{PermisoCitasEditar, true, false, false},
+		{PermisoCitasFinalizar, true, true, false},
+		{PermisoCitasPropias, false, false, true},
+		{PermisoFacturasVer, true, false, false},
+		{PermisoFacturasCrear, true, true, false},
+		{PermisoFacturasAnular, true, false, false},
+		{PermisoFacturasNumeracion, true, false, false},
+		{PermisoComprobantesGestionar, true, false, false},
+		{PermisoPagosRegistrar, true, true, false},
+		{PermisoCajaOperar, true, true, false},
+		{PermisoCajaAuditar, true, false, false},
+		{PermisoPromocionesVer, true, true, false},
+		{PermisoPromocionesAdministrar, true, false, false},
+		{PermisoCatalogoAdministrar, true, false, false},
+		{PermisoImpuestosVer, true, true, false},
+		{PermisoImpuestosAdministrar, true, false, false},
+		{PermisoHorariosVer, true, true, false},
+		{PermisoHorariosVerTodos, true, false, false},
+		{PermisoHorariosAdministrar, true, false, false},
+		{PermisoAusenciasSolicitar, true, true, false},
+		{PermisoAusenciasRevisar, true, false, false},
+		{PermisoEmpleadosVer, true, true, false},
+		{PermisoEmpleadosAdministrar, true, false, false},
+		{PermisoSalonAdministrar, true, false, false},
+		{PermisoReportesCitas, true, true, false},
+		{PermisoReportesPropinas, true, true, false},
+		{PermisoReportesIngresos, true, false, false},
+		{PermisoReportesVerTodos, true, false, false},
+		{PermisoNotificacionesEnviar, true, true, false},
+		{PermisoUsuariosVer, true, true, false},
+		{PermisoUsuariosAdministrar, true, false, false},
+		{PermisoAuditoriaVer, true, false, false},
+		{PermisoInventarioAlertas, true, true, false},
+		{PermisoEstadisticasVer, true, true, false},
+		{PermisoRolesAdministrar, true, false, false},
+	}
+
+	if len(casos) != len(catalogoPermisos) {
+		t.Fatalf("la tabla cubre %d permisos y el catálogo tiene %d", len(casos), len(catalogoPermisos))
+	}
+	for _, tc := range casos {
+		if !permisoConocido(tc.permiso) {
+			t.Errorf("%s no está en el catálogo", tc.permiso)
+		}
+		for rol, esperado := range map[string]bool{"admin": tc.admin, "empleado": tc.empleado, "cliente": tc.cliente} {
+			if got := slices.Contains(permisosPredeterminados[rol], tc.permiso); got != esperado {
+				t.Errorf("%s tiene %s = %v, se esperaba %v", rol, tc.permiso, got, esperado)
+			}
+		}
+	}
+}
+
+func TestPermisosPredeterminadosSonValidos(t *testing.T) {
+	for rol, permisos := range permisosPredeterminados {
+		if !slices.Contains(rolesSistema, rol) {
+			t.Errorf("rol desconocido %q", rol)
+		}
+		for i, p := range permisos {
+			if !permisoConocido(p) {
+				t.Errorf("%s: permiso desconocido %q", rol, p)
+			}
+			if slices.Contains(permisos[:i], p) {
+				t.Errorf("%s: permiso repetido %q", rol, p)
+			}
+		}
+	}
+	for _, rol := range rolesSistema {
+		if len(permisosPredeterminados[rol]) == 0 {
+			t.Errorf("%s no tiene permisos predeterminados", rol)
+		}
+	}
+	// ActualizarPermisosRol exige lo mismo; sin esto nadie podría editar los roles
+	if !slices.Contains(permisosPredeterminados["admin"], PermisoRolesAdministrar) {
+		t.Errorf("admin debe tener %s", PermisoRolesAdministrar)
+	}
+}
+
+// Un permiso agregado a una base ya cargada recibe sus valores predeterminados una sola
+// vez; los ya sembrados no se tocan aunque el admin se los haya quitado a un rol.
+func TestSembrarPermisosNuevos(t *testing.T) {
+	mock := baseSimulada(t)
+	sembrados := sqlmock.NewRows([]string{"permiso"})
+	for _, p := range catalogoPermisos {
+		if p.Codigo != PermisoCitasBuscarCedula {
+			sembrados.AddRow(p.Codigo)
+		}
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(consulta("SELECT permiso FROM permisos_sembrados WITH (UPDLOCK, HOLDLOCK)")).WillReturnRows(sembrados)
+	for _, rol := range []string{"admin", "empleado"} {
+		mock.ExpectExec(consulta("INSERT INTO roles_permisos (rol, permiso)")).
+			WithArgs(sql.Named("rol", rol), sql.Named("permiso", PermisoCitasBuscarCedula)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(consulta("INSERT INTO permisos_sembrados (permiso)")).
+		WithArgs(sql.Named("permiso", PermisoCitasBuscarCedula)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := SembrarPermisos(); err != nil {
+		t.Fatalf("sembrar: %v", err)
+	}
+}
+
+func TestSembrarPermisosSinNuevos(t *testing.T) {
+	mock := baseSimulada(t)
+	sembrados := sqlmock.NewRows([]string{"permiso"})
+	for _, p := range catalogoPermisos {
+		sembrados.AddRow(p.Codigo)
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(consulta("SELECT permiso FROM permisos_sembrados")).WillReturnRows(sembrados)
+	mock.ExpectRollback()
+
+	if err := SembrarPermisos(); err != nil {
+		t.Fatalf("sembrar: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Manejador de la política de citas (anticipación, reprogramaciones, reconfirmación).
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /politicas/citas
+func ObtenerPoliticaCitasHandler(c *gin.Context) {
+	politica, err := ObtenerPoliticaCitas()
+	if err != nil {
+		fmt.Println("❌ Error al obtener política de citas:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la política de citas"})
+		return
+	}
+	c.JSON(http.StatusOK, politica)
+}
+
+// PUT /politicas/citas
+func ActualizarPoliticaCitas(c *gin.Context) {
+	var input PoliticaCitas
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if input.AnticipacionMinimaHoras < 0 || input.MaxReprogramaciones < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La anticipación y el máximo de reprogramaciones no pueden ser negativos"})
+		return
+	}
+
+	if err := GuardarPoliticaCitas(input); err != nil {
+		fmt.Println("❌ Error al guardar política de citas:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar la política de citas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Política de citas actualizada correctamente", "politica": input})
+}
@@ -0,0 +1,66 @@
+// Política de citas configurable por el salón: anticipación mínima para cambios,
+// tope de reprogramaciones y si una cita movida debe volver a confirmarse.
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+// Valores usados mientras no exista la fila de configuración
+const (
+	anticipacionMinimaPorDefecto     = 12
+	maxReprogramacionesPorDefecto    = 2
+	requiereReconfirmacionPorDefecto = true
+)
+
+type PoliticaCitas struct {
+	AnticipacionMinimaHoras int  `json:"anticipacion_minima_horas"`
+	MaxReprogramaciones     int  `json:"max_reprogramaciones"`
+	RequiereReconfirmacion  bool `json:"requiere_reconfirmacion"`
+}
+
+func (p PoliticaCitas) AnticipacionMinima() time.Duration {
+	return time.Duration(p.AnticipacionMinimaHoras) * time.Hour
+}
+
+// ObtenerPoliticaCitas lee la configuración vigente (fila id = 1 de politica_citas).
+func ObtenerPoliticaCitas() (PoliticaCitas, error) {
+	p := PoliticaCitas{
+		AnticipacionMinimaHoras: anticipacionMinimaPorDefecto,
+		MaxReprogramaciones:     maxReprogramacionesPorDefecto,
+		RequiereReconfirmacion:  requiereReconfirmacionPorDefecto,
+	}
+	err := dto.DB.QueryRow(`
+		SELECT anticipacion_minima_horas, max_reprogramaciones, requiere_reconfirmacion
+		FROM politica_citas WHERE id = 1`).
+		Scan(&p.AnticipacionMinimaHoras, &p.MaxReprogramaciones, &p.RequiereReconfirmacion)
+	if err != nil && err != sql.ErrNoRows {
+		return p, fmt.Errorf("consultar política de citas: %w", err)
+	}
+	return p, nil
+}
+
+// GuardarPoliticaCitas crea o reemplaza la configuración.
+func GuardarPoliticaCitas(p PoliticaCitas) error {
+	_, err := dto.DB.Exec(`
+		MERGE politica_citas AS destino
+		USING (SELECT 1 AS id) AS origen ON destino.id = origen.id
+		WHEN MATCHED THEN
+			UPDATE SET anticipacion_minima_horas = @anticipacion, max_reprogramaciones = @max,
+			           requiere_reconfirmacion = @reconfirmar, actualizado_en = GETDATE()
+		WHEN NOT MATCHED THEN
+			INSERT (id, anticipacion_minima_horas, max_reprogramaciones, requiere_reconfirmacion)
+			VALUES (1, @anticipacion, @max, @reconfirmar);`,
+		sql.Named("anticipacion", p.AnticipacionMinimaHoras),
+		sql.Named("max", p.MaxReprogramaciones),
+		sql.Named("reconfirmar", p.RequiereReconfirmacion),
+	)
+	if err != nil {
+		return fmt.Errorf("guardar política de citas: %w", err)
+	}
+	return nil
+}
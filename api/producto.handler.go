@@ -75,14 +75,6 @@ func ObtenerProducto(c *gin.Context) {
 
 // POST /productos
 func CrearProducto(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	fmt.Printf("🔐 Rol obtenido del token: %v (existe: %v)\n", rol, existe)
-	if !existe || rol != "admin" {
-		fmt.Println("❌ Error de autorización: Rol no es admin")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden crear productos"})
-		return
-	}
-
 	nombre := c.PostForm("nombre")
 	descripcion := c.PostForm("descripcion")
 	precioStr := c.PostForm("precio")
@@ -136,14 +128,6 @@ func CrearProducto(c *gin.Context) {
 
 // PUT /productos/:id
 func ActualizarProducto(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	fmt.Printf("🔐 [ACTUALIZAR] Rol obtenido del token: %v (existe: %v)\n", rol, existe)
-	if !existe || rol != "admin" {
-		fmt.Println("❌ Error de autorización: Rol no es admin")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden actualizar productos"})
-		return
-	}
-
 	id := c.Param("id")
 	nombre := c.PostForm("nombre")
 	descripcion := c.PostForm("descripcion")
@@ -206,14 +190,6 @@ func ActualizarProducto(c *gin.Context) {
 
 // DELETE /productos/:id
 func EliminarProducto(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	fmt.Printf("🔐 [ELIMINAR] Rol obtenido del token: %v (existe: %v)\n", rol, existe)
-	if !existe || rol != "admin" {
-		fmt.Println("❌ Error de autorización: Rol no es admin")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden eliminar productos"})
-		return
-	}
-
 	id := c.Param("id")
 	fmt.Printf("🗑️ Intentando eliminar producto con ID: %s\n", id)
 
@@ -0,0 +1,143 @@
+// Manejador de promociones: catálogo de códigos (admin) y aplicación de un código a
+// una factura en borrador (personal).
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /promociones
+func ListarPromocionesHandler(c *gin.Context) {
+	promociones, err := ListarPromociones()
+	if err != nil {
+		fmt.Println("❌ Error al listar promociones:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar promociones"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"promociones": promociones})
+}
+
+// POST /promociones
+// {"codigo": "CUMPLE10", "nombre": "Cumpleaños", "tipo": "porcentaje", "valor": 10, "fecha_inicio": "2025-01-01", "limite_por_cliente": 1}
+// {"codigo": "MARTES2X1", "nombre": "Manicura 2x1", "tipo": "2x1", "aplica_a": "seleccion", "servicios": [3], "dias_semana": "2", ...}
+func CrearPromocionHandler(c *gin.Context) {
+	var input Promocion
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	id, err := CrearPromocion(input, actorDeContexto(c).ID)
+	switch {
+	case errors.Is(err, ErrPromocionInvalida):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrPromocionDuplicada):
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya existe una promoción con ese código"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al crear promoción:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo crear la promoción"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Promoción creada", "id": id})
+}
+
+// PUT /promociones/:id  {"activa": false} o {"fecha_fin": "2025-12-31", "limite_total": 100}
+func ActualizarPromocionHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de promoción inválido"})
+		return
+	}
+
+	var input struct {
+		Activa           *bool   `json:"activa"`
+		FechaFin         *string `json:"fecha_fin"`
+		LimitePorCliente *int    `json:"limite_por_cliente"`
+		LimiteTotal      *int    `json:"limite_total"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	err = ActualizarPromocion(id, input.Activa, input.FechaFin, input.LimitePorCliente, input.LimiteTotal)
+	switch {
+	case errors.Is(err, ErrPromocionNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promoción no encontrada"})
+		return
+	case errors.Is(err, ErrPromocionInvalida):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al actualizar promoción:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo actualizar la promoción"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Promoción actualizada"})
+}
+
+// POST /facturas/:id/promocion  {"codigo": "CUMPLE10"}
+func AplicarPromocionFacturaHandler(c *gin.Context) {
+	facturaID, ok := facturaEditableParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Codigo string `json:"codigo"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Codigo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique el código de la promoción"})
+		return
+	}
+
+	if err := AplicarPromocionFactura(facturaID, input.Codigo); err != nil {
+		responderErrorLineaFactura(c, err)
+		return
+	}
+	responderFacturaActualizada(c, http.StatusOK, facturaID, gin.H{"mensaje": "Promoción aplicada"})
+}
+
+// DELETE /facturas/:id/promocion
+func QuitarPromocionFacturaHandler(c *gin.Context) {
+	facturaID, ok := facturaEditableParam(c)
+	if !ok {
+		return
+	}
+
+	if err := QuitarPromocionFactura(facturaID); err != nil {
+		responderErrorLineaFactura(c, err)
+		return
+	}
+	responderFacturaActualizada(c, http.StatusOK, facturaID, gin.H{"mensaje": "Promoción quitada"})
+}
+
+func esErrorPromocion(err error) bool {
+	for _, e := range []error{ErrPromocionNoExiste, ErrPromocionNoVigente, ErrPromocionNoAplica, ErrPromocionAgotada,
+		ErrPromocionLimiteCliente, ErrPromocionSinCliente, ErrPromocionYaAplicada} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// responderErrorPromocion traduce los errores al validar un código.
+func responderErrorPromocion(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrPromocionNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "El código de promoción no existe"})
+	case errors.Is(err, ErrPromocionSinCliente):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	}
+}
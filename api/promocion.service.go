@@ -0,0 +1,723 @@
+// Promociones y descuentos. Un código de cupón se valida al agendar (queda reservado en
+// la cita) o al facturar, y se traduce en descuentos sobre las líneas de la factura.
+// Los descuentos manuales del personal viven en la misma columna de la línea; la
+// promoción nunca pisa un descuento manual.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tipos de promoción
+const (
+	PromoPorcentaje = "porcentaje"
+	PromoMontoFijo  = "monto_fijo"
+	Promo2x1        = "2x1" // por cada dos unidades del mismo ítem, una va gratis
+)
+
+// A qué líneas aplica una promoción
+const (
+	AplicaTodo      = "todo"
+	AplicaServicios = "servicios"
+	AplicaProductos = "productos"
+	AplicaSeleccion = "seleccion"
+)
+
+var (
+	ErrPromocionNoExiste      = errors.New("el código de promoción no existe")
+	ErrPromocionNoVigente     = errors.New("la promoción no está vigente para esa fecha")
+	ErrPromocionNoAplica      = errors.New("la promoción no aplica a los servicios o productos indicados")
+	ErrPromocionAgotada       = errors.New("la promoción alcanzó su límite de usos")
+	ErrPromocionLimiteCliente = errors.New("el cliente ya usó esta promoción el máximo de veces permitido")
+	ErrPromocionSinCliente    = errors.New("la promoción tiene límite por cliente: la factura debe tener un cliente identificado")
+	ErrPromocionYaAplicada    = errors.New("ya hay otra promoción aplicada")
+	ErrPromocionInvalida      = errors.New("datos de promoción inválidos")
+	ErrPromocionDuplicada     = errors.New("ya existe una promoción con ese código")
+	ErrDescuentoInvalido      = errors.New("el descuento no puede ser negativo ni mayor al monto de la línea")
+)
+
+type Promocion struct {
+	ID               int     `json:"id"`
+	Codigo           string  `json:"codigo"`
+	Nombre           string  `json:"nombre"`
+	Descripcion      *string `json:"descripcion"`
+	Tipo             string  `json:"tipo"`
+	Valor            float64 `json:"valor"`
+	AplicaA          string  `json:"aplica_a"`
+	FechaInicio      string  `json:"fecha_inicio"`
+	FechaFin         *string `json:"fecha_fin"`
+	DiasSemana       *string `json:"dias_semana"` // "2" = martes, "1,3,5"; 0 = domingo
+	LimitePorCliente *int    `json:"limite_por_cliente"`
+	LimiteTotal      *int    `json:"limite_total"`
+	Activa           bool    `json:"activa"`
+	Servicios        []int   `json:"servicios"` // solo con aplica_a = seleccion
+	Productos        []int   `json:"productos"`
+	Usos             int     `json:"usos"`
+}
+
+// clientePromocion identifica al cliente para los límites de uso: la cuenta si la
+// tiene, o la cédula si es invitado.
+type clientePromocion struct {
+	usuarioID sql.NullInt32
+	cedula    string
+}
+
+func (c clientePromocion) identificado() bool {
+	return c.usuarioID.Valid || c.cedula != ""
+}
+
+// lineaDescuento es lo que necesita el cálculo de descuentos de cada línea.
+type lineaDescuento struct {
+	servicioID *int
+	productoID *int
+	cantidad   int
+	precio     float64
+	tarifa     float64
+	manual     bool // tiene descuento manual: la promoción no la toca
+}
+
+func (l lineaDescuento) bruto() int64 {
+	return centavos(redondear(l.precio * float64(l.cantidad)))
+}
+
+// vigenteEn indica si la promoción se puede usar en la fecha (sin hora) indicada.
+func (p *Promocion) vigenteEn(fecha time.Time) bool {
+	dia := fecha.Format("2006-01-02")
+	if !p.Activa || dia < p.FechaInicio || (p.FechaFin != nil && dia > *p.FechaFin) {
+		return false
+	}
+	if p.DiasSemana == nil || *p.DiasSemana == "" {
+		return true
+	}
+	for _, d := range strings.Split(*p.DiasSemana, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(d)); err == nil && time.Weekday(n) == fecha.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Promocion) aplicaA(l lineaDescuento) bool {
+	switch p.AplicaA {
+	case AplicaServicios:
+		return l.servicioID != nil
+	case AplicaProductos:
+		return l.productoID != nil
+	case AplicaSeleccion:
+		if l.servicioID != nil {
+			return slices.Contains(p.Servicios, *l.servicioID)
+		}
+		if l.productoID != nil {
+			return slices.Contains(p.Productos, *l.productoID)
+		}
+		return false
+	}
+	return l.servicioID != nil || l.productoID != nil
+}
+
+// descuentosPromocion calcula en centavos el descuento de cada línea. El monto fijo se
+// consume en el orden de las líneas; el 2x1 cuenta las unidades de cada ítem entre
+// todas sus líneas y regala la mitad, empezando por las últimas.
+func descuentosPromocion(p *Promocion, lineas []lineaDescuento) []int64 {
+	descuentos := make([]int64, len(lineas))
+	switch p.Tipo {
+	case PromoPorcentaje:
+		for i, l := range lineas {
+			if !l.manual && p.aplicaA(l) {
+				descuentos[i] = centavos(redondear(aMonto(l.bruto()) * p.Valor / 100))
+			}
+		}
+	case PromoMontoFijo:
+		restante := centavos(p.Valor)
+		for i, l := range lineas {
+			if restante <= 0 {
+				break
+			}
+			if !l.manual && p.aplicaA(l) {
+				descuentos[i] = min(restante, l.bruto())
+				restante -= descuentos[i]
+			}
+		}
+	case Promo2x1:
+		unidades := map[string]int{}
+		for _, l := range lineas {
+			if !l.manual && p.aplicaA(l) {
+				unidades[claveItem(l)] += l.cantidad
+			}
+		}
+		gratis := map[string]int{}
+		for k, n := range unidades {
+			gratis[k] = n / 2
+		}
+		for i := len(lineas) - 1; i >= 0; i-- {
+			l := lineas[i]
+			if l.manual || !p.aplicaA(l) {
+				continue
+			}
+			n := min(gratis[claveItem(l)], l.cantidad)
+			gratis[claveItem(l)] -= n
+			descuentos[i] = centavos(redondear(l.precio * float64(n)))
+		}
+	}
+	return descuentos
+}
+
+func claveItem(l lineaDescuento) string {
+	if l.servicioID != nil {
+		return "s" + strconv.Itoa(*l.servicioID)
+	}
+	if l.productoID != nil {
+		return "p" + strconv.Itoa(*l.productoID)
+	}
+	return ""
+}
+
+// motivoPromocion es el texto de la línea de descuento en la factura.
+func motivoPromocion(p *Promocion) string {
+	return recortar("Promoción "+p.Codigo+": "+p.Nombre, 100)
+}
+
+const columnasPromocion = `
+	SELECT p.id, p.codigo, p.nombre, p.descripcion, p.tipo, p.valor, p.aplica_a,
+	       CONVERT(VARCHAR(10), p.fecha_inicio, 23), CONVERT(VARCHAR(10), p.fecha_fin, 23), p.dias_semana,
+	       p.limite_por_cliente, p.limite_total, p.activa,
+	       (SELECT COUNT(*) FROM usos_promocion u LEFT JOIN citas c ON u.cita_id = c.id
+	        WHERE u.promocion_id = p.id AND (c.id IS NULL OR c.estado NOT IN (@cancelada, @rechazada)))
+	FROM promociones p`
+
+// consultorSQL lo cumplen tanto *sql.DB como *sql.Tx.
+type consultorSQL interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ListarPromociones devuelve todas las promociones con sus ítems y usos.
+func ListarPromociones() ([]Promocion, error) {
+	rows, err := dto.DB.Query(columnasPromocion+" ORDER BY p.activa DESC, p.fecha_inicio DESC",
+		sql.Named("cancelada", EstadoCancelada), sql.Named("rechazada", EstadoRechazada))
+	if err != nil {
+		return nil, fmt.Errorf("listar promociones: %w", err)
+	}
+	defer rows.Close()
+
+	promociones := []Promocion{}
+	for rows.Next() {
+		p, err := escanearPromocion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promociones = append(promociones, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range promociones {
+		if err := cargarItemsPromocion(dto.DB, &promociones[i]); err != nil {
+			return nil, err
+		}
+	}
+	return promociones, nil
+}
+
+// promocionPorCodigo busca la promoción por código (sin distinguir mayúsculas).
+func promocionPorCodigo(q consultorSQL, codigo string) (*Promocion, error) {
+	p, err := escanearPromocion(q.QueryRow(columnasPromocion+" WHERE p.codigo = @codigo",
+		sql.Named("codigo", strings.ToUpper(strings.TrimSpace(codigo))),
+		sql.Named("cancelada", EstadoCancelada), sql.Named("rechazada", EstadoRechazada)))
+	if err != nil {
+		return nil, err
+	}
+	return p, cargarItemsPromocion(q, p)
+}
+
+func promocionPorID(q consultorSQL, id int) (*Promocion, error) {
+	p, err := escanearPromocion(q.QueryRow(columnasPromocion+" WHERE p.id = @id", sql.Named("id", id),
+		sql.Named("cancelada", EstadoCancelada), sql.Named("rechazada", EstadoRechazada)))
+	if err != nil {
+		return nil, err
+	}
+	return p, cargarItemsPromocion(q, p)
+}
+
+func escanearPromocion(s interface{ Scan(...interface{}) error }) (*Promocion, error) {
+	var p Promocion
+	var limiteCliente, limiteTotal sql.NullInt32
+	err := s.Scan(&p.ID, &p.Codigo, &p.Nombre, &p.Descripcion, &p.Tipo, &p.Valor, &p.AplicaA,
+		&p.FechaInicio, &p.FechaFin, &p.DiasSemana, &limiteCliente, &limiteTotal, &p.Activa, &p.Usos)
+	if err == sql.ErrNoRows {
+		return nil, ErrPromocionNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("leer promoción: %w", err)
+	}
+	p.LimitePorCliente = nullInt32Ptr(limiteCliente)
+	p.LimiteTotal = nullInt32Ptr(limiteTotal)
+	return &p, nil
+}
+
+func cargarItemsPromocion(q consultorSQL, p *Promocion) error {
+	p.Servicios, p.Productos = []int{}, []int{}
+	rows, err := q.Query("SELECT servicio_id, producto_id FROM promocion_items WHERE promocion_id = @id", sql.Named("id", p.ID))
+	if err != nil {
+		return fmt.Errorf("consultar ítems de la promoción: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var servicioID, productoID sql.NullInt32
+		if err := rows.Scan(&servicioID, &productoID); err != nil {
+			return fmt.Errorf("leer ítem de la promoción: %w", err)
+		}
+		if servicioID.Valid {
+			p.Servicios = append(p.Servicios, int(servicioID.Int32))
+		} else if productoID.Valid {
+			p.Productos = append(p.Productos, int(productoID.Int32))
+		}
+	}
+	return rows.Err()
+}
+
+// CrearPromocion valida y registra la promoción. El código se guarda en mayúsculas.
+func CrearPromocion(p Promocion, creadoPor sql.NullInt32) (int, error) {
+	p.Codigo = strings.ToUpper(strings.TrimSpace(p.Codigo))
+	if p.AplicaA == "" {
+		p.AplicaA = AplicaTodo
+	}
+	if err := validarPromocion(p); err != nil {
+		return 0, err
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var existe int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM promociones WHERE codigo = @codigo", sql.Named("codigo", p.Codigo)).Scan(&existe); err != nil {
+		return 0, fmt.Errorf("consultar promociones: %w", err)
+	}
+	if existe > 0 {
+		return 0, ErrPromocionDuplicada
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO promociones (codigo, nombre, descripcion, tipo, valor, aplica_a, fecha_inicio, fecha_fin, dias_semana,
+		                         limite_por_cliente, limite_total, creado_por)
+		OUTPUT INSERTED.id
+		VALUES (@codigo, @nombre, @descripcion, @tipo, @valor, @aplica_a, @inicio, @fin, @dias, @limite_cliente, @limite_total, @creado_por)`,
+		sql.Named("codigo", p.Codigo),
+		sql.Named("nombre", strings.TrimSpace(p.Nombre)),
+		sql.Named("descripcion", p.Descripcion),
+		sql.Named("tipo", p.Tipo),
+		sql.Named("valor", p.Valor),
+		sql.Named("aplica_a", p.AplicaA),
+		sql.Named("inicio", p.FechaInicio),
+		sql.Named("fin", p.FechaFin),
+		sql.Named("dias", p.DiasSemana),
+		sql.Named("limite_cliente", p.LimitePorCliente),
+		sql.Named("limite_total", p.LimiteTotal),
+		sql.Named("creado_por", creadoPor),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("crear promoción: %w", err)
+	}
+
+	if p.AplicaA == AplicaSeleccion {
+		for _, s := range p.Servicios {
+			if _, err := tx.Exec("INSERT INTO promocion_items (promocion_id, servicio_id) VALUES (@id, @item)", sql.Named("id", id), sql.Named("item", s)); err != nil {
+				return 0, fmt.Errorf("agregar servicio a la promoción: %w", err)
+			}
+		}
+		for _, pr := range p.Productos {
+			if _, err := tx.Exec("INSERT INTO promocion_items (promocion_id, producto_id) VALUES (@id, @item)", sql.Named("id", id), sql.Named("item", pr)); err != nil {
+				return 0, fmt.Errorf("agregar producto a la promoción: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return id, nil
+}
+
+func validarPromocion(p Promocion) error {
+	var problemas []string
+	if p.Codigo == "" || len(p.Codigo) > 30 || strings.ContainsAny(p.Codigo, " \t") {
+		problemas = append(problemas, "código sin espacios de hasta 30 caracteres")
+	}
+	if strings.TrimSpace(p.Nombre) == "" {
+		problemas = append(problemas, "nombre obligatorio")
+	}
+	switch p.Tipo {
+	case PromoPorcentaje:
+		if p.Valor <= 0 || p.Valor > 100 {
+			problemas = append(problemas, "el porcentaje debe estar entre 0 y 100")
+		}
+	case PromoMontoFijo:
+		if p.Valor <= 0 {
+			problemas = append(problemas, "el monto fijo debe ser mayor a cero")
+		}
+	case Promo2x1:
+	default:
+		problemas = append(problemas, "tipo debe ser porcentaje, monto_fijo o 2x1")
+	}
+	switch p.AplicaA {
+	case AplicaTodo, AplicaServicios, AplicaProductos:
+	case AplicaSeleccion:
+		if len(p.Servicios)+len(p.Productos) == 0 {
+			problemas = append(problemas, "indique los servicios o productos de la selección")
+		}
+	default:
+		problemas = append(problemas, "aplica_a debe ser todo, servicios, productos o seleccion")
+	}
+	inicio, err := time.Parse("2006-01-02", p.FechaInicio)
+	if err != nil {
+		problemas = append(problemas, "fecha_inicio con formato YYYY-MM-DD")
+	}
+	if p.FechaFin != nil {
+		if fin, err := time.Parse("2006-01-02", *p.FechaFin); err != nil || fin.Before(inicio) {
+			problemas = append(problemas, "fecha_fin con formato YYYY-MM-DD y posterior al inicio")
+		}
+	}
+	if p.DiasSemana != nil {
+		for _, d := range strings.Split(*p.DiasSemana, ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(d)); err != nil || n < 0 || n > 6 {
+				problemas = append(problemas, "dias_semana son números del 0 (domingo) al 6 separados por coma")
+				break
+			}
+		}
+	}
+	if (p.LimitePorCliente != nil && *p.LimitePorCliente <= 0) || (p.LimiteTotal != nil && *p.LimiteTotal <= 0) {
+		problemas = append(problemas, "los límites de uso deben ser mayores a cero")
+	}
+	if len(problemas) > 0 {
+		return fmt.Errorf("%w: %s", ErrPromocionInvalida, strings.Join(problemas, "; "))
+	}
+	return nil
+}
+
+// ActualizarPromocion activa o desactiva la promoción y ajusta su fin o sus límites.
+// Los descuentos ya aplicados no cambian.
+func ActualizarPromocion(id int, activa *bool, fechaFin *string, limitePorCliente, limiteTotal *int) error {
+	if fechaFin != nil {
+		if _, err := time.Parse("2006-01-02", *fechaFin); err != nil {
+			return fmt.Errorf("%w: fecha_fin con formato YYYY-MM-DD", ErrPromocionInvalida)
+		}
+	}
+	if (limitePorCliente != nil && *limitePorCliente <= 0) || (limiteTotal != nil && *limiteTotal <= 0) {
+		return fmt.Errorf("%w: los límites de uso deben ser mayores a cero", ErrPromocionInvalida)
+	}
+
+	res, err := dto.DB.Exec(`
+		UPDATE promociones
+		SET activa = COALESCE(@activa, activa), fecha_fin = COALESCE(@fin, fecha_fin),
+		    limite_por_cliente = COALESCE(@limite_cliente, limite_por_cliente), limite_total = COALESCE(@limite_total, limite_total)
+		WHERE id = @id`,
+		sql.Named("activa", activa), sql.Named("fin", fechaFin),
+		sql.Named("limite_cliente", limitePorCliente), sql.Named("limite_total", limiteTotal), sql.Named("id", id))
+	if err != nil {
+		return fmt.Errorf("actualizar promoción: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPromocionNoExiste
+	}
+	return nil
+}
+
+// verificarLimitesPromocion revisa el límite total y el del cliente. citaID excluye la
+// reserva de la propia cita, que ya está contada.
+func verificarLimitesPromocion(tx *sql.Tx, p *Promocion, cliente clientePromocion, citaID sql.NullInt32) error {
+	// Bloquea la promoción para que dos cajas no tomen el último uso a la vez
+	if _, err := tx.Exec("UPDATE promociones SET activa = activa WHERE id = @id", sql.Named("id", p.ID)); err != nil {
+		return fmt.Errorf("bloquear promoción: %w", err)
+	}
+
+	var total, delCliente int
+	err := tx.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(CASE WHEN (@usuario_id IS NOT NULL AND u.usuario_id = @usuario_id) OR (@cedula <> '' AND u.cedula = @cedula) THEN 1 ELSE 0 END), 0)
+		FROM usos_promocion u
+		LEFT JOIN citas c ON u.cita_id = c.id
+		WHERE u.promocion_id = @id AND (c.id IS NULL OR c.estado NOT IN (@cancelada, @rechazada))
+		  AND (@cita_id IS NULL OR u.cita_id IS NULL OR u.cita_id <> @cita_id)`,
+		sql.Named("id", p.ID),
+		sql.Named("usuario_id", cliente.usuarioID),
+		sql.Named("cedula", cliente.cedula),
+		sql.Named("cita_id", citaID),
+		sql.Named("cancelada", EstadoCancelada),
+		sql.Named("rechazada", EstadoRechazada),
+	).Scan(&total, &delCliente)
+	if err != nil {
+		return fmt.Errorf("contar usos de la promoción: %w", err)
+	}
+	if p.LimiteTotal != nil && total >= *p.LimiteTotal {
+		return ErrPromocionAgotada
+	}
+	if p.LimitePorCliente != nil {
+		if !cliente.identificado() {
+			return ErrPromocionSinCliente
+		}
+		if delCliente >= *p.LimitePorCliente {
+			return ErrPromocionLimiteCliente
+		}
+	}
+	return nil
+}
+
+// ReservaPromocion es el resultado de validar un código al agendar.
+type ReservaPromocion struct {
+	Codigo     string  `json:"codigo"`
+	Nombre     string  `json:"nombre"`
+	Precio     float64 `json:"precio"`
+	Descuento  float64 `json:"descuento"`
+	PrecioNeto float64 `json:"precio_neto"`
+}
+
+// reservarPromocionCita valida el código para el servicio y la fecha de la cita, la
+// liga a la cita y registra el uso. Se cobra al facturar la cita.
+func reservarPromocionCita(tx *sql.Tx, codigo string, citaID int32, servicioID int, fecha time.Time, cliente clientePromocion) (*ReservaPromocion, error) {
+	p, err := promocionPorCodigo(tx, codigo)
+	if err != nil {
+		return nil, err
+	}
+	if !p.vigenteEn(fecha) {
+		return nil, ErrPromocionNoVigente
+	}
+
+	var precio float64
+	if err := tx.QueryRow("SELECT precio FROM servicios WHERE id = @id", sql.Named("id", servicioID)).Scan(&precio); err != nil {
+		return nil, fmt.Errorf("consultar precio del servicio: %w", err)
+	}
+	linea := lineaDescuento{servicioID: &servicioID, cantidad: 1, precio: precio}
+	if !p.aplicaA(linea) {
+		return nil, ErrPromocionNoAplica
+	}
+	if err := verificarLimitesPromocion(tx, p, cliente, sql.NullInt32{}); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE citas SET promocion_id = @promocion_id WHERE id = @id", sql.Named("promocion_id", p.ID), sql.Named("id", citaID)); err != nil {
+		return nil, fmt.Errorf("asignar promoción a la cita: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO usos_promocion (promocion_id, usuario_id, cedula, cita_id) VALUES (@promocion_id, @usuario_id, @cedula, @cita_id)",
+		sql.Named("promocion_id", p.ID), sql.Named("usuario_id", cliente.usuarioID), sql.Named("cedula", textoONulo(cliente.cedula)), sql.Named("cita_id", citaID))
+	if err != nil {
+		return nil, fmt.Errorf("registrar uso de la promoción: %w", err)
+	}
+
+	// El 2x1 no rebaja una cita sola; el descuento real se calcula al facturar
+	descuento := aMonto(descuentosPromocion(p, []lineaDescuento{linea})[0])
+	return &ReservaPromocion{Codigo: p.Codigo, Nombre: p.Nombre, Precio: precio, Descuento: descuento, PrecioNeto: redondear(precio - descuento)}, nil
+}
+
+// AplicarPromocionFactura aplica un código a una factura en borrador. La vigencia se
+// mide a la fecha de la factura; si la cita ya traía una promoción reservada, esa manda.
+func AplicarPromocionFactura(facturaID int, codigo string) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bloquearFacturaEditable(tx, facturaID); err != nil {
+		return err
+	}
+	if err := aplicarPromocionTx(tx, facturaID, codigo); err != nil {
+		return err
+	}
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+func aplicarPromocionTx(tx *sql.Tx, facturaID int, codigo string) error {
+	var actual sql.NullInt32
+	var fecha time.Time
+	var citaID sql.NullInt32
+	cliente := clientePromocion{}
+	err := tx.QueryRow(`
+		SELECT f.promocion_id, f.fecha, f.idCita, COALESCE(c.usuario_id, f.cliente_id), COALESCE(c.cedula_invitado, f.cedula_cliente, '')
+		FROM factura f LEFT JOIN citas c ON f.idCita = c.id
+		WHERE f.idFact = @id`, sql.Named("id", facturaID)).Scan(&actual, &fecha, &citaID, &cliente.usuarioID, &cliente.cedula)
+	if err != nil {
+		return fmt.Errorf("consultar factura: %w", err)
+	}
+
+	p, err := promocionPorCodigo(tx, codigo)
+	if err != nil {
+		return err
+	}
+	if actual.Valid {
+		if int(actual.Int32) == p.ID {
+			return nil
+		}
+		return ErrPromocionYaAplicada
+	}
+	if !p.vigenteEn(fecha) {
+		return ErrPromocionNoVigente
+	}
+
+	lineas, _, err := lineasParaDescuento(tx, facturaID)
+	if err != nil {
+		return err
+	}
+	aplica := false
+	for _, l := range lineas {
+		aplica = aplica || (!l.manual && p.aplicaA(l))
+	}
+	if !aplica {
+		return ErrPromocionNoAplica
+	}
+	if err := verificarLimitesPromocion(tx, p, cliente, citaID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE factura SET promocion_id = @promocion_id WHERE idFact = @id", sql.Named("promocion_id", p.ID), sql.Named("id", facturaID)); err != nil {
+		return fmt.Errorf("asignar promoción a la factura: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO usos_promocion (promocion_id, usuario_id, cedula, cita_id, idFact)
+		VALUES (@promocion_id, @usuario_id, @cedula, @cita_id, @factura_id)`,
+		sql.Named("promocion_id", p.ID), sql.Named("usuario_id", cliente.usuarioID), sql.Named("cedula", textoONulo(cliente.cedula)),
+		sql.Named("cita_id", citaID), sql.Named("factura_id", facturaID))
+	if err != nil {
+		return fmt.Errorf("registrar uso de la promoción: %w", err)
+	}
+	return nil
+}
+
+// usarPromocionDeCita pasa a la factura la promoción reservada al agendar la cita.
+func usarPromocionDeCita(tx *sql.Tx, facturaID, citaID, promocionID int) error {
+	if _, err := tx.Exec("UPDATE factura SET promocion_id = @promocion_id WHERE idFact = @id", sql.Named("promocion_id", promocionID), sql.Named("id", facturaID)); err != nil {
+		return fmt.Errorf("asignar promoción a la factura: %w", err)
+	}
+	_, err := tx.Exec("UPDATE usos_promocion SET idFact = @factura_id WHERE cita_id = @cita_id AND promocion_id = @promocion_id AND idFact IS NULL",
+		sql.Named("factura_id", facturaID), sql.Named("cita_id", citaID), sql.Named("promocion_id", promocionID))
+	if err != nil {
+		return fmt.Errorf("registrar uso de la promoción: %w", err)
+	}
+	return nil
+}
+
+// QuitarPromocionFactura deja la factura en borrador sin promoción y libera el uso.
+func QuitarPromocionFactura(facturaID int) error {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bloquearFacturaEditable(tx, facturaID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE factura SET promocion_id = NULL WHERE idFact = @id", sql.Named("id", facturaID)); err != nil {
+		return fmt.Errorf("quitar promoción: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM usos_promocion WHERE idFact = @id", sql.Named("id", facturaID)); err != nil {
+		return fmt.Errorf("liberar uso de la promoción: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE citas SET promocion_id = NULL WHERE id = (SELECT idCita FROM factura WHERE idFact = @id)", sql.Named("id", facturaID)); err != nil {
+		return fmt.Errorf("quitar promoción de la cita: %w", err)
+	}
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// lineasParaDescuento lee las líneas de la factura en orden, con su id.
+func lineasParaDescuento(tx *sql.Tx, facturaID int) ([]lineaDescuento, []int, error) {
+	rows, err := tx.Query(`
+		SELECT idDetalle, idServicio, idProducto, cant, precio, tarifa_impuesto, CASE WHEN descuento > 0 AND promocion_id IS NULL THEN 1 ELSE 0 END
+		FROM detallefactura WHERE idFact = @id ORDER BY idDetalle`, sql.Named("id", facturaID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("consultar líneas: %w", err)
+	}
+	defer rows.Close()
+
+	var lineas []lineaDescuento
+	var ids []int
+	for rows.Next() {
+		var l lineaDescuento
+		var id int
+		var servicioID, productoID sql.NullInt32
+		if err := rows.Scan(&id, &servicioID, &productoID, &l.cantidad, &l.precio, &l.tarifa, &l.manual); err != nil {
+			return nil, nil, fmt.Errorf("leer línea: %w", err)
+		}
+		l.servicioID, l.productoID = nullInt32Ptr(servicioID), nullInt32Ptr(productoID)
+		lineas = append(lineas, l)
+		ids = append(ids, id)
+	}
+	return lineas, ids, rows.Err()
+}
+
+// aplicarDescuentosPromocion recalcula el descuento de promoción de cada línea de la
+// factura; sin promoción, quita los que hubiera. Los descuentos manuales no se tocan.
+func aplicarDescuentosPromocion(tx *sql.Tx, facturaID int) error {
+	var promocionID sql.NullInt32
+	if err := tx.QueryRow("SELECT promocion_id FROM factura WHERE idFact = @id", sql.Named("id", facturaID)).Scan(&promocionID); err != nil {
+		return fmt.Errorf("consultar promoción de la factura: %w", err)
+	}
+
+	var p *Promocion
+	var err error
+	if promocionID.Valid {
+		if p, err = promocionPorID(tx, int(promocionID.Int32)); err != nil {
+			return err
+		}
+	}
+
+	lineas, ids, err := lineasParaDescuento(tx, facturaID)
+	if err != nil {
+		return err
+	}
+	descuentos := make([]int64, len(lineas))
+	if p != nil {
+		descuentos = descuentosPromocion(p, lineas)
+	}
+
+	for i, l := range lineas {
+		if l.manual {
+			continue
+		}
+		var promocion sql.NullInt32
+		var motivo sql.NullString
+		if descuentos[i] > 0 {
+			promocion = sql.NullInt32{Int32: int32(p.ID), Valid: true}
+			motivo = sql.NullString{String: motivoPromocion(p), Valid: true}
+		}
+		subtotal := aMonto(l.bruto() - descuentos[i])
+		_, err := tx.Exec(`
+			UPDATE detallefactura
+			SET descuento = @descuento, promocion_id = @promocion_id, motivo_descuento = @motivo,
+			    subtotal = @subtotal, impuesto = @impuesto
+			WHERE idDetalle = @id AND (descuento <> @descuento OR subtotal <> @subtotal OR ISNULL(promocion_id, 0) <> ISNULL(@promocion_id, 0))`,
+			sql.Named("descuento", aMonto(descuentos[i])),
+			sql.Named("promocion_id", promocion),
+			sql.Named("motivo", motivo),
+			sql.Named("subtotal", subtotal),
+			sql.Named("impuesto", impuestoDeLinea(subtotal, l.tarifa)),
+			sql.Named("id", ids[i]),
+		)
+		if err != nil {
+			return fmt.Errorf("aplicar descuento: %w", err)
+		}
+	}
+	return nil
+}
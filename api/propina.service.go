@@ -0,0 +1,81 @@
+// Propinas por empleado: lo recibido en los pagos de las facturas y atribuido a quien
+// atendió. Cada propina cuenta el día en que se registró el pago.
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+type PropinaRegistrada struct {
+	PagoID      int     `json:"pago_id"`
+	FacturaID   int     `json:"factura_id"`
+	Consecutivo *string `json:"consecutivo"`
+	Metodo      string  `json:"metodo"`
+	Monto       float64 `json:"monto"`
+	Fecha       string  `json:"fecha"`
+}
+
+type PropinasEmpleado struct {
+	EmpleadoID int                 `json:"empleado_id"`
+	Nombre     string              `json:"nombre"`
+	Cantidad   int                 `json:"cantidad"`
+	Total      float64             `json:"total"`
+	Propinas   []PropinaRegistrada `json:"propinas"`
+}
+
+// PropinasPorEmpleado agrupa las propinas del rango [inicio, fin]. Con empleadoID
+// solo devuelve las de ese empleado.
+func PropinasPorEmpleado(inicio, fin time.Time, empleadoID *int) ([]PropinasEmpleado, error) {
+	var empleado sql.NullInt32
+	if empleadoID != nil {
+		empleado = sql.NullInt32{Int32: int32(*empleadoID), Valid: true}
+	}
+	rows, err := dto.DB.Query(`
+		SELECT u.id, u.nombre, p.id, p.idFact, f.consecutivo, p.metodo, p.propina, CONVERT(VARCHAR(19), p.creado_en, 126)
+		FROM pagos_factura p
+		JOIN usuarios u ON u.id = p.empleado_propina_id
+		JOIN factura f ON f.idFact = p.idFact
+		WHERE p.propina > 0
+		  AND CAST(p.creado_en AS DATE) BETWEEN @inicio AND @fin
+		  AND (@empleado IS NULL OR p.empleado_propina_id = @empleado)
+		ORDER BY u.nombre, u.id, p.creado_en, p.id`,
+		sql.Named("inicio", inicio.Format("2006-01-02")),
+		sql.Named("fin", fin.Format("2006-01-02")),
+		sql.Named("empleado", empleado),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("consultar propinas: %w", err)
+	}
+	defer rows.Close()
+
+	empleados := []PropinasEmpleado{}
+	for rows.Next() {
+		var id int
+		var nombre string
+		var p PropinaRegistrada
+		if err := rows.Scan(&id, &nombre, &p.PagoID, &p.FacturaID, &p.Consecutivo, &p.Metodo, &p.Monto, &p.Fecha); err != nil {
+			return nil, fmt.Errorf("leer propina: %w", err)
+		}
+		if len(empleados) == 0 || empleados[len(empleados)-1].EmpleadoID != id {
+			empleados = append(empleados, PropinasEmpleado{EmpleadoID: id, Nombre: nombre, Propinas: []PropinaRegistrada{}})
+		}
+		e := &empleados[len(empleados)-1]
+		e.Propinas = append(e.Propinas, p)
+		e.Cantidad++
+		e.Total = redondear(e.Total + p.Monto)
+	}
+	return empleados, rows.Err()
+}
+
+// totalPropinas suma las propinas de todos los empleados del reporte.
+func totalPropinas(empleados []PropinasEmpleado) float64 {
+	var total float64
+	for _, e := range empleados {
+		total = redondear(total + e.Total)
+	}
+	return total
+}
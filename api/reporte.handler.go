@@ -1,18 +1,21 @@
-// Generación de reportes para administración (citas diarias, ingresos).
+// Generación de reportes para administración (citas diarias, ingresos, propinas).
 
 package api
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"restapi/dto"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const maxDiasReporteTurnos = 62
+
 func ReporteCitasPorFechas(c *gin.Context) {
-	rol, _ := c.Get("rol")
 	usuarioID, _ := c.Get("usuarioID")
 
 	fechaInicio := c.Query("inicio") // formato YYYY-MM-DD
@@ -29,6 +32,13 @@ func ReporteCitasPorFechas(c *gin.Context) {
 		return
 	}
 
+	// Opcional: incluir quién trabaja cada día del rango
+	incluirTurnos := c.Query("incluir_turnos") == "true"
+	if incluirTurnos && end.Sub(start) > maxDiasReporteTurnos*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El rango con turnos no puede superar 62 días"})
+		return
+	}
+
 	// Query base
 	query := `
 		SELECT c.id, u.nombre AS cliente, u.cedula, s.nombre AS servicio, s.precio, 
@@ -37,26 +47,27 @@ func ReporteCitasPorFechas(c *gin.Context) {
 		JOIN usuarios u ON u.id = c.usuario_id
 		JOIN servicios s ON s.id = c.servicio_id
 		LEFT JOIN usuarios e ON e.id = c.empleado_id
-		WHERE DATE(c.fecha_hora) BETWEEN ? AND ?
+		WHERE CAST(c.fecha_hora AS DATE) BETWEEN @inicio AND @fin
 		  AND (c.estado = 'confirmada' OR c.estado = 'atendida')
 	`
 
 	var rows *sql.Rows
 	var err error
 
-	if rol == "admin" {
+	inicio := sql.Named("inicio", fechaInicio)
+	fin := sql.Named("fin", fechaFin)
+
+	// Sin reportes:ver_todos cada empleado ve solo sus citas
+	if tienePermiso(c, PermisoReportesVerTodos) {
 		if empleadoFiltro != "" {
-			query += " AND c.empleado_id = ? ORDER BY c.fecha_hora"
-			rows, err = dto.DB.Query(query, start, end, empleadoFiltro)
+			query += " AND c.empleado_id = @empleado_id ORDER BY c.fecha_hora"
+			rows, err = dto.DB.Query(query, inicio, fin, sql.Named("empleado_id", empleadoFiltro))
 		} else {
-			rows, err = dto.DB.Query(query+" ORDER BY c.fecha_hora", start, end)
+			rows, err = dto.DB.Query(query+" ORDER BY c.fecha_hora", inicio, fin)
 		}
-	} else if rol == "empleado" {
-		query += " AND c.empleado_id = ? ORDER BY c.fecha_hora"
-		rows, err = dto.DB.Query(query, start, end, usuarioID)
 	} else {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Acceso denegado"})
-		return
+		query += " AND c.empleado_id = @empleado_id ORDER BY c.fecha_hora"
+		rows, err = dto.DB.Query(query, inicio, fin, sql.Named("empleado_id", usuarioID))
 	}
 
 	if err != nil {
@@ -95,5 +106,91 @@ func ReporteCitasPorFechas(c *gin.Context) {
 		})
 	}
 
-	c.JSON(http.StatusOK, reporte)
+	if !incluirTurnos {
+		c.JSON(http.StatusOK, reporte)
+		return
+	}
+
+	turnos := map[string][]EmpleadoEnTurno{}
+	for dia := start; !dia.After(end); dia = dia.AddDate(0, 0, 1) {
+		empleados, err := EmpleadosEnTurno(dia)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener empleados en turno"})
+			return
+		}
+		turnos[dia.Format("2006-01-02")] = empleados
+	}
+
+	c.JSON(http.StatusOK, gin.H{"citas": reporte, "turnos": turnos})
+}
+
+// GET /reporte/ingresos?inicio=YYYY-MM-DD&fin=YYYY-MM-DD
+func ReporteIngresos(c *gin.Context) {
+	layout := "2006-01-02"
+	start, err1 := time.Parse(layout, c.Query("inicio"))
+	end, err2 := time.Parse(layout, c.Query("fin"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+		return
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La fecha final no puede ser anterior a la inicial"})
+		return
+	}
+
+	dias, err := IngresosPorDia(start, end)
+	if err != nil {
+		fmt.Println("❌ Error al generar reporte de ingresos:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar reporte"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dias": dias, "totales": totalIngresos(dias)})
+}
+
+// GET /reporte/propinas?inicio=YYYY-MM-DD&fin=YYYY-MM-DD[&empleado_id=3]
+// Con reportes:ver_todos se ve a todos los empleados (o al indicado); si no, solo las
+// propinas propias.
+func ReportePropinas(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+
+	layout := "2006-01-02"
+	start, err1 := time.Parse(layout, c.Query("inicio"))
+	end, err2 := time.Parse(layout, c.Query("fin"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido. Use YYYY-MM-DD"})
+		return
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La fecha final no puede ser anterior a la inicial"})
+		return
+	}
+
+	var empleadoID *int
+	if tienePermiso(c, PermisoReportesVerTodos) {
+		if filtro := c.Query("empleado_id"); filtro != "" {
+			id, err := strconv.Atoi(filtro)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ID de empleado inválido"})
+				return
+			}
+			empleadoID = &id
+		}
+	} else {
+		id, ok := usuarioID.(int)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no autenticado"})
+			return
+		}
+		empleadoID = &id
+	}
+
+	empleados, err := PropinasPorEmpleado(start, end, empleadoID)
+	if err != nil {
+		fmt.Println("❌ Error al generar reporte de propinas:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar reporte"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"empleados": empleados, "total": totalPropinas(empleados)})
 }
@@ -0,0 +1,57 @@
+// Manejador de roles: catálogo de permisos y edición del conjunto de permisos de cada
+// rol (requiere roles:administrar).
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /permisos
+func ListarPermisosHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permisos": catalogoPermisos})
+}
+
+// GET /roles
+func ListarRolesHandler(c *gin.Context) {
+	roles, err := ListarRolesPermisos()
+	if err != nil {
+		fmt.Println("❌ Error al listar roles:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// PUT /roles/:rol/permisos  {"permisos": ["citas:finalizar", "facturas:crear"]}
+// Reemplaza el conjunto completo; rige para los tokens ya emitidos en menos de un minuto.
+func ActualizarPermisosRolHandler(c *gin.Context) {
+	var input struct {
+		Permisos []string `json:"permisos"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Permisos == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique la lista de permisos"})
+		return
+	}
+
+	rol := c.Param("rol")
+	err := ActualizarPermisosRol(rol, input.Permisos)
+	switch {
+	case errors.Is(err, ErrRolNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rol no encontrado"})
+		return
+	case errors.Is(err, ErrPermisoDesconocido), errors.Is(err, ErrRolSinAdministracion):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al actualizar permisos del rol:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudieron guardar los permisos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Permisos actualizados", "rol": rol})
+}
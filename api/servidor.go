@@ -26,67 +26,187 @@ func InicializarServidor() *gin.Engine {
 	// =====================
 	router.POST("/usuarios", RegistrarUsuario)
 	router.POST("/login", LoginUsuario)
+	router.POST("/token/refrescar", RefrescarToken)
+	router.POST("/password/olvido", OlvidoContrasena)
+	router.POST("/password/restablecer", RestablecerContrasenaHandler)
+	router.POST("/correo/verificar", VerificarCorreoHandler)
 	router.POST("/citas/invitado", CrearCitaInvitado)
-	router.GET("/citas/invitado/:cedula", ObtenerUltimaCitaInvitado)
-	router.GET("/citas/invitado/:cedula/todas", ObtenerCitasPorCedulaInvitado)
+	router.POST("/invitados/codigo", SolicitarCodigoInvitado)
+	router.POST("/invitados/verificar", VerificarCodigoInvitado)
 	router.GET("/servicios", ListarServicios)
 	router.GET("/servicios/:id", ObtenerServicio)
+	router.GET("/disponibilidad", ConsultarDisponibilidad)
+	router.GET("/horario-salon", ListarHorarioSalon)
+	router.GET("/horario-salon/dia", ObtenerHorarioDia)
 	router.GET("/productos", ListarProductos)
 	router.GET("/productos/:id", ObtenerProducto)
 
+	// =====================
+	// RUTAS DE INVITADOS (token de gestión o enlace mágico)
+	// =====================
+	invitado := router.Group("/invitados")
+	invitado.Use(AutenticarInvitado())
+	invitado.GET("/citas", ListarCitasInvitado)
+	invitado.PUT("/citas/:id/cancelar", CancelarCitaInvitado)
+	invitado.PUT("/citas/:id/reprogramar", ReprogramarCitaInvitado)
+
 	// =====================
 	// RUTAS PROTEGIDAS (requieren token)
 	// =====================
+	// RequierePermiso declara aquí el permiso de cada ruta; qué roles lo tienen se edita
+	// en /roles. Las rutas sin permiso están abiertas a cualquier usuario autenticado.
 
 	autorizado := router.Group("/")
 	autorizado.Use(Autenticar())
 
+	// Cierre de sesión
+	autorizado.POST("/logout", CerrarSesionHandler)
+	autorizado.POST("/logout/todos", CerrarTodasLasSesionesHandler)
+
 	// LISTADOS ESPECÍFICOS DE CITAS (antes que las genéricas)
-	autorizado.GET("/citas/usuarios", ListarCitasUsuarios)
-	autorizado.GET("/citas/invitados", ListarCitasInvitados)
+	autorizado.GET("/citas/usuarios", RequierePermiso(PermisoCitasVerTodas), ListarCitasUsuarios)
+	autorizado.GET("/citas/invitados", RequierePermiso(PermisoCitasVerTodas), ListarCitasInvitados)
+	autorizado.GET("/citas/invitado/:cedula", RequierePermiso(PermisoCitasBuscarCedula), ObtenerUltimaCitaInvitado)
+	autorizado.GET("/citas/invitado/:cedula/todas", RequierePermiso(PermisoCitasBuscarCedula), ObtenerCitasPorCedulaInvitado)
 
 	// RUTAS DE FACTURAS CON PREFIJO DIFERENTE
-	autorizado.POST("/cita/:id/finalizar", FinalizarCita)
-	autorizado.POST("/cita/:id/factura", GenerarFacturaDesdeCita)
+	autorizado.POST("/cita/:id/finalizar", RequierePermiso(PermisoCitasFinalizar), FinalizarCita)
+	autorizado.POST("/cita/:id/factura", RequierePermiso(PermisoFacturasCrear), GenerarFacturaDesdeCita)
 	autorizado.GET("/cita/:id/factura", ObtenerFacturaPorCita)
-	autorizado.GET("/facturas", ListarFacturas)
+	autorizado.GET("/facturas", RequierePermiso(PermisoFacturasVer), ListarFacturas)
 	autorizado.GET("/facturas/:id", ObtenerFactura)
 	autorizado.GET("/facturas/:id/pdf", DescargarFacturaPDF)
 
+	// Punto de venta: líneas de facturas en borrador
+	autorizado.POST("/facturas/:id/detalles", RequierePermiso(PermisoFacturasCrear), AgregarDetalleFactura)
+	autorizado.PUT("/facturas/:id/detalles/:detalleId", RequierePermiso(PermisoFacturasCrear), ActualizarDetalleFactura)
+	autorizado.DELETE("/facturas/:id/detalles/:detalleId", RequierePermiso(PermisoFacturasCrear), EliminarDetalleFactura)
+	autorizado.PUT("/facturas/:id/cerrar", RequierePermiso(PermisoFacturasCrear), CerrarFacturaHandler)
+	autorizado.POST("/ventas", RequierePermiso(PermisoFacturasCrear), CrearVenta)
+
+	// Promociones y códigos de descuento
+	autorizado.GET("/promociones", RequierePermiso(PermisoPromocionesVer), ListarPromocionesHandler)
+	autorizado.POST("/promociones", RequierePermiso(PermisoPromocionesAdministrar), CrearPromocionHandler)
+	autorizado.PUT("/promociones/:id", RequierePermiso(PermisoPromocionesAdministrar), ActualizarPromocionHandler)
+	autorizado.POST("/facturas/:id/promocion", RequierePermiso(PermisoFacturasCrear), AplicarPromocionFacturaHandler)
+	autorizado.DELETE("/facturas/:id/promocion", RequierePermiso(PermisoFacturasCrear), QuitarPromocionFacturaHandler)
+
+	// Pagos de facturas
+	autorizado.POST("/facturas/:id/pagos", RequierePermiso(PermisoPagosRegistrar), RegistrarPagosFactura)
+	autorizado.GET("/facturas/:id/pagos", ListarPagosFactura)
+
+	// Caja: apertura, retiros y cierre por terminal
+	autorizado.GET("/caja/actual", RequierePermiso(PermisoCajaOperar), SesionCajaActualHandler)
+	autorizado.POST("/caja/abrir", RequierePermiso(PermisoCajaOperar), AbrirCajaHandler)
+	autorizado.POST("/caja/retiros", RequierePermiso(PermisoCajaOperar), RegistrarRetiroHandler)
+	autorizado.POST("/caja/cerrar", RequierePermiso(PermisoCajaOperar), CerrarCajaHandler)
+	autorizado.GET("/caja/sesiones", RequierePermiso(PermisoCajaAuditar), ListarSesionesCajaHandler)
+	autorizado.GET("/caja/sesiones/:id", RequierePermiso(PermisoCajaAuditar), ObtenerSesionCajaHandler)
+	autorizado.GET("/caja/sesiones/:id/pdf", RequierePermiso(PermisoCajaAuditar), DescargarCierreCajaPDF)
+
+	// Anulaciones y notas de crédito
+	autorizado.POST("/facturas/:id/anular", RequierePermiso(PermisoFacturasAnular), AnularFactura)
+	autorizado.POST("/facturas/:id/notas-credito", RequierePermiso(PermisoFacturasAnular), CrearNotaCredito)
+	autorizado.GET("/facturas/:id/notas-credito", ListarNotasCreditoFactura)
+
+	// Series de numeración consecutiva
+	autorizado.GET("/series-documento", RequierePermiso(PermisoFacturasNumeracion), ListarSeriesDocumentoHandler)
+	autorizado.POST("/series-documento", RequierePermiso(PermisoFacturasNumeracion), CrearSerieDocumentoHandler)
+	autorizado.PUT("/series-documento/:id", RequierePermiso(PermisoFacturasNumeracion), ActualizarSerieDocumentoHandler)
+
+	// Comprobantes electrónicos de Hacienda
+	autorizado.POST("/facturas/:id/comprobante", RequierePermiso(PermisoComprobantesGestionar), GenerarComprobanteFacturaHandler)
+	autorizado.POST("/notas-credito/:id/comprobante", RequierePermiso(PermisoComprobantesGestionar), GenerarComprobanteNotaCreditoHandler)
+	autorizado.GET("/comprobantes/:clave", RequierePermiso(PermisoComprobantesGestionar), ObtenerComprobanteHandler)
+	autorizado.GET("/comprobantes/:clave/xml", RequierePermiso(PermisoComprobantesGestionar), DescargarComprobanteXML)
+	autorizado.POST("/comprobantes/:clave/enviar", RequierePermiso(PermisoComprobantesGestionar), EnviarComprobanteHandler)
+	autorizado.POST("/comprobantes/:clave/consultar", RequierePermiso(PermisoComprobantesGestionar), ConsultarComprobanteHandler)
+
 	// Citas protegidas (rutas genéricas)
 	autorizado.POST("/citas", CrearCita)
 	autorizado.GET("/citas/:id", ObtenerCita)
-	autorizado.PUT("/citas/:id", ActualizarCita)
-	autorizado.PUT("/citas/:id/confirmar", ConfirmarCita)
-	autorizado.PUT("/citas/:id/rechazar", RechazarCita)
+	autorizado.GET("/citas/:id/historial", ObtenerHistorialCita)
+	autorizado.PUT("/citas/:id", RequierePermiso(PermisoCitasEditar), ActualizarCita)
+	autorizado.PUT("/citas/:id/confirmar", RequierePermiso(PermisoCitasConfirmar), ConfirmarCita)
+	autorizado.PUT("/citas/:id/rechazar", RequierePermiso(PermisoCitasConfirmar), RechazarCita)
 	autorizado.PUT("/citas/:id/cancelar", CancelarCitaConMotivo)
 
 	// Servicios protegidos
-	autorizado.POST("/servicios", CrearServicio)
-	autorizado.PUT("/servicios/:id", ActualizarServicio)
-	autorizado.DELETE("/servicios/:id", EliminarServicio)
+	autorizado.POST("/servicios", RequierePermiso(PermisoCatalogoAdministrar), CrearServicio)
+	autorizado.PUT("/servicios/:id", RequierePermiso(PermisoCatalogoAdministrar), ActualizarServicio)
+	autorizado.DELETE("/servicios/:id", RequierePermiso(PermisoCatalogoAdministrar), EliminarServicio)
+	autorizado.PUT("/servicios/:id/categoria-impuesto", RequierePermiso(PermisoCatalogoAdministrar), AsignarImpuestoServicio)
+	autorizado.PUT("/servicios/:id/cabys", RequierePermiso(PermisoCatalogoAdministrar), AsignarCABYSServicio)
 
 	// Productos protegidos (solo admin)
-	autorizado.POST("/productos", CrearProducto)
-	autorizado.PUT("/productos/:id", ActualizarProducto)
-	autorizado.DELETE("/productos/:id", EliminarProducto)
+	autorizado.POST("/productos", RequierePermiso(PermisoCatalogoAdministrar), CrearProducto)
+	autorizado.PUT("/productos/:id", RequierePermiso(PermisoCatalogoAdministrar), ActualizarProducto)
+	autorizado.DELETE("/productos/:id", RequierePermiso(PermisoCatalogoAdministrar), EliminarProducto)
+	autorizado.PUT("/productos/:id/categoria-impuesto", RequierePermiso(PermisoCatalogoAdministrar), AsignarImpuestoProducto)
+	autorizado.PUT("/productos/:id/cabys", RequierePermiso(PermisoCatalogoAdministrar), AsignarCABYSProducto)
+
+	// Impuestos: categorías de IVA y tarifas por vigencia
+	autorizado.GET("/impuestos/categorias", RequierePermiso(PermisoImpuestosVer), ListarCategoriasImpuestoHandler)
+	autorizado.POST("/impuestos/categorias", RequierePermiso(PermisoImpuestosAdministrar), CrearCategoriaImpuestoHandler)
+	autorizado.POST("/impuestos/categorias/:id/tasas", RequierePermiso(PermisoImpuestosAdministrar), ProgramarTarifaImpuestoHandler)
+
+	// Horarios de empleados: turnos, excepciones y ausencias
+	autorizado.GET("/horarios/turnos", RequierePermiso(PermisoHorariosVer), ListarTurnos)
+	autorizado.POST("/horarios/turnos", RequierePermiso(PermisoHorariosAdministrar), CrearTurno)
+	autorizado.PUT("/horarios/turnos/:id", RequierePermiso(PermisoHorariosAdministrar), ActualizarTurno)
+	autorizado.DELETE("/horarios/turnos/:id", RequierePermiso(PermisoHorariosAdministrar), EliminarTurno)
+	autorizado.GET("/horarios/excepciones", RequierePermiso(PermisoHorariosVer), ListarExcepcionesHorario)
+	autorizado.POST("/horarios/excepciones", RequierePermiso(PermisoHorariosAdministrar), CrearExcepcionHorario)
+	autorizado.PUT("/horarios/excepciones/:id", RequierePermiso(PermisoHorariosAdministrar), ActualizarExcepcionHorario)
+	autorizado.DELETE("/horarios/excepciones/:id", RequierePermiso(PermisoHorariosAdministrar), EliminarExcepcionHorario)
+	autorizado.GET("/ausencias", RequierePermiso(PermisoHorariosVer), ListarAusencias)
+	autorizado.POST("/ausencias", RequierePermiso(PermisoAusenciasSolicitar), SolicitarAusencia)
+	autorizado.PUT("/ausencias/:id/aprobar", RequierePermiso(PermisoAusenciasRevisar), AprobarAusencia)
+	autorizado.PUT("/ausencias/:id/rechazar", RequierePermiso(PermisoAusenciasRevisar), RechazarAusencia)
+	autorizado.PUT("/ausencias/:id/cancelar", RequierePermiso(PermisoAusenciasSolicitar), CancelarAusencia)
+	autorizado.GET("/empleados/en-turno", RequierePermiso(PermisoHorariosVer), ListarEmpleadosEnTurno)
+	autorizado.GET("/empleados/:id/servicios", RequierePermiso(PermisoEmpleadosVer), ListarServiciosEmpleado)
+	autorizado.PUT("/empleados/:id/servicios", RequierePermiso(PermisoEmpleadosAdministrar), ActualizarServiciosEmpleado)
+
+	// Horario de atención del salón
+	autorizado.PUT("/horario-salon/:dia", RequierePermiso(PermisoSalonAdministrar), ActualizarHorarioSalon)
+	autorizado.GET("/dias-especiales", ListarDiasEspeciales)
+	autorizado.POST("/dias-especiales", RequierePermiso(PermisoSalonAdministrar), CrearDiaEspecial)
+	autorizado.PUT("/dias-especiales/:id", RequierePermiso(PermisoSalonAdministrar), ActualizarDiaEspecial)
+	autorizado.DELETE("/dias-especiales/:id", RequierePermiso(PermisoSalonAdministrar), EliminarDiaEspecial)
 
 	// Reportes, notificaciones y perfil
-	autorizado.POST("/notificaciones/:id", EnviarNotificacion)
-	autorizado.GET("/reporte/citas-por-fechas", ReporteCitasPorFechas)
+	autorizado.POST("/notificaciones/:id", RequierePermiso(PermisoNotificacionesEnviar), EnviarNotificacion)
+	autorizado.GET("/reporte/citas-por-fechas", RequierePermiso(PermisoReportesCitas), ReporteCitasPorFechas)
+	autorizado.GET("/reporte/ingresos", RequierePermiso(PermisoReportesIngresos), ReporteIngresos)
+	autorizado.GET("/reporte/propinas", RequierePermiso(PermisoReportesPropinas), ReportePropinas)
 	autorizado.GET("/mi-perfil", VerMiPerfil)
+	autorizado.PUT("/mi-perfil/estilista-preferido", ActualizarEstilistaPreferido)
+	autorizado.PUT("/mi-perfil/contrasena", CambiarContrasenaHandler)
+	autorizado.POST("/correo/verificacion", ReenviarVerificacionCorreo)
+	autorizado.POST("/mi-perfil/reclamar-citas/codigo", RequierePermiso(PermisoCitasPropias), SolicitarCodigoReclamo)
+	autorizado.POST("/mi-perfil/reclamar-citas", RequierePermiso(PermisoCitasPropias), ReclamarCitasInvitado)
 	autorizado.GET("/mis-citas", MisCitasCliente)
+	autorizado.PUT("/mis-citas/:id/reprogramar", RequierePermiso(PermisoCitasPropias), ReprogramarMiCita)
+	autorizado.GET("/politicas/citas", ObtenerPoliticaCitasHandler)
+	autorizado.PUT("/politicas/citas", RequierePermiso(PermisoSalonAdministrar), ActualizarPoliticaCitas)
 
 	// Admin puede registrar usuarios
-	autorizado.POST("/admin/usuarios", RegistrarUsuarioComoAdmin)
-	autorizado.GET("/usuarios", ListarUsuarios)
+	autorizado.POST("/admin/usuarios", RequierePermiso(PermisoUsuariosAdministrar), RegistrarUsuarioComoAdmin)
+	autorizado.POST("/admin/usuarios/fusionar", RequierePermiso(PermisoUsuariosAdministrar), FusionarUsuarios)
+	autorizado.GET("/usuarios", RequierePermiso(PermisoUsuariosVer), ListarUsuarios)
+
+	// Roles y permisos
+	autorizado.GET("/permisos", RequierePermiso(PermisoRolesAdministrar), ListarPermisosHandler)
+	autorizado.GET("/roles", RequierePermiso(PermisoRolesAdministrar), ListarRolesHandler)
+	autorizado.PUT("/roles/:rol/permisos", RequierePermiso(PermisoRolesAdministrar), ActualizarPermisosRolHandler)
 
 	// Nuevas funcionalidades con triggers
-	autorizado.GET("/alertas/inventario", ObtenerAlertasInventario)
-	autorizado.PUT("/alertas/inventario/:id/resolver", ResolverAlertaInventario)
-	autorizado.GET("/auditoria/usuarios", ObtenerAuditoriaUsuarios)
-	autorizado.GET("/estadisticas/clientes", ObtenerEstadisticasClientes)
-	autorizado.GET("/historial/precios-servicios", ObtenerHistorialPreciosServicios)
+	autorizado.GET("/alertas/inventario", RequierePermiso(PermisoInventarioAlertas), ObtenerAlertasInventario)
+	autorizado.PUT("/alertas/inventario/:id/resolver", RequierePermiso(PermisoInventarioAlertas), ResolverAlertaInventario)
+	autorizado.GET("/auditoria/usuarios", RequierePermiso(PermisoAuditoriaVer), ObtenerAuditoriaUsuarios)
+	autorizado.GET("/estadisticas/clientes", RequierePermiso(PermisoEstadisticasVer), ObtenerEstadisticasClientes)
+	autorizado.GET("/historial/precios-servicios", RequierePermiso(PermisoEstadisticasVer), ObtenerHistorialPreciosServicios)
 
 	return router
 }
@@ -0,0 +1,75 @@
+// Manejador de sesiones: renovación del token de acceso con el token de refresco y
+// cierre de sesión en el dispositivo actual o en todos.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /token/refrescar  {"refresh_token": "..."}
+// Devuelve un token de acceso nuevo y otro token de refresco; el anterior deja de servir.
+func RefrescarToken(c *gin.Context) {
+	var input struct {
+		TokenRefresco string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.TokenRefresco == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indique el refresh_token"})
+		return
+	}
+
+	tokens, err := RefrescarSesion(input.TokenRefresco, c.Request.UserAgent(), c.ClientIP())
+	switch {
+	case errors.Is(err, ErrTokenRefresco), errors.Is(err, ErrTokenRefrescoReusado):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al refrescar token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// POST /logout
+// Revoca el token presentado y los tokens de refresco de este dispositivo.
+func CerrarSesionHandler(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+	jti, _ := c.Get("tokenJTI")
+	sesion, _ := c.Get("tokenSesion")
+	expira, _ := c.Get("tokenExpira")
+
+	id, _ := usuarioID.(int)
+	jtiTexto, _ := jti.(string)
+	sesionTexto, _ := sesion.(string)
+	vence, ok := expira.(time.Time)
+	if !ok {
+		vence = time.Now().Add(duracionTokenAcceso)
+	}
+
+	if err := CerrarSesion(id, jtiTexto, sesionTexto, vence); err != nil {
+		fmt.Println("❌ Error al cerrar sesión:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo cerrar la sesión"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Sesión cerrada"})
+}
+
+// POST /logout/todos
+// Cierra la sesión en todos los dispositivos del usuario, incluido este.
+func CerrarTodasLasSesionesHandler(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+	id, _ := usuarioID.(int)
+
+	if err := CerrarTodasLasSesiones(id); err != nil {
+		fmt.Println("❌ Error al cerrar todas las sesiones:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudieron cerrar las sesiones"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Se cerró la sesión en todos los dispositivos"})
+}
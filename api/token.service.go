@@ -0,0 +1,393 @@
+// Tokens de usuario: tokens de acceso de corta duración firmados con claves rotables
+// (encabezado kid), tokens de refresco rotativos guardados en el servidor y revocación
+// al cerrar sesión, en un dispositivo o en todos.
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"restapi/dto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	duracionTokenAcceso   = 15 * time.Minute
+	duracionTokenRefresco = 30 * 24 * time.Hour
+)
+
+var (
+	ErrTokenInvalido        = errors.New("token inválido")
+	ErrTokenRefresco        = errors.New("token de refresco inválido o vencido")
+	ErrTokenRefrescoReusado = errors.New("el token de refresco ya se había usado; la sesión se cerró por seguridad")
+)
+
+// clavesJWT son las claves para verificar por kid y la activa para firmar.
+type clavesJWT struct {
+	kidActivo string
+	porKid    map[string][]byte
+}
+
+var (
+	clavesJWTUnaVez sync.Once
+	clavesJWTCache  clavesJWT
+	clavesJWTError  error
+)
+
+// CargarClavesJWT lee JWT_CLAVES una sola vez. El formato es "kid:secreto,kid:secreto";
+// se firma con JWT_KID_ACTIVO o, si no está, con la primera. Las demás solo verifican,
+// así una clave nueva se agrega al frente y la anterior se quita cuando vencen sus
+// tokens. Se llama al arrancar: si falta o está mal formada la API no debe levantar,
+// porque una clave al azar invalida los tokens en cada reinicio y en cada réplica. Solo
+// con JWT_CLAVE_TEMPORAL=1 (desarrollo) se acepta una clave temporal.
+func CargarClavesJWT() error {
+	_, err := clavesFirma()
+	return err
+}
+
+func clavesFirma() (clavesJWT, error) {
+	clavesJWTUnaVez.Do(func() {
+		config := os.Getenv("JWT_CLAVES")
+		if strings.TrimSpace(config) == "" && os.Getenv("JWT_CLAVE_TEMPORAL") == "1" {
+			fmt.Println("⚠️ JWT_CLAVE_TEMPORAL=1: se usa una clave temporal; los tokens no sobreviven un reinicio")
+			secreto := make([]byte, 32)
+			if _, err := rand.Read(secreto); err != nil {
+				clavesJWTError = fmt.Errorf("generar clave JWT temporal: %w", err)
+				return
+			}
+			clavesJWTCache = clavesJWT{kidActivo: "temporal", porKid: map[string][]byte{"temporal": secreto}}
+			return
+		}
+		clavesJWTCache, clavesJWTError = leerClavesJWT(config, os.Getenv("JWT_KID_ACTIVO"))
+	})
+	return clavesJWTCache, clavesJWTError
+}
+
+func leerClavesJWT(config, kidActivo string) (clavesJWT, error) {
+	claves := clavesJWT{porKid: map[string][]byte{}}
+	if strings.TrimSpace(config) == "" {
+		return claves, errors.New("JWT_CLAVES no está configurada (en desarrollo se puede usar JWT_CLAVE_TEMPORAL=1)")
+	}
+	for _, par := range strings.Split(config, ",") {
+		kid, secreto, ok := strings.Cut(strings.TrimSpace(par), ":")
+		kid = strings.TrimSpace(kid)
+		if !ok || kid == "" || len(secreto) < 32 {
+			return claves, fmt.Errorf("JWT_CLAVES mal formada cerca de %q: use kid:secreto con secretos de al menos 32 caracteres", kid)
+		}
+		if _, repetido := claves.porKid[kid]; repetido {
+			return claves, fmt.Errorf("JWT_CLAVES repite el kid %q", kid)
+		}
+		claves.porKid[kid] = []byte(secreto)
+		if claves.kidActivo == "" {
+			claves.kidActivo = kid
+		}
+	}
+	if kidActivo != "" {
+		if _, ok := claves.porKid[kidActivo]; !ok {
+			return claves, fmt.Errorf("JWT_KID_ACTIVO %q no está en JWT_CLAVES", kidActivo)
+		}
+		claves.kidActivo = kidActivo
+	}
+	return claves, nil
+}
+
+// emisionToken devuelve el iat del token en milisegundos Unix. Los tokens firmados
+// antes de guardar milisegundos traen segundos enteros y se leen igual.
+func emisionToken(claims jwt.MapClaims) int64 {
+	iat, _ := claims["iat"].(float64)
+	return int64(math.Round(iat * 1000))
+}
+
+// firmarToken firma los claims con la clave activa e indica su kid en el encabezado.
+func firmarToken(claims jwt.MapClaims) (string, error) {
+	claves, err := clavesFirma()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = claves.kidActivo
+	return token.SignedString(claves.porKid[claves.kidActivo])
+}
+
+// leerToken valida firma y vencimiento con la clave del kid del token. Los tokens sin
+// kid (firmados con la clave fija anterior) ya no se aceptan.
+func leerToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrTokenInvalido
+		}
+		claves, err := clavesFirma()
+		if err != nil {
+			return nil, err
+		}
+		kid, _ := token.Header["kid"].(string)
+		secreto, ok := claves.porKid[kid]
+		if !ok {
+			return nil, ErrTokenInvalido
+		}
+		return secreto, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrTokenInvalido
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrTokenInvalido
+	}
+	return claims, nil
+}
+
+// TokensSesion es lo que recibe el cliente al iniciar sesión o refrescar.
+type TokensSesion struct {
+	Token         string `json:"token"`
+	TokenRefresco string `json:"refresh_token"`
+	ExpiraEn      int    `json:"expira_en"` // segundos de vida del token de acceso
+}
+
+// IniciarSesion abre una sesión nueva (un dispositivo) para el usuario.
+func IniciarSesion(usuarioID int, nombre, rol, agente, ip string) (TokensSesion, error) {
+	sesion, err := aleatorioHex(16)
+	if err != nil {
+		return TokensSesion{}, err
+	}
+	refresco, err := guardarTokenRefresco(dto.DB, usuarioID, sesion, agente, ip)
+	if err != nil {
+		return TokensSesion{}, err
+	}
+	return tokensDeSesion(usuarioID, nombre, rol, sesion, refresco)
+}
+
+// RefrescarSesion cambia un token de refresco por uno nuevo y un token de acceso. Cada
+// token de refresco sirve una sola vez: si se presenta uno ya usado, alguien lo copió y
+// se revoca toda la sesión.
+func RefrescarSesion(tokenRefresco, agente, ip string) (TokensSesion, error) {
+	if tokenRefresco == "" {
+		return TokensSesion{}, ErrTokenRefresco
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return TokensSesion{}, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	ahora := time.Now().UTC()
+	var id, usuarioID int
+	var sesion string
+	var vigente bool
+	var usado, revocado sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, usuario_id, sesion, CAST(CASE WHEN expira_en > @ahora THEN 1 ELSE 0 END AS BIT), usado_en, revocado_en
+		FROM tokens_refresco WITH (UPDLOCK, ROWLOCK) WHERE token_hash = @hash`,
+		sql.Named("ahora", ahora),
+		sql.Named("hash", hashToken(tokenRefresco)),
+	).Scan(&id, &usuarioID, &sesion, &vigente, &usado, &revocado)
+	if err == sql.ErrNoRows {
+		return TokensSesion{}, ErrTokenRefresco
+	} else if err != nil {
+		return TokensSesion{}, fmt.Errorf("consultar token de refresco: %w", err)
+	}
+
+	if revocado.Valid {
+		return TokensSesion{}, ErrTokenRefresco
+	}
+	if usado.Valid {
+		if err := revocarSesionRefresco(tx, usuarioID, sesion, ahora); err != nil {
+			return TokensSesion{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return TokensSesion{}, fmt.Errorf("confirmar transacción: %w", err)
+		}
+		return TokensSesion{}, ErrTokenRefrescoReusado
+	}
+	if !vigente {
+		return TokensSesion{}, ErrTokenRefresco
+	}
+
+	// El rol se relee: un cambio de rol aplica desde el siguiente refresco
+	var nombre, rol string
+	err = tx.QueryRow("SELECT nombre, rol FROM usuarios WHERE id = @id AND desactivado_en IS NULL", sql.Named("id", usuarioID)).Scan(&nombre, &rol)
+	if err == sql.ErrNoRows {
+		return TokensSesion{}, ErrTokenRefresco
+	} else if err != nil {
+		return TokensSesion{}, fmt.Errorf("consultar usuario: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE tokens_refresco SET usado_en = @ahora WHERE id = @id", sql.Named("ahora", ahora), sql.Named("id", id)); err != nil {
+		return TokensSesion{}, fmt.Errorf("marcar token de refresco: %w", err)
+	}
+	nuevo, err := guardarTokenRefresco(tx, usuarioID, sesion, agente, ip)
+	if err != nil {
+		return TokensSesion{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return TokensSesion{}, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return tokensDeSesion(usuarioID, nombre, rol, sesion, nuevo)
+}
+
+// CerrarSesion revoca el token de acceso presentado y los tokens de refresco de su
+// sesión; los demás dispositivos siguen conectados.
+func CerrarSesion(usuarioID int, jti, sesion string, expira time.Time) error {
+	ahora := time.Now().UTC()
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// De paso se limpian las revocaciones que ya vencieron solas
+	if _, err := tx.Exec("DELETE FROM tokens_revocados WHERE expira_en < @ahora", sql.Named("ahora", ahora)); err != nil {
+		return fmt.Errorf("limpiar tokens revocados: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO tokens_revocados (jti, usuario_id, expira_en, revocado_en)
+		SELECT @jti, @usuario_id, @expira, @ahora
+		WHERE NOT EXISTS (SELECT 1 FROM tokens_revocados WHERE jti = @jti)`,
+		sql.Named("jti", jti),
+		sql.Named("usuario_id", usuarioID),
+		sql.Named("expira", expira.UTC()),
+		sql.Named("ahora", ahora),
+	)
+	if err != nil {
+		return fmt.Errorf("revocar token de acceso: %w", err)
+	}
+	if sesion != "" {
+		if err := revocarSesionRefresco(tx, usuarioID, sesion, ahora); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// CerrarTodasLasSesiones invalida todos los tokens de acceso emitidos hasta ahora y
+// revoca todos los tokens de refresco del usuario.
+func CerrarTodasLasSesiones(usuarioID int) error {
+	ahora := time.Now().UTC()
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := revocarTodasLasSesiones(tx, usuarioID, ahora); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// revocarTodasLasSesiones hace el trabajo de CerrarTodasLasSesiones dentro de una
+// transacción ajena (p. ej. al restablecer la contraseña).
+func revocarTodasLasSesiones(tx *sql.Tx, usuarioID int, ahora time.Time) error {
+	if _, err := tx.Exec("UPDATE usuarios SET tokens_validos_desde = @desde WHERE id = @id",
+		sql.Named("desde", ahora.UnixMilli()), sql.Named("id", usuarioID)); err != nil {
+		return fmt.Errorf("invalidar tokens de acceso: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE tokens_refresco SET revocado_en = @ahora WHERE usuario_id = @id AND revocado_en IS NULL",
+		sql.Named("ahora", ahora), sql.Named("id", usuarioID)); err != nil {
+		return fmt.Errorf("revocar tokens de refresco: %w", err)
+	}
+	return nil
+}
+
+// tokenRevocado indica si el token de acceso se revocó con logout o quedó antes del
+// corte de "cerrar todas las sesiones". emitido y el corte van en milisegundos Unix:
+// con segundos, el login que sigue a un cambio de contraseña en el mismo segundo
+// recibía un token ya revocado.
+func tokenRevocado(usuarioID int, jti string, emitido int64) (bool, error) {
+	var revocado bool
+	err := dto.DB.QueryRow(`
+		SELECT CASE WHEN EXISTS (SELECT 1 FROM tokens_revocados WHERE jti = @jti)
+		              OR EXISTS (SELECT 1 FROM usuarios WHERE id = @id AND tokens_validos_desde >= @emitido)
+		            THEN CAST(1 AS BIT) ELSE CAST(0 AS BIT) END`,
+		sql.Named("jti", jti), sql.Named("id", usuarioID), sql.Named("emitido", emitido),
+	).Scan(&revocado)
+	if err != nil {
+		return false, fmt.Errorf("consultar revocación de token: %w", err)
+	}
+	return revocado, nil
+}
+
+func tokensDeSesion(usuarioID int, nombre, rol, sesion, refresco string) (TokensSesion, error) {
+	jti, err := aleatorioHex(16)
+	if err != nil {
+		return TokensSesion{}, err
+	}
+	ahora := time.Now()
+	acceso, err := firmarToken(jwt.MapClaims{
+		"id":     usuarioID,
+		"nombre": nombre,
+		"rol":    rol,
+		"sid":    sesion,
+		"jti":    jti,
+		"iat":    float64(ahora.UnixMilli()) / 1000, // con milisegundos, ver tokenRevocado
+		"exp":    ahora.Add(duracionTokenAcceso).Unix(),
+	})
+	if err != nil {
+		return TokensSesion{}, fmt.Errorf("firmar token: %w", err)
+	}
+	return TokensSesion{Token: acceso, TokenRefresco: refresco, ExpiraEn: int(duracionTokenAcceso.Seconds())}, nil
+}
+
+// guardarTokenRefresco genera un token de refresco y guarda solo su hash.
+func guardarTokenRefresco(e ejecutorSQL, usuarioID int, sesion, agente, ip string) (string, error) {
+	token, err := aleatorioHex(32)
+	if err != nil {
+		return "", err
+	}
+	ahora := time.Now().UTC()
+	_, err = e.Exec(`
+		INSERT INTO tokens_refresco (usuario_id, sesion, token_hash, expira_en, creado_en, agente, ip)
+		VALUES (@usuario_id, @sesion, @hash, @expira, @ahora, @agente, @ip)`,
+		sql.Named("usuario_id", usuarioID),
+		sql.Named("sesion", sesion),
+		sql.Named("hash", hashToken(token)),
+		sql.Named("expira", ahora.Add(duracionTokenRefresco)),
+		sql.Named("ahora", ahora),
+		sql.Named("agente", textoONulo(recortar(agente, 255))),
+		sql.Named("ip", textoONulo(recortar(ip, 45))),
+	)
+	if err != nil {
+		return "", fmt.Errorf("guardar token de refresco: %w", err)
+	}
+	return token, nil
+}
+
+func revocarSesionRefresco(tx *sql.Tx, usuarioID int, sesion string, ahora time.Time) error {
+	_, err := tx.Exec("UPDATE tokens_refresco SET revocado_en = @ahora WHERE usuario_id = @usuario_id AND sesion = @sesion AND revocado_en IS NULL",
+		sql.Named("ahora", ahora), sql.Named("usuario_id", usuarioID), sql.Named("sesion", sesion))
+	if err != nil {
+		return fmt.Errorf("revocar sesión: %w", err)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
+
+func aleatorioHex(bytes int) (string, error) {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generar valor aleatorio: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
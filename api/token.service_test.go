@@ -0,0 +1,79 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// clavesDePrueba fija las claves JWT antes de que clavesFirma lea el entorno.
+func clavesDePrueba() {
+	clavesJWTUnaVez.Do(func() {
+		clavesJWTCache = clavesJWT{kidActivo: "prueba", porKid: map[string][]byte{"prueba": []byte("0123456789abcdef0123456789abcdef")}}
+	})
+}
+
+// Un login justo después de "cerrar todas las sesiones" (mismo segundo) no puede
+// quedar del lado revocado del corte.
+func TestEmisionTokenDespuesDelCorte(t *testing.T) {
+	clavesDePrueba()
+	corte := time.Now().UTC().UnixMilli()
+	time.Sleep(2 * time.Millisecond)
+
+	tokens, err := tokensDeSesion(5, "Ana", "cliente", "sesion", "refresco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := leerToken(tokens.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emitido := emisionToken(claims); emitido <= corte {
+		t.Fatalf("emitido %d no es posterior al corte %d", emitido, corte)
+	}
+}
+
+func TestEmisionTokenEnSegundos(t *testing.T) {
+	if got := emisionToken(jwt.MapClaims{"iat": float64(1700000000)}); got != 1700000000000 {
+		t.Fatalf("emisionToken = %d", got)
+	}
+	if got := emisionToken(jwt.MapClaims{"iat": 1700000000.123}); got != 1700000000123 {
+		t.Fatalf("emisionToken = %d", got)
+	}
+}
+
+func TestLeerClavesJWT(t *testing.T) {
+	secreto := "0123456789abcdef0123456789abcdef"
+	casos := []struct {
+		nombre, config, activo string
+		kidEsperado            string
+		falla                  bool
+	}{
+		{"vacía", "", "", "", true},
+		{"una clave", "k1:" + secreto, "", "k1", false},
+		{"activa la primera", "k2:" + secreto + ",k1:" + secreto, "", "k2", false},
+		{"activa indicada", "k2:" + secreto + ",k1:" + secreto, "k1", "k1", false},
+		{"activa que no existe", "k1:" + secreto, "k9", "", true},
+		{"sin separador", "k1" + secreto, "", "", true},
+		{"secreto corto", "k1:corto", "", "", true},
+		{"kid repetido", "k1:" + secreto + ",k1:" + secreto, "", "", true},
+	}
+	for _, tc := range casos {
+		t.Run(tc.nombre, func(t *testing.T) {
+			claves, err := leerClavesJWT(tc.config, tc.activo)
+			if tc.falla {
+				if err == nil {
+					t.Fatal("se esperaba error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claves.kidActivo != tc.kidEsperado {
+				t.Fatalf("kid activo %q, se esperaba %q", claves.kidActivo, tc.kidEsperado)
+			}
+		})
+	}
+}
@@ -7,15 +7,11 @@ import (
 	"fmt"
 	"net/http"
 	"restapi/dto"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var secretKey = []byte("clave_secreta_super_segura")
-
 // Registro de usuarios (cliente por defecto)
 func RegistrarUsuario(c *gin.Context) {
 	var usuario struct {
@@ -31,6 +27,10 @@ func RegistrarUsuario(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "detalle": err.Error()})
 		return
 	}
+	if err := validarContrasena(usuario.Contrasena); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(usuario.Contrasena), bcrypt.DefaultCost)
 	if err != nil {
@@ -39,15 +39,17 @@ func RegistrarUsuario(c *gin.Context) {
 		return
 	}
 
-	_, err = dto.DB.Exec(
-		"INSERT INTO usuarios(nombre, correo, cedula, telefono, contrasena, rol) VALUES(@nombre, @correo, @cedula, @telefono, @contrasena, @rol)",
+	// usuarios tiene trigger de auditoría: el id sale de SCOPE_IDENTITY, no de OUTPUT
+	var usuarioID int
+	err = dto.DB.QueryRow(
+		"INSERT INTO usuarios(nombre, correo, cedula, telefono, contrasena, rol) VALUES(@nombre, @correo, @cedula, @telefono, @contrasena, @rol); SELECT CAST(SCOPE_IDENTITY() AS INT)",
 		sql.Named("nombre", usuario.Nombre),
 		sql.Named("correo", usuario.Correo),
 		sql.Named("cedula", usuario.Cedula),
 		sql.Named("telefono", usuario.Telefono),
 		sql.Named("contrasena", string(hashedPassword)),
 		sql.Named("rol", "cliente"),
-	)
+	).Scan(&usuarioID)
 
 	if err != nil {
 		fmt.Println("Error al ejecutar INSERT usuarios:", err)
@@ -55,7 +57,18 @@ func RegistrarUsuario(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"mensaje": "Usuario registrado correctamente"})
+	// Avisar si hay citas hechas como invitado con esta cédula que puede reclamar
+	porReclamar, err := CitasPorReclamar(usuario.Cedula)
+	if err != nil {
+		fmt.Println("Error al contar citas de invitado:", err)
+	}
+
+	// Si el correo no sale, la cuenta queda creada igual; se puede reenviar desde el perfil
+	if err := EnviarVerificacionCorreo(usuarioID); err != nil {
+		fmt.Println("❌ Error al enviar verificación de correo:", err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"mensaje": "Usuario registrado correctamente", "citas_por_reclamar": porReclamar, "correo_verificado": false})
 }
 
 // Login de usuario (todos los roles)
@@ -71,7 +84,7 @@ func LoginUsuario(c *gin.Context) {
 	}
 
 	var usuario dto.Usuario
-	err := dto.DB.QueryRow("SELECT id, nombre, contrasena, rol FROM usuarios WHERE correo=@correo", sql.Named("correo", input.Correo)).
+	err := dto.DB.QueryRow("SELECT id, nombre, contrasena, rol FROM usuarios WHERE correo=@correo AND desactivado_en IS NULL", sql.Named("correo", input.Correo)).
 		Scan(&usuario.ID, &usuario.Nombre, &usuario.Contrasena, &usuario.Rol)
 
 	if err != nil {
@@ -86,21 +99,18 @@ func LoginUsuario(c *gin.Context) {
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":     usuario.ID,
-		"nombre": usuario.Nombre,
-		"rol":    usuario.Rol,
-		"exp":    time.Now().Add(99999 * time.Minute).Unix(), //Para modificar el tiempo (para efectos de prueba se pondra mucho)
-	})
-
-	tokenString, err := token.SignedString(secretKey)
+	// Token de acceso corto más token de refresco para renovarlo (POST /token/refrescar)
+	tokens, err := IniciarSesion(int(usuario.ID), usuario.Nombre, usuario.Rol, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
+		fmt.Println("❌ Error al iniciar sesión:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
+		"token":         tokens.Token,
+		"refresh_token": tokens.TokenRefresco,
+		"expira_en":     tokens.ExpiraEn,
 		"usuario": gin.H{
 			"id":     usuario.ID,
 			"nombre": usuario.Nombre,
@@ -112,12 +122,6 @@ func LoginUsuario(c *gin.Context) {
 
 // Registro manual de usuarios (clientes o empleados) por parte de un administrador
 func RegistrarUsuarioComoAdmin(c *gin.Context) {
-	rol, existe := c.Get("rol")
-	if !existe || rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores pueden registrar usuarios manualmente"})
-		return
-	}
-
 	var input struct {
 		Nombre     string `json:"nombre"`
 		Correo     string `json:"correo"`
@@ -136,6 +140,10 @@ func RegistrarUsuarioComoAdmin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Rol inválido"})
 		return
 	}
+	if err := validarContrasena(input.Contrasena); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Contrasena), bcrypt.DefaultCost)
 	if err != nil {
@@ -172,10 +180,16 @@ func VerMiPerfil(c *gin.Context) {
 		Cedula   string `json:"cedula"`
 		Telefono string `json:"telefono"`
 		Rol      string `json:"rol"`
+
+		EmpleadoPreferidoID *int32 `json:"empleado_preferido_id"`
+		CorreoVerificado    bool   `json:"correo_verificado"`
 	}
 
-	err := dto.DB.QueryRow("SELECT id, nombre, correo, cedula, telefono, rol FROM usuarios WHERE id = @id", sql.Named("id", usuarioID)).
-		Scan(&usuario.ID, &usuario.Nombre, &usuario.Correo, &usuario.Cedula, &usuario.Telefono, &usuario.Rol)
+	err := dto.DB.QueryRow(`
+		SELECT id, nombre, correo, cedula, telefono, rol, empleado_preferido_id,
+		       CAST(CASE WHEN correo_verificado_en IS NULL THEN 0 ELSE 1 END AS BIT)
+		FROM usuarios WHERE id = @id`, sql.Named("id", usuarioID)).
+		Scan(&usuario.ID, &usuario.Nombre, &usuario.Correo, &usuario.Cedula, &usuario.Telefono, &usuario.Rol, &usuario.EmpleadoPreferidoID, &usuario.CorreoVerificado)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo obtener el perfil"})
@@ -185,18 +199,39 @@ func VerMiPerfil(c *gin.Context) {
 	c.JSON(http.StatusOK, usuario)
 }
 
-// ListarUsuarios - Obtener lista de usuarios/clientes usando stored procedure
-func ListarUsuarios(c *gin.Context) {
-	fmt.Println("=== INICIO ListarUsuarios ===")
+// PUT /mi-perfil/estilista-preferido  {"empleado_id": 3} o {"empleado_id": null} para quitarlo
+func ActualizarEstilistaPreferido(c *gin.Context) {
+	usuarioID, _ := c.Get("usuarioID")
+
+	var input struct {
+		EmpleadoID *int32 `json:"empleado_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if input.EmpleadoID != nil && !esEmpleado(*input.EmpleadoID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El empleado no existe"})
+		return
+	}
 
-	// Verificar permisos (solo admin y empleados pueden ver lista completa)
-	rol, _ := c.Get("rol")
-	if rol != "admin" && rol != "empleado" {
-		fmt.Printf("Acceso denegado - Rol: %v", rol)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores o empleados pueden listar usuarios"})
+	_, err := dto.DB.Exec("UPDATE usuarios SET empleado_preferido_id = @empleado_id WHERE id = @id",
+		sql.Named("empleado_id", input.EmpleadoID),
+		sql.Named("id", usuarioID),
+	)
+	if err != nil {
+		fmt.Println("❌ Error al guardar estilista preferido:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo actualizar el estilista preferido"})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Estilista preferido actualizado correctamente"})
+}
+
+// ListarUsuarios - Obtener lista de usuarios/clientes usando stored procedure
+func ListarUsuarios(c *gin.Context) {
+	fmt.Println("=== INICIO ListarUsuarios ===")
+
 	// Ejecutar stored procedure ListarUsuarios
 	query := "EXEC ListarUsuarios"
 	fmt.Printf("Ejecutando query: %s", query)
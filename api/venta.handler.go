@@ -0,0 +1,36 @@
+// Manejador de ventas de mostrador (sin cita).
+
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /ventas
+//
+//	{"cedula": "1-1111-1111", "nombre": "Ana", "lineas": [{"producto_id": 4, "cantidad": 1}], "cerrar": true}
+func CrearVenta(c *gin.Context) {
+	var input VentaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	facturaID, err := CrearVentaMostrador(input, actorDeContexto(c).ID)
+	switch {
+	case errors.Is(err, ErrVentaSinLineas):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La venta debe tener al menos una línea"})
+		return
+	case errors.Is(err, ErrClienteNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "El cliente no existe"})
+		return
+	case err != nil:
+		responderErrorLineaFactura(c, err)
+		return
+	}
+
+	responderFacturaActualizada(c, http.StatusCreated, facturaID, gin.H{"mensaje": "Venta registrada", "factura_id": facturaID})
+}
@@ -0,0 +1,117 @@
+// Ventas de mostrador: facturas sin cita para clientes registrados, invitados
+// identificados por cédula o compradores anónimos.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"strings"
+)
+
+// Tipos de factura
+const (
+	TipoFacturaCita      = "cita"
+	TipoFacturaMostrador = "mostrador"
+)
+
+var ErrVentaSinLineas = errors.New("la venta debe tener al menos una línea")
+
+// VentaInput es el cuerpo de POST /ventas. El comprador se identifica con cliente_id
+// (cuenta registrada), con cédula y nombre (invitado) o con nada (consumidor final).
+type VentaInput struct {
+	ClienteID     *int32              `json:"cliente_id"`
+	Cedula        string              `json:"cedula"`
+	Nombre        string              `json:"nombre"`
+	Telefono      string              `json:"telefono"`
+	Observaciones string              `json:"observaciones"`
+	Lineas        []LineaFacturaInput `json:"lineas"`
+	Promocion     string              `json:"codigo_promocion"` // opcional
+	Cerrar        bool                `json:"cerrar"`
+}
+
+// CrearVentaMostrador crea la factura de mostrador con todas sus líneas en una sola
+// transacción; si alguna línea falla (por ejemplo, sin stock) no se crea nada.
+func CrearVentaMostrador(in VentaInput, creadoPor sql.NullInt32) (int, error) {
+	if len(in.Lineas) == 0 {
+		return 0, ErrVentaSinLineas
+	}
+	in.Cedula = strings.TrimSpace(in.Cedula)
+	in.Nombre = strings.TrimSpace(in.Nombre)
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var clienteID sql.NullInt32
+	if in.ClienteID != nil {
+		var rol string
+		err := tx.QueryRow("SELECT rol FROM usuarios WHERE id = @id", sql.Named("id", *in.ClienteID)).Scan(&rol)
+		if err == sql.ErrNoRows {
+			return 0, ErrClienteNoExiste
+		} else if err != nil {
+			return 0, fmt.Errorf("consultar cliente: %w", err)
+		}
+		// Es cuenta de cliente si su rol tiene citas propias
+		esCliente, err := RolTienePermiso(rol, PermisoCitasPropias)
+		if err != nil {
+			return 0, err
+		}
+		if !esCliente {
+			return 0, ErrClienteNoExiste
+		}
+		clienteID = sql.NullInt32{Int32: *in.ClienteID, Valid: true}
+		// Los datos salen de la cuenta; no se duplican en la factura
+		in.Cedula, in.Nombre, in.Telefono = "", "", ""
+	}
+
+	var facturaID int
+	err = tx.QueryRow(`
+		INSERT INTO factura (tipo, cliente_id, cedula_cliente, nombre_cliente, telefono_cliente, observaciones, creado_por)
+		VALUES (@tipo, @cliente_id, @cedula, @nombre, @telefono, @observaciones, @creado_por);
+		SELECT CAST(SCOPE_IDENTITY() AS INT)`,
+		sql.Named("tipo", TipoFacturaMostrador),
+		sql.Named("cliente_id", clienteID),
+		sql.Named("cedula", textoONulo(in.Cedula)),
+		sql.Named("nombre", textoONulo(in.Nombre)),
+		sql.Named("telefono", textoONulo(in.Telefono)),
+		sql.Named("observaciones", textoONulo(in.Observaciones)),
+		sql.Named("creado_por", creadoPor),
+	).Scan(&facturaID)
+	if err != nil {
+		return 0, fmt.Errorf("crear factura de mostrador: %w", err)
+	}
+
+	for _, linea := range in.Lineas {
+		if _, err := agregarLineaTx(tx, facturaID, linea); err != nil {
+			return 0, err
+		}
+	}
+	if strings.TrimSpace(in.Promocion) != "" {
+		if err := aplicarPromocionTx(tx, facturaID, in.Promocion); err != nil {
+			return 0, err
+		}
+	}
+	if err := recalcularTotalesFactura(tx, facturaID); err != nil {
+		return 0, err
+	}
+	if in.Cerrar {
+		if err := cerrarFacturaTx(tx, facturaID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return facturaID, nil
+}
+
+func textoONulo(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
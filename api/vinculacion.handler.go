@@ -0,0 +1,117 @@
+// Manejador para reclamar citas hechas como invitado y fusionar clientes duplicados.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"restapi/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /mi-perfil/reclamar-citas/codigo
+// Envía un código al teléfono usado en las reservas de invitado con la cédula de la cuenta.
+func SolicitarCodigoReclamo(c *gin.Context) {
+	cedula, ok := cedulaDeCliente(c)
+	if !ok {
+		return
+	}
+
+	err := EnviarCodigoInvitado(cedula)
+	switch {
+	case errors.Is(err, ErrCedulaSinTelefono):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No hay citas de invitado registradas con su cédula"})
+		return
+	case errors.Is(err, ErrCodigoMuyPronto):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Espere un momento antes de pedir otro código"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al enviar código de reclamo:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo enviar el código"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Enviamos un código al teléfono usado en sus citas como invitado"})
+}
+
+// POST /mi-perfil/reclamar-citas  {"codigo": "123456"}
+func ReclamarCitasInvitado(c *gin.Context) {
+	cedula, ok := cedulaDeCliente(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Codigo string `json:"codigo"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Codigo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El código es obligatorio"})
+		return
+	}
+
+	if err := consumirCodigoInvitado(cedula, input.Codigo); errors.Is(err, ErrCodigoInvalido) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Código inválido o vencido"})
+		return
+	} else if err != nil {
+		fmt.Println("❌ Error al verificar código de reclamo:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo verificar el código"})
+		return
+	}
+
+	actor := actorDeContexto(c)
+	vinculadas, err := VincularCitasInvitado(actor.ID.Int32, cedula)
+	if err != nil {
+		fmt.Println("❌ Error al vincular citas de invitado:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudieron vincular las citas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Citas vinculadas a su cuenta", "citas_vinculadas": vinculadas})
+}
+
+// POST /admin/usuarios/fusionar  {"origen_id": 7, "destino_id": 3}
+// La cuenta de origen se desactiva y todo su historial pasa a la de destino.
+func FusionarUsuarios(c *gin.Context) {
+	var input struct {
+		OrigenID  int32 `json:"origen_id"`
+		DestinoID int32 `json:"destino_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.OrigenID == 0 || input.DestinoID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "origen_id y destino_id son obligatorios"})
+		return
+	}
+
+	resultado, err := FusionarClientes(input.OrigenID, input.DestinoID, actorDeContexto(c).ID.Int32)
+	switch {
+	case errors.Is(err, ErrClienteNoExiste):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cliente no encontrado"})
+		return
+	case errors.Is(err, ErrFusionMismoCliente):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se puede fusionar un cliente consigo mismo"})
+		return
+	case errors.Is(err, ErrFusionSoloClientes):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solo se pueden fusionar cuentas de clientes"})
+		return
+	case err != nil:
+		fmt.Println("❌ Error al fusionar clientes:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudieron fusionar los clientes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mensaje": "Clientes fusionados correctamente", "resultado": resultado})
+}
+
+// cedulaDeCliente devuelve la cédula de la cuenta autenticada; solo aplica a clientes.
+func cedulaDeCliente(c *gin.Context) (string, bool) {
+	usuarioID, _ := c.Get("usuarioID")
+	var cedula string
+	err := dto.DB.QueryRow("SELECT cedula FROM usuarios WHERE id = @id", sql.Named("id", usuarioID)).Scan(&cedula)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo obtener el perfil"})
+		return "", false
+	}
+	return cedula, true
+}
@@ -0,0 +1,193 @@
+// Vinculación de citas de invitado a cuentas registradas y fusión de clientes duplicados.
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"restapi/dto"
+	"time"
+)
+
+var (
+	ErrClienteNoExiste    = errors.New("el cliente no existe")
+	ErrFusionMismoCliente = errors.New("no se puede fusionar un cliente consigo mismo")
+	ErrFusionSoloClientes = errors.New("solo se pueden fusionar cuentas de clientes")
+)
+
+// CitasPorReclamar cuenta las citas de invitado hechas con la cédula indicada.
+func CitasPorReclamar(cedula string) (int, error) {
+	var total int
+	err := dto.DB.QueryRow("SELECT COUNT(*) FROM citas WHERE usuario_id IS NULL AND cedula_invitado = @cedula",
+		sql.Named("cedula", cedula)).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("contar citas de invitado: %w", err)
+	}
+	return total, nil
+}
+
+// VincularCitasInvitado pasa a la cuenta las citas de invitado de su cédula. Las
+// facturas de cita cuelgan de la cita y se mueven con ella; las ventas de mostrador
+// hechas con la cédula se asignan a la cuenta. Devuelve cuántas citas se vincularon.
+func VincularCitasInvitado(usuarioID int32, cedula string) (int64, error) {
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE citas SET usuario_id = @usuario_id, actualizado_en = GETDATE()
+		WHERE usuario_id IS NULL AND cedula_invitado = @cedula`,
+		sql.Named("usuario_id", usuarioID),
+		sql.Named("cedula", cedula),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("vincular citas de invitado: %w", err)
+	}
+	vinculadas, _ := res.RowsAffected()
+
+	_, err = tx.Exec(`
+		UPDATE factura SET cliente_id = @usuario_id, cedula_cliente = NULL, nombre_cliente = NULL, telefono_cliente = NULL
+		WHERE idCita IS NULL AND cliente_id IS NULL AND cedula_cliente = @cedula`,
+		sql.Named("usuario_id", usuarioID),
+		sql.Named("cedula", cedula),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("vincular ventas de mostrador: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return vinculadas, nil
+}
+
+// ResultadoFusion resume lo que se movió de la cuenta duplicada a la que se conserva.
+type ResultadoFusion struct {
+	OrigenID      int32 `json:"origen_id"`
+	DestinoID     int32 `json:"destino_id"`
+	CitasMovidas  int64 `json:"citas_movidas"`
+	CitasInvitado int64 `json:"citas_invitado_vinculadas"`
+}
+
+// FusionarClientes mueve citas e historial de origen a destino, vincula las citas de
+// invitado hechas con la cédula de origen, deja registro en fusiones_clientes y
+// desactiva la cuenta de origen. No se borra porque tokens_cuenta, tokens_refresco y
+// usos_promocion la referencian; sus sesiones y enlaces pendientes quedan anulados.
+func FusionarClientes(origenID, destinoID, adminID int32) (*ResultadoFusion, error) {
+	if origenID == destinoID {
+		return nil, ErrFusionMismoCliente
+	}
+
+	tx, err := dto.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var origenNombre, origenCorreo, origenCedula, origenRol, destinoRol string
+	var origenPreferido sql.NullInt32
+	err = tx.QueryRow("SELECT nombre, correo, cedula, rol, empleado_preferido_id FROM usuarios WITH (UPDLOCK) WHERE id = @id AND desactivado_en IS NULL",
+		sql.Named("id", origenID)).Scan(&origenNombre, &origenCorreo, &origenCedula, &origenRol, &origenPreferido)
+	if err == sql.ErrNoRows {
+		return nil, ErrClienteNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("consultar cliente de origen: %w", err)
+	}
+	err = tx.QueryRow("SELECT rol FROM usuarios WITH (UPDLOCK) WHERE id = @id AND desactivado_en IS NULL", sql.Named("id", destinoID)).Scan(&destinoRol)
+	if err == sql.ErrNoRows {
+		return nil, ErrClienteNoExiste
+	} else if err != nil {
+		return nil, fmt.Errorf("consultar cliente de destino: %w", err)
+	}
+	for _, rol := range []string{origenRol, destinoRol} {
+		esCliente, err := RolTienePermiso(rol, PermisoCitasPropias)
+		if err != nil {
+			return nil, err
+		}
+		if !esCliente {
+			return nil, ErrFusionSoloClientes
+		}
+	}
+
+	resultado := &ResultadoFusion{OrigenID: origenID, DestinoID: destinoID}
+
+	res, err := tx.Exec("UPDATE citas SET usuario_id = @destino, actualizado_en = GETDATE() WHERE usuario_id = @origen",
+		sql.Named("destino", destinoID), sql.Named("origen", origenID))
+	if err != nil {
+		return nil, fmt.Errorf("mover citas: %w", err)
+	}
+	resultado.CitasMovidas, _ = res.RowsAffected()
+
+	res, err = tx.Exec(`
+		UPDATE citas SET usuario_id = @destino, actualizado_en = GETDATE()
+		WHERE usuario_id IS NULL AND cedula_invitado = @cedula`,
+		sql.Named("destino", destinoID), sql.Named("cedula", origenCedula))
+	if err != nil {
+		return nil, fmt.Errorf("vincular citas de invitado: %w", err)
+	}
+	resultado.CitasInvitado, _ = res.RowsAffected()
+
+	// Referencias que deben pasar a la cuenta que se conserva
+	_, err = tx.Exec(`
+		UPDATE citas_historial SET actor_id = @destino WHERE actor_id = @origen;
+		UPDATE factura SET cliente_id = @destino WHERE cliente_id = @origen;
+		UPDATE usos_promocion SET usuario_id = @destino WHERE usuario_id = @origen;
+		UPDATE factura SET cliente_id = @destino, cedula_cliente = NULL, nombre_cliente = NULL, telefono_cliente = NULL
+		WHERE idCita IS NULL AND cliente_id IS NULL AND cedula_cliente = @cedula;
+		UPDATE usuarios SET empleado_preferido_id = COALESCE(empleado_preferido_id, @preferido) WHERE id = @destino;
+		DELETE FROM estadisticas_clientes WHERE cliente_id = @origen;`,
+		sql.Named("destino", destinoID),
+		sql.Named("origen", origenID),
+		sql.Named("preferido", origenPreferido),
+		sql.Named("cedula", origenCedula),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reasignar referencias: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO fusiones_clientes (origen_id, origen_nombre, origen_correo, origen_cedula, destino_id,
+		                               citas_movidas, citas_invitado, realizado_por)
+		VALUES (@origen, @nombre, @correo, @cedula, @destino, @movidas, @invitado, @admin)`,
+		sql.Named("origen", origenID),
+		sql.Named("nombre", origenNombre),
+		sql.Named("correo", origenCorreo),
+		sql.Named("cedula", origenCedula),
+		sql.Named("destino", destinoID),
+		sql.Named("movidas", resultado.CitasMovidas),
+		sql.Named("invitado", resultado.CitasInvitado),
+		sql.Named("admin", adminID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registrar fusión: %w", err)
+	}
+
+	ahora := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE tokens_cuenta SET usado_en = @ahora WHERE usuario_id = @id AND usado_en IS NULL",
+		sql.Named("ahora", ahora), sql.Named("id", origenID)); err != nil {
+		return nil, fmt.Errorf("anular enlaces pendientes: %w", err)
+	}
+	if err := revocarTodasLasSesiones(tx, int(origenID), ahora); err != nil {
+		return nil, err
+	}
+	// correo y cedula son únicos: se reemplazan por marcas para que la persona pueda
+	// volver a registrarse; los datos originales quedan en fusiones_clientes
+	_, err = tx.Exec(`
+		UPDATE usuarios
+		SET desactivado_en = @ahora,
+		    correo = CONCAT('fusionado-', id, '@desactivado.invalid'),
+		    cedula = CONCAT('FUS-', id)
+		WHERE id = @id`,
+		sql.Named("ahora", ahora), sql.Named("id", origenID))
+	if err != nil {
+		return nil, fmt.Errorf("desactivar cliente duplicado: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("confirmar transacción: %w", err)
+	}
+	return resultado, nil
+}
@@ -0,0 +1,24 @@
+-- Consultas del motor de disponibilidad (api/disponibilidad.service.go)
+
+-- name: EmpleadosActivos :many
+SELECT id, nombre FROM usuarios WHERE rol = 'empleado' ORDER BY nombre;
+
+-- name: OcupacionesDelDia :many
+-- Citas que bloquean agenda en el día consultado
+SELECT c.empleado_id, c.fecha_hora, s.duracion_minutos + s.buffer_minutos AS bloqueo_minutos
+FROM citas c
+JOIN servicios s ON s.id = c.servicio_id
+WHERE c.fecha_hora >= @desde AND c.fecha_hora < @hasta
+  AND c.estado IN ('pendiente', 'confirmada')
+  AND c.id <> @excluir;
+
+-- name: TraslapesEmpleado :one
+-- Citas activas del empleado que se cruzan con [@inicio, @fin)
+SELECT COUNT(*)
+FROM citas c
+JOIN servicios s ON s.id = c.servicio_id
+WHERE c.empleado_id = @empleado_id
+  AND c.id <> @excluir
+  AND c.estado IN ('pendiente', 'confirmada')
+  AND c.fecha_hora < @fin
+  AND DATEADD(MINUTE, s.duracion_minutos + s.buffer_minutos, c.fecha_hora) > @inicio;
@@ -0,0 +1,12 @@
+-- Índice para las consultas del motor de disponibilidad
+-- (citas activas por empleado en un rango de fechas)
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'IX_citas_empleado_fecha_hora')
+BEGIN
+    CREATE INDEX IX_citas_empleado_fecha_hora ON citas(empleado_id, fecha_hora) INCLUDE (estado, servicio_id);
+    PRINT 'Índice IX_citas_empleado_fecha_hora creado';
+END
+ELSE
+BEGIN
+    PRINT 'El índice IX_citas_empleado_fecha_hora ya existe';
+END
@@ -0,0 +1,143 @@
+-- Duración y tiempo de limpieza (buffer) por servicio
+-- Usados por el motor de disponibilidad y la detección de traslapes de citas
+
+IF NOT EXISTS (SELECT * FROM sys.columns WHERE object_id = OBJECT_ID('servicios') AND name = 'duracion_minutos')
+BEGIN
+    ALTER TABLE servicios ADD
+        duracion_minutos INT NOT NULL CONSTRAINT DF_servicios_duracion DEFAULT 60,
+        buffer_minutos INT NOT NULL CONSTRAINT DF_servicios_buffer DEFAULT 0;
+
+    PRINT 'Columnas duracion_minutos y buffer_minutos agregadas a servicios';
+END
+ELSE
+BEGIN
+    PRINT 'Las columnas de duración ya existen';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.check_constraints WHERE name = 'CHK_servicios_tiempos')
+    ALTER TABLE servicios ADD CONSTRAINT CHK_servicios_tiempos CHECK (duracion_minutos > 0 AND buffer_minutos >= 0);
+GO
+
+-- Stored procedures de servicios con columnas explícitas
+DROP PROCEDURE IF EXISTS CrearServicio;
+GO
+CREATE PROCEDURE CrearServicio
+    @nombre NVARCHAR(100),
+    @descripcion NVARCHAR(255),
+    @precio DECIMAL(10,2),
+    @duracion_minutos INT = 60,
+    @buffer_minutos INT = 0
+AS
+BEGIN
+    INSERT INTO servicios (nombre, descripcion, precio, duracion_minutos, buffer_minutos)
+    VALUES (@nombre, @descripcion, @precio, @duracion_minutos, @buffer_minutos);
+END;
+GO
+
+DROP PROCEDURE IF EXISTS ActualizarServicio;
+GO
+CREATE PROCEDURE ActualizarServicio
+    @id INT,
+    @nombre NVARCHAR(100),
+    @descripcion NVARCHAR(255),
+    @precio DECIMAL(10,2),
+    @duracion_minutos INT = 60,
+    @buffer_minutos INT = 0
+AS
+BEGIN
+    UPDATE servicios
+    SET nombre = @nombre,
+        descripcion = @descripcion,
+        precio = @precio,
+        duracion_minutos = @duracion_minutos,
+        buffer_minutos = @buffer_minutos,
+        actualizado_en = GETDATE()
+    WHERE id = @id;
+END;
+GO
+
+DROP PROCEDURE IF EXISTS ObtenerServicioPorId;
+GO
+CREATE PROCEDURE ObtenerServicioPorId
+    @id INT
+AS
+BEGIN
+    SELECT id, nombre, descripcion, precio, duracion_minutos, buffer_minutos
+    FROM servicios
+    WHERE id = @id;
+END;
+GO
+
+DROP PROCEDURE IF EXISTS ListarServicios;
+GO
+CREATE PROCEDURE ListarServicios
+AS
+BEGIN
+    SELECT id, nombre, descripcion, precio, duracion_minutos, buffer_minutos, creado_en, actualizado_en
+    FROM servicios
+    ORDER BY nombre;
+END;
+GO
+
+-- Trigger de validación: conflicto por traslape de intervalos, no solo por hora exacta
+DROP TRIGGER IF EXISTS tr_validacion_citas;
+GO
+CREATE TRIGGER tr_validacion_citas
+ON citas
+AFTER INSERT, UPDATE
+AS
+BEGIN
+    SET NOCOUNT ON;
+
+    -- Validar que el intervalo (duración + limpieza) no se cruce con otra cita activa del empleado
+    IF EXISTS (
+        SELECT 1
+        FROM inserted i
+        INNER JOIN servicios si ON si.id = i.servicio_id
+        INNER JOIN citas c ON c.empleado_id = i.empleado_id
+                           AND c.id != i.id
+                           AND c.estado IN ('pendiente', 'confirmada')
+        INNER JOIN servicios sc ON sc.id = c.servicio_id
+        WHERE i.empleado_id IS NOT NULL
+          AND i.estado IN ('pendiente', 'confirmada')
+          AND c.fecha_hora < DATEADD(MINUTE, si.duracion_minutos + si.buffer_minutos, i.fecha_hora)
+          AND i.fecha_hora < DATEADD(MINUTE, sc.duracion_minutos + sc.buffer_minutos, c.fecha_hora)
+    )
+    BEGIN
+        RAISERROR('Conflicto de horario: El empleado ya tiene una cita que se traslapa con ese horario', 16, 1);
+        ROLLBACK TRANSACTION;
+        RETURN;
+    END
+
+    -- Validar que la fecha no sea en el pasado (solo para INSERT)
+    IF EXISTS (
+        SELECT 1 FROM inserted
+        WHERE fecha_hora < GETDATE()
+        AND NOT EXISTS (SELECT 1 FROM deleted WHERE id = inserted.id)
+    )
+    BEGIN
+        RAISERROR('No se pueden crear citas con fecha y hora pasadas', 16, 1);
+        ROLLBACK TRANSACTION;
+        RETURN;
+    END
+
+    -- Validar horario de atención (8:00 AM a 6:00 PM)
+    IF EXISTS (
+        SELECT 1 FROM inserted
+        WHERE DATEPART(HOUR, fecha_hora) < 8 OR DATEPART(HOUR, fecha_hora) >= 18
+    )
+    BEGIN
+        RAISERROR('Las citas solo pueden programarse entre 8:00 AM y 6:00 PM', 16, 1);
+        ROLLBACK TRANSACTION;
+        RETURN;
+    END
+
+    -- Actualizar fecha de modificación
+    UPDATE citas
+    SET actualizado_en = GETDATE()
+    WHERE id IN (SELECT id FROM inserted);
+END;
+GO
+
+PRINT 'Duración de servicios y validación por traslape configuradas';
@@ -0,0 +1,70 @@
+-- Horarios de empleados: plantillas semanales, excepciones puntuales y ausencias
+-- dia_semana sigue la numeración de Go (time.Weekday): 0 = domingo ... 6 = sábado
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'turnos_empleados') AND type in (N'U'))
+BEGIN
+    CREATE TABLE turnos_empleados (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        empleado_id INT NOT NULL,
+        dia_semana TINYINT NOT NULL,
+        hora_inicio TIME(0) NOT NULL,
+        hora_fin TIME(0) NOT NULL,
+        creado_en DATETIME DEFAULT GETDATE(),
+        actualizado_en DATETIME NULL,
+        CONSTRAINT FK_turnos_empleado FOREIGN KEY (empleado_id) REFERENCES usuarios(id),
+        CONSTRAINT CHK_turnos_dia CHECK (dia_semana BETWEEN 0 AND 6),
+        CONSTRAINT CHK_turnos_horas CHECK (hora_fin > hora_inicio)
+    );
+    CREATE INDEX IX_turnos_empleado_dia ON turnos_empleados(empleado_id, dia_semana);
+    PRINT 'Tabla turnos_empleados creada';
+END
+GO
+
+-- Cambios de un día concreto: trabaja = 0 marca el día libre, trabaja = 1 reemplaza el horario
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'excepciones_horario') AND type in (N'U'))
+BEGIN
+    CREATE TABLE excepciones_horario (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        empleado_id INT NOT NULL,
+        fecha DATE NOT NULL,
+        trabaja BIT NOT NULL DEFAULT 0,
+        hora_inicio TIME(0) NULL,
+        hora_fin TIME(0) NULL,
+        motivo NVARCHAR(255) NULL,
+        creado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT FK_excepciones_empleado FOREIGN KEY (empleado_id) REFERENCES usuarios(id),
+        CONSTRAINT UQ_excepciones_empleado_fecha UNIQUE (empleado_id, fecha),
+        CONSTRAINT CHK_excepciones_horas CHECK (
+            trabaja = 0 OR (hora_inicio IS NOT NULL AND hora_fin IS NOT NULL AND hora_fin > hora_inicio)
+        )
+    );
+    PRINT 'Tabla excepciones_horario creada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'ausencias_empleados') AND type in (N'U'))
+BEGIN
+    CREATE TABLE ausencias_empleados (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        empleado_id INT NOT NULL,
+        fecha_inicio DATE NOT NULL,
+        fecha_fin DATE NOT NULL,
+        tipo NVARCHAR(20) NOT NULL,
+        motivo NVARCHAR(255) NULL,
+        estado NVARCHAR(20) NOT NULL DEFAULT 'pendiente',
+        revisado_por INT NULL,
+        revisado_en DATETIME NULL,
+        comentario_revision NVARCHAR(255) NULL,
+        creado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT FK_ausencias_empleado FOREIGN KEY (empleado_id) REFERENCES usuarios(id),
+        CONSTRAINT FK_ausencias_revisor FOREIGN KEY (revisado_por) REFERENCES usuarios(id),
+        CONSTRAINT CHK_ausencias_fechas CHECK (fecha_fin >= fecha_inicio),
+        CONSTRAINT CHK_ausencias_tipo CHECK (tipo IN ('vacaciones', 'enfermedad', 'personal')),
+        CONSTRAINT CHK_ausencias_estado CHECK (estado IN ('pendiente', 'aprobada', 'rechazada', 'cancelada'))
+    );
+    CREATE INDEX IX_ausencias_empleado_fechas ON ausencias_empleados(empleado_id, fecha_inicio, fecha_fin);
+    PRINT 'Tabla ausencias_empleados creada';
+END
+GO
+
+PRINT 'Horarios de empleados configurados';
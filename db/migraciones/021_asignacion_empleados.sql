@@ -0,0 +1,32 @@
+-- Asignación automática de empleados: especialidades por servicio y estilista preferido del cliente
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'empleado_servicios') AND type in (N'U'))
+BEGIN
+    CREATE TABLE empleado_servicios (
+        empleado_id INT NOT NULL,
+        servicio_id INT NOT NULL,
+        creado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT PK_empleado_servicios PRIMARY KEY (empleado_id, servicio_id),
+        CONSTRAINT FK_empleado_servicios_empleado FOREIGN KEY (empleado_id) REFERENCES usuarios(id),
+        CONSTRAINT FK_empleado_servicios_servicio FOREIGN KEY (servicio_id) REFERENCES servicios(id) ON DELETE CASCADE
+    );
+    CREATE INDEX IX_empleado_servicios_servicio ON empleado_servicios(servicio_id);
+    PRINT 'Tabla empleado_servicios creada';
+END
+GO
+
+IF COL_LENGTH('usuarios', 'empleado_preferido_id') IS NULL
+BEGIN
+    ALTER TABLE usuarios ADD empleado_preferido_id INT NULL
+        CONSTRAINT FK_usuarios_empleado_preferido REFERENCES usuarios(id);
+    PRINT 'Columna usuarios.empleado_preferido_id agregada';
+END
+GO
+
+-- La rotación busca la última cita asignada a cada empleado
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'IX_citas_empleado_actualizado')
+BEGIN
+    CREATE INDEX IX_citas_empleado_actualizado ON citas(empleado_id, actualizado_en) WHERE empleado_id IS NOT NULL;
+    PRINT 'Índice IX_citas_empleado_actualizado creado';
+END
+GO
@@ -0,0 +1,28 @@
+-- Historial de estados de las citas: cada transición con su actor, fecha y motivo
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'citas_historial') AND type in (N'U'))
+BEGIN
+    CREATE TABLE citas_historial (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        cita_id INT NOT NULL,
+        estado_anterior NVARCHAR(20) NULL,
+        estado_nuevo NVARCHAR(20) NOT NULL,
+        actor_id INT NULL,
+        actor_rol NVARCHAR(20) NOT NULL,
+        motivo NVARCHAR(500) NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT FK_citas_historial_cita FOREIGN KEY (cita_id) REFERENCES citas(id) ON DELETE CASCADE,
+        CONSTRAINT FK_citas_historial_actor FOREIGN KEY (actor_id) REFERENCES usuarios(id)
+    );
+    CREATE INDEX IX_citas_historial_cita ON citas_historial(cita_id, creado_en);
+    PRINT 'Tabla citas_historial creada';
+END
+GO
+
+-- Las citas existentes arrancan su línea de tiempo con el estado que tienen hoy
+INSERT INTO citas_historial (cita_id, estado_anterior, estado_nuevo, actor_id, actor_rol, motivo, creado_en)
+SELECT c.id, NULL, c.estado, NULL, 'sistema', 'Estado previo al historial', ISNULL(c.actualizado_en, c.creado_en)
+FROM citas c
+WHERE NOT EXISTS (SELECT 1 FROM citas_historial h WHERE h.cita_id = c.id);
+PRINT 'Historial inicial de citas registrado';
+GO
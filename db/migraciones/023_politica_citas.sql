@@ -0,0 +1,25 @@
+-- Política de citas configurable y contador de reprogramaciones por cita
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'politica_citas') AND type in (N'U'))
+BEGIN
+    -- Una sola fila (id = 1) con la configuración vigente
+    CREATE TABLE politica_citas (
+        id INT PRIMARY KEY,
+        anticipacion_minima_horas INT NOT NULL DEFAULT 12,
+        max_reprogramaciones INT NOT NULL DEFAULT 2,
+        requiere_reconfirmacion BIT NOT NULL DEFAULT 1,
+        actualizado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT CHK_politica_citas_fila_unica CHECK (id = 1),
+        CONSTRAINT CHK_politica_citas_valores CHECK (anticipacion_minima_horas >= 0 AND max_reprogramaciones >= 0)
+    );
+    INSERT INTO politica_citas (id) VALUES (1);
+    PRINT 'Tabla politica_citas creada';
+END
+GO
+
+IF COL_LENGTH('citas', 'reprogramaciones') IS NULL
+BEGIN
+    ALTER TABLE citas ADD reprogramaciones INT NOT NULL CONSTRAINT DF_citas_reprogramaciones DEFAULT 0;
+    PRINT 'Columna citas.reprogramaciones agregada';
+END
+GO
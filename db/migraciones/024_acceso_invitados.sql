@@ -0,0 +1,25 @@
+-- Códigos de un solo uso para que los invitados consulten sus citas por cédula
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'codigos_invitado') AND type in (N'U'))
+BEGIN
+    CREATE TABLE codigos_invitado (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        cedula NVARCHAR(20) NOT NULL,
+        telefono NVARCHAR(20) NOT NULL,
+        codigo_hash CHAR(64) NOT NULL,          -- SHA-256 de cedula:codigo, nunca el código en claro
+        intentos INT NOT NULL DEFAULT 0,
+        expira_en DATETIME NOT NULL,
+        usado_en DATETIME NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE()
+    );
+    CREATE INDEX IX_codigos_invitado_cedula ON codigos_invitado(cedula, creado_en);
+    PRINT 'Tabla codigos_invitado creada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'IX_citas_cedula_invitado')
+BEGIN
+    CREATE INDEX IX_citas_cedula_invitado ON citas(cedula_invitado) WHERE cedula_invitado IS NOT NULL;
+    PRINT 'Índice IX_citas_cedula_invitado creado';
+END
+GO
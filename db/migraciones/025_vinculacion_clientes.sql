@@ -0,0 +1,63 @@
+-- Vinculación de citas de invitado a cuentas y fusión de clientes duplicados
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'fusiones_clientes') AND type in (N'U'))
+BEGIN
+    -- Sin FK a origen_id: la cuenta de origen se elimina al fusionar
+    CREATE TABLE fusiones_clientes (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        origen_id INT NOT NULL,
+        origen_nombre NVARCHAR(100) NOT NULL,
+        origen_correo NVARCHAR(100) NOT NULL,
+        origen_cedula NVARCHAR(20) NOT NULL,
+        destino_id INT NOT NULL,
+        citas_movidas INT NOT NULL DEFAULT 0,
+        citas_invitado INT NOT NULL DEFAULT 0,
+        realizado_por INT NOT NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT FK_fusiones_destino FOREIGN KEY (destino_id) REFERENCES usuarios(id),
+        CONSTRAINT FK_fusiones_admin FOREIGN KEY (realizado_por) REFERENCES usuarios(id)
+    );
+    PRINT 'Tabla fusiones_clientes creada';
+END
+GO
+
+-- tr_estadisticas_clientes (017) usa columnas que citas no tiene (cliente_id, fecha);
+-- las estadísticas se recalculan con este procedimiento cuando cambian las citas de un cliente.
+DROP TRIGGER IF EXISTS tr_estadisticas_clientes;
+GO
+
+CREATE OR ALTER PROCEDURE RecalcularEstadisticasCliente
+    @cliente_id INT
+AS
+BEGIN
+    SET NOCOUNT ON;
+
+    MERGE estadisticas_clientes AS destino
+    USING (
+        SELECT
+            @cliente_id AS cliente_id,
+            COUNT(c.id) AS total_citas,
+            SUM(CASE WHEN c.estado = 'finalizada' THEN 1 ELSE 0 END) AS citas_completadas,
+            SUM(CASE WHEN c.estado = 'cancelada' THEN 1 ELSE 0 END) AS citas_canceladas,
+            ISNULL(SUM(CASE WHEN c.estado = 'finalizada' THEN s.precio ELSE 0 END), 0) AS gasto_total,
+            CAST(MAX(c.fecha_hora) AS DATE) AS ultima_cita
+        FROM citas c
+        JOIN servicios s ON s.id = c.servicio_id
+        WHERE c.usuario_id = @cliente_id
+    ) AS origen ON destino.cliente_id = origen.cliente_id
+    WHEN MATCHED THEN
+        UPDATE SET
+            total_citas = origen.total_citas,
+            citas_completadas = origen.citas_completadas,
+            citas_canceladas = origen.citas_canceladas,
+            gasto_total = origen.gasto_total,
+            ultima_cita = origen.ultima_cita,
+            fecha_actualizacion = GETDATE()
+    WHEN NOT MATCHED THEN
+        INSERT (cliente_id, total_citas, citas_completadas, citas_canceladas, gasto_total, ultima_cita)
+        VALUES (origen.cliente_id, origen.total_citas, origen.citas_completadas,
+                origen.citas_canceladas, origen.gasto_total, origen.ultima_cita);
+END;
+GO
+PRINT 'Procedimiento RecalcularEstadisticasCliente creado';
+GO
@@ -0,0 +1,101 @@
+-- Horario de atención configurable: plantilla semanal del salón y días especiales
+-- (feriados, cierres por remodelación, horarios reducidos)
+-- dia_semana sigue la numeración de Go (time.Weekday): 0 = domingo ... 6 = sábado
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'horario_salon') AND type in (N'U'))
+BEGIN
+    CREATE TABLE horario_salon (
+        dia_semana TINYINT PRIMARY KEY,
+        abierto BIT NOT NULL DEFAULT 1,
+        hora_apertura TIME(0) NULL,
+        hora_cierre TIME(0) NULL,
+        actualizado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT CHK_horario_salon_dia CHECK (dia_semana BETWEEN 0 AND 6),
+        CONSTRAINT CHK_horario_salon_horas CHECK (
+            abierto = 0 OR (hora_apertura IS NOT NULL AND hora_cierre IS NOT NULL AND hora_cierre > hora_apertura)
+        )
+    );
+
+    -- Mismo horario que aplicaba el trigger: todos los días de 8:00 a 18:00
+    INSERT INTO horario_salon (dia_semana, abierto, hora_apertura, hora_cierre)
+    VALUES (0, 1, '08:00', '18:00'), (1, 1, '08:00', '18:00'), (2, 1, '08:00', '18:00'), (3, 1, '08:00', '18:00'),
+           (4, 1, '08:00', '18:00'), (5, 1, '08:00', '18:00'), (6, 1, '08:00', '18:00');
+    PRINT 'Tabla horario_salon creada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'dias_especiales') AND type in (N'U'))
+BEGIN
+    CREATE TABLE dias_especiales (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        fecha_inicio DATE NOT NULL,
+        fecha_fin DATE NOT NULL,
+        abierto BIT NOT NULL DEFAULT 0,
+        hora_apertura TIME(0) NULL,
+        hora_cierre TIME(0) NULL,
+        tipo NVARCHAR(20) NOT NULL,
+        motivo NVARCHAR(255) NULL,
+        creado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT CHK_dias_especiales_rango CHECK (fecha_fin >= fecha_inicio),
+        CONSTRAINT CHK_dias_especiales_tipo CHECK (tipo IN ('feriado', 'cierre', 'horario_especial')),
+        CONSTRAINT CHK_dias_especiales_horas CHECK (
+            abierto = 0 OR (hora_apertura IS NOT NULL AND hora_cierre IS NOT NULL AND hora_cierre > hora_apertura)
+        )
+    );
+    CREATE INDEX IX_dias_especiales_rango ON dias_especiales(fecha_inicio, fecha_fin);
+    PRINT 'Tabla dias_especiales creada';
+END
+GO
+
+-- tr_validacion_citas sin el horario fijo de 8:00 a 18:00; el horario de atención
+-- configurable se valida en la API (VerificarDisponibilidad y VerificarHorarioSalon)
+DROP TRIGGER IF EXISTS tr_validacion_citas;
+GO
+CREATE TRIGGER tr_validacion_citas
+ON citas
+AFTER INSERT, UPDATE
+AS
+BEGIN
+    SET NOCOUNT ON;
+
+    -- Validar que el intervalo (duración + limpieza) no se cruce con otra cita activa del empleado
+    IF EXISTS (
+        SELECT 1
+        FROM inserted i
+        INNER JOIN servicios si ON si.id = i.servicio_id
+        INNER JOIN citas c ON c.empleado_id = i.empleado_id
+                           AND c.id != i.id
+                           AND c.estado IN ('pendiente', 'confirmada')
+        INNER JOIN servicios sc ON sc.id = c.servicio_id
+        WHERE i.empleado_id IS NOT NULL
+          AND i.estado IN ('pendiente', 'confirmada')
+          AND c.fecha_hora < DATEADD(MINUTE, si.duracion_minutos + si.buffer_minutos, i.fecha_hora)
+          AND i.fecha_hora < DATEADD(MINUTE, sc.duracion_minutos + sc.buffer_minutos, c.fecha_hora)
+    )
+    BEGIN
+        RAISERROR('Conflicto de horario: El empleado ya tiene una cita que se traslapa con ese horario', 16, 1);
+        ROLLBACK TRANSACTION;
+        RETURN;
+    END
+
+    -- Validar que la fecha no sea en el pasado (solo para INSERT)
+    IF EXISTS (
+        SELECT 1 FROM inserted
+        WHERE fecha_hora < GETDATE()
+        AND NOT EXISTS (SELECT 1 FROM deleted WHERE id = inserted.id)
+    )
+    BEGIN
+        RAISERROR('No se pueden crear citas con fecha y hora pasadas', 16, 1);
+        ROLLBACK TRANSACTION;
+        RETURN;
+    END
+
+    -- Actualizar fecha de modificación
+    UPDATE citas
+    SET actualizado_en = GETDATE()
+    WHERE id IN (SELECT id FROM inserted);
+END;
+GO
+
+PRINT 'Horario de atención configurable instalado';
+GO
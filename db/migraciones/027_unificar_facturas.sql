@@ -0,0 +1,159 @@
+-- Unifica las facturas en factura/detallefactura (idFact, idCita), que es el esquema del
+-- script maestro y el único que usa la API.
+-- Bases creadas con los scripts de backup_facturas tienen además la tabla facturas
+-- (id, cita_id, numero_factura...) y un detallefactura con otra forma (factura_id,
+-- tipo_item, item_id, precio_unitario). Esta migración:
+--   1. Renombra ese detallefactura viejo a detallefactura_legacy.
+--   2. Crea factura/detallefactura si faltan.
+--   3. Copia cada fila de facturas a factura (una sola vez, queda en facturas_migradas)
+--      junto con sus líneas.
+--   4. Renombra facturas a facturas_legacy para que nada vuelva a leerla.
+-- Los datos viejos se conservan en las tablas *_legacy para auditoría.
+
+-- 1. detallefactura con la forma vieja
+IF COL_LENGTH('detallefactura', 'factura_id') IS NOT NULL
+   AND OBJECT_ID(N'detallefactura_legacy', N'U') IS NULL
+BEGIN
+    -- Los triggers viejos calculan con columnas que ya no existirán en la tabla nueva
+    DECLARE @sql NVARCHAR(MAX) = N'';
+    SELECT @sql = @sql + N'DROP TRIGGER ' + QUOTENAME(name) + N';'
+    FROM sys.triggers WHERE parent_id = OBJECT_ID(N'detallefactura');
+    EXEC sp_executesql @sql;
+
+    EXEC sp_rename 'detallefactura', 'detallefactura_legacy';
+    PRINT 'Tabla detallefactura vieja renombrada a detallefactura_legacy';
+END
+GO
+
+-- 2. Esquema unificado
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'factura') AND type in (N'U'))
+BEGIN
+    CREATE TABLE factura (
+        idFact INT IDENTITY(1,1) PRIMARY KEY,
+        idCita INT NOT NULL,
+        fecha DATE NOT NULL DEFAULT GETDATE(),
+        impuesto DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+        subtotal DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+        total DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+        observaciones TEXT NULL,
+        CONSTRAINT FK_factura_cita FOREIGN KEY (idCita) REFERENCES citas(id)
+    );
+    CREATE INDEX IX_factura_idCita ON factura(idCita);
+    PRINT 'Tabla factura creada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'detallefactura') AND type in (N'U'))
+BEGIN
+    CREATE TABLE detallefactura (
+        idDetalle INT IDENTITY(1,1) PRIMARY KEY,
+        idFact INT NOT NULL,
+        idProducto INT NULL,
+        idServicio INT NULL,
+        cant INT NOT NULL DEFAULT 1,
+        precio DECIMAL(10,2) NOT NULL,
+        subtotal DECIMAL(10,2) NOT NULL,
+        detallePersonalizado TEXT NULL,
+        descripcion TEXT NULL,
+        CONSTRAINT FK_detallefactura_factura FOREIGN KEY (idFact) REFERENCES factura(idFact),
+        CONSTRAINT FK_detallefactura_producto FOREIGN KEY (idProducto) REFERENCES productos(id),
+        CONSTRAINT FK_detallefactura_servicio FOREIGN KEY (idServicio) REFERENCES servicios(id),
+        CONSTRAINT CHK_producto_o_servicio CHECK (
+            (idProducto IS NOT NULL AND idServicio IS NULL) OR
+            (idProducto IS NULL AND idServicio IS NOT NULL)
+        )
+    );
+    CREATE INDEX IX_detallefactura_idFact ON detallefactura(idFact);
+    CREATE INDEX IX_detallefactura_idProducto ON detallefactura(idProducto);
+    CREATE INDEX IX_detallefactura_idServicio ON detallefactura(idServicio);
+    PRINT 'Tabla detallefactura creada (ejecutar triggers_sistema_completo.sql para sus triggers)';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'facturas_migradas') AND type in (N'U'))
+BEGIN
+    CREATE TABLE facturas_migradas (
+        legacy_id INT PRIMARY KEY,
+        idFact INT NOT NULL,
+        numero_factura NVARCHAR(50) NULL,
+        migrado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT FK_facturas_migradas_factura FOREIGN KEY (idFact) REFERENCES factura(idFact)
+    );
+    PRINT 'Tabla facturas_migradas creada';
+END
+GO
+
+-- 3. Copiar datos de facturas (idempotente gracias a facturas_migradas)
+IF OBJECT_ID(N'facturas', N'U') IS NOT NULL
+BEGIN
+    DECLARE @nuevas TABLE (legacy_id INT PRIMARY KEY, idFact INT NOT NULL);
+
+    BEGIN TRANSACTION;
+
+    -- MERGE permite guardar la pareja (id viejo, idFact nuevo) en el OUTPUT
+    MERGE factura AS destino
+    USING (
+        SELECT f.id, f.cita_id, f.numero_factura, f.fecha_emision, f.impuestos, f.subtotal, f.total,
+               'Migrada de la factura ' + f.numero_factura
+                   + ISNULL(' (' + f.estado + ISNULL(', ' + f.metodo_pago, '') + ')', '')
+                   + ISNULL('. ' + CAST(f.notas AS NVARCHAR(MAX)), '') AS observaciones
+        FROM facturas f
+        WHERE NOT EXISTS (SELECT 1 FROM facturas_migradas m WHERE m.legacy_id = f.id)
+          AND EXISTS (SELECT 1 FROM citas c WHERE c.id = f.cita_id)
+    ) AS origen
+    ON 1 = 0
+    WHEN NOT MATCHED THEN
+        INSERT (idCita, fecha, impuesto, subtotal, total, observaciones)
+        VALUES (origen.cita_id, CAST(origen.fecha_emision AS DATE), origen.impuestos, origen.subtotal, origen.total, origen.observaciones)
+    OUTPUT origen.id, inserted.idFact INTO @nuevas (legacy_id, idFact);
+
+    INSERT INTO facturas_migradas (legacy_id, idFact, numero_factura)
+    SELECT n.legacy_id, n.idFact, f.numero_factura
+    FROM @nuevas n
+    JOIN facturas f ON f.id = n.legacy_id;
+
+    IF OBJECT_ID(N'detallefactura_legacy', N'U') IS NOT NULL
+    BEGIN
+        -- Ventas históricas: no deben volver a descontar inventario ni recalcular impuestos
+        DISABLE TRIGGER ALL ON detallefactura;
+
+        INSERT INTO detallefactura (idFact, idProducto, idServicio, cant, precio, subtotal, descripcion)
+        SELECT n.idFact,
+               CASE WHEN d.tipo_item = 'producto' THEN d.item_id END,
+               CASE WHEN d.tipo_item = 'servicio' THEN d.item_id END,
+               d.cantidad, d.precio_unitario, d.subtotal, d.descripcion
+        FROM detallefactura_legacy d
+        JOIN @nuevas n ON n.legacy_id = d.factura_id
+        WHERE (d.tipo_item = 'producto' AND EXISTS (SELECT 1 FROM productos p WHERE p.id = d.item_id))
+           OR (d.tipo_item = 'servicio' AND EXISTS (SELECT 1 FROM servicios s WHERE s.id = d.item_id))
+        ORDER BY d.factura_id, d.id;
+
+        ENABLE TRIGGER ALL ON detallefactura;
+
+        DECLARE @omitidas INT = (
+            SELECT COUNT(*) FROM detallefactura_legacy d
+            JOIN @nuevas n ON n.legacy_id = d.factura_id
+            WHERE NOT ((d.tipo_item = 'producto' AND EXISTS (SELECT 1 FROM productos p WHERE p.id = d.item_id))
+                    OR (d.tipo_item = 'servicio' AND EXISTS (SELECT 1 FROM servicios s WHERE s.id = d.item_id)))
+        );
+        IF @omitidas > 0
+            PRINT CONCAT(@omitidas, ' líneas viejas no se copiaron porque su producto o servicio ya no existe (quedan en detallefactura_legacy)');
+    END
+
+    COMMIT TRANSACTION;
+
+    DECLARE @migradas INT = (SELECT COUNT(*) FROM @nuevas);
+    PRINT CONCAT(@migradas, ' facturas copiadas de facturas a factura');
+
+    IF EXISTS (SELECT 1 FROM facturas f WHERE NOT EXISTS (SELECT 1 FROM facturas_migradas m WHERE m.legacy_id = f.id))
+        PRINT 'Hay facturas viejas cuya cita ya no existe; se conservan en facturas_legacy';
+END
+GO
+
+-- 4. Retirar la tabla vieja
+IF OBJECT_ID(N'facturas', N'U') IS NOT NULL AND OBJECT_ID(N'facturas_legacy', N'U') IS NULL
+BEGIN
+    EXEC sp_rename 'facturas', 'facturas_legacy';
+    PRINT 'Tabla facturas renombrada a facturas_legacy';
+END
+GO
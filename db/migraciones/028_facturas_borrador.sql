@@ -0,0 +1,65 @@
+-- Punto de venta: la factura nace como borrador para agregar productos y servicios
+-- extra antes de cerrarla. Los totales los calcula la API al modificar líneas.
+
+IF COL_LENGTH('factura', 'estado') IS NULL
+BEGIN
+    ALTER TABLE factura ADD
+        estado NVARCHAR(20) NOT NULL CONSTRAINT DF_factura_estado DEFAULT 'borrador'
+            CONSTRAINT CHK_factura_estado CHECK (estado IN ('borrador', 'cerrada')),
+        cerrada_en DATETIME NULL;
+
+    -- Las facturas que ya existían se emitieron con el flujo anterior: quedan cerradas
+    EXEC('UPDATE factura SET estado = ''cerrada'', cerrada_en = CAST(fecha AS DATETIME)');
+    PRINT 'Columnas factura.estado y factura.cerrada_en agregadas';
+END
+GO
+
+-- tr_detallefactura_calcular_subtotal (script maestro) y tr_detallefactura_calcular_totales
+-- (triggers_sistema_completo) calculan el impuesto de forma distinta y se pisan entre sí.
+-- La API recalcula subtotal, impuesto y total en la misma transacción que cambia la línea.
+DROP TRIGGER IF EXISTS tr_detallefactura_calcular_subtotal;
+GO
+DROP TRIGGER IF EXISTS tr_detallefactura_calcular_totales;
+GO
+
+-- Inventario por diferencia: agregar una línea descuenta, aumentar la cantidad descuenta
+-- la diferencia y eliminarla devuelve el stock
+DROP TRIGGER IF EXISTS tr_actualizar_inventario_venta;
+GO
+CREATE TRIGGER tr_actualizar_inventario_venta
+ON detallefactura
+AFTER INSERT, UPDATE, DELETE
+AS
+BEGIN
+    SET NOCOUNT ON;
+
+    UPDATE p
+    SET cantidad_disponible = p.cantidad_disponible - m.vendido,
+        actualizado_en = GETDATE()
+    FROM productos p
+    INNER JOIN (
+        SELECT idProducto, SUM(cant) AS vendido
+        FROM (
+            SELECT idProducto, cant FROM inserted WHERE idProducto IS NOT NULL
+            UNION ALL
+            SELECT idProducto, -cant FROM deleted WHERE idProducto IS NOT NULL
+        ) movimientos
+        GROUP BY idProducto
+    ) m ON p.id = m.idProducto
+    WHERE m.vendido <> 0;
+
+    IF EXISTS (
+        SELECT 1 FROM productos p
+        INNER JOIN inserted i ON p.id = i.idProducto
+        WHERE p.cantidad_disponible < 0
+    )
+    BEGIN
+        RAISERROR('Error: No hay suficiente inventario para completar la venta', 16, 1);
+        ROLLBACK TRANSACTION;
+        RETURN;
+    END
+END;
+GO
+
+PRINT 'Facturas en borrador listas';
+GO
@@ -0,0 +1,49 @@
+-- Ventas de mostrador: facturas sin cita para un cliente registrado, un invitado
+-- identificado por cédula o un comprador anónimo (consumidor final)
+
+-- idCita pasa a ser opcional. El índice y la FK dependen de la columna, así que se
+-- recrean alrededor del ALTER COLUMN.
+IF EXISTS (SELECT 1 FROM sys.columns WHERE object_id = OBJECT_ID(N'factura') AND name = 'idCita' AND is_nullable = 0)
+BEGIN
+    IF EXISTS (SELECT 1 FROM sys.indexes WHERE object_id = OBJECT_ID(N'factura') AND name = 'IX_factura_idCita')
+        DROP INDEX IX_factura_idCita ON factura;
+    IF EXISTS (SELECT 1 FROM sys.foreign_keys WHERE name = 'FK_factura_cita')
+        ALTER TABLE factura DROP CONSTRAINT FK_factura_cita;
+
+    ALTER TABLE factura ALTER COLUMN idCita INT NULL;
+
+    ALTER TABLE factura ADD CONSTRAINT FK_factura_cita FOREIGN KEY (idCita) REFERENCES citas(id);
+    CREATE INDEX IX_factura_idCita ON factura(idCita);
+    PRINT 'Columna factura.idCita ahora admite NULL';
+END
+GO
+
+IF COL_LENGTH('factura', 'tipo') IS NULL
+BEGIN
+    ALTER TABLE factura ADD
+        tipo NVARCHAR(20) NOT NULL CONSTRAINT DF_factura_tipo DEFAULT 'cita',
+        cliente_id INT NULL CONSTRAINT FK_factura_cliente REFERENCES usuarios(id),
+        cedula_cliente NVARCHAR(20) NULL,
+        nombre_cliente NVARCHAR(100) NULL,
+        telefono_cliente NVARCHAR(20) NULL,
+        creado_por INT NULL CONSTRAINT FK_factura_creado_por REFERENCES usuarios(id);
+    PRINT 'Columnas de venta de mostrador agregadas a factura';
+END
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.check_constraints WHERE name = 'CHK_factura_tipo')
+BEGIN
+    ALTER TABLE factura ADD CONSTRAINT CHK_factura_tipo CHECK (
+        (tipo = 'cita' AND idCita IS NOT NULL) OR (tipo = 'mostrador' AND idCita IS NULL)
+    );
+    PRINT 'Restricción CHK_factura_tipo creada';
+END
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE object_id = OBJECT_ID(N'factura') AND name = 'IX_factura_cliente')
+BEGIN
+    CREATE INDEX IX_factura_cliente ON factura(cliente_id) WHERE cliente_id IS NOT NULL;
+    CREATE INDEX IX_factura_cedula_cliente ON factura(cedula_cliente) WHERE cedula_cliente IS NOT NULL;
+    PRINT 'Índices de clientes de factura creados';
+END
+GO
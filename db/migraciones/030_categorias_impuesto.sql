@@ -0,0 +1,91 @@
+-- Categorías de IVA con tarifas por fecha de vigencia. Cada línea de factura guarda la
+-- categoría, la tarifa y el impuesto con que se emitió, así las facturas viejas no
+-- cambian cuando cambia una tarifa.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'categorias_impuesto') AND type in (N'U'))
+BEGIN
+    CREATE TABLE categorias_impuesto (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        codigo NVARCHAR(20) NOT NULL UNIQUE,
+        nombre NVARCHAR(100) NOT NULL,
+        descripcion NVARCHAR(255) NULL,
+        activo BIT NOT NULL DEFAULT 1,
+        creado_en DATETIME DEFAULT GETDATE()
+    );
+
+    -- Tarifas de la Ley del IVA (Ley 9635); 'general' es la que aplica por defecto
+    INSERT INTO categorias_impuesto (codigo, nombre, descripcion) VALUES
+    ('general', 'IVA general', 'Tarifa general para bienes y servicios'),
+    ('reducida_4', 'IVA reducido 4%', 'Servicios de salud privados y otros con tarifa del 4%'),
+    ('reducida_2', 'IVA reducido 2%', 'Medicamentos, seguros personales y otros con tarifa del 2%'),
+    ('reducida_1', 'IVA reducido 1%', 'Canasta básica y otros con tarifa del 1%'),
+    ('exento', 'Exento', 'Bienes y servicios exentos de IVA');
+    PRINT 'Tabla categorias_impuesto creada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'tasas_impuesto') AND type in (N'U'))
+BEGIN
+    CREATE TABLE tasas_impuesto (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        categoria_id INT NOT NULL,
+        tarifa DECIMAL(5,2) NOT NULL, -- porcentaje: 13.00 = 13 %
+        vigente_desde DATE NOT NULL,
+        creado_en DATETIME DEFAULT GETDATE(),
+        CONSTRAINT FK_tasas_impuesto_categoria FOREIGN KEY (categoria_id) REFERENCES categorias_impuesto(id),
+        CONSTRAINT UQ_tasas_impuesto_vigencia UNIQUE (categoria_id, vigente_desde),
+        CONSTRAINT CHK_tasas_impuesto_tarifa CHECK (tarifa >= 0 AND tarifa <= 100)
+    );
+
+    INSERT INTO tasas_impuesto (categoria_id, tarifa, vigente_desde)
+    SELECT id, CASE codigo
+                   WHEN 'general' THEN 13
+                   WHEN 'reducida_4' THEN 4
+                   WHEN 'reducida_2' THEN 2
+                   WHEN 'reducida_1' THEN 1
+                   ELSE 0
+               END, '2019-07-01'
+    FROM categorias_impuesto;
+    PRINT 'Tabla tasas_impuesto creada';
+END
+GO
+
+-- Categoría de servicios y productos; NULL = general
+IF COL_LENGTH('servicios', 'categoria_impuesto_id') IS NULL
+BEGIN
+    ALTER TABLE servicios ADD categoria_impuesto_id INT NULL
+        CONSTRAINT FK_servicios_categoria_impuesto REFERENCES categorias_impuesto(id);
+    PRINT 'Columna servicios.categoria_impuesto_id agregada';
+END
+GO
+
+IF COL_LENGTH('productos', 'categoria_impuesto_id') IS NULL
+BEGIN
+    ALTER TABLE productos ADD categoria_impuesto_id INT NULL
+        CONSTRAINT FK_productos_categoria_impuesto REFERENCES categorias_impuesto(id);
+    PRINT 'Columna productos.categoria_impuesto_id agregada';
+END
+GO
+
+-- Impuesto por línea
+IF COL_LENGTH('detallefactura', 'tarifa_impuesto') IS NULL
+BEGIN
+    ALTER TABLE detallefactura ADD
+        categoria_impuesto_id INT NULL CONSTRAINT FK_detallefactura_categoria_impuesto REFERENCES categorias_impuesto(id),
+        tarifa_impuesto DECIMAL(5,2) NOT NULL CONSTRAINT DF_detallefactura_tarifa DEFAULT 0,
+        impuesto DECIMAL(10,2) NOT NULL CONSTRAINT DF_detallefactura_impuesto DEFAULT 0;
+
+    -- Las líneas existentes se emitieron con el 13 % fijo
+    EXEC('
+        UPDATE detallefactura
+        SET categoria_impuesto_id = (SELECT id FROM categorias_impuesto WHERE codigo = ''general''),
+            tarifa_impuesto = 13,
+            impuesto = ROUND(subtotal * 0.13, 2)');
+    PRINT 'Columnas de impuesto agregadas a detallefactura';
+END
+GO
+
+-- La factura de una cita se genera en la API (CrearFacturaDesdeCita), que calcula el
+-- impuesto por línea. El procedimiento aplicaba 13 % a todo.
+DROP PROCEDURE IF EXISTS GenerarFacturaDesdeCita;
+GO
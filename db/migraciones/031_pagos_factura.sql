@@ -0,0 +1,25 @@
+-- Pagos de facturas: efectivo, tarjeta, SINPE Móvil y transferencia, con pagos
+-- parciales y divididos. El estado de pago de la factura se deriva de esta tabla.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'pagos_factura') AND type in (N'U'))
+BEGIN
+    CREATE TABLE pagos_factura (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        idFact INT NOT NULL,
+        metodo NVARCHAR(20) NOT NULL,
+        monto DECIMAL(10,2) NOT NULL,            -- lo que se aplica a la factura
+        recibido DECIMAL(10,2) NULL,             -- efectivo entregado por el cliente
+        vuelto DECIMAL(10,2) NOT NULL DEFAULT 0,
+        referencia NVARCHAR(100) NULL,           -- autorización de tarjeta, comprobante SINPE o de transferencia
+        registrado_por INT NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT FK_pagos_factura_factura FOREIGN KEY (idFact) REFERENCES factura(idFact),
+        CONSTRAINT FK_pagos_factura_usuario FOREIGN KEY (registrado_por) REFERENCES usuarios(id),
+        CONSTRAINT CHK_pagos_factura_metodo CHECK (metodo IN ('efectivo', 'tarjeta', 'sinpe_movil', 'transferencia')),
+        CONSTRAINT CHK_pagos_factura_monto CHECK (monto > 0),
+        CONSTRAINT CHK_pagos_factura_vuelto CHECK (vuelto >= 0 AND (recibido IS NULL OR recibido = monto + vuelto))
+    );
+    CREATE INDEX IX_pagos_factura_idFact ON pagos_factura(idFact);
+    PRINT 'Tabla pagos_factura creada';
+END
+GO
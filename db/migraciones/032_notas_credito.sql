@@ -0,0 +1,80 @@
+-- Anulaciones, notas de crédito y reembolsos. La factura original no se modifica:
+-- cada corrección es un documento nuevo que la referencia y acredita líneas de ella.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'notas_credito') AND type in (N'U'))
+BEGIN
+    CREATE TABLE notas_credito (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        idFact INT NOT NULL,
+        tipo NVARCHAR(20) NOT NULL,                -- anulacion: acredita todo lo pendiente; parcial: líneas elegidas
+        motivo NVARCHAR(500) NOT NULL,
+        subtotal DECIMAL(10,2) NOT NULL DEFAULT 0,
+        impuesto DECIMAL(10,2) NOT NULL DEFAULT 0,
+        total DECIMAL(10,2) NOT NULL DEFAULT 0,
+        devolver_inventario BIT NOT NULL DEFAULT 0,
+        metodo_reembolso NVARCHAR(20) NULL,
+        monto_reembolsado DECIMAL(10,2) NOT NULL DEFAULT 0,
+        referencia_reembolso NVARCHAR(100) NULL,
+        creado_por INT NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT FK_notas_credito_factura FOREIGN KEY (idFact) REFERENCES factura(idFact),
+        CONSTRAINT FK_notas_credito_usuario FOREIGN KEY (creado_por) REFERENCES usuarios(id),
+        CONSTRAINT CHK_notas_credito_tipo CHECK (tipo IN ('anulacion', 'parcial')),
+        CONSTRAINT CHK_notas_credito_reembolso CHECK (
+            monto_reembolsado >= 0 AND monto_reembolsado <= total
+            AND (monto_reembolsado = 0 OR metodo_reembolso IN ('efectivo', 'tarjeta', 'sinpe_movil', 'transferencia'))
+        )
+    );
+    CREATE INDEX IX_notas_credito_idFact ON notas_credito(idFact);
+    -- Una factura se anula una sola vez
+    CREATE UNIQUE INDEX UX_notas_credito_anulacion ON notas_credito(idFact) WHERE tipo = 'anulacion';
+    PRINT 'Tabla notas_credito creada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'detalle_nota_credito') AND type in (N'U'))
+BEGIN
+    CREATE TABLE detalle_nota_credito (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        nota_id INT NOT NULL,
+        idDetalle INT NOT NULL,                    -- línea acreditada de la factura original
+        cant INT NOT NULL,
+        precio DECIMAL(10,2) NOT NULL,
+        subtotal DECIMAL(10,2) NOT NULL,
+        tarifa_impuesto DECIMAL(5,2) NOT NULL,
+        impuesto DECIMAL(10,2) NOT NULL,
+        devuelto_inventario BIT NOT NULL DEFAULT 0,
+        CONSTRAINT FK_detalle_nota_credito_nota FOREIGN KEY (nota_id) REFERENCES notas_credito(id),
+        CONSTRAINT FK_detalle_nota_credito_detalle FOREIGN KEY (idDetalle) REFERENCES detallefactura(idDetalle),
+        CONSTRAINT CHK_detalle_nota_credito_cant CHECK (cant > 0)
+    );
+    CREATE INDEX IX_detalle_nota_credito_detalle ON detalle_nota_credito(idDetalle);
+    PRINT 'Tabla detalle_nota_credito creada';
+END
+GO
+
+-- Las líneas de una factura cerrada ya no cambian: las correcciones van en notas de crédito
+DROP TRIGGER IF EXISTS tr_detallefactura_factura_cerrada;
+GO
+CREATE TRIGGER tr_detallefactura_factura_cerrada
+ON detallefactura
+AFTER INSERT, UPDATE, DELETE
+AS
+BEGIN
+    SET NOCOUNT ON;
+
+    IF EXISTS (
+        SELECT 1 FROM factura f
+        WHERE f.estado <> 'borrador'
+          AND f.idFact IN (SELECT idFact FROM inserted UNION SELECT idFact FROM deleted)
+    )
+    BEGIN
+        RAISERROR('Error: La factura está cerrada; use una nota de crédito', 16, 1);
+        ROLLBACK TRANSACTION;
+        RETURN;
+    END
+END;
+GO
+
+PRINT 'Notas de crédito listas';
+GO
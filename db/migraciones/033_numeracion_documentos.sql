@@ -0,0 +1,74 @@
+-- Numeración consecutiva sin saltos por serie (sucursal, terminal, tipo de documento).
+-- Una SEQUENCE (como seq_factura en backup_facturas) pierde números en cada rollback;
+-- el contador de la serie se incrementa dentro de la transacción del documento y se
+-- revierte con ella.
+--
+-- Consecutivo de 20 dígitos como lo pide Hacienda:
+--   sucursal (3) + terminal (5) + tipo de documento (2) + número (10)
+-- Tipos: 01 factura electrónica, 03 nota de crédito, 04 tiquete electrónico.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'series_documento') AND type in (N'U'))
+BEGIN
+    CREATE TABLE series_documento (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        sucursal CHAR(3) NOT NULL,
+        terminal CHAR(5) NOT NULL,
+        tipo_documento CHAR(2) NOT NULL,
+        ultimo_numero BIGINT NOT NULL DEFAULT 0,
+        descripcion NVARCHAR(100) NULL,
+        activa BIT NOT NULL DEFAULT 1,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT UQ_series_documento UNIQUE (sucursal, terminal, tipo_documento),
+        CONSTRAINT CHK_series_documento_tipo CHECK (tipo_documento IN ('01', '03', '04')),
+        CONSTRAINT CHK_series_documento_codigos CHECK (sucursal NOT LIKE '%[^0-9]%' AND terminal NOT LIKE '%[^0-9]%'),
+        CONSTRAINT CHK_series_documento_numero CHECK (ultimo_numero BETWEEN 0 AND 9999999999)
+    );
+
+    INSERT INTO series_documento (sucursal, terminal, tipo_documento, descripcion) VALUES
+    ('001', '00001', '01', 'Caja principal - facturas'),
+    ('001', '00001', '03', 'Caja principal - notas de crédito'),
+    ('001', '00001', '04', 'Caja principal - tiquetes');
+    PRINT 'Tabla series_documento creada';
+END
+GO
+
+IF COL_LENGTH('factura', 'consecutivo') IS NULL
+BEGIN
+    ALTER TABLE factura ADD
+        serie_id INT NULL CONSTRAINT FK_factura_serie REFERENCES series_documento(id),
+        tipo_documento CHAR(2) NULL,
+        consecutivo CHAR(20) NULL;
+    PRINT 'Columnas de numeración agregadas a factura';
+END
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE object_id = OBJECT_ID(N'factura') AND name = 'UX_factura_consecutivo')
+BEGIN
+    CREATE UNIQUE INDEX UX_factura_consecutivo ON factura(consecutivo) WHERE consecutivo IS NOT NULL;
+    PRINT 'Índice UX_factura_consecutivo creado';
+END
+GO
+
+IF COL_LENGTH('notas_credito', 'consecutivo') IS NULL
+BEGIN
+    ALTER TABLE notas_credito ADD
+        serie_id INT NULL CONSTRAINT FK_notas_credito_serie REFERENCES series_documento(id),
+        consecutivo CHAR(20) NULL;
+    PRINT 'Columnas de numeración agregadas a notas_credito';
+END
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE object_id = OBJECT_ID(N'notas_credito') AND name = 'UX_notas_credito_consecutivo')
+BEGIN
+    CREATE UNIQUE INDEX UX_notas_credito_consecutivo ON notas_credito(consecutivo) WHERE consecutivo IS NOT NULL;
+    PRINT 'Índice UX_notas_credito_consecutivo creado';
+END
+GO
+
+-- La secuencia del esquema viejo nunca se usó fuera de los SP de backup_facturas
+IF EXISTS (SELECT 1 FROM sys.sequences WHERE name = 'seq_factura')
+BEGIN
+    DROP SEQUENCE seq_factura;
+    PRINT 'Secuencia seq_factura eliminada';
+END
+GO
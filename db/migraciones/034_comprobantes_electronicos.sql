@@ -0,0 +1,49 @@
+-- Comprobantes electrónicos de Hacienda (v4.4): XML firmado de cada factura, tiquete
+-- o nota de crédito, con su clave de 50 dígitos y el estado del envío.
+
+-- Código CABYS (13 dígitos) obligatorio en cada línea del comprobante
+IF COL_LENGTH('servicios', 'codigo_cabys') IS NULL
+BEGIN
+    ALTER TABLE servicios ADD codigo_cabys CHAR(13) NULL;
+    PRINT 'Columna servicios.codigo_cabys agregada';
+END
+GO
+
+IF COL_LENGTH('productos', 'codigo_cabys') IS NULL
+BEGIN
+    ALTER TABLE productos ADD codigo_cabys CHAR(13) NULL;
+    PRINT 'Columna productos.codigo_cabys agregada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'comprobantes_electronicos') AND type in (N'U'))
+BEGIN
+    CREATE TABLE comprobantes_electronicos (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        clave CHAR(50) NOT NULL,
+        consecutivo CHAR(20) NOT NULL,
+        tipo_documento CHAR(2) NOT NULL,
+        idFact INT NULL,                          -- factura o tiquete
+        nota_credito_id INT NULL,                 -- nota de crédito
+        fecha_emision DATETIME NOT NULL,
+        xml_firmado NVARCHAR(MAX) NOT NULL,
+        estado NVARCHAR(20) NOT NULL DEFAULT 'generado',
+        respuesta_hacienda NVARCHAR(MAX) NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        enviado_en DATETIME NULL,
+        actualizado_en DATETIME NULL,
+        CONSTRAINT UQ_comprobantes_electronicos_clave UNIQUE (clave),
+        CONSTRAINT FK_comprobantes_factura FOREIGN KEY (idFact) REFERENCES factura(idFact),
+        CONSTRAINT FK_comprobantes_nota_credito FOREIGN KEY (nota_credito_id) REFERENCES notas_credito(id),
+        CONSTRAINT CHK_comprobantes_documento CHECK (
+            (idFact IS NOT NULL AND nota_credito_id IS NULL AND tipo_documento IN ('01', '04'))
+            OR (idFact IS NULL AND nota_credito_id IS NOT NULL AND tipo_documento = '03')
+        ),
+        CONSTRAINT CHK_comprobantes_estado CHECK (estado IN ('generado', 'enviado', 'aceptado', 'rechazado', 'error'))
+    );
+    -- Un comprobante por documento
+    CREATE UNIQUE INDEX UX_comprobantes_factura ON comprobantes_electronicos(idFact) WHERE idFact IS NOT NULL;
+    CREATE UNIQUE INDEX UX_comprobantes_nota_credito ON comprobantes_electronicos(nota_credito_id) WHERE nota_credito_id IS NOT NULL;
+    PRINT 'Tabla comprobantes_electronicos creada';
+END
+GO
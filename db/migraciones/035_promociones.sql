@@ -0,0 +1,103 @@
+-- Promociones con código de cupón: porcentaje, monto fijo o 2x1, con vigencia por
+-- fechas y días de la semana, servicios/productos a los que aplica y límite de usos
+-- por cliente. El descuento se guarda en la línea de la factura.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'promociones') AND type in (N'U'))
+BEGIN
+    CREATE TABLE promociones (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        codigo NVARCHAR(30) NOT NULL,
+        nombre NVARCHAR(100) NOT NULL,
+        descripcion NVARCHAR(255) NULL,
+        tipo NVARCHAR(20) NOT NULL,               -- porcentaje, monto_fijo o 2x1
+        valor DECIMAL(10,2) NOT NULL DEFAULT 0,   -- % o colones; no aplica al 2x1
+        aplica_a NVARCHAR(20) NOT NULL DEFAULT 'todo', -- todo, servicios, productos o seleccion
+        fecha_inicio DATE NOT NULL,
+        fecha_fin DATE NULL,
+        dias_semana NVARCHAR(13) NULL,            -- "2" = solo martes; "1,3,5"; NULL = todos (0 = domingo)
+        limite_por_cliente INT NULL,
+        limite_total INT NULL,
+        activa BIT NOT NULL DEFAULT 1,
+        creado_por INT NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT UQ_promociones_codigo UNIQUE (codigo),
+        CONSTRAINT FK_promociones_creado_por FOREIGN KEY (creado_por) REFERENCES usuarios(id),
+        CONSTRAINT CHK_promociones_tipo CHECK (tipo IN ('porcentaje', 'monto_fijo', '2x1')),
+        CONSTRAINT CHK_promociones_valor CHECK (valor >= 0 AND (tipo <> 'porcentaje' OR valor <= 100)),
+        CONSTRAINT CHK_promociones_aplica CHECK (aplica_a IN ('todo', 'servicios', 'productos', 'seleccion')),
+        CONSTRAINT CHK_promociones_fechas CHECK (fecha_fin IS NULL OR fecha_fin >= fecha_inicio),
+        CONSTRAINT CHK_promociones_limites CHECK ((limite_por_cliente IS NULL OR limite_por_cliente > 0) AND (limite_total IS NULL OR limite_total > 0))
+    );
+    PRINT 'Tabla promociones creada';
+END
+GO
+
+-- Servicios y productos de las promociones con aplica_a = 'seleccion'
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'promocion_items') AND type in (N'U'))
+BEGIN
+    CREATE TABLE promocion_items (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        promocion_id INT NOT NULL,
+        servicio_id INT NULL,
+        producto_id INT NULL,
+        CONSTRAINT FK_promocion_items_promocion FOREIGN KEY (promocion_id) REFERENCES promociones(id) ON DELETE CASCADE,
+        CONSTRAINT FK_promocion_items_servicio FOREIGN KEY (servicio_id) REFERENCES servicios(id),
+        CONSTRAINT FK_promocion_items_producto FOREIGN KEY (producto_id) REFERENCES productos(id),
+        CONSTRAINT CHK_promocion_items_item CHECK ((servicio_id IS NULL) <> (producto_id IS NULL))
+    );
+    CREATE INDEX IX_promocion_items_promocion ON promocion_items(promocion_id);
+    PRINT 'Tabla promocion_items creada';
+END
+GO
+
+-- Cada uso de un código: se reserva al agendar la cita y se completa al facturar
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'usos_promocion') AND type in (N'U'))
+BEGIN
+    CREATE TABLE usos_promocion (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        promocion_id INT NOT NULL,
+        usuario_id INT NULL,
+        cedula NVARCHAR(20) NULL,                 -- clientes sin cuenta
+        cita_id INT NULL,
+        idFact INT NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT FK_usos_promocion_promocion FOREIGN KEY (promocion_id) REFERENCES promociones(id),
+        CONSTRAINT FK_usos_promocion_usuario FOREIGN KEY (usuario_id) REFERENCES usuarios(id),
+        CONSTRAINT FK_usos_promocion_cita FOREIGN KEY (cita_id) REFERENCES citas(id),
+        CONSTRAINT FK_usos_promocion_factura FOREIGN KEY (idFact) REFERENCES factura(idFact)
+    );
+    CREATE INDEX IX_usos_promocion_cliente ON usos_promocion(promocion_id, usuario_id);
+    CREATE UNIQUE INDEX UX_usos_promocion_factura ON usos_promocion(idFact) WHERE idFact IS NOT NULL;
+    PRINT 'Tabla usos_promocion creada';
+END
+GO
+
+-- Promoción reservada al agendar
+IF COL_LENGTH('citas', 'promocion_id') IS NULL
+BEGIN
+    ALTER TABLE citas ADD promocion_id INT NULL
+        CONSTRAINT FK_citas_promocion REFERENCES promociones(id);
+    PRINT 'Columna citas.promocion_id agregada';
+END
+GO
+
+-- Promoción aplicada a la factura; se recalcula con cada cambio de líneas en borrador
+IF COL_LENGTH('factura', 'promocion_id') IS NULL
+BEGIN
+    ALTER TABLE factura ADD promocion_id INT NULL
+        CONSTRAINT FK_factura_promocion REFERENCES promociones(id);
+    PRINT 'Columna factura.promocion_id agregada';
+END
+GO
+
+-- Descuento de la línea: subtotal = precio * cant - descuento. Sin promocion_id el
+-- descuento es manual y la promoción no lo reemplaza.
+IF COL_LENGTH('detallefactura', 'descuento') IS NULL
+BEGIN
+    ALTER TABLE detallefactura ADD
+        descuento DECIMAL(10,2) NOT NULL CONSTRAINT DF_detallefactura_descuento DEFAULT 0,
+        promocion_id INT NULL CONSTRAINT FK_detallefactura_promocion REFERENCES promociones(id),
+        motivo_descuento NVARCHAR(100) NULL;
+    PRINT 'Columnas de descuento agregadas a detallefactura';
+END
+GO
@@ -0,0 +1,26 @@
+-- Propinas registradas junto con el pago y atribuidas al empleado que atendió. La
+-- propina no se aplica a la factura ni forma parte de la base imponible.
+
+IF COL_LENGTH('pagos_factura', 'propina') IS NULL
+BEGIN
+    ALTER TABLE pagos_factura ADD
+        propina DECIMAL(10,2) NOT NULL CONSTRAINT DF_pagos_factura_propina DEFAULT 0,
+        empleado_propina_id INT NULL CONSTRAINT FK_pagos_factura_empleado_propina REFERENCES usuarios(id);
+    PRINT 'Columnas de propina agregadas a pagos_factura';
+END
+GO
+
+-- Un pago puede ser solo propina (monto 0) y el efectivo recibido cubre ambos
+IF EXISTS (SELECT * FROM sys.check_constraints WHERE name = 'CHK_pagos_factura_monto')
+    AND NOT EXISTS (SELECT * FROM sys.check_constraints WHERE name = 'CHK_pagos_factura_propina')
+BEGIN
+    ALTER TABLE pagos_factura DROP CONSTRAINT CHK_pagos_factura_monto;
+    ALTER TABLE pagos_factura DROP CONSTRAINT CHK_pagos_factura_vuelto;
+    ALTER TABLE pagos_factura ADD
+        CONSTRAINT CHK_pagos_factura_monto CHECK (monto >= 0 AND propina >= 0 AND (monto > 0 OR propina > 0)),
+        CONSTRAINT CHK_pagos_factura_vuelto CHECK (vuelto >= 0 AND (recibido IS NULL OR recibido = monto + propina + vuelto)),
+        CONSTRAINT CHK_pagos_factura_propina CHECK (propina = 0 OR empleado_propina_id IS NOT NULL);
+    CREATE INDEX IX_pagos_factura_empleado_propina ON pagos_factura(empleado_propina_id, creado_en);
+    PRINT 'Restricciones de pagos_factura actualizadas para propinas';
+END
+GO
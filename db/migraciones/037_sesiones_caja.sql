@@ -0,0 +1,76 @@
+-- Sesiones de caja: apertura con fondo inicial, retiros de efectivo y cierre con el
+-- monto contado. Los pagos y reembolsos quedan ligados a la sesión abierta de la
+-- terminal para poder cuadrar el efectivo al final del día.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'sesiones_caja') AND type in (N'U'))
+BEGIN
+    CREATE TABLE sesiones_caja (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        sucursal CHAR(3) NOT NULL,
+        terminal CHAR(5) NOT NULL,
+        estado NVARCHAR(10) NOT NULL DEFAULT 'abierta',   -- abierta o cerrada
+        monto_inicial DECIMAL(10,2) NOT NULL,
+        observaciones_apertura NVARCHAR(255) NULL,
+        abierta_por INT NULL,
+        abierta_en DATETIME NOT NULL DEFAULT GETDATE(),
+        efectivo_esperado DECIMAL(10,2) NULL,            -- se fija al cerrar
+        monto_contado DECIMAL(10,2) NULL,
+        diferencia DECIMAL(10,2) NULL,                   -- contado - esperado
+        observaciones_cierre NVARCHAR(255) NULL,
+        cerrada_por INT NULL,
+        cerrada_en DATETIME NULL,
+        CONSTRAINT FK_sesiones_caja_abierta_por FOREIGN KEY (abierta_por) REFERENCES usuarios(id),
+        CONSTRAINT FK_sesiones_caja_cerrada_por FOREIGN KEY (cerrada_por) REFERENCES usuarios(id),
+        CONSTRAINT CHK_sesiones_caja_estado CHECK (estado IN ('abierta', 'cerrada')),
+        CONSTRAINT CHK_sesiones_caja_montos CHECK (monto_inicial >= 0 AND (monto_contado IS NULL OR monto_contado >= 0)),
+        CONSTRAINT CHK_sesiones_caja_cierre CHECK (estado = 'abierta' OR (cerrada_en IS NOT NULL AND monto_contado IS NOT NULL))
+    );
+    -- Una sola sesión abierta por terminal
+    CREATE UNIQUE INDEX UX_sesiones_caja_abierta ON sesiones_caja(sucursal, terminal) WHERE estado = 'abierta';
+    CREATE INDEX IX_sesiones_caja_abierta_en ON sesiones_caja(abierta_en);
+    PRINT 'Tabla sesiones_caja creada';
+END
+GO
+
+-- Retiros de efectivo durante la sesión (depósitos al banco, pago de propinas, etc.)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'retiros_caja') AND type in (N'U'))
+BEGIN
+    CREATE TABLE retiros_caja (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        sesion_id INT NOT NULL,
+        monto DECIMAL(10,2) NOT NULL,
+        motivo NVARCHAR(255) NOT NULL,
+        registrado_por INT NULL,
+        creado_en DATETIME NOT NULL DEFAULT GETDATE(),
+        CONSTRAINT FK_retiros_caja_sesion FOREIGN KEY (sesion_id) REFERENCES sesiones_caja(id),
+        CONSTRAINT FK_retiros_caja_usuario FOREIGN KEY (registrado_por) REFERENCES usuarios(id),
+        CONSTRAINT CHK_retiros_caja_monto CHECK (monto > 0)
+    );
+    CREATE INDEX IX_retiros_caja_sesion ON retiros_caja(sesion_id);
+    PRINT 'Tabla retiros_caja creada';
+END
+GO
+
+IF COL_LENGTH('pagos_factura', 'sesion_caja_id') IS NULL
+BEGIN
+    ALTER TABLE pagos_factura ADD sesion_caja_id INT NULL
+        CONSTRAINT FK_pagos_factura_sesion_caja REFERENCES sesiones_caja(id);
+    PRINT 'Columna pagos_factura.sesion_caja_id agregada';
+END
+GO
+
+IF COL_LENGTH('notas_credito', 'sesion_caja_id') IS NULL
+BEGIN
+    ALTER TABLE notas_credito ADD sesion_caja_id INT NULL
+        CONSTRAINT FK_notas_credito_sesion_caja REFERENCES sesiones_caja(id);
+    PRINT 'Columna notas_credito.sesion_caja_id agregada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'IX_pagos_factura_sesion_caja')
+BEGIN
+    CREATE INDEX IX_pagos_factura_sesion_caja ON pagos_factura(sesion_caja_id);
+    CREATE INDEX IX_notas_credito_sesion_caja ON notas_credito(sesion_caja_id);
+    PRINT 'Índices de sesión de caja creados';
+END
+GO
@@ -0,0 +1,47 @@
+-- Ciclo de vida de los tokens: tokens de refresco rotativos guardados en el servidor,
+-- lista de tokens de acceso revocados y corte para "cerrar sesión en todos los
+-- dispositivos". Las fechas se guardan en UTC.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'tokens_refresco') AND type in (N'U'))
+BEGIN
+    CREATE TABLE tokens_refresco (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        usuario_id INT NOT NULL,
+        sesion CHAR(32) NOT NULL,                -- identifica el dispositivo; se conserva al rotar
+        token_hash CHAR(64) NOT NULL,            -- SHA-256 del token; el token no se guarda
+        expira_en DATETIME NOT NULL,
+        creado_en DATETIME NOT NULL,
+        usado_en DATETIME NULL,                  -- se usó para rotar; reusarlo revoca la sesión
+        revocado_en DATETIME NULL,
+        agente NVARCHAR(255) NULL,
+        ip NVARCHAR(45) NULL,
+        CONSTRAINT FK_tokens_refresco_usuario FOREIGN KEY (usuario_id) REFERENCES usuarios(id),
+        CONSTRAINT UQ_tokens_refresco_hash UNIQUE (token_hash)
+    );
+    CREATE INDEX IX_tokens_refresco_usuario ON tokens_refresco(usuario_id, revocado_en);
+    CREATE INDEX IX_tokens_refresco_sesion ON tokens_refresco(sesion);
+    PRINT 'Tabla tokens_refresco creada';
+END
+GO
+
+-- Tokens de acceso revocados antes de vencer (logout). Se limpian al vencer.
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'tokens_revocados') AND type in (N'U'))
+BEGIN
+    CREATE TABLE tokens_revocados (
+        jti CHAR(32) NOT NULL PRIMARY KEY,
+        usuario_id INT NULL,
+        expira_en DATETIME NOT NULL,
+        revocado_en DATETIME NOT NULL
+    );
+    CREATE INDEX IX_tokens_revocados_expira ON tokens_revocados(expira_en);
+    PRINT 'Tabla tokens_revocados creada';
+END
+GO
+
+-- Tokens de acceso emitidos hasta este instante (milisegundos Unix desde la 041) ya no valen
+IF COL_LENGTH('usuarios', 'tokens_validos_desde') IS NULL
+BEGIN
+    ALTER TABLE usuarios ADD tokens_validos_desde BIGINT NULL;
+    PRINT 'Columna usuarios.tokens_validos_desde agregada';
+END
+GO
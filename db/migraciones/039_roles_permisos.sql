@@ -0,0 +1,16 @@
+-- Permisos por rol. Las rutas exigen permisos (ver InicializarServidor) y cada rol
+-- tiene su conjunto en esta tabla, editable desde PUT /roles/:rol/permisos.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'roles_permisos') AND type in (N'U'))
+BEGIN
+    CREATE TABLE roles_permisos (
+        rol NVARCHAR(20) NOT NULL,               -- mismo valor que usuarios.rol
+        permiso NVARCHAR(50) NOT NULL,           -- "recurso:accion", p. ej. citas:confirmar
+        CONSTRAINT PK_roles_permisos PRIMARY KEY (rol, permiso)
+    );
+    PRINT 'Tabla roles_permisos creada';
+END
+GO
+
+-- La carga inicial no va aquí: la hace SembrarPermisos al arrancar la API, a partir de
+-- permisosPredeterminados (api/permiso.service.go), si la tabla está vacía.
@@ -0,0 +1,29 @@
+-- Verificación de correo y restablecimiento de contraseña: tokens de un solo uso con
+-- vencimiento que se envían por correo. Solo se guarda el hash. Fechas en UTC.
+
+IF COL_LENGTH('usuarios', 'correo_verificado_en') IS NULL
+BEGIN
+    ALTER TABLE usuarios ADD correo_verificado_en DATETIME NULL;
+    PRINT 'Columna usuarios.correo_verificado_en agregada';
+END
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'tokens_cuenta') AND type in (N'U'))
+BEGIN
+    CREATE TABLE tokens_cuenta (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        usuario_id INT NOT NULL,
+        tipo NVARCHAR(20) NOT NULL,              -- verificar_correo o restablecer
+        token_hash CHAR(64) NOT NULL,            -- SHA-256 del token; el token no se guarda
+        correo NVARCHAR(100) NOT NULL,           -- a dónde se envió; si el usuario lo cambia, el token ya no sirve
+        expira_en DATETIME NOT NULL,
+        creado_en DATETIME NOT NULL,
+        usado_en DATETIME NULL,
+        CONSTRAINT FK_tokens_cuenta_usuario FOREIGN KEY (usuario_id) REFERENCES usuarios(id),
+        CONSTRAINT UQ_tokens_cuenta_hash UNIQUE (token_hash),
+        CONSTRAINT CHK_tokens_cuenta_tipo CHECK (tipo IN ('verificar_correo', 'restablecer'))
+    );
+    CREATE INDEX IX_tokens_cuenta_usuario ON tokens_cuenta(usuario_id, tipo, usado_en);
+    PRINT 'Tabla tokens_cuenta creada';
+END
+GO
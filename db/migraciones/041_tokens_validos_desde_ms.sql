@@ -0,0 +1,12 @@
+-- usuarios.tokens_validos_desde pasa de segundos a milisegundos Unix. Con segundos, un
+-- token emitido en el mismo segundo que "cerrar todas las sesiones" (o que un cambio o
+-- restablecimiento de contraseña) nacía revocado. Los valores en segundos son menores
+-- que 100000000000 (año 5138), así la conversión se puede correr más de una vez.
+
+IF COL_LENGTH('usuarios', 'tokens_validos_desde') IS NOT NULL
+BEGIN
+    UPDATE usuarios SET tokens_validos_desde = tokens_validos_desde * 1000
+    WHERE tokens_validos_desde < 100000000000;
+    PRINT 'usuarios.tokens_validos_desde convertido a milisegundos';
+END
+GO
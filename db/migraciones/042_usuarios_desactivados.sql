@@ -0,0 +1,11 @@
+-- Cuentas desactivadas. Al fusionar clientes la cuenta de origen ya no se borra: la
+-- referencian tokens_cuenta, tokens_refresco y usos_promocion, y el historial queda
+-- más claro si la fila sigue existiendo. Una cuenta desactivada no inicia sesión ni
+-- puede pedir restablecer la contraseña.
+
+IF COL_LENGTH('usuarios', 'desactivado_en') IS NULL
+BEGIN
+    ALTER TABLE usuarios ADD desactivado_en DATETIME NULL;
+    PRINT 'Columna usuarios.desactivado_en agregada';
+END
+GO
@@ -0,0 +1,42 @@
+-- Estadísticas de clientes al día. La 025 quitó tr_estadisticas_clientes (usaba columnas
+-- que citas no tiene) y desde entonces RecalcularEstadisticasCliente solo corría al
+-- reclamar citas de invitado y al fusionar clientes: crear, cancelar o finalizar una
+-- cita dejaba las estadísticas atrasadas. El trigger nuevo recalcula a cada cliente
+-- tocado (el de antes y el de después, si la cita cambió de dueño) con el mismo
+-- procedimiento.
+
+DROP TRIGGER IF EXISTS tr_estadisticas_clientes;
+GO
+CREATE TRIGGER tr_estadisticas_clientes
+ON citas
+AFTER INSERT, UPDATE, DELETE
+AS
+BEGIN
+    SET NOCOUNT ON;
+
+    -- Las columnas que entran en las estadísticas; el resto (actualizado_en,
+    -- empleado_id, ...) no las cambia
+    IF EXISTS (SELECT 1 FROM inserted)
+       AND NOT (UPDATE(usuario_id) OR UPDATE(estado) OR UPDATE(servicio_id) OR UPDATE(fecha_hora))
+        RETURN;
+
+    DECLARE @cliente_id INT;
+    DECLARE clientes CURSOR LOCAL FAST_FORWARD FOR
+        SELECT usuario_id FROM inserted WHERE usuario_id IS NOT NULL
+        UNION
+        SELECT usuario_id FROM deleted WHERE usuario_id IS NOT NULL;
+
+    OPEN clientes;
+    FETCH NEXT FROM clientes INTO @cliente_id;
+    WHILE @@FETCH_STATUS = 0
+    BEGIN
+        EXEC RecalcularEstadisticasCliente @cliente_id;
+        FETCH NEXT FROM clientes INTO @cliente_id;
+    END
+    CLOSE clientes;
+    DEALLOCATE clientes;
+END;
+GO
+
+PRINT 'Trigger tr_estadisticas_clientes creado';
+GO
@@ -0,0 +1,13 @@
+-- Índice por fecha de las citas. Al crear una cita se bloquea el rango del día
+-- (UPDLOCK, HOLDLOCK) mientras se verifica la disponibilidad; con este índice el
+-- bloqueo cubre solo las citas de ese día y no la tabla completa
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'IX_citas_fecha_hora')
+BEGIN
+    CREATE INDEX IX_citas_fecha_hora ON citas(fecha_hora);
+    PRINT 'Índice IX_citas_fecha_hora creado';
+END
+ELSE
+BEGIN
+    PRINT 'El índice IX_citas_fecha_hora ya existe';
+END
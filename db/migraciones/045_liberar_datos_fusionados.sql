@@ -0,0 +1,11 @@
+-- Cuentas fusionadas antes de este cambio: conservaban correo y cédula, que son únicos,
+-- y la persona no podía volver a registrarse con ellos. Se reemplazan por las mismas
+-- marcas que pone FusionarClientes; los originales están en fusiones_clientes.
+
+UPDATE usuarios
+SET correo = CONCAT('fusionado-', id, '@desactivado.invalid'),
+    cedula = CONCAT('FUS-', id)
+WHERE desactivado_en IS NOT NULL
+  AND correo NOT LIKE 'fusionado-%@desactivado.invalid';
+PRINT 'Correo y cédula liberados en las cuentas fusionadas';
+GO
@@ -0,0 +1,19 @@
+-- Permisos ya sembrados. SembrarPermisos solo cargaba la matriz predeterminada con
+-- roles_permisos vacía, así que un permiso agregado después (citas:buscar_cedula, por
+-- ejemplo) nunca llegaba a una base existente y sus rutas respondían 403. Ahora cada
+-- permiso del catálogo se siembra una vez: los roles reciben sus valores
+-- predeterminados y lo que el admin quite después desde /roles no vuelve al reiniciar.
+
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'permisos_sembrados') AND type in (N'U'))
+BEGIN
+    CREATE TABLE permisos_sembrados (
+        permiso NVARCHAR(50) NOT NULL PRIMARY KEY,
+        sembrado_en DATETIME NOT NULL DEFAULT GETDATE()
+    );
+
+    -- Lo que ya tiene algún rol se sembró antes de esta tabla
+    INSERT INTO permisos_sembrados (permiso)
+    SELECT DISTINCT permiso FROM roles_permisos;
+    PRINT 'Tabla permisos_sembrados creada';
+END
+GO
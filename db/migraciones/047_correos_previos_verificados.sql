@@ -0,0 +1,10 @@
+-- Reservar una cita ahora exige el correo confirmado. Las cuentas creadas antes de la
+-- verificación nunca recibieron el enlace: se dan por verificadas para no bloquearlas.
+-- Las que ya recibieron un enlace siguen pendientes hasta que lo abran.
+
+UPDATE usuarios
+SET correo_verificado_en = GETUTCDATE()
+WHERE correo_verificado_en IS NULL
+  AND NOT EXISTS (SELECT 1 FROM tokens_cuenta t WHERE t.usuario_id = usuarios.id AND t.tipo = 'verificar_correo');
+PRINT 'Cuentas previas a la verificación de correo marcadas como verificadas';
+GO
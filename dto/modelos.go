@@ -32,12 +32,14 @@ type Cita struct {
 }
 
 type Servicio struct {
-	ID            int32          `json:"id"`
-	Nombre        string         `json:"nombre"`
-	Descripcion   sql.NullString `json:"descripcion"`
-	Precio        float64        `json:"precio"`
-	CreadoEn      sql.NullTime   `json:"creado_en"`
-	ActualizadoEn sql.NullTime   `json:"actualizado_en"`
+	ID              int32          `json:"id"`
+	Nombre          string         `json:"nombre"`
+	Descripcion     sql.NullString `json:"descripcion"`
+	Precio          float64        `json:"precio"`
+	DuracionMinutos int32          `json:"duracion_minutos"`
+	BufferMinutos   int32          `json:"buffer_minutos"` // limpieza/preparación después del servicio
+	CreadoEn        sql.NullTime   `json:"creado_en"`
+	ActualizadoEn   sql.NullTime   `json:"actualizado_en"`
 }
 
 type Producto struct {
@@ -3,12 +3,19 @@
 package main
 
 import (
+	"log"
 	"restapi/api"
 	"restapi/dto"
 )
 
 func main() {
+	if err := api.CargarClavesJWT(); err != nil {
+		log.Fatalf("Claves JWT: %v", err)
+	}
 	dto.ConectarBaseDatos()
+	if err := api.SembrarPermisos(); err != nil {
+		log.Fatalf("No se pudieron cargar los permisos de los roles: %v", err)
+	}
 	router := api.InicializarServidor()
 	router.Run(":8080")
 }